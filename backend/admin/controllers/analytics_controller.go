@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"sort"
 
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -26,7 +27,7 @@ func GetTotalRevenue(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching orders"})
 		return
 	}
-	total := 0.0
+	var total money.Amount
 	for _, o := range orders {
 		total += o.Total
 	}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetExchangeRates lists the exchange rates loaded for all shops.
+func GetExchangeRates(c *gin.Context) {
+	rates, err := services.ListExchangeRatesService()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving exchange rates"})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// ImportExchangeRates loads exchange rates for all shops from an uploaded
+// file (form field "file") or the request body, both JSON of the form
+// { "base": "USD", "rates": { "EUR": 0.92, "JPY": 151.3 } }.
+func ImportExchangeRates(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if header, err := c.FormFile("file"); err == nil {
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not read uploaded file"})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	n, err := services.ImportExchangeRatesService(body, models.ExchangeRateSourceFile)
+	if err != nil {
+		c.JSON(exchangeRateErrorStatus(err), gin.H{"error": err.Error(), "imported": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": n})
+}
+
+// RefreshExchangeRates reloads exchange rates for all shops from the
+// configured rates API.
+func RefreshExchangeRates(c *gin.Context) {
+	n, err := services.RefreshExchangeRatesService()
+	if err != nil {
+		c.JSON(exchangeRateErrorStatus(err), gin.H{"error": err.Error(), "imported": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": n})
+}
+
+// exchangeRateErrorStatus maps an exchange rate load failure to an HTTP
+// status code. Bad data from the rates API is the API's fault, not the caller's.
+func exchangeRateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrExchangeRatesNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrInvalidExchangeRate), errors.Is(err, services.ErrInvalidCurrency):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/Endale2/DRPS/shared/models"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // GetOrders retrieves all orders (optionally filter by shop_id)
@@ -44,6 +46,8 @@ func CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
+	// New orders always enter the state machine at pending
+	order.Status = models.OrderStatusPending
 	result, err := services.CreateOrderService(&order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating order"})
@@ -52,7 +56,8 @@ func CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// UpdateOrder updates an existing order by its ID
+// UpdateOrder updates an existing order by its ID. Status changes go through
+// the order state machine; only address fields may otherwise be edited.
 func UpdateOrder(c *gin.Context) {
 	id := c.Param("id")
 	var updatedData map[string]interface{}
@@ -60,9 +65,9 @@ func UpdateOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
-	result, err := services.UpdateOrderService(id, bson.M(updatedData))
+	result, err := services.ApplyOrderUpdateService(id, bson.M(updatedData), adminActor(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order"})
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, result)
@@ -88,10 +93,35 @@ func UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status payload"})
 		return
 	}
-	result, err := services.UpdateOrderService(id, bson.M{"status": payload.Status})
+	result, err := services.TransitionOrderStatusService(id, models.OrderStatus(payload.Status), adminActor(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order status"})
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, result)
 }
+
+// orderErrorStatus maps an order service failure to an HTTP status code.
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidOrderTransition):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrOrderFieldNotEditable), errors.Is(err, services.ErrOrderStatusDerived):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// adminActor identifies the authenticated admin for the order timeline.
+func adminActor(c *gin.Context) models.OrderActor {
+	actor := models.OrderActor{Role: models.OrderActorAdmin}
+	if uidVal, exists := c.Get("user_id"); exists {
+		if uidHex, ok := uidVal.(string); ok {
+			actor.ID, _ = primitive.ObjectIDFromHex(uidHex)
+		}
+	}
+	return actor
+}
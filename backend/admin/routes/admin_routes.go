@@ -74,6 +74,14 @@ func AdminRoutes(r *gin.Engine) {
 		analyticsGroup.GET("/top-customers", controllers.GetTopCustomers)
 	}
 
+	// Exchange rates for all shops, loaded from a file or the rates API
+	rateGroup := adminGroup.Group("/exchange-rates", middlewares.AuthMiddleware())
+	{
+		rateGroup.GET("/", controllers.GetExchangeRates)
+		rateGroup.POST("/import", controllers.ImportExchangeRates)
+		rateGroup.POST("/refresh", controllers.RefreshExchangeRates)
+	}
+
 	// Staff sub-group
 	staffGroup := adminGroup.Group("/staff", middlewares.AuthMiddleware())
 	{
@@ -1,13 +1,14 @@
 package controllers
 
 import (
+    "log"
     "net/http" // Needed for os.Getenv
     "time"
-    "strings"
 
     authServices "github.com/Endale2/DRPS/auth/services"
     "github.com/Endale2/DRPS/auth/utils"                          // Ensure utils package has GoogleOAuthConfig and ParseToken
     customerRepo "github.com/Endale2/DRPS/customers/repositories" // Ensure this path is correct
+    sharedServices "github.com/Endale2/DRPS/shared/services"
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -56,6 +57,22 @@ func CustomerVerifyOTP(c *gin.Context) {
     c.SetSameSite(http.SameSiteLaxMode)
     c.SetCookie("refresh_token", rt, int((7 * 24 * time.Hour).Seconds()), "/", cookieDomain, secure, true)
     c.SetSameSite(http.SameSiteLaxMode)
+    // Carts kept while shopping as a guest become the customer's; sign-in
+    // succeeds even if they cannot be merged, and the cookie is kept to retry
+    if value, err := c.Cookie(utils.CartSessionCookie); err == nil {
+        if sessionID, err := utils.ParseCartSession(value); err == nil {
+            if err := sharedServices.MergeGuestCartsService(sessionID, cust.ID); err != nil {
+                log.Printf("could not merge guest carts into customer %s: %v", cust.ID.Hex(), err)
+            } else {
+                c.SetCookie(utils.CartSessionCookie, "", -1, "/", cookieDomain, secure, true)
+            }
+        }
+    }
+    // The email is now verified, so orders placed at guest checkout with it
+    // become the customer's; a failure is retried at the next sign-in
+    if _, err := sharedServices.ClaimGuestOrdersService(cust.Email, cust.ID); err != nil {
+        log.Printf("could not claim guest orders for customer %s: %v", cust.ID.Hex(), err)
+    }
 	c.JSON(http.StatusOK, gin.H{"profile": cust, "profileComplete": profileComplete})
 }
 
@@ -205,21 +222,5 @@ func CustomerLogout(c *gin.Context) {
 // Dev: any localhost/127.0.0.1 or *.localhost → domain ".localhost", secure=false
 // Prod: any *.shop24.sbs or api.shop24.sbs → domain ".shop24.sbs", secure depends on TLS/proxy
 func resolveCookieDomainAndSecure(c *gin.Context) (string, bool) {
-    host := c.Request.Host
-    hostname := host
-    if idx := strings.Index(host, ":"); idx != -1 {
-        hostname = host[:idx]
-    }
-
-    // Determine if request is over HTTPS directly or via proxy header
-    secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
-
-    if hostname == "localhost" || hostname == "127.0.0.1" || strings.HasSuffix(hostname, ".localhost") {
-        return ".localhost", false
-    }
-    if hostname == "api.shop24.sbs" || hostname == "shop24.sbs" || strings.HasSuffix(hostname, ".shop24.sbs") {
-        return ".shop24.sbs", secure
-    }
-    // Default: scope cookie to current host; use secure flag as detected
-    return hostname, secure
+    return utils.CookieDomainAndSecure(c)
 }
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Endale2/DRPS/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CartSessionMiddleware lets a route be used signed in or as a guest. A valid
+// access_token sets "user_id" as AuthMiddleware does. Without one the request
+// gets "cart_session_id" from the signed cart_session cookie, issuing a new
+// cookie if there is none.
+//
+// A request that carries a refresh token but no usable access token comes from
+// a signed-in customer whose access token lapsed; it gets a 401 so the client
+// refreshes, rather than being quietly switched to a guest cart.
+func CartSessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenStr, err := c.Cookie("access_token"); err == nil {
+			claims, err := utils.ParseToken(tokenStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			c.Set("user_id", claims.UserID)
+			c.Next()
+			return
+		}
+		if _, err := c.Cookie("refresh_token"); err == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+			return
+		}
+
+		if value, err := c.Cookie(utils.CartSessionCookie); err == nil {
+			if sessionID, err := utils.ParseCartSession(value); err == nil {
+				c.Set("cart_session_id", sessionID)
+				c.Next()
+				return
+			}
+		}
+		sessionID, value, err := utils.NewCartSession()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not start cart session"})
+			return
+		}
+		cookieDomain, secure := utils.CookieDomainAndSecure(c)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(utils.CartSessionCookie, value, int(utils.CartSessionTTL.Seconds()), "/", cookieDomain, secure, true)
+		c.Set("cart_session_id", sessionID)
+		c.Next()
+	}
+}
@@ -0,0 +1,123 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a write safe
+// to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the header value we are willing to store.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecorder tees the response body so it can be stored.
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes POST, PUT, PATCH and DELETE requests that carry
+// an Idempotency-Key header run at most once per user and endpoint. A retry
+// with the same key and body gets the stored response back; the same key with
+// a different body gets 422. Requests without the header are unaffected.
+// It must run after AuthMiddleware or CartSessionMiddleware so the key can be
+// scoped to the user or guest session.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			key = ""
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "could not read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := c.GetString("user_id")
+		if owner == "" {
+			owner = "session:" + c.GetString("cart_session_id")
+		}
+		scope := owner + " " + c.Request.Method + " " + c.Request.URL.Path
+		sum := sha256.Sum256(body)
+
+		record, replay, err := services.BeginIdempotentRequestService(scope, key, hex.EncodeToString(sum[:]))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not check idempotency key"})
+			return
+		}
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.ResponseStatus, record.ResponseContentType, record.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// A handler that panics never finishes the request; drop the key so a
+		// retry runs again instead of getting 409 until the key expires, and
+		// hand the panic on to the recovery middleware.
+		defer func() {
+			if r := recover(); r != nil {
+				if err := services.AbandonIdempotentRequestService(record); err != nil {
+					log.Printf("idempotency: could not release key %q: %v", key, err)
+				}
+				panic(r)
+			}
+		}()
+		c.Next()
+
+		// Server errors are not remembered, so the client can retry them.
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := services.AbandonIdempotentRequestService(record); err != nil {
+				log.Printf("idempotency: could not release key %q: %v", key, err)
+			}
+			return
+		}
+		if err := services.CompleteIdempotentRequestService(record, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Printf("idempotency: could not store response for key %q: %v", key, err)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"sync"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/Endale2/DRPS/auth/utils" // Ensure utils package has VerifyGoogleIDToken and CreateToken
 	customerModels "github.com/Endale2/DRPS/customers/models"
 	customerRepo "github.com/Endale2/DRPS/customers/repositories"
+	sharedRepo "github.com/Endale2/DRPS/shared/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -53,6 +56,10 @@ func VerifyCustomerOTP(email, otp string) (*customerModels.Customer, string, str
 	entry, ok := otpStore.m[emailKey]
 	otpStore.Unlock()
 	if !ok || entry.Expires.Before(time.Now()) || entry.OTP != otp {
+		// Kept for order risk checks; a failure to record it must not block sign-in
+		if err := sharedRepo.RecordOTPFailure(context.Background(), emailKey); err != nil {
+			log.Printf("could not record failed OTP attempt: %v", err)
+		}
 		return nil, "", "", false, errors.New("invalid or expired OTP")
 	}
 	// Remove OTP after use
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CartSessionCookie holds the signed session ID a guest's carts are kept under.
+const CartSessionCookie = "cart_session"
+
+// CartSessionTTL is how long a guest's cart session cookie lasts.
+const CartSessionTTL = 30 * 24 * time.Hour
+
+// ErrInvalidCartSession is returned for a cart session cookie that was not
+// issued by us.
+var ErrInvalidCartSession = errors.New("invalid cart session")
+
+// cartSessionSecret signs cart session cookies. CART_SESSION_SECRET lets it be
+// rotated on its own; otherwise the JWT secret is used.
+func cartSessionSecret() []byte {
+	if secret := os.Getenv("CART_SESSION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return jwtKey
+}
+
+func cartSessionSignature(id string) string {
+	mac := hmac.New(sha256.New, cartSessionSecret())
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewCartSession creates a guest session ID and the signed cookie value that
+// carries it.
+func NewCartSession() (id, value string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id = hex.EncodeToString(b)
+	return id, id + "." + cartSessionSignature(id), nil
+}
+
+// ParseCartSession verifies a cart session cookie value and returns its
+// session ID.
+func ParseCartSession(value string) (string, error) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", ErrInvalidCartSession
+	}
+	if !hmac.Equal([]byte(sig), []byte(cartSessionSignature(id))) {
+		return "", ErrInvalidCartSession
+	}
+	return id, nil
+}
+
+// CookieDomainAndSecure returns the cookie domain and whether the cookie should be Secure
+// Dev: any localhost/127.0.0.1 or *.localhost → domain ".localhost", secure=false
+// Prod: any *.shop24.sbs or api.shop24.sbs → domain ".shop24.sbs", secure depends on TLS/proxy
+func CookieDomainAndSecure(c *gin.Context) (string, bool) {
+	host := c.Request.Host
+	hostname := host
+	if idx := strings.Index(host, ":"); idx != -1 {
+		hostname = host[:idx]
+	}
+
+	// Determine if request is over HTTPS directly or via proxy header
+	secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+
+	if hostname == "localhost" || hostname == "127.0.0.1" || strings.HasSuffix(hostname, ".localhost") {
+		return ".localhost", false
+	}
+	if hostname == "api.shop24.sbs" || hostname == "shop24.sbs" || strings.HasSuffix(hostname, ".shop24.sbs") {
+		return ".shop24.sbs", secure
+	}
+	// Default: scope cookie to current host; use secure flag as detected
+	return hostname, secure
+}
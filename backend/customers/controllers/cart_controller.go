@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/Endale2/DRPS/shared/models"
@@ -9,11 +10,36 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// getCartIDOrCreate fetches or creates a cart for the authenticated customer and shop.
-func getCartIDOrCreate(shopID, customerID primitive.ObjectID) (*models.Cart, error) {
-	// For simplicity, assume one cart per customer per shop
-	cart, err := sharedSvc.GetOrCreateCartService(shopID, customerID)
-	return cart, err
+// storefrontCart returns the cart the request shops with in the shop: the
+// signed-in customer's, or the guest session's. If there is neither, it
+// answers the request itself and returns false.
+func storefrontCart(c *gin.Context, shop *models.Shop) (*models.Cart, bool) {
+	if cidHex := c.GetString("user_id"); cidHex != "" {
+		customerID, err := primitive.ObjectIDFromHex(cidHex)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
+			return nil, false
+		}
+		// Link customer to shop if not already linked
+		_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
+		cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		return cart, true
+	}
+	sessionID := c.GetString("cart_session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return nil, false
+	}
+	cart, err := sharedSvc.GetOrCreateGuestCartService(shop.ID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return cart, true
 }
 
 // GetCart handles GET /shops/:shopSlug/cart
@@ -24,27 +50,27 @@ func GetCart(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
-	cidVal, exists := c.Get("user_id")
-	if !exists || cidVal == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
-		return
-	}
-	cidHex, ok := cidVal.(string)
+	cart, ok := storefrontCart(c, shop)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
 		return
 	}
-	customerID, _ := primitive.ObjectIDFromHex(cidHex)
-	// Link customer to shop if not already linked
-	_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
-	cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
+
+	// Re-check the cart against the shop so its warnings are current; it is
+	// saved only if that changed something
+	cartService := sharedSvc.NewCartService()
+	changed, err := cartService.Revalidate(cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if changed {
+		if err := sharedSvc.SaveRevalidatedCartService(cart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// Return cart with discount details
-	cartService := sharedSvc.NewCartService()
 	cartWithDetails, err := cartService.GetCartWithDiscountDetails(cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -64,22 +90,8 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	cidVal, exists := c.Get("user_id")
-	if !exists || cidVal == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
-		return
-	}
-	cidHex, ok := cidVal.(string)
+	cart, ok := storefrontCart(c, shop)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
-		return
-	}
-	customerID, _ := primitive.ObjectIDFromHex(cidHex)
-	// Link customer to shop if not already linked
-	_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
-	cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -134,22 +146,8 @@ func UpdateCartItem(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
-	cidVal, exists := c.Get("user_id")
-	if !exists || cidVal == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
-		return
-	}
-	cidHex, ok := cidVal.(string)
+	cart, ok := storefrontCart(c, shop)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
-		return
-	}
-	customerID, _ := primitive.ObjectIDFromHex(cidHex)
-	// Link customer to shop if not already linked
-	_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
-	cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	var req struct {
@@ -191,22 +189,8 @@ func RemoveCartItem(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
-	cidVal, exists := c.Get("user_id")
-	if !exists || cidVal == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
-		return
-	}
-	cidHex, ok := cidVal.(string)
+	cart, ok := storefrontCart(c, shop)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
-		return
-	}
-	customerID, _ := primitive.ObjectIDFromHex(cidHex)
-	// Link customer to shop if not already linked
-	_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
-	cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	var req struct {
@@ -247,32 +231,105 @@ func ClearCart(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
-	cidVal, exists := c.Get("user_id")
-	if !exists || cidVal == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+	cart, ok := storefrontCart(c, shop)
+	if !ok {
+		return
+	}
+	cartService := sharedSvc.NewCartService()
+	if err := cartService.ClearCart(cart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	cidHex, ok := cidVal.(string)
+	_ = sharedSvc.SaveCartService(cart)
+
+	// Return cart with discount details
+	cartWithDetails, err := cartService.GetCartWithDiscountDetails(cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cartWithDetails)
+}
+
+// SetCartShipping handles PUT /shops/:shopSlug/cart/shipping
+// Body: { "address": { "country": "US", "region": "CA", ... }, "method_id": "zones:..." }
+// The response's shipping_options lists the methods available for the address;
+// send one of their IDs as method_id to choose it.
+func SetCartShipping(c *gin.Context) {
+	shopSlug := c.Param("shopSlug")
+	shop, err := sharedSvc.GetShopBySlugService(shopSlug)
+	if err != nil || shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	cart, ok := storefrontCart(c, shop)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
 		return
 	}
-	customerID, _ := primitive.ObjectIDFromHex(cidHex)
-	// Link customer to shop if not already linked
-	_, _, _ = sharedSvc.LinkIfNotLinked(shop.ID, customerID)
-	cart, err := sharedSvc.GetOrCreateCartService(shop.ID, customerID)
+	var req struct {
+		Address  map[string]interface{} `json:"address" binding:"required"`
+		MethodID string                 `json:"method_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cartService := sharedSvc.NewCartService()
+	if err := cartService.SetShipping(cart, req.Address, req.MethodID); err != nil {
+		switch {
+		case errors.Is(err, sharedSvc.ErrShippingAddressInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, sharedSvc.ErrShippingMethodUnavailable):
+			// The address is kept so the customer can pick from the options returned
+			_ = sharedSvc.SaveCartService(cart)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "cart": cart})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	_ = sharedSvc.SaveCartService(cart)
+
+	cartWithDetails, err := cartService.GetCartWithDiscountDetails(cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	c.JSON(http.StatusOK, cartWithDetails)
+}
+
+// SetCartCurrency handles PUT /shops/:shopSlug/cart/currency
+// Body: { "currency": "EUR" }; the shop's own currency, or empty, switches back.
+func SetCartCurrency(c *gin.Context) {
+	shopSlug := c.Param("shopSlug")
+	shop, err := sharedSvc.GetShopBySlugService(shopSlug)
+	if err != nil || shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	cart, ok := storefrontCart(c, shop)
+	if !ok {
+		return
+	}
+	var req struct {
+		Currency string `json:"currency"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	cartService := sharedSvc.NewCartService()
-	if err := cartService.ClearCart(cart); err != nil {
+	if err := cartService.SetCurrency(cart, shop, req.Currency); err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := sharedSvc.SaveCartService(cart); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	_ = sharedSvc.SaveCartService(cart)
 
-	// Return cart with discount details
 	cartWithDetails, err := cartService.GetCartWithDiscountDetails(cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -281,3 +338,69 @@ func ClearCart(c *gin.Context) {
 
 	c.JSON(http.StatusOK, cartWithDetails)
 }
+
+// AcknowledgeCartChanges handles POST /shops/:shopSlug/cart/acknowledge
+// Records that the customer has seen the cart's warnings: they are cleared and
+// the lines' current prices are taken as agreed, so checkout can proceed.
+func AcknowledgeCartChanges(c *gin.Context) {
+	shopSlug := c.Param("shopSlug")
+	shop, err := sharedSvc.GetShopBySlugService(shopSlug)
+	if err != nil || shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	cart, ok := storefrontCart(c, shop)
+	if !ok {
+		return
+	}
+
+	cartService := sharedSvc.NewCartService()
+	cartService.AcknowledgeChanges(cart)
+	if err := sharedSvc.SaveCartService(cart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cartWithDetails, err := cartService.GetCartWithDiscountDetails(cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cartWithDetails)
+}
+
+// ReserveCart handles POST /shops/:shopSlug/cart/reserve
+// Called when the customer starts checkout: holds stock for every cart line
+// until the hold expires, the order is placed or the cart is cleared.
+func ReserveCart(c *gin.Context) {
+	shopSlug := c.Param("shopSlug")
+	shop, err := sharedSvc.GetShopBySlugService(shopSlug)
+	if err != nil || shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	cart, ok := storefrontCart(c, shop)
+	if !ok {
+		return
+	}
+	if len(cart.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+		return
+	}
+
+	holds, err := sharedSvc.ReserveCartService(cart)
+	if err != nil {
+		if errors.Is(err, sharedSvc.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reservations": holds,
+		"expires_at":   holds[0].ExpiresAt,
+	})
+}
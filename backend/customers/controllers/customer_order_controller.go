@@ -2,10 +2,12 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"time"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,6 +24,12 @@ type OrderItemRequest struct {
 // PlaceOrderRequest represents the complete request structure for placing an order
 type PlaceOrderRequest struct {
 	Items []OrderItemRequest `json:"items" binding:"required,min=1"`
+	// Shipping is optional; once the address has shipping options, one must be picked
+	ShippingAddress  map[string]interface{} `json:"shipping_address,omitempty"`
+	ShippingMethodID string                 `json:"shipping_method_id,omitempty"`
+	BillingAddress   map[string]interface{} `json:"billing_address,omitempty"`
+	// Currency the customer shops in; empty means the shop's own
+	Currency string `json:"currency,omitempty"`
 }
 
 // DebugProduct handles GET /shops/:shopSlug/debug/product/:productId
@@ -127,7 +135,7 @@ func UpdateProductPrice(c *gin.Context) {
 
 	// Parse request body
 	var req struct {
-		Price float64 `json:"price" binding:"required"`
+		Price money.Amount `json:"price" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -233,7 +241,7 @@ func TestDiscounts(c *gin.Context) {
 		}
 
 		// Test discount calculation
-		testPrice := 100.0
+		testPrice := money.Amount(100 * money.Scale)
 		savings := discount.CalculateDiscount(testPrice)
 		result["test_calculation"] = map[string]interface{}{
 			"test_price":  testPrice,
@@ -293,35 +301,14 @@ func PlaceOrder(c *gin.Context) {
 		return
 	}
 
-	// Validate request - ensure we only have the minimal required data
-	if len(req.Items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no items in order"})
-		return
-	}
-
-	// Get customer segments for discount validation
-	customerSegmentIDs, err := services.GetCustomerSegmentIDs(shop.ID, customerID)
-	if err != nil {
-		customerSegmentIDs = []primitive.ObjectID{}
-	}
-
-	// Initialize order variables
-	var orderItems []models.OrderItem
-	var itemDiscountDetails []map[string]interface{}
-	subtotal := 0.0
-	totalDiscount := 0.0
-	appliedDiscountIDsMap := make(map[primitive.ObjectID]struct{})
-
-	// Process each item - ALL pricing calculated server-side
+	// Convert to checkout lines - pricing is resolved server-side
+	lines := make([]services.CheckoutLine, 0, len(req.Items))
 	for _, itemReq := range req.Items {
-		// Validate product ID
 		productID, err := primitive.ObjectIDFromHex(itemReq.ProductID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID: " + itemReq.ProductID})
 			return
 		}
-
-		// Validate variant ID if provided
 		variantID := primitive.NilObjectID
 		if itemReq.VariantID != "" {
 			variantID, err = primitive.ObjectIDFromHex(itemReq.VariantID)
@@ -330,229 +317,183 @@ func PlaceOrder(c *gin.Context) {
 				return
 			}
 		}
+		lines = append(lines, services.CheckoutLine{
+			ProductID: productID,
+			VariantID: variantID,
+			Quantity:  itemReq.Quantity,
+		})
+	}
 
-		// Validate quantity
-		if itemReq.Quantity <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be positive"})
-			return
-		}
+	// Price, write the order, record discount usage and reduce stock as one unit
+	result, err := services.NewCheckoutService().PlaceOrder(shop, customerID, lines, services.CheckoutShipping{
+		Address:  req.ShippingAddress,
+		MethodID: req.ShippingMethodID,
+	}, services.CheckoutClient{IP: c.ClientIP(), BillingAddress: req.BillingAddress, Currency: req.Currency})
+	if err != nil {
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		// Fetch product from database - server-side validation
-		product, err := services.GetProductByIDService(itemReq.ProductID)
-		if err != nil || product == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found: " + itemReq.ProductID})
-			return
-		}
+	// Return order with server-calculated totals
+	c.JSON(http.StatusCreated, gin.H{
+		"id":                    result.Order.ID.Hex(),
+		"order":                 result.Order.ForCustomer(),
+		"item_discount_details": result.ItemDiscountDetails,
+		"server_calculated":     true, // Flag to indicate all pricing was calculated server-side
+		"security_note":         "All pricing calculated securely on server",
+	})
+}
 
-		// Validate product belongs to this shop
-		if product.ShopID != shop.ID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found in this shop"})
-			return
-		}
+// CheckoutCart handles POST /shops/:shopSlug/checkout
+// It turns the customer's saved cart into an order. While the cart has
+// warnings, such as a line repriced or gone out of stock, it responds 409 with
+// them and the refreshed cart instead; once the customer has acknowledged them
+// at POST /cart/acknowledge, posting again places the order.
+// Optional body: { "billing_address": { ... } }
+func CheckoutCart(c *gin.Context) {
+	shopSlug := c.Param("shopSlug")
+	shop, err := services.GetShopBySlugService(shopSlug)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
 
-		// Determine unit price and product details - server-side calculation
-		var unitPrice float64
-		var productName string
-		var productImage string
-		var stock int
-		var orderVariantID primitive.ObjectID
-
-		// Check if product has variants
-		hasRealVariants := len(product.Variants) > 0
-
-		if hasRealVariants && !variantID.IsZero() {
-			// Variant-specific pricing
-			var foundVariant *models.Variant
-			for i := range product.Variants {
-				if product.Variants[i].VariantID == variantID {
-					foundVariant = &product.Variants[i]
-					break
-				}
-			}
-			if foundVariant == nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "variant not found: " + itemReq.VariantID + " for product: " + itemReq.ProductID})
-				return
-			}
-			unitPrice = foundVariant.Price
-			productName = product.Name
-			if len(foundVariant.Options) > 0 {
-				productName += " - "
-				for i, opt := range foundVariant.Options {
-					if i > 0 {
-						productName += ", "
-					}
-					productName += opt.Name + ": " + opt.Value
-				}
-			}
-			if foundVariant.Image != "" {
-				productImage = foundVariant.Image
-			} else {
-				productImage = product.MainImage
-			}
-			stock = foundVariant.Stock
-			orderVariantID = variantID
-		} else {
-			// Product-level pricing
-			unitPrice = product.Price
-			productName = product.Name
-			productImage = product.MainImage
-			stock = product.Stock
-			orderVariantID = primitive.NilObjectID
-		}
+	cidVal, exists := c.Get("user_id")
+	if !exists || cidVal == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return
+	}
+	cidHex, ok := cidVal.(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
+		return
+	}
+	customerID, err := primitive.ObjectIDFromHex(cidHex)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid customer ID"})
+		return
+	}
 
-		// Validate stock availability
-		if stock < itemReq.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock for product/variant: " + itemReq.ProductID})
+	var req struct {
+		BillingAddress map[string]interface{} `json:"billing_address"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+	}
 
-		// Calculate line total server-side
-		lineTotal := unitPrice * float64(itemReq.Quantity)
-		subtotal += lineTotal
-
-		// Get collection IDs for discount eligibility
-		collectionIDs, err := services.GetCollectionIDsForProduct(productID)
-		if err != nil {
-			collectionIDs = []primitive.ObjectID{}
-		}
-
-		// Get active discounts for this product/variant - ALL discount logic server-side
-		discounts, err := services.GetActiveDiscountsForProductService(shop.ID, productID, variantID, collectionIDs)
-		if err != nil {
-			discounts = []models.Discount{}
-		}
-
-		// Find best eligible discount - server-side calculation only
-		var bestDiscount *models.Discount
-		bestSavings := 0.0
-
-		// Use the improved discount selection logic
-		bestDiscount, _ = services.GetBestEligibleDiscountForProduct(productID, variantID, customerID, customerSegmentIDs, discounts)
-
-		if bestDiscount != nil {
-			// Calculate actual savings for this specific order
-			bestSavings = bestDiscount.CalculateDiscountForQuantity(unitPrice, itemReq.Quantity)
-		} else {
-		}
-
-		// Apply discount if found - server-side calculation
-		itemDiscountAmount := 0.0
-		appliedDiscountIDs := []primitive.ObjectID{}
-		if bestDiscount != nil && bestSavings > 0 {
-			itemDiscountAmount = bestSavings
-			appliedDiscountIDs = append(appliedDiscountIDs, bestDiscount.ID)
-			appliedDiscountIDsMap[bestDiscount.ID] = struct{}{}
-		}
+	_, _, _ = services.LinkIfNotLinked(shop.ID, customerID)
 
-		totalDiscount += itemDiscountAmount
-		finalLineTotal := lineTotal - itemDiscountAmount
-		if finalLineTotal < 0 {
-			finalLineTotal = 0
+	client := services.CheckoutClient{IP: c.ClientIP(), BillingAddress: req.BillingAddress}
+	result, err := services.NewCheckoutService().CheckoutCart(shop, customerID, client)
+	if err != nil {
+		var checkoutErr *services.CheckoutError
+		if errors.As(err, &checkoutErr) && errors.Is(err, services.ErrCheckoutCartChanged) {
+			cart, _ := services.GetOrCreateCartService(shop.ID, customerID)
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   err.Error(),
+				"changes": checkoutErr.Changes,
+				"cart":    cart,
+			})
+			return
 		}
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		// Store discount details for response
-		itemDiscountDetails = append(itemDiscountDetails, map[string]interface{}{
-			"product_id":           productID.Hex(),
-			"variant_id":           variantID.Hex(),
-			"unit_price":           unitPrice,
-			"quantity":             itemReq.Quantity,
-			"line_total":           lineTotal,
-			"discount":             itemDiscountAmount,
-			"final_line_total":     finalLineTotal,
-			"applied_discount_ids": appliedDiscountIDs,
-		})
+	c.JSON(http.StatusCreated, gin.H{
+		"id":                    result.Order.ID.Hex(),
+		"order":                 result.Order.ForCustomer(),
+		"item_discount_details": result.ItemDiscountDetails,
+	})
+}
 
-		// Create order item with server-calculated pricing
-		orderItem := models.OrderItem{
-			ProductID:  productID,
-			VariantID:  orderVariantID,
-			Name:       productName,
-			Quantity:   itemReq.Quantity,
-			UnitPrice:  unitPrice,
-			TotalPrice: finalLineTotal, // Use server-calculated discounted price
-			Image:      productImage,
-		}
-		orderItems = append(orderItems, orderItem)
+// GuestCheckoutCart handles POST /shops/:shopSlug/checkout/guest
+// Checks out the guest session's cart without an account. The order is placed
+// for the customer with the email, so it is theirs once they sign in. Like
+// CheckoutCart, it responds 409 with the cart's warnings and the refreshed
+// cart, including when the address changed the totals, until the guest has
+// acknowledged them.
+// Body: { "email": "...", "shipping_address": { ... }, "shipping_method_id": "...", "billing_address": { ... } }
+func GuestCheckoutCart(c *gin.Context) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return
 	}
-
-	// Calculate final totals server-side
-	finalTotal := subtotal - totalDiscount
-	if finalTotal < 0 {
-		finalTotal = 0
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
 	}
-
-	// Prepare applied discount IDs
-	appliedDiscountIDs := make([]primitive.ObjectID, 0, len(appliedDiscountIDsMap))
-	for id := range appliedDiscountIDsMap {
-		appliedDiscountIDs = append(appliedDiscountIDs, id)
+	sessionID := c.GetString("cart_session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "already signed in; use /checkout"})
+		return
 	}
 
-	// Create order with server-calculated totals
-	order := &models.Order{
-		ShopID:             shop.ID,
-		CustomerID:         customerID,
-		Items:              orderItems,
-		Subtotal:           subtotal,
-		DiscountTotal:      totalDiscount,
-		Total:              finalTotal,
-		Status:             "pending",
-		AppliedDiscountIDs: appliedDiscountIDs,
-		CreatedAt:          time.Now(),
-		UpdatedAt:          time.Now(),
+	var req struct {
+		Email            string                 `json:"email" binding:"required,email"`
+		ShippingAddress  map[string]interface{} `json:"shipping_address" binding:"required"`
+		ShippingMethodID string                 `json:"shipping_method_id"`
+		BillingAddress   map[string]interface{} `json:"billing_address"`
 	}
-
-	// Save order to database
-	created, err := services.CreateOrderService(order)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Record discount usage
-	for id := range appliedDiscountIDsMap {
-		for _, item := range itemDiscountDetails {
-			for _, appliedID := range item["applied_discount_ids"].([]primitive.ObjectID) {
-				if appliedID == id {
-					_ = services.RecordDiscountUsageAtomic(id.Hex(), customerID, item["line_total"].(float64))
-				}
-			}
+	guest := services.GuestCheckout{Email: req.Email, ShippingAddress: req.ShippingAddress, ShippingMethodID: req.ShippingMethodID}
+	client := services.CheckoutClient{IP: c.ClientIP(), BillingAddress: req.BillingAddress}
+	result, err := services.NewCheckoutService().CheckoutGuestCart(shop, sessionID, guest, client)
+	if err != nil {
+		var checkoutErr *services.CheckoutError
+		if errors.As(err, &checkoutErr) && errors.Is(err, services.ErrCheckoutCartChanged) {
+			cart, _ := services.GetOrCreateGuestCartService(shop.ID, sessionID)
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   err.Error(),
+				"changes": checkoutErr.Changes,
+				"cart":    cart,
+			})
+			return
 		}
+		c.JSON(checkoutErrorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	// Reduce stock for all items
-	for _, itemReq := range req.Items {
-		productID, _ := primitive.ObjectIDFromHex(itemReq.ProductID)
-		if itemReq.VariantID != "" {
-			variantID, _ := primitive.ObjectIDFromHex(itemReq.VariantID)
-			if !variantID.IsZero() {
-				err := services.ReduceVariantStock(productID, variantID, itemReq.Quantity)
-				if err != nil {
-					// fmt.Printf("Warning: Failed to reduce stock for variant %s: %v\n", itemReq.VariantID, err)
-				}
-			} else {
-				err := services.ReduceProductStock(productID, itemReq.Quantity)
-				if err != nil {
-					// fmt.Printf("Warning: Failed to reduce stock for product %s: %v\n", itemReq.ProductID, err)
-				}
-			}
-		} else {
-			err := services.ReduceProductStock(productID, itemReq.Quantity)
-			if err != nil {
-				// fmt.Printf("Warning: Failed to reduce stock for product %s: %v\n", itemReq.ProductID, err)
-			}
-		}
+	// The token is how the guest views and pays for the order; the order
+	// stands without it
+	token, err := services.GuestOrderToken(result.Order)
+	if err != nil {
+		log.Printf("guest checkout: no order link for order %s: %v", result.Order.ID.Hex(), err)
 	}
-
-	// Return order with server-calculated totals
 	c.JSON(http.StatusCreated, gin.H{
-		"id":                    created.ID.Hex(),
-		"order":                 created,
-		"item_discount_details": itemDiscountDetails,
-		"server_calculated":     true, // Flag to indicate all pricing was calculated server-side
-		"security_note":         "All pricing calculated securely on server",
+		"id":                    result.Order.ID.Hex(),
+		"order":                 result.Order.ForCustomer(),
+		"item_discount_details": result.ItemDiscountDetails,
+		"token":                 token,
 	})
 }
 
+// checkoutErrorStatus maps a checkout failure to an HTTP status code.
+func checkoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCheckoutEmpty), errors.Is(err, services.ErrCheckoutInvalidItem),
+		errors.Is(err, services.ErrCheckoutShippingRequired), errors.Is(err, services.ErrCheckoutCurrencyUnavailable):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCheckoutInsufficientStock), errors.Is(err, services.ErrCheckoutDiscountUnavailable),
+		errors.Is(err, services.ErrCheckoutCartChanged), errors.Is(err, services.ErrCheckoutShippingUnavailable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // ListShopOrders handles GET /shops/:shopSlug/orders
 func ListShopOrders(c *gin.Context) {
 	shopSlug := c.Param("shopSlug")
@@ -588,7 +529,11 @@ func ListShopOrders(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, list)
+	views := make([]*models.Order, len(list))
+	for i := range list {
+		views[i] = list[i].ForCustomer()
+	}
+	c.JSON(http.StatusOK, views)
 }
 
 // GetOrderDetail handles GET /shops/:shopSlug/orders/:orderId
@@ -627,5 +572,170 @@ func GetOrderDetail(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, order)
+	writeCustomerOrderDetail(c, order)
+}
+
+// writeCustomerOrderDetail responds with the order as its customer sees it,
+// with its timeline and shipments.
+func writeCustomerOrderDetail(c *gin.Context, order *models.Order) {
+	timeline, err := services.CustomerOrderTimelineService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	shipments, err := services.CustomerOrderShipmentsService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, struct {
+		*models.Order
+		Timeline  []services.CustomerOrderEvent `json:"timeline"`
+		Shipments []services.CustomerShipment   `json:"shipments"`
+	}{order.ForCustomer(), timeline, shipments})
+}
+
+// CancelOrder handles POST /shops/:shopSlug/orders/:orderId/cancel
+// Body (optional): { "reason": "..." }
+func CancelOrder(c *gin.Context) {
+	shop, customerID, ok := storefrontShopAndCustomer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	order, err := services.CancelOrderByCustomerService(shop, c.Param("orderId"), customerID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		case errors.Is(err, services.ErrOrderNotCancellable), errors.Is(err, services.ErrInvalidOrderTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrCancelRefundFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, order.ForCustomer())
+}
+
+// ReturnItemRequest is one order line and quantity the customer wants to return.
+type ReturnItemRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+	VariantID string `json:"variant_id,omitempty"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// RequestReturn handles POST /shops/:shopSlug/orders/:orderId/returns
+// Body: { "items": [ { "product_id": "...", "variant_id": "...", "quantity": 1 } ], "reason": "..." }
+func RequestReturn(c *gin.Context) {
+	shop, customerID, ok := storefrontShopAndCustomer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Items  []ReturnItemRequest `json:"items" binding:"required,min=1"`
+		Reason string              `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines := make([]services.ReturnLine, 0, len(req.Items))
+	for _, item := range req.Items {
+		productID, err := primitive.ObjectIDFromHex(item.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID: " + item.ProductID})
+			return
+		}
+		variantID := primitive.NilObjectID
+		if item.VariantID != "" {
+			if variantID, err = primitive.ObjectIDFromHex(item.VariantID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID: " + item.VariantID})
+				return
+			}
+		}
+		lines = append(lines, services.ReturnLine{ProductID: productID, VariantID: variantID, Quantity: item.Quantity})
+	}
+
+	ret, err := services.RequestReturnService(shop, c.Param("orderId"), customerID, lines, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		case errors.Is(err, services.ErrOrderNotReturnable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidReturnItems):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, ret)
+}
+
+// ListOrderReturns handles GET /shops/:shopSlug/orders/:orderId/returns
+func ListOrderReturns(c *gin.Context) {
+	_, customerID, ok := storefrontShopAndCustomer(c)
+	if !ok {
+		return
+	}
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID"})
+		return
+	}
+	returns, err := services.ListCustomerOrderReturnsService(orderID, customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, returns)
+}
+
+// storefrontShopAndCustomer resolves :shopSlug and the authenticated customer,
+// writing the error response itself when either is missing.
+func storefrontShopAndCustomer(c *gin.Context) (*models.Shop, primitive.ObjectID, bool) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return nil, primitive.NilObjectID, false
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	cidVal, exists := c.Get("user_id")
+	if !exists || cidVal == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return nil, primitive.NilObjectID, false
+	}
+	cidHex, ok := cidVal.(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id"})
+		return nil, primitive.NilObjectID, false
+	}
+	customerID, err := primitive.ObjectIDFromHex(cidHex)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid customer ID"})
+		return nil, primitive.NilObjectID, false
+	}
+	return shop, customerID, true
 }
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// draftOrderShop looks up the shop a checkout link belongs to.
+func draftOrderShop(c *gin.Context) (*models.Shop, bool) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return nil, false
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return nil, false
+	}
+	return shop, true
+}
+
+// GetDraftOrderLink handles GET /shops/:shopSlug/draft-orders/:draftId?token=...
+// Opens a checkout link a seller sent. The signed token is the only
+// authentication; the draft is re-priced so it shows what would be paid now.
+func GetDraftOrderLink(c *gin.Context) {
+	shop, ok := draftOrderShop(c)
+	if !ok {
+		return
+	}
+	draft, err := services.OpenDraftOrderLinkService(shop, c.Param("draftId"), c.Query("token"))
+	if err != nil {
+		c.JSON(draftOrderLinkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"draft_order":     draft,
+		"payment_methods": services.ShopPaymentMethods(shop),
+	})
+}
+
+// PayDraftOrderLink handles POST /shops/:shopSlug/draft-orders/:draftId/pay
+// Body: { "token": "...", "provider": "manual" }
+// Turns the draft into an order and starts paying for it; the response says
+// what the customer has to do next. If the total changed since the link was
+// opened, 409 is returned with the re-priced draft.
+func PayDraftOrderLink(c *gin.Context) {
+	shop, ok := draftOrderShop(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Provider string `json:"provider" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, payment, err := services.PayDraftOrderService(shop, c.Param("draftId"), req.Token, req.Provider)
+	if err != nil {
+		if errors.Is(err, services.ErrDraftOrderChanged) {
+			draft, _ := services.GetDraftOrderService(shop.ID, c.Param("draftId"))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "draft_order": draft})
+			return
+		}
+		if order != nil {
+			// The order was made but payment could not start; paying again resumes it
+			c.JSON(draftOrderLinkErrorStatus(err), gin.H{"error": err.Error(), "order": order})
+			return
+		}
+		c.JSON(draftOrderLinkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"order": order, "payment": payment})
+}
+
+// draftOrderLinkErrorStatus maps a checkout link failure to an HTTP status code.
+func draftOrderLinkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrDraftOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDraftOrderLinkInvalid):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrPaymentProviderUnknown), errors.Is(err, services.ErrPaymentMethodNotEnabled):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDraftOrderCompleted), errors.Is(err, services.ErrOrderNotPayable):
+		return http.StatusConflict
+	}
+	return checkoutErrorStatus(err)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// guestOrder resolves :shopSlug and the guest order the token opens, writing
+// the error response itself when either cannot be had.
+func guestOrder(c *gin.Context, token string) (*models.Shop, *models.Order, bool) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return nil, nil, false
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return nil, nil, false
+	}
+	order, err := services.OpenGuestOrderService(shop, c.Param("orderId"), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrGuestOrderLinkInvalid):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, nil, false
+	}
+	return shop, order, true
+}
+
+// GetGuestOrder handles GET /shops/:shopSlug/guest/orders/:orderId?token=...
+// Shows an order placed at guest checkout to whoever has the token returned
+// when it was placed.
+func GetGuestOrder(c *gin.Context) {
+	_, order, ok := guestOrder(c, c.Query("token"))
+	if !ok {
+		return
+	}
+	writeCustomerOrderDetail(c, order)
+}
+
+// StartGuestOrderPayment handles POST /shops/:shopSlug/guest/orders/:orderId/payments
+// Body: { "token": "...", "provider": "manual" }
+// Starts paying for a guest order, like StartOrderPayment does for a signed-in
+// customer.
+func StartGuestOrderPayment(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Provider string `json:"provider" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shop, order, ok := guestOrder(c, req.Token)
+	if !ok {
+		return
+	}
+
+	payment, err := services.StartOrderPaymentService(shop, order, req.Provider, models.OrderActor{Role: models.OrderActorCustomer, ID: order.CustomerID})
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, payment)
+}
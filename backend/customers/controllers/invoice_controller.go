@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderInvoicePDF handles GET /shops/:shopSlug/orders/:orderId/invoice.pdf
+// Downloads the invoice for one of the customer's paid orders.
+func GetOrderInvoicePDF(c *gin.Context) {
+	shop, customerID, ok := storefrontShopAndCustomer(c)
+	if !ok {
+		return
+	}
+	order, err := services.GetOrderByIDService(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if order == nil || order.ShopID != shop.ID || order.CustomerID != customerID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	doc, err := services.InvoicePDFService(shop, order)
+	if err != nil {
+		if errors.Is(err, services.ErrInvoiceNotAvailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "invoice-"+order.InvoiceNumber+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", doc)
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPaymentWebhookBytes bounds how much of a webhook body is read.
+const maxPaymentWebhookBytes = 1 << 20
+
+// ListPaymentMethods handles GET /shops/:shopSlug/payment-methods
+func ListPaymentMethods(c *gin.Context) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"payment_methods": services.ShopPaymentMethods(shop)})
+}
+
+// StartOrderPayment handles POST /shops/:shopSlug/orders/:orderId/payments
+// Body: { "provider": "manual" }
+// Starts paying for a pending order; the response says what the customer has
+// to do next (instructions or a redirect URL).
+func StartOrderPayment(c *gin.Context) {
+	shop, customerID, ok := storefrontShopAndCustomer(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Provider string `json:"provider" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := services.GetOrderByIDService(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if order == nil || order.ShopID != shop.ID || order.CustomerID != customerID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	payment, err := services.StartOrderPaymentService(shop, order, req.Provider, models.OrderActor{Role: models.OrderActorCustomer, ID: customerID})
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, payment)
+}
+
+// paymentErrorStatus maps a failure to start a payment to an HTTP status code.
+func paymentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPaymentProviderUnknown), errors.Is(err, services.ErrPaymentMethodNotEnabled):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderNotPayable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// PaymentWebhook handles POST /shops/:shopSlug/payments/webhooks/:provider
+// Called by payment providers, not customers: the provider's signature is the
+// only authentication.
+func PaymentWebhook(c *gin.Context) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup shop"})
+		return
+	}
+	if shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPaymentWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+		return
+	}
+
+	err = services.HandlePaymentWebhookService(shop, c.Param("provider"), c.Request.Header, body)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	case errors.Is(err, services.ErrPaymentWebhookInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentProviderUnknown), errors.Is(err, services.ErrPaymentNotFound),
+		errors.Is(err, services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		// 5xx makes the provider retry later
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
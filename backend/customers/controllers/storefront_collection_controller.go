@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/Endale2/DRPS/sellers/repositories"
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,7 +18,7 @@ type CollectionProductSummary struct {
 	Name         string             `json:"name"`
 	MainImage    string             `json:"main_image"`
 	Description  string             `json:"description"`
-	Price        float64            `json:"price"`
+	Price        money.Amount       `json:"price"`
 	VariantCount int                `json:"variant_count"`
 }
 
@@ -53,6 +55,7 @@ func ListCollections(c *gin.Context) {
 }
 
 // GetCollection handles GET /shops/:shopSlug/collections/:collectionHandle
+// Product prices are in ?currency= if given.
 func GetCollection(c *gin.Context) {
 	shopSlug := c.Param("shopSlug")
 	shop, err := services.GetShopBySlugService(shopSlug)
@@ -65,6 +68,11 @@ func GetCollection(c *gin.Context) {
 		return
 	}
 
+	converter, ok := storefrontConverter(c, shop)
+	if !ok {
+		return
+	}
+
 	handle := c.Param("collectionHandle")
 	coll, err := repositories.GetCollectionByHandle(shop.ID, handle)
 	if err != nil {
@@ -78,7 +86,7 @@ func GetCollection(c *gin.Context) {
 
 	// Build richer product summaries by querying products that belong to this collection
 	allProducts, _ := services.GetProductsByShopIDService(shop.ID)
-	var products []map[string]interface{}
+	var inCollection []models.Product
 	for _, p := range allProducts {
 		// Check if this product belongs to the current collection
 		belongsToCollection := false
@@ -89,9 +97,13 @@ func GetCollection(c *gin.Context) {
 			}
 		}
 		if belongsToCollection {
-			products = append(products, services.ProductToAPIResponseWithDiscounts(&p))
+			inCollection = append(inCollection, p)
 		}
 	}
+	var products []map[string]interface{}
+	for _, resp := range services.ProductsToAPIResponseWithDiscounts(inCollection) {
+		products = append(products, services.PresentProductResponse(resp, converter))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"id":          coll.ID,
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListStorefrontCurrencies handles GET /shops/:shopSlug/currencies
+// Lists the currencies customers may shop in: the shop's own, then every
+// enabled one there is a rate for.
+func ListStorefrontCurrencies(c *gin.Context) {
+	shop, err := services.GetShopBySlugService(c.Param("shopSlug"))
+	if err != nil || shop == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	currencies, err := services.ShopCurrenciesService(shop)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	available := []string{currencies.Currency}
+	for _, pc := range currencies.Presentment {
+		if pc.Rate > 0 {
+			available = append(available, pc.Currency)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"currency": currencies.Currency, "available": available})
+}
+
+// storefrontConverter returns the converter into the ?currency= the customer
+// asked for, the shop's own if none. If the shop does not offer it, it
+// answers the request itself and returns false.
+func storefrontConverter(c *gin.Context, shop *models.Shop) (*services.CurrencyConverter, bool) {
+	converter, err := services.PresentmentConverterService(shop, c.Query("currency"))
+	if err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return converter, true
+}
+
+// currencyErrorStatus maps a presentment currency failure to an HTTP status code.
+func currencyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrency), errors.Is(err, services.ErrCurrencyNotEnabled):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrExchangeRateNotFound):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -14,7 +14,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GetProductsByShop returns all products for a shop identified by its slug.
+// GetProductsByShop returns all products for a shop identified by its slug,
+// priced in ?currency= if given.
 // GET /shops/:shopSlug/products
 func GetProductsByShop(c *gin.Context) {
 	shopSlug := c.Param("shopSlug")
@@ -29,6 +30,10 @@ func GetProductsByShop(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
+	converter, ok := storefrontConverter(c, shop)
+	if !ok {
+		return
+	}
 
 	// 2) Parse pagination params
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -62,18 +67,21 @@ func GetProductsByShop(c *gin.Context) {
 	}
 
 	// Patch: Ensure variant options is never null
-	apiProducts := make([]map[string]interface{}, 0, len(pagedProducts))
 	for i := range pagedProducts {
 		for j := range pagedProducts[i].Variants {
 			if pagedProducts[i].Variants[j].Options == nil {
 				pagedProducts[i].Variants[j].Options = []models.Option{}
 			}
 		}
-		apiProducts = append(apiProducts, services.ProductToAPIResponseWithDiscounts(&pagedProducts[i]))
+	}
+	apiProducts := services.ProductsToAPIResponseWithDiscounts(pagedProducts)
+	for i := range apiProducts {
+		apiProducts[i] = services.PresentProductResponse(apiProducts[i], converter)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"products": apiProducts,
+		"currency": converter.To,
 		"total":    total,
 		"page":     page,
 		"limit":    limit,
@@ -81,7 +89,7 @@ func GetProductsByShop(c *gin.Context) {
 }
 
 // GetProductDetail returns one product by its slug, verifying it belongs to this shop.
-// GET /shops/:shopSlug/products/:productSlug
+// GET /shops/:shopSlug/products/:productSlug?currency=EUR
 func GetProductDetail(c *gin.Context) {
 	shopSlug := c.Param("shopSlug")
 	productSlug := c.Param("productSlug")
@@ -96,6 +104,10 @@ func GetProductDetail(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
+	converter, ok := storefrontConverter(c, shop)
+	if !ok {
+		return
+	}
 
 	// 2) Fetch product by slug
 	product, err := services.GetProductBySlugService(productSlug)
@@ -114,7 +126,7 @@ func GetProductDetail(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, services.ProductToAPIResponseWithDiscounts(product))
+	c.JSON(http.StatusOK, services.PresentProductResponse(services.ProductToAPIResponseWithDiscounts(product), converter))
 }
 
 // GET /shops/:shopSlug/products/id/:productId
@@ -144,7 +156,7 @@ func GetProductDetailByID(c *gin.Context) {
 }
 
 // SearchProductsByShop returns paginated products matching a search query for a shop
-// GET /shops/:shopSlug/products/search?q=...&page=1&limit=20
+// GET /shops/:shopSlug/products/search?q=...&page=1&limit=20&currency=EUR
 func SearchProductsByShop(c *gin.Context) {
 	shopSlug := c.Param("shopSlug")
 	q := strings.ToLower(c.DefaultQuery("q", ""))
@@ -168,6 +180,10 @@ func SearchProductsByShop(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
 		return
 	}
+	converter, ok := storefrontConverter(c, shop)
+	if !ok {
+		return
+	}
 
 	// 2) Fetch all products for the shop
 	products, err := services.GetProductsByShopSlugService(shopSlug)
@@ -200,18 +216,21 @@ func SearchProductsByShop(c *gin.Context) {
 		pagedProducts = []models.Product{}
 	}
 
-	apiProducts := make([]map[string]interface{}, 0, len(pagedProducts))
 	for i := range pagedProducts {
 		for j := range pagedProducts[i].Variants {
 			if pagedProducts[i].Variants[j].Options == nil {
 				pagedProducts[i].Variants[j].Options = []models.Option{}
 			}
 		}
-		apiProducts = append(apiProducts, services.ProductToAPIResponseWithDiscounts(&pagedProducts[i]))
+	}
+	apiProducts := services.ProductsToAPIResponseWithDiscounts(pagedProducts)
+	for i := range apiProducts {
+		apiProducts[i] = services.PresentProductResponse(apiProducts[i], converter)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"products": apiProducts,
+		"currency": converter.To,
 		"total":    total,
 		"page":     page,
 		"limit":    limit,
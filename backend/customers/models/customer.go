@@ -18,4 +18,8 @@ type Customer struct {
     Country    string             `bson:"country" json:"country"`
     CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
     UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+    // Guest records are made at guest checkout from an email nobody has
+    // verified; signing in never uses them
+    Guest      bool               `bson:"guest,omitempty" json:"guest,omitempty"`
 }
\ No newline at end of file
@@ -27,10 +27,12 @@ func GetCustomerByID(id primitive.ObjectID) (*models.Customer, error) {
 	return &customer, nil
 }
 
-// GetCustomerByEmail retrieves a Customer by its email.
+// GetCustomerByEmail retrieves a Customer by its email. Guest checkout
+// records are skipped.
 func GetCustomerByEmail(email string) (*models.Customer, error) {
 	var customer models.Customer
-	err := customerCollection.FindOne(context.Background(), bson.M{"email": email}).Decode(&customer)
+	filter := bson.M{"email": email, "guest": bson.M{"$ne": true}}
+	err := customerCollection.FindOne(context.Background(), filter).Decode(&customer)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -37,17 +37,50 @@ func StorefrontRoutes(r *gin.Engine) {
 		shops.POST("/:shopSlug/debug/fix-variant-ids", controllers.FixVariantIDs)
 		shops.GET("/:shopSlug/test-discounts", controllers.TestDiscounts)
 
+		// Currencies customers may shop in; product endpoints take ?currency=
+		shops.GET("/:shopSlug/currencies", controllers.ListStorefrontCurrencies)
+
+		// Payment methods and provider webhooks (webhooks authenticate by signature)
+		shops.GET("/:shopSlug/payment-methods", controllers.ListPaymentMethods)
+		shops.POST("/:shopSlug/payments/webhooks/:provider", controllers.PaymentWebhook)
+
+		// Draft order checkout links (authenticated by the link's signed token)
+		shops.GET("/:shopSlug/draft-orders/:draftId", controllers.GetDraftOrderLink)
+		shops.POST("/:shopSlug/draft-orders/:draftId/pay", controllers.PayDraftOrderLink)
+
+		// Orders placed at guest checkout (authenticated by the token returned
+		// when the order was placed)
+		shops.GET("/:shopSlug/guest/orders/:orderId", controllers.GetGuestOrder)
+		shops.POST("/:shopSlug/guest/orders/:orderId/payments", controllers.StartGuestOrderPayment)
+
+		// Cart endpoints: the signed-in customer's cart, or a guest's kept
+		// under a signed cart_session cookie
+		cart := shops.Group("/:shopSlug", middlewares.CartSessionMiddleware(), middlewares.IdempotencyMiddleware())
+		{
+			cart.GET("/cart", controllers.GetCart)
+			cart.POST("/cart/items", controllers.AddToCart)
+			cart.PUT("/cart/items", controllers.UpdateCartItem)
+			cart.DELETE("/cart/items", controllers.RemoveCartItem)
+			cart.POST("/cart/clear", controllers.ClearCart)
+			cart.POST("/cart/reserve", controllers.ReserveCart)
+			cart.PUT("/cart/shipping", controllers.SetCartShipping)
+			cart.PUT("/cart/currency", controllers.SetCartCurrency)
+			cart.POST("/cart/acknowledge", controllers.AcknowledgeCartChanges)
+			cart.POST("/checkout/guest", controllers.GuestCheckoutCart)
+		}
+
 		// Protected endpoints: all under /shops/:shopSlug/ and require auth
-		auth := shops.Group("/:shopSlug", middlewares.AuthMiddleware())
+		auth := shops.Group("/:shopSlug", middlewares.AuthMiddleware(), middlewares.IdempotencyMiddleware())
 		{
-			auth.GET("/cart", controllers.GetCart)
-			auth.POST("/cart/items", controllers.AddToCart)
-			auth.PUT("/cart/items", controllers.UpdateCartItem)
-			auth.DELETE("/cart/items", controllers.RemoveCartItem)
-			auth.POST("/cart/clear", controllers.ClearCart)
+			auth.POST("/checkout", controllers.CheckoutCart)
 			auth.POST("/orders", controllers.PlaceOrder)
 			auth.GET("/orders", controllers.ListShopOrders)
 			auth.GET("/orders/:orderId", controllers.GetOrderDetail)
+			auth.GET("/orders/:orderId/invoice.pdf", controllers.GetOrderInvoicePDF)
+			auth.POST("/orders/:orderId/cancel", controllers.CancelOrder)
+			auth.POST("/orders/:orderId/payments", controllers.StartOrderPayment)
+			auth.POST("/orders/:orderId/returns", controllers.RequestReturn)
+			auth.GET("/orders/:orderId/returns", controllers.ListOrderReturns)
 			auth.GET("/wishlist", controllers.GetWishlist)
 			auth.POST("/wishlist", controllers.AddToWishlist)
 			auth.DELETE("/wishlist/:productId", controllers.RemoveFromWishlist)
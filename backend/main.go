@@ -16,6 +16,7 @@ import (
 	"github.com/Endale2/DRPS/config"
 	storefrontRoutes "github.com/Endale2/DRPS/customers/routes"
 	sellerRoutes "github.com/Endale2/DRPS/sellers/routes"
+	"github.com/Endale2/DRPS/shared/services"
 )
 
 func main() {
@@ -35,6 +36,26 @@ func main() {
 		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
 	}
 
+	// Rewrite amounts stored as floats, so guarded updates match, renumber
+	// orders sharing a number, so the unique order number index can be built,
+	// and move order counters past the numbers already issued
+	if n, err := services.GetSeedService().MigrateData(); err != nil {
+		log.Printf("⚠️  Failed to migrate data: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ Migrated %d documents", n)
+	}
+
+	// Ensure indexes (TTL cleanup, uniqueness) exist before serving traffic
+	if err := services.GetSeedService().CreateIndexes(); err != nil {
+		log.Fatalf("❌ Failed to create indexes: %v", err)
+	}
+
+	// Keep exchange rates current if a rates API is configured
+	services.StartExchangeRateRefresh()
+
+	// Email customers about carts they left without ordering
+	services.StartCartRecovery()
+
 	// Set Gin to release mode to suppress debug endpoint and warning logs
 	gin.SetMode(gin.ReleaseMode)
 	// Initialize Gin router
@@ -69,8 +90,8 @@ func main() {
 			return false
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
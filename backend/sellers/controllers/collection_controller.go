@@ -7,6 +7,7 @@ import (
 	"github.com/Endale2/DRPS/sellers/models"
 	"github.com/Endale2/DRPS/sellers/repositories"
 	"github.com/Endale2/DRPS/sellers/services"
+	"github.com/Endale2/DRPS/shared/money"
 	sharedSvc "github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -405,9 +406,9 @@ func formatCollectionResponse(coll *models.Collection, shopID primitive.ObjectID
 		Name          string             `json:"name"`
 		MainImage     string             `json:"main_image"`
 		Category      string             `json:"category"`
-		Price         float64            `json:"price"`
+		Price         money.Amount       `json:"price"`
 		Stock         int                `json:"stock"`
-		StartingPrice *float64           `json:"starting_price,omitempty"`
+		StartingPrice *money.Amount      `json:"starting_price,omitempty"`
 	}
 	var summaries []ProductSummary
 	// Fetch all products that belong to this collection
@@ -424,7 +425,7 @@ func formatCollectionResponse(coll *models.Collection, shopID primitive.ObjectID
 		if !belongsToCollection {
 			continue
 		}
-		var startingPrice *float64
+		var startingPrice *money.Amount
 		if len(p.Variants) > 0 {
 			min := p.Variants[0].Price
 			for _, v := range p.Variants {
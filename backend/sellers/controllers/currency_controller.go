@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /seller/shops/:shopId/currencies
+// The shop's currency and the presentment currencies customers may shop in,
+// each with the rate it is converted at and where the rate came from.
+func GetShopCurrencies(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	currencies, err := services.ShopCurrenciesService(shop)
+	if err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, currencies)
+}
+
+// PUT /seller/shops/:shopId/currencies
+// Body: { "currencies": [{ "currency": "EUR", "rounding": "charm" }, { "currency": "JPY" }] }
+// rounding is "" (to the currency's smallest unit), "whole" or "charm" (x.99).
+func SetShopCurrencies(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Currencies []models.PresentmentCurrency `json:"currencies"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currencies, err := services.SetPresentmentCurrenciesService(shop, req.Currencies)
+	if err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, currencies)
+}
+
+// PUT /seller/shops/:shopId/currencies/:currency/rate
+// Body: { "rate": 0.92 } — units of :currency per unit of the shop's currency.
+// Overrides the rate loaded for all shops until deleted.
+func SetShopExchangeRate(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Rate float64 `json:"rate" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currencies, err := services.SetShopExchangeRateService(shop, c.Param("currency"), req.Rate)
+	if err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, currencies)
+}
+
+// DELETE /seller/shops/:shopId/currencies/:currency/rate
+// Drops the shop's own rate, so the rate loaded for all shops applies again.
+func DeleteShopExchangeRate(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	currencies, err := services.DeleteShopExchangeRateService(shop, c.Param("currency"))
+	if err != nil {
+		c.JSON(currencyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, currencies)
+}
+
+// currencyErrorStatus maps a currency or exchange rate failure to an HTTP
+// status code.
+func currencyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrency), errors.Is(err, services.ErrInvalidExchangeRate):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrExchangeRateNotFound):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrShopExchangeRateNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
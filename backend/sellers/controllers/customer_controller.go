@@ -10,6 +10,7 @@ import (
 	"github.com/Endale2/DRPS/sellers/models"
 	"github.com/Endale2/DRPS/sellers/services"
 	sharedmodels "github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	scService "github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -539,7 +540,7 @@ func GetCustomerOrderHistory(c *gin.Context) {
 		return
 	}
 	var customerOrders []sharedmodels.Order
-	var totalSpend float64
+	var totalSpend money.Amount
 	var lastOrder *sharedmodels.Order
 	for i := range orders {
 		if orders[i].CustomerID == custID {
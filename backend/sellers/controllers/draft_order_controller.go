@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /seller/shops/:shopId/draft-orders?status=open|completed
+func ListDraftOrders(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	status := models.DraftOrderStatus(c.Query("status"))
+	switch status {
+	case "", models.DraftOrderStatusOpen, models.DraftOrderStatusCompleted:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open or completed"})
+		return
+	}
+	drafts, err := services.ListDraftOrdersService(shopID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, drafts)
+}
+
+// POST /seller/shops/:shopId/draft-orders
+// Body: { "customer_id": "...", "lines": [ ... ], "discount": { "type": "percentage" | "fixed", "value": 10, "reason": "..." }, "shipping_address": { ... }, "shipping_method_id": "...", "note": "..." }
+// Line: { "product_id": "...", "variant_id": "...", "quantity": 1, "discount": { ... } }, or a custom item: { "name": "Gift wrap", "unit_price": 5, "tax_class": "standard", "quantity": 1 }
+// Totals are worked out the same way checkout does; prices are never taken from product lines.
+func CreateDraftOrder(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var in models.DraftOrder
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	draft, err := services.CreateDraftOrderService(shop, &in)
+	if err != nil {
+		c.JSON(draftOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, draft)
+}
+
+// GET /seller/shops/:shopId/draft-orders/:draftId
+func GetDraftOrder(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	draft, err := services.GetDraftOrderService(shopID, c.Param("draftId"))
+	if err != nil {
+		c.JSON(draftOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// PUT /seller/shops/:shopId/draft-orders/:draftId
+// Body: the full draft, as for create. Only open drafts can be changed.
+func UpdateDraftOrder(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var in models.DraftOrder
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	draft, err := services.UpdateDraftOrderService(shop, c.Param("draftId"), &in)
+	if err != nil {
+		c.JSON(draftOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// DELETE /seller/shops/:shopId/draft-orders/:draftId
+func DeleteDraftOrder(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	if err := services.DeleteDraftOrderService(shopID, c.Param("draftId")); err != nil {
+		c.JSON(draftOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "draft order deleted"})
+}
+
+// POST /seller/shops/:shopId/draft-orders/:draftId/send
+// Issues a new signed checkout link, revoking earlier ones, and notifies the
+// customer. The link is returned so the seller can also share it directly.
+func SendDraftOrderLink(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	link, err := services.SendDraftOrderLinkService(shop, c.Param("draftId"))
+	if err != nil {
+		c.JSON(draftOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// draftOrderErrorStatus maps a draft order failure to an HTTP status code.
+func draftOrderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidDraftOrder), errors.Is(err, services.ErrCheckoutEmpty),
+		errors.Is(err, services.ErrCheckoutInvalidItem), errors.Is(err, services.ErrCheckoutShippingRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDraftOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDraftOrderCompleted), errors.Is(err, services.ErrCheckoutInsufficientStock),
+		errors.Is(err, services.ErrCheckoutShippingUnavailable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
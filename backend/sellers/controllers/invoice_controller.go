@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPackingSlipsPerRequest bounds a bulk packing slip download.
+const maxPackingSlipsPerRequest = 100
+
+// GET /seller/shops/:shopId/orders/:orderId/invoice.pdf
+func GetOrderInvoicePDF(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	doc, err := services.InvoicePDFService(shop, order)
+	if err != nil {
+		if errors.Is(err, services.ErrInvoiceNotAvailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sendPDF(c, "invoice-"+order.InvoiceNumber+".pdf", doc)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/packing-slip.pdf
+func GetOrderPackingSlipPDF(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	sendPDF(c, "packing-slip-"+order.OrderNumber+".pdf", services.PackingSlipsPDFService(shop, []*models.Order{order}))
+}
+
+// GET /seller/shops/:shopId/orders/packing-slips.pdf?ids=<orderId>,<orderId>
+// One page per order, in the order given, for batch fulfillment. Without ids,
+// the orders matching the list filters (search, status, from, to) are used.
+func GetPackingSlipsPDF(c *gin.Context) {
+	shop, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxPackingSlipsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d orders per request", maxPackingSlipsPerRequest)})
+		return
+	}
+
+	var orders []*models.Order
+	var err error
+	if len(ids) > 0 {
+		orders, err = services.GetShopOrdersService(shopID, ids)
+	} else {
+		filter, ferr := orderFilterFromQuery(c)
+		if ferr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ferr.Error()})
+			return
+		}
+		orders, err = services.FindShopOrdersService(shopID, filter, maxPackingSlipsPerRequest)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyOrders) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if len(orders) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no orders match"})
+		return
+	}
+	name := "packing-slips-" + time.Now().Format("20060102-150405") + ".pdf"
+	sendPDF(c, name, services.PackingSlipsPDFService(shop, orders))
+}
+
+// sendPDF writes a PDF download.
+func sendPDF(c *gin.Context, filename string, doc []byte) {
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/pdf", doc)
+}
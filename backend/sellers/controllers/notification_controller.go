@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GET /seller/shops/:shopId/notifications?unread=true
+func ListNotifications(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+
+	notifications, err := services.ListSellerNotificationsService(shop, c.Query("unread") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// POST /seller/shops/:shopId/notifications/:notificationId/read
+func MarkNotificationRead(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("notificationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification ID"})
+		return
+	}
+	if err := services.MarkNotificationReadService(id, shop.OwnerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "notification marked as read"})
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// orderFilterFromQuery reads the order list filters: search, status, and a
+// from/to date range. Dates are RFC 3339 times or YYYY-MM-DD days; a day in
+// to includes the whole of that day.
+func orderFilterFromQuery(c *gin.Context) (services.OrderFilter, error) {
+	f := services.OrderFilter{Search: c.Query("search"), Status: c.Query("status")}
+	parse := func(name string, endOfDay bool) (*time.Time, error) {
+		v := strings.TrimSpace(c.Query(name))
+		if v == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return &t, nil
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC 3339 time", name)
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	var err error
+	if f.From, err = parse("from", false); err != nil {
+		return f, err
+	}
+	if f.To, err = parse("to", true); err != nil {
+		return f, err
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return f, errors.New("from must be before to")
+	}
+	return f, nil
+}
+
+// POST /seller/shops/:shopId/orders/bulk/status
+// Body: { "order_ids": ["..."], "status": "processing" }
+// Each order goes through the state machine on its own; the response lists
+// the outcome per order.
+func BulkUpdateOrderStatus(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		OrderIDs []string           `json:"order_ids" binding:"required,min=1"`
+		Status   models.OrderStatus `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results, err := services.BulkTransitionOrdersService(shopID, body.OrderIDs, body.Status, sellerActor(c))
+	if err != nil {
+		c.JSON(bulkOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// POST /seller/shops/:shopId/orders/bulk/fulfill
+// Body: { "order_ids": ["..."], "carrier": "ups" }
+// Ships whatever is left to ship on each order and marks it shipped.
+func BulkFulfillOrders(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		OrderIDs []string `json:"order_ids" binding:"required,min=1"`
+		Carrier  string   `json:"carrier" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results, err := services.BulkFulfillOrdersService(shop, body.OrderIDs, body.Carrier, sellerActor(c))
+	if err != nil {
+		c.JSON(bulkOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GET /seller/shops/:shopId/orders/export?format=csv|xlsx&search=&status=&from=&to=
+// Streams every matching order, one row per line item.
+func ExportOrders(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	filter, err := orderFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := services.OrderExportFormat(strings.ToLower(c.DefaultQuery("format", string(services.OrderExportCSV))))
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case services.OrderExportCSV:
+	case services.OrderExportXLSX:
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidExportFormat.Error()})
+		return
+	}
+
+	name := "orders-" + time.Now().Format("20060102-150405") + "." + string(format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if err := services.ExportOrdersService(shop, filter, format, c.Writer); err != nil {
+		// The download has started, so the status can no longer change; the
+		// client sees a truncated file
+		log.Printf("orders export for shop %s failed: %v", shop.ID.Hex(), err)
+		c.Abort()
+	}
+}
+
+// bulkOrderErrorStatus maps a bulk order failure to an HTTP status code.
+func bulkOrderErrorStatus(err error) int {
+	if errors.Is(err, services.ErrTooManyOrders) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// POST /seller/shops/:shopId/orders/:orderId/edits
+// Opens an edit on the order, or returns the one already open.
+func BeginOrderEdit(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edit, err := services.BeginOrderEditService(shop, order, sellerActor(c))
+	if err != nil {
+		c.JSON(orderEditErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, edit)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/edits
+func ListOrderEdits(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edits, err := services.ListOrderEditsService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, edits)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/edits/:editId
+func GetOrderEdit(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edit, err := services.GetOrderEditService(order.ID, c.Param("editId"))
+	if err != nil {
+		c.JSON(orderEditErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, edit)
+}
+
+// PUT /seller/shops/:shopId/orders/:orderId/edits/:editId
+// Body: { "changes": [ { "type": "add" | "remove" | "set_quantity", "product_id": "...", "variant_id": "...", "quantity": 2 } ], "shipping_method_id": "...", "reason": "..." }
+// Replaces the staged changes and returns the edit re-priced, with the amount due or refund it would settle.
+func StageOrderEdit(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Changes          []models.OrderEditChange `json:"changes"`
+		ShippingMethodID string                   `json:"shipping_method_id"`
+		Reason           string                   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edit, err := services.StageOrderEditService(shop, order, c.Param("editId"), body.Changes, body.ShippingMethodID, body.Reason)
+	if err != nil {
+		c.JSON(orderEditErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, edit)
+}
+
+// POST /seller/shops/:shopId/orders/:orderId/edits/:editId/commit
+// Applies the edit. If its total changed since it was staged, responds 409
+// with the re-priced edit so the seller can review it and commit again.
+func CommitOrderEdit(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edit, updated, err := services.CommitOrderEditService(shop, order, c.Param("editId"), sellerActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrOrderEditChanged) {
+			fresh, _ := services.GetOrderEditService(order.ID, c.Param("editId"))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "edit": fresh})
+			return
+		}
+		c.JSON(orderEditErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"edit": edit, "order": updated})
+}
+
+// DELETE /seller/shops/:shopId/orders/:orderId/edits/:editId
+func DiscardOrderEdit(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	edit, err := services.DiscardOrderEditService(order.ID, c.Param("editId"))
+	if err != nil {
+		c.JSON(orderEditErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, edit)
+}
+
+// orderEditErrorStatus maps an order edit failure to an HTTP status code.
+func orderEditErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrderEdit), errors.Is(err, services.ErrCheckoutInvalidItem),
+		errors.Is(err, services.ErrCheckoutShippingRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderEditNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrderNotEditable), errors.Is(err, services.ErrOrderEditClosed),
+		errors.Is(err, services.ErrOrderEditConflict), errors.Is(err, services.ErrCheckoutInsufficientStock),
+		errors.Is(err, services.ErrCheckoutShippingUnavailable), errors.Is(err, services.ErrCheckoutDiscountUnavailable):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRefundFailed):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /seller/shops/:shopId/orders/:orderId/payments
+func ListOrderPayments(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	payments, err := services.ListOrderPaymentsService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, payments)
+}
+
+// POST /seller/shops/:shopId/orders/:orderId/payments/capture
+// Confirms the order's pending payment, e.g. cash collected on delivery, and
+// marks the order paid.
+func CaptureOrderPayment(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	payment, err := services.CapturePaymentService(order, sellerActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentNotFound):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, payment)
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GET /seller/shops/:shopId/returns?status=requested
+func ListReturns(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	returns, err := services.ListShopReturnsService(shopID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, returns)
+}
+
+// GET /seller/shops/:shopId/returns/:returnId
+func GetReturn(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	ret, err := services.GetShopReturnService(shopID, c.Param("returnId"))
+	if err != nil {
+		c.JSON(returnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// POST /seller/shops/:shopId/returns/:returnId/approve
+// Body (optional): { "note": "..." }
+func ApproveReturn(c *gin.Context) {
+	decideReturn(c, true)
+}
+
+// POST /seller/shops/:shopId/returns/:returnId/reject
+// Body (optional): { "note": "..." }
+func RejectReturn(c *gin.Context) {
+	decideReturn(c, false)
+}
+
+func decideReturn(c *gin.Context, approve bool) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ret, err := services.DecideReturnService(shopID, c.Param("returnId"), approve, body.Note, sellerActor(c))
+	if err != nil {
+		c.JSON(returnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// POST /seller/shops/:shopId/returns/:returnId/receive
+// Body: { "items": [ { "product_id": "...", "variant_id": "...", "disposition": "restock" | "write_off" } ] }
+func ReceiveReturn(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Items []struct {
+			ProductID   string                   `json:"product_id" binding:"required"`
+			VariantID   string                   `json:"variant_id"`
+			Disposition models.ReturnDisposition `json:"disposition" binding:"required"`
+		} `json:"items" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dispositions := map[string]models.ReturnDisposition{}
+	for _, item := range body.Items {
+		productID, err := primitive.ObjectIDFromHex(item.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID: " + item.ProductID})
+			return
+		}
+		variantID := primitive.NilObjectID
+		if item.VariantID != "" {
+			if variantID, err = primitive.ObjectIDFromHex(item.VariantID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID: " + item.VariantID})
+				return
+			}
+		}
+		dispositions[services.ReturnDispositionKey(productID, variantID)] = item.Disposition
+	}
+
+	ret, err := services.ReceiveReturnService(shopID, c.Param("returnId"), dispositions, sellerActor(c))
+	if err != nil {
+		c.JSON(returnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// returnErrorStatus maps a returns service failure to an HTTP status code.
+func returnErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReturnNotFound), errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidReturnTransition):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidReturnItems):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	sellerRepositories "github.com/Endale2/DRPS/sellers/repositories"
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
@@ -40,8 +41,7 @@ func getShopAndVerifySeller(c *gin.Context) (*models.Shop, primitive.ObjectID, b
 func filterSoldOrders(orders []models.Order) []models.Order {
 	var filtered []models.Order
 	for _, o := range orders {
-		status := o.Status
-		if status == "paid" || status == "shipped" || status == "delivered" {
+		if services.IsSoldOrder(&o) {
 			filtered = append(filtered, o)
 		}
 	}
@@ -59,11 +59,11 @@ func GetShopAnalyticsSummary(c *gin.Context) {
 	customers, _ := repositories.GetShopCustomerLinks(shopID)
 	products, _ := services.GetProductsByShopIDService(shopID)
 
-	totalRevenue := 0.0
+	var totalRevenue money.Amount
 	totalOrders := len(orders)
 	customerOrderCount := make(map[primitive.ObjectID]int)
 	for _, o := range orders {
-		totalRevenue += o.Total
+		totalRevenue += o.NetTotal()
 		customerOrderCount[o.CustomerID]++
 	}
 	totalCustomers := len(customers)
@@ -78,9 +78,17 @@ func GetShopAnalyticsSummary(c *gin.Context) {
 			returningCustomers++
 		}
 	}
-	avgOrderValue := 0.0
+	var avgOrderValue money.Amount
 	if totalOrders > 0 {
-		avgOrderValue = totalRevenue / float64(totalOrders)
+		avgOrderValue = totalRevenue.Part(1, totalOrders, money.HalfUp)
+	}
+	returnRate := 0.0
+	if metrics, err := services.ReturnMetricsService(shopID, orders); err == nil {
+		returnRate = metrics.ReturnRate
+	}
+	cartRecoveryRate := 0.0
+	if metrics, err := services.CartRecoveryMetricsService(shopID); err == nil {
+		cartRecoveryRate = metrics.RecoveryRate
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -91,9 +99,42 @@ func GetShopAnalyticsSummary(c *gin.Context) {
 		"total_products":      len(products),
 		"total_customers":     totalCustomers,
 		"returning_customers": returningCustomers,
+		"return_rate":         returnRate,
+		"cart_recovery_rate":  cartRecoveryRate,
 	})
 }
 
+// GET /seller/shops/:shopId/analytics/returns
+func GetShopReturnMetrics(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	orders, _ := services.ListOrdersByShopService(shopID.Hex())
+	orders = filterSoldOrders(orders)
+	metrics, err := services.ReturnMetricsService(shopID, orders)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
+
+// GET /seller/shops/:shopId/analytics/cart-recovery
+// Abandoned cart emails sent, and the orders and revenue they brought back.
+func GetShopCartRecoveryMetrics(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	metrics, err := services.CartRecoveryMetricsService(shopID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
+
 // GET /seller/shops/:shopId/analytics/revenue-over-time?days=30
 func GetShopRevenueOverTime(c *gin.Context) {
 	_, shopID, ok := getShopAndVerifySeller(c)
@@ -110,7 +151,7 @@ func GetShopRevenueOverTime(c *gin.Context) {
 	orders = filterSoldOrders(orders)
 
 	// Build daily revenue
-	revenueMap := make(map[string]float64)
+	revenueMap := make(map[string]money.Amount)
 	now := time.Now()
 	for i := 0; i < days; i++ {
 		date := now.AddDate(0, 0, -i).Format("2006-01-02")
@@ -119,12 +160,12 @@ func GetShopRevenueOverTime(c *gin.Context) {
 	for _, o := range orders {
 		date := o.CreatedAt.Format("2006-01-02")
 		if _, ok := revenueMap[date]; ok {
-			revenueMap[date] += o.Total
+			revenueMap[date] += o.NetTotal()
 		}
 	}
 	// Sort by date ascending
 	var labels []string
-	var values []float64
+	var values []money.Amount
 	for i := days - 1; i >= 0; i-- {
 		date := now.AddDate(0, 0, -i).Format("2006-01-02")
 		labels = append(labels, date)
@@ -179,7 +220,7 @@ func GetShopTopProducts(c *gin.Context) {
 	orders = filterSoldOrders(orders)
 	products, _ := services.GetProductsByShopIDService(shopID)
 	productSales := map[primitive.ObjectID]int{}
-	productRevenue := map[primitive.ObjectID]float64{}
+	productRevenue := map[primitive.ObjectID]money.Amount{}
 	for _, o := range orders {
 		for _, item := range o.Items {
 			productSales[item.ProductID] += item.Quantity
@@ -193,7 +234,7 @@ func GetShopTopProducts(c *gin.Context) {
 		Category     string             `json:"category"`
 		MainImage    string             `json:"mainImage"`
 		TotalSold    int                `json:"totalSold"`
-		TotalRevenue float64            `json:"totalRevenue"`
+		TotalRevenue money.Amount       `json:"totalRevenue"`
 	}
 	var stats []prodStat
 	for _, p := range products {
@@ -289,11 +330,11 @@ func GetShopDiscountPerformance(c *gin.Context) {
 		ID          primitive.ObjectID `json:"id"`
 		Name        string             `json:"name"`
 		TotalUsage  int                `json:"totalUsage"`
-		TotalAmount float64            `json:"totalAmount"`
+		TotalAmount money.Amount       `json:"totalAmount"`
 	}
 	var stats []discStat
 	for _, d := range discounts {
-		amount := 0.0
+		var amount money.Amount
 		for _, usage := range d.UsageTracking {
 			amount += usage.TotalSpent
 		}
@@ -370,7 +411,7 @@ func GetShopCategorySales(c *gin.Context) {
 		}
 		productCategory[p.ID] = collTitle
 	}
-	categoryRevenue := make(map[string]float64)
+	categoryRevenue := make(map[string]money.Amount)
 	now := time.Now()
 	cutoff := now.AddDate(0, 0, -days)
 	for _, o := range orders {
@@ -388,7 +429,7 @@ func GetShopCategorySales(c *gin.Context) {
 	// Sort categories by revenue
 	type catPair struct {
 		Category string
-		Revenue  float64
+		Revenue  money.Amount
 	}
 	var pairs []catPair
 	for cat, rev := range categoryRevenue {
@@ -399,7 +440,7 @@ func GetShopCategorySales(c *gin.Context) {
 		pairs = pairs[:6]
 	}
 	var labels []string
-	var values []float64
+	var values []money.Amount
 	for _, p := range pairs {
 		labels = append(labels, p.Category)
 		values = append(values, p.Revenue)
@@ -459,25 +500,24 @@ func GetShopDashboardAnalytics(c *gin.Context) {
 	newOrdersToday := 0
 	today := time.Now()
 	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
-	totalRevenue := 0.0
-	revenueToday := 0.0
+	var totalRevenue, revenueToday money.Amount
 	for _, o := range orders {
 		if o.Status == "pending" {
 			pendingOrders++
 		}
 		if o.CreatedAt.After(today) {
-			if o.Status == "paid" || o.Status == "shipped" || o.Status == "delivered" {
+			if services.IsSoldOrder(&o) {
 				newOrdersToday++
-				revenueToday += o.Total
+				revenueToday += o.NetTotal()
 			}
 		}
 	}
 	for _, o := range soldOrders {
-		totalRevenue += o.Total
+		totalRevenue += o.NetTotal()
 	}
-	avgOrderValue := 0.0
+	var avgOrderValue money.Amount
 	if totalOrders > 0 {
-		avgOrderValue = totalRevenue / float64(totalOrders)
+		avgOrderValue = totalRevenue.Part(1, totalOrders, money.HalfUp)
 	}
 
 	totalProducts := len(products)
@@ -572,7 +612,7 @@ func GetShopDashboardAnalytics(c *gin.Context) {
 	// --- Weekly sales (last 7 days, by date) ---
 	days := 7
 	now := time.Now()
-	revenueMap := make(map[string]float64)
+	revenueMap := make(map[string]money.Amount)
 	for i := 0; i < days; i++ {
 		date := now.AddDate(0, 0, -i).Format("2006-01-02")
 		revenueMap[date] = 0
@@ -580,7 +620,7 @@ func GetShopDashboardAnalytics(c *gin.Context) {
 	for _, o := range soldOrders {
 		date := o.CreatedAt.Format("2006-01-02")
 		if _, ok := revenueMap[date]; ok {
-			revenueMap[date] += o.Total
+			revenueMap[date] += o.NetTotal()
 		}
 	}
 	weeklySales := make([]gin.H, 0, days)
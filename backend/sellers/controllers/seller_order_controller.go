@@ -2,6 +2,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"math"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
@@ -37,8 +39,8 @@ func CreateOrder(c *gin.Context) {
 	}
 
 	in.ShopID = shopID
-	in.Status = "pending"     // default status
-	in.CreatedAt = time.Now() // service will override, but good practice
+	in.Status = models.OrderStatusPending // default status
+	in.CreatedAt = time.Now()             // service will override, but good practice
 	in.UpdatedAt = time.Now()
 
 	created, err := services.CreateOrderService(&in)
@@ -77,14 +79,15 @@ func ListOrders(c *gin.Context) {
 		}
 	}
 
-	// Get search parameter
-	searchQuery := c.Query("search")
-
-	// Get status parameter
-	status := c.Query("status")
+	// Get search, status and date range parameters
+	filter, err := orderFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Get paginated orders with customer information
-	orders, total, err := services.ListOrdersByShopPaginatedService(shopHex, page, limit, searchQuery, status)
+	orders, total, err := services.ListOrdersByShopPaginatedService(shopHex, page, limit, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -252,32 +255,318 @@ func GetOrdersForDashboard(c *gin.Context) {
 }
 
 // PATCH  /seller/shops/:shopId/orders/:orderId
+// A "status" key is applied through the order state machine; only address
+// fields may otherwise be changed. Illegal transitions return 409.
 func UpdateOrder(c *gin.Context) {
-	_, _ = c.Get("user_id")
-
-	shopHex := c.Param("shopId")
-	if _, err := primitive.ObjectIDFromHex(shopHex); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shop ID"})
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
 		return
 	}
 
-	// TODO: verify that shop belongs to seller
-
 	var upd bson.M
 	if err := c.ShouldBindJSON(&upd); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	orderID := c.Param("orderId")
-	updated, err := services.UpdateOrderService(orderID, upd)
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+
+	updated, err := services.ApplyOrderUpdateService(order.ID.Hex(), upd, sellerActor(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, updated)
 }
 
+// POST /seller/shops/:shopId/orders/:orderId/approve
+// Releases an order held for risk review so the customer can pay for it. To
+// reject a held order, cancel it.
+func ApproveOrder(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	approved, err := services.ApproveOrderReviewService(order, sellerActor(c))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, approved)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/timeline
+func GetOrderTimeline(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+
+	events, err := services.ListOrderTimelineService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// POST /seller/shops/:shopId/orders/:orderId/notes
+// Body: { "note": "...", "customer_visible": false }
+func AddOrderNote(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Note            string `json:"note" binding:"required"`
+		CustomerVisible bool   `json:"customer_visible"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+
+	event, err := services.AddOrderNoteService(order, sellerActor(c), body.Note, body.CustomerVisible)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, event)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/refunds
+func ListOrderRefunds(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	refunds, err := services.ListOrderRefundsService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, refunds)
+}
+
+// POST /seller/shops/:shopId/orders/:orderId/refunds
+// Body: { "type": "full"|"partial"|"line", "amount": 10.5 (partial), "lines": [ { "product_id", "variant_id", "quantity" } ] (line),
+// "include_shipping": false, "reason": "...", "return_id": "..." (optional) }
+func CreateOrderRefund(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Type   models.RefundType `json:"type" binding:"required"`
+		Amount money.Amount      `json:"amount"`
+		Lines  []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			VariantID string `json:"variant_id"`
+			Quantity  int    `json:"quantity" binding:"required,min=1"`
+		} `json:"lines"`
+		IncludeShipping bool   `json:"include_shipping"`
+		Reason          string `json:"reason"`
+		ReturnID        string `json:"return_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := services.RefundRequest{
+		Type:            body.Type,
+		Amount:          body.Amount,
+		IncludeShipping: body.IncludeShipping,
+		Reason:          body.Reason,
+	}
+	for _, line := range body.Lines {
+		productID, err := primitive.ObjectIDFromHex(line.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID: " + line.ProductID})
+			return
+		}
+		variantID := primitive.NilObjectID
+		if line.VariantID != "" {
+			if variantID, err = primitive.ObjectIDFromHex(line.VariantID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID: " + line.VariantID})
+				return
+			}
+		}
+		req.Lines = append(req.Lines, services.RefundLineRequest{ProductID: productID, VariantID: variantID, Quantity: line.Quantity})
+	}
+	if body.ReturnID != "" {
+		returnID, err := primitive.ObjectIDFromHex(body.ReturnID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid return ID"})
+			return
+		}
+		req.ReturnID = &returnID
+	}
+
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	refund, err := services.IssueRefundService(order, req, sellerActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRefund):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrOrderNotRefundable), errors.Is(err, services.ErrRefundConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, refund)
+}
+
+// GET /seller/shops/:shopId/orders/:orderId/shipments
+func ListOrderShipments(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	shipments, err := services.ListOrderShipmentsService(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shipments)
+}
+
+// POST /seller/shops/:shopId/orders/:orderId/shipments
+// Body: { "carrier": "UPS", "tracking_number": "...", "tracking_url_template": "https://...{tracking_number}",
+// "items": [ { "product_id": "...", "variant_id": "...", "quantity": 1 } ] }
+func CreateOrderShipment(c *gin.Context) {
+	shop, _, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Carrier             string `json:"carrier" binding:"required"`
+		TrackingNumber      string `json:"tracking_number"`
+		TrackingURLTemplate string `json:"tracking_url_template"`
+		Items               []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			VariantID string `json:"variant_id"`
+			Quantity  int    `json:"quantity" binding:"required,min=1"`
+		} `json:"items" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := services.ShipmentRequest{
+		Carrier:             body.Carrier,
+		TrackingNumber:      body.TrackingNumber,
+		TrackingURLTemplate: body.TrackingURLTemplate,
+	}
+	for _, item := range body.Items {
+		productID, err := primitive.ObjectIDFromHex(item.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID: " + item.ProductID})
+			return
+		}
+		variantID := primitive.NilObjectID
+		if item.VariantID != "" {
+			if variantID, err = primitive.ObjectIDFromHex(item.VariantID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID: " + item.VariantID})
+				return
+			}
+		}
+		req.Lines = append(req.Lines, services.ShipmentLine{ProductID: productID, VariantID: variantID, Quantity: item.Quantity})
+	}
+
+	order, ok := getShopOrder(c, shop)
+	if !ok {
+		return
+	}
+	shipment, err := services.CreateShipmentService(shop, order, req, sellerActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidShipment):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrOrderNotShippable), errors.Is(err, services.ErrInvalidOrderTransition),
+			errors.Is(err, services.ErrShipmentConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, shipment)
+}
+
+// getShopOrder loads the :orderId order and checks it belongs to shop,
+// writing a 404 when it does not.
+func getShopOrder(c *gin.Context, shop *models.Shop) (*models.Order, bool) {
+	order, err := services.GetOrderByIDService(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if order == nil || order.ShopID != shop.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return nil, false
+	}
+	return order, true
+}
+
+// sellerActor identifies the authenticated seller for the order timeline.
+func sellerActor(c *gin.Context) models.OrderActor {
+	actor := models.OrderActor{Role: models.OrderActorSeller}
+	if sellerHex, exists := c.Get("user_id"); exists {
+		if s, ok := sellerHex.(string); ok {
+			actor.ID, _ = primitive.ObjectIDFromHex(s)
+		}
+	}
+	return actor
+}
+
+// orderErrorStatus maps an order service failure to an HTTP status code.
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidOrderTransition):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrOrderFieldNotEditable), errors.Is(err, services.ErrOrderStatusDerived):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // DELETE /seller/shops/:shopId/orders/:orderId
 func DeleteOrder(c *gin.Context) {
 	_, _ = c.Get("user_id")
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"github.com/Endale2/DRPS/shared/services"
 	"github.com/gin-gonic/gin"
@@ -24,7 +25,7 @@ type optionInput struct {
 // variantInput represents a single variant with multiple options.
 type variantInput struct {
 	Options []optionInput `json:"options" binding:"required"`
-	Price   float64       `json:"price" binding:"required"`
+	Price   money.Amount  `json:"price" binding:"required"`
 	Stock   int           `json:"stock"`
 	Image   string        `json:"image"`
 }
@@ -36,7 +37,7 @@ type createProductInput struct {
 	MainImage     string         `json:"main_image"` // <-- Added
 	Images        []string       `json:"images" binding:"required"`
 	CollectionIDs []string       `json:"collection_ids" binding:"required"`
-	Price         *float64       `json:"price"`
+	Price         *money.Amount  `json:"price"`
 	Stock         *int           `json:"stock"` // <-- Added
 	Variants      []variantInput `json:"variants"`
 	// SEO fields
@@ -245,10 +246,7 @@ func GetProducts(c *gin.Context) {
 	}
 
 	// Format products for API response
-	apiProducts := make([]map[string]interface{}, 0, len(products))
-	for i := range products {
-		apiProducts = append(apiProducts, services.ProductToAPIResponse(&products[i]))
-	}
+	apiProducts := services.ProductsToAPIResponse(products)
 
 	totalPages := 1
 	if limit > 0 {
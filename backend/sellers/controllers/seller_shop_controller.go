@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"encoding/json"
 	"net/http"
 	"regexp"
 	"strings"
@@ -86,6 +87,12 @@ func CreateShop(c *gin.Context) {
 	if shop.Currency == "" {
 		shop.Currency = "USD"
 	}
+	currency, err := shopService.ValidateShopCurrency(shop.Currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shop.Currency = currency
 
 	if shop.Status == "" {
 		shop.Status = "inactive"
@@ -202,6 +209,87 @@ func UpdateShop(c *gin.Context) {
 		}
 	}
 
+	if raw, exists := updates["currency"]; exists {
+		code, _ := raw.(string)
+		currency, err := shopService.ValidateShopCurrency(code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["currency"] = currency
+	}
+
+	if raw, exists := updates["orderNumbering"]; exists && raw != nil {
+		var format models.OrderNumberFormat
+		b, _ := json.Marshal(raw)
+		if err := json.Unmarshal(b, &format); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid orderNumbering"})
+			return
+		}
+		if err := shopService.ValidateOrderNumberFormat(format); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["orderNumbering"] = format
+	}
+
+	if raw, exists := updates["customerCancelWindowHours"]; exists && raw != nil {
+		hours, ok := raw.(float64)
+		if !ok || hours < 0 || hours != float64(int(hours)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "customerCancelWindowHours must be a whole number of hours, 0 or more"})
+			return
+		}
+		updates["customerCancelWindowHours"] = int(hours)
+	}
+
+	if raw, exists := updates["riskReviewThreshold"]; exists && raw != nil {
+		threshold, ok := raw.(float64)
+		if !ok || threshold != float64(int(threshold)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "riskReviewThreshold must be a whole number"})
+			return
+		}
+		if err := shopService.ValidateRiskReviewThreshold(int(threshold)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["riskReviewThreshold"] = int(threshold)
+	}
+
+	if raw, exists := updates["cartRecovery"]; exists && raw != nil {
+		var settings models.CartRecoverySettings
+		b, _ := json.Marshal(raw)
+		if err := json.Unmarshal(b, &settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cartRecovery"})
+			return
+		}
+		if err := shopService.ValidateCartRecoverySettings(settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["cartRecovery"] = settings
+	}
+
+	if raw, exists := updates["pricesIncludeTax"]; exists {
+		if _, ok := raw.(bool); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pricesIncludeTax must be true or false"})
+			return
+		}
+	}
+
+	if raw, exists := updates["paymentMethods"]; exists && raw != nil {
+		var methods []string
+		b, _ := json.Marshal(raw)
+		if err := json.Unmarshal(b, &methods); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paymentMethods must be a list of provider names"})
+			return
+		}
+		if err := shopService.ValidateShopPaymentMethods(methods); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["paymentMethods"] = methods
+	}
+
 	res, err := shopService.UpdateShopService(shopID, updates)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /seller/shops/:shopId/shipping-zones
+func ListShippingZones(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	zones, err := services.ListShippingZonesService(shopID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, zones)
+}
+
+// POST /seller/shops/:shopId/shipping-zones
+// Body: { "name": "Domestic", "countries": ["US"], "regions": ["CA"], "methods": [ ... ] }
+// Method: { "name": "Standard", "type": "flat" | "weight" | "price" | "free_over", "rate": 5, "tiers": [ { "min": 0, "max": 2, "rate": 5 } ], "free_over": 50 }
+func CreateShippingZone(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var zone models.ShippingZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	created, err := services.CreateShippingZoneService(shopID, &zone)
+	if err != nil {
+		c.JSON(shippingZoneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GET /seller/shops/:shopId/shipping-zones/:zoneId
+func GetShippingZone(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	zone, err := services.GetShippingZoneService(shopID, c.Param("zoneId"))
+	if err != nil {
+		c.JSON(shippingZoneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, zone)
+}
+
+// PUT /seller/shops/:shopId/shipping-zones/:zoneId
+// Body: the full zone, as for create. Send methods back with their IDs to keep them.
+func UpdateShippingZone(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var zone models.ShippingZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updated, err := services.UpdateShippingZoneService(shopID, c.Param("zoneId"), &zone)
+	if err != nil {
+		c.JSON(shippingZoneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DELETE /seller/shops/:shopId/shipping-zones/:zoneId
+func DeleteShippingZone(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	if err := services.DeleteShippingZoneService(shopID, c.Param("zoneId")); err != nil {
+		c.JSON(shippingZoneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "shipping zone deleted"})
+}
+
+// shippingZoneErrorStatus maps a shipping zone failure to an HTTP status code.
+func shippingZoneErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidShippingZone):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrShippingZoneNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /seller/shops/:shopId/tax-regions
+func ListTaxRegions(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	regions, err := services.ListTaxRegionsService(shopID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, regions)
+}
+
+// POST /seller/shops/:shopId/tax-regions
+// Body: { "name": "California", "country": "US", "region": "CA", "rate": 0.0725,
+// "class_rates": { "reduced": 0.02 }, "tax_shipping": false }
+func CreateTaxRegion(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var region models.TaxRegion
+	if err := c.ShouldBindJSON(&region); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	created, err := services.CreateTaxRegionService(shopID, &region)
+	if err != nil {
+		c.JSON(taxRegionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GET /seller/shops/:shopId/tax-regions/:regionId
+func GetTaxRegion(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	region, err := services.GetTaxRegionService(shopID, c.Param("regionId"))
+	if err != nil {
+		c.JSON(taxRegionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, region)
+}
+
+// PUT /seller/shops/:shopId/tax-regions/:regionId
+// Body: the full region, as for create.
+func UpdateTaxRegion(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	var region models.TaxRegion
+	if err := c.ShouldBindJSON(&region); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updated, err := services.UpdateTaxRegionService(shopID, c.Param("regionId"), &region)
+	if err != nil {
+		c.JSON(taxRegionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DELETE /seller/shops/:shopId/tax-regions/:regionId
+func DeleteTaxRegion(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	if err := services.DeleteTaxRegionService(shopID, c.Param("regionId")); err != nil {
+		c.JSON(taxRegionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "tax region deleted"})
+}
+
+// taxRegionErrorStatus maps a tax region failure to an HTTP status code.
+func taxRegionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTaxRegion):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTaxRegionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /seller/shops/:shopId/analytics/tax-liability?from=2024-01-01&to=2024-04-01
+// from is inclusive and to exclusive, both UTC dates; the default is the
+// current calendar month.
+func GetShopTaxLiability(c *gin.Context) {
+	_, shopID, ok := getShopAndVerifySeller(c)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date like 2024-01-31"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date like 2024-01-31"})
+			return
+		}
+		to = t
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+
+	report, err := services.TaxLiabilityReportService(shopID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -9,7 +9,7 @@ import (
 func SellerRoute(r *gin.Engine) {
 	// 1) Root seller group, with auth
 	sellerGroup := r.Group("/seller")
-	sellerGroup.Use(middlewares.AuthMiddleware())
+	sellerGroup.Use(middlewares.AuthMiddleware(), middlewares.IdempotencyMiddleware())
 
 	// 2) /seller/shops  — list & create
 	sellerGroup.POST("/shops", controllers.CreateShop)
@@ -108,12 +108,90 @@ func SellerRoute(r *gin.Engine) {
 			orders.GET("", controllers.ListOrders)
 			orders.GET("/dashboard", controllers.GetOrdersForDashboard)
 			orders.GET("/stats", controllers.GetOrderStats)
+			orders.GET("/packing-slips.pdf", controllers.GetPackingSlipsPDF)
+			orders.GET("/export", controllers.ExportOrders)
+			orders.POST("/bulk/status", controllers.BulkUpdateOrderStatus)
+			orders.POST("/bulk/fulfill", controllers.BulkFulfillOrders)
 			orders.GET("/:orderId", controllers.GetOrder)
 			orders.GET("/:orderId/details", controllers.GetOrderWithCustomerDetails)
+			orders.GET("/:orderId/invoice.pdf", controllers.GetOrderInvoicePDF)
+			orders.GET("/:orderId/packing-slip.pdf", controllers.GetOrderPackingSlipPDF)
 			orders.PATCH("/:orderId", controllers.UpdateOrder)
+			orders.POST("/:orderId/approve", controllers.ApproveOrder)
+			orders.GET("/:orderId/timeline", controllers.GetOrderTimeline)
+			orders.POST("/:orderId/notes", controllers.AddOrderNote)
+			orders.GET("/:orderId/refunds", controllers.ListOrderRefunds)
+			orders.POST("/:orderId/refunds", controllers.CreateOrderRefund)
+			orders.GET("/:orderId/shipments", controllers.ListOrderShipments)
+			orders.POST("/:orderId/shipments", controllers.CreateOrderShipment)
+			orders.GET("/:orderId/payments", controllers.ListOrderPayments)
+			orders.POST("/:orderId/payments/capture", controllers.CaptureOrderPayment)
+			orders.POST("/:orderId/edits", controllers.BeginOrderEdit)
+			orders.GET("/:orderId/edits", controllers.ListOrderEdits)
+			orders.GET("/:orderId/edits/:editId", controllers.GetOrderEdit)
+			orders.PUT("/:orderId/edits/:editId", controllers.StageOrderEdit)
+			orders.POST("/:orderId/edits/:editId/commit", controllers.CommitOrderEdit)
+			orders.DELETE("/:orderId/edits/:editId", controllers.DiscardOrderEdit)
 			orders.DELETE("/:orderId", controllers.DeleteOrder)
 		}
 
+		// draft orders, paid by the customer through a signed checkout link
+		draftGroup := shopGroup.Group("/draft-orders")
+		{
+			draftGroup.GET("", controllers.ListDraftOrders)
+			draftGroup.POST("", controllers.CreateDraftOrder)
+			draftGroup.GET("/:draftId", controllers.GetDraftOrder)
+			draftGroup.PUT("/:draftId", controllers.UpdateDraftOrder)
+			draftGroup.DELETE("/:draftId", controllers.DeleteDraftOrder)
+			draftGroup.POST("/:draftId/send", controllers.SendDraftOrderLink)
+		}
+
+		// shipping zones and their rate methods
+		shippingGroup := shopGroup.Group("/shipping-zones")
+		{
+			shippingGroup.GET("", controllers.ListShippingZones)
+			shippingGroup.POST("", controllers.CreateShippingZone)
+			shippingGroup.GET("/:zoneId", controllers.GetShippingZone)
+			shippingGroup.PUT("/:zoneId", controllers.UpdateShippingZone)
+			shippingGroup.DELETE("/:zoneId", controllers.DeleteShippingZone)
+		}
+
+		// tax regions and their rates
+		taxGroup := shopGroup.Group("/tax-regions")
+		{
+			taxGroup.GET("", controllers.ListTaxRegions)
+			taxGroup.POST("", controllers.CreateTaxRegion)
+			taxGroup.GET("/:regionId", controllers.GetTaxRegion)
+			taxGroup.PUT("/:regionId", controllers.UpdateTaxRegion)
+			taxGroup.DELETE("/:regionId", controllers.DeleteTaxRegion)
+		}
+
+		// presentment currencies and the shop's own exchange rates
+		currencyGroup := shopGroup.Group("/currencies")
+		{
+			currencyGroup.GET("", controllers.GetShopCurrencies)
+			currencyGroup.PUT("", controllers.SetShopCurrencies)
+			currencyGroup.PUT("/:currency/rate", controllers.SetShopExchangeRate)
+			currencyGroup.DELETE("/:currency/rate", controllers.DeleteShopExchangeRate)
+		}
+
+		// returns (RMA)
+		returnsGroup := shopGroup.Group("/returns")
+		{
+			returnsGroup.GET("", controllers.ListReturns)
+			returnsGroup.GET("/:returnId", controllers.GetReturn)
+			returnsGroup.POST("/:returnId/approve", controllers.ApproveReturn)
+			returnsGroup.POST("/:returnId/reject", controllers.RejectReturn)
+			returnsGroup.POST("/:returnId/receive", controllers.ReceiveReturn)
+		}
+
+		// notifications
+		notifGroup := shopGroup.Group("/notifications")
+		{
+			notifGroup.GET("", controllers.ListNotifications)
+			notifGroup.POST("/:notificationId/read", controllers.MarkNotificationRead)
+		}
+
 		// ─────  Analytics endpoints ─────
 		analyticsGroup := shopGroup.Group("/analytics")
 		{
@@ -127,6 +205,9 @@ func SellerRoute(r *gin.Engine) {
 			analyticsGroup.GET("/customers-over-time", controllers.GetShopCustomersOverTime)
 			analyticsGroup.GET("/category-sales", controllers.GetShopCategorySales)
 			analyticsGroup.GET("/recent-orders", controllers.GetShopRecentOrders)
+			analyticsGroup.GET("/returns", controllers.GetShopReturnMetrics)
+			analyticsGroup.GET("/cart-recovery", controllers.GetShopCartRecoveryMetrics)
+			analyticsGroup.GET("/tax-liability", controllers.GetShopTaxLiability)
 			analyticsGroup.GET("/dashboard", controllers.GetShopDashboardAnalytics) // NEW ENDPOINT
 		}
 
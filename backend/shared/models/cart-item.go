@@ -1,8 +1,7 @@
 package models
 
 import (
-	
-
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -15,12 +14,14 @@ type CartItem struct {
 	VariantOptions map[string]string `bson:"variant_options" json:"variant_options"` // snapshot
 	Image      string              `bson:"image,omitempty" json:"image,omitempty"`   // primary image or variant image
 
-	UnitPrice  float64           `bson:"unit_price" json:"unit_price"` // pre-discount
+	UnitPrice  money.Amount          `bson:"unit_price" json:"unit_price"` // pre-discount
+	AddedPrice *money.Amount         `bson:"added_price,omitempty" json:"added_price,omitempty"` // UnitPrice when added, or when the customer last acknowledged a change; nil until recorded
 	Quantity   int               `bson:"quantity" json:"quantity"`
-	LineTotal  float64           `bson:"line_total" json:"line_total"` // UnitPrice * Quantity (before discounts)
+	LineTotal  money.Amount          `bson:"line_total" json:"line_total"` // UnitPrice * Quantity (before discounts)
 
-	DiscountAmount float64       `bson:"discount_amount,omitempty" json:"discount_amount,omitempty"` // optional line discount
-	FinalLineTotal float64       `bson:"final_line_total" json:"final_line_total"` // LineTotal - DiscountAmount
+	DiscountAmount money.Amount      `bson:"discount_amount,omitempty" json:"discount_amount,omitempty"` // optional line discount
+	FinalLineTotal money.Amount      `bson:"final_line_total" json:"final_line_total"` // LineTotal - DiscountAmount
+	TaxAmount      money.Amount      `bson:"tax_amount,omitempty" json:"tax_amount,omitempty"` // tax on FinalLineTotal
 
 	AppliedDiscountIDs []primitive.ObjectID `bson:"applied_discount_ids,omitempty" json:"applied_discount_ids,omitempty"`
 }
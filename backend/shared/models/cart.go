@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,15 +15,35 @@ type Cart struct {
 	ShopID         primitive.ObjectID   `bson:"shop_id" json:"shop_id"`
 	Items          []CartItem           `bson:"items" json:"items"`
 
-	Subtotal       float64              `bson:"subtotal" json:"subtotal"` // sum of item LineTotals (before discounts)
-	TotalDiscounts float64              `bson:"total_discounts" json:"total_discounts"` // sum of all discounts (order + item)
-	ShippingCost   float64              `bson:"shipping_cost,omitempty" json:"shipping_cost,omitempty"` // calculated separately
-	TaxAmount      float64              `bson:"tax_amount,omitempty" json:"tax_amount,omitempty"`       // calculated separately
-	GrandTotal     float64              `bson:"grand_total" json:"grand_total"` // Subtotal - Discounts + Shipping + Tax
+	Subtotal       money.Amount             `bson:"subtotal" json:"subtotal"` // sum of item LineTotals (before discounts)
+	TotalDiscounts money.Amount             `bson:"total_discounts" json:"total_discounts"` // sum of all discounts (order + item)
+	ShippingCost   money.Amount             `bson:"shipping_cost,omitempty" json:"shipping_cost,omitempty"` // calculated separately
+	TaxAmount      money.Amount             `bson:"tax_amount,omitempty" json:"tax_amount,omitempty"`       // calculated separately
+	GrandTotal     money.Amount             `bson:"grand_total" json:"grand_total"` // Subtotal - Discounts + Shipping + Tax
+	TaxIncluded    bool                 `bson:"tax_included,omitempty" json:"tax_included,omitempty"` // TaxAmount is already in the prices
 
 	AppliedDiscountIDs []primitive.ObjectID `bson:"applied_discount_ids,omitempty" json:"applied_discount_ids,omitempty"` // for order-wide or shipping discounts
 
-	Currency       string               `bson:"currency" json:"currency"` // e.g., "USD"
+	// Shipping: address chosen by the customer, methods available to it, and the pick
+	ShippingAddress  map[string]interface{} `bson:"shipping_address,omitempty" json:"shipping_address,omitempty"`
+	ShippingOptions  []ShippingQuote        `bson:"shipping_options,omitempty" json:"shipping_options,omitempty"`
+	ShippingMethodID string                 `bson:"shipping_method_id,omitempty" json:"shipping_method_id,omitempty"`
+
+	Warnings       []CartWarning        `bson:"warnings" json:"warnings,omitempty"` // changes the customer has yet to acknowledge
+
+	Currency       string               `bson:"currency" json:"currency"` // the currency the customer shops in, e.g. "EUR"
+	Presentment    *Presentment         `bson:"presentment,omitempty" json:"presentment,omitempty"` // the cart in Currency; the amounts above are in the shop's currency
 	LastUpdated    time.Time            `bson:"last_updated" json:"last_updated"`
+	CustomerActivityAt time.Time        `bson:"customer_activity_at,omitempty" json:"-"` // when the customer last changed the cart; re-pricing and reads do not count
+	RecoveryEmailedAt *time.Time        `bson:"recovery_emailed_at,omitempty" json:"-"` // when a recovery email was last sent for the cart
 	CreatedAt      time.Time            `bson:"created_at,omitempty" json:"created_at,omitempty"`
 }
+
+// LastActivity is when the customer last changed the cart. Carts saved before
+// that was recorded fall back to when they were last written.
+func (c *Cart) LastActivity() time.Time {
+	if c.CustomerActivityAt.IsZero() {
+		return c.LastUpdated
+	}
+	return c.CustomerActivityAt
+}
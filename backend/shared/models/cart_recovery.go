@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CartRecoverySettings controls the emails sent to customers who leave items
+// in their cart without placing an order.
+type CartRecoverySettings struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// AbandonedAfterHours is how long a cart must go untouched to count as abandoned
+	AbandonedAfterHours int `bson:"abandonedAfterHours" json:"abandonedAfterHours"`
+	// DiscountPercent, if set, is taken off the cart's products for the
+	// customer emailed, for DiscountValidHours after the email is sent
+	DiscountPercent    float64 `bson:"discountPercent,omitempty" json:"discountPercent,omitempty"`
+	DiscountValidHours int     `bson:"discountValidHours,omitempty" json:"discountValidHours,omitempty"`
+}
+
+// DefaultCartRecovery applies when a shop has not set its own cart recovery
+// settings: an email a day after the cart was last touched, with no discount.
+var DefaultCartRecovery = CartRecoverySettings{Enabled: true, AbandonedAfterHours: 24, DiscountValidHours: 48}
+
+// CartRecovery records a recovery email sent for an abandoned cart and, once
+// the customer orders from the shop again, the order it recovered.
+type CartRecovery struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID     primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	CartID     primitive.ObjectID `bson:"cart_id" json:"cart_id"`
+	CustomerID primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	Email      string             `bson:"email" json:"email"`
+	// CartTotal is the cart's grand total, in the shop's currency, when emailed
+	CartTotal money.Amount `bson:"cart_total" json:"cart_total"`
+
+	// The discount offered in the email, if any
+	DiscountID        primitive.ObjectID `bson:"discount_id,omitempty" json:"discount_id,omitempty"`
+	DiscountCode      string             `bson:"discount_code,omitempty" json:"discount_code,omitempty"`
+	DiscountExpiresAt *time.Time         `bson:"discount_expires_at,omitempty" json:"discount_expires_at,omitempty"`
+
+	SentAt time.Time `bson:"sent_at" json:"sent_at"`
+
+	// Set when the customer places an order after the email
+	RecoveredAt *time.Time         `bson:"recovered_at,omitempty" json:"recovered_at,omitempty"`
+	OrderID     primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderTotal  money.Amount       `bson:"order_total,omitempty" json:"order_total,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Reasons for a cart warning.
+const (
+	CartWarningPriceChanged    = "price_changed"    // the line costs more or less than when it was added
+	CartWarningOutOfStock      = "out_of_stock"     // the line was removed, none is left to sell
+	CartWarningQuantityReduced = "quantity_reduced" // the line was cut down to the stock left
+	CartWarningProductDeleted  = "product_deleted"  // the line was removed with its product
+	CartWarningVariantRemoved  = "variant_removed"  // the line was removed with its variant
+	CartWarningDiscountExpired = "discount_expired" // a discount the line had no longer applies
+	CartWarningShippingChanged = "shipping_changed" // the chosen shipping method's price moved, or it is no longer offered
+	CartWarningTaxChanged      = "tax_changed"
+)
+
+// CartWarning tells the customer about a change to their cart they did not
+// make themselves. Warnings stay on the cart until the customer acknowledges
+// them, and checkout refuses a cart that still has any. Shipping and tax
+// warnings have no product.
+type CartWarning struct {
+	ProductID primitive.ObjectID `bson:"product_id,omitempty" json:"product_id"`
+	VariantID primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Name      string             `bson:"name,omitempty" json:"name"`
+	Reason    string             `bson:"reason" json:"reason"`
+	Before    float64            `bson:"before" json:"before"` // a quantity, or an amount in the shop's currency units
+	After     float64            `bson:"after" json:"after"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultShopCurrency is the currency of shops that have not set their own.
+const DefaultShopCurrency = "USD"
+
+// Where an exchange rate came from.
+const (
+	ExchangeRateSourceFile   = "file"
+	ExchangeRateSourceAPI    = "api"
+	ExchangeRateSourceManual = "manual" // a shop's own override
+)
+
+// ExchangeRate is how many units of Quote one unit of Base buys. Rates
+// without a shop apply to every shop; a shop's own rate for a pair wins over
+// them.
+type ExchangeRate struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ShopID    *primitive.ObjectID `bson:"shop_id" json:"shop_id,omitempty"`
+	Base      string              `bson:"base" json:"base"`
+	Quote     string              `bson:"quote" json:"quote"`
+	Rate      float64             `bson:"rate" json:"rate"`
+	Source    string              `bson:"source" json:"source"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// PriceRounding is how converted prices are rounded in a presentment
+// currency, so they look like prices set in it.
+type PriceRounding string
+
+const (
+	PriceRoundingNone  PriceRounding = ""      // to the currency's smallest unit
+	PriceRoundingWhole PriceRounding = "whole" // up to a whole unit: 12.30 → 13.00
+	PriceRoundingCharm PriceRounding = "charm" // up to a whole unit, less one cent: 12.30 → 12.99
+)
+
+// PresentmentCurrency is a currency, other than the shop's own, customers may
+// shop in.
+type PresentmentCurrency struct {
+	Currency string        `bson:"currency" json:"currency"`
+	Rounding PriceRounding `bson:"rounding,omitempty" json:"rounding,omitempty"`
+}
+
+// PresentmentLine is one cart or order line in the presentment currency.
+type PresentmentLine struct {
+	UnitPrice      money.Amount `bson:"unit_price" json:"unit_price"`
+	LineTotal      money.Amount `bson:"line_total" json:"line_total"` // UnitPrice × quantity, before discounts
+	DiscountAmount money.Amount `bson:"discount_amount,omitempty" json:"discount_amount,omitempty"`
+	TaxAmount      money.Amount `bson:"tax_amount,omitempty" json:"tax_amount,omitempty"`
+}
+
+// Presentment is a cart or order priced in the currency the customer shops
+// in, converted from the shop currency at ExchangeRate. The shop-currency
+// amounts stay authoritative: they are what is charged, refunded and
+// reported. Items line up with the cart's or order's items.
+type Presentment struct {
+	Currency      string            `bson:"currency" json:"currency"`
+	ExchangeRate  float64           `bson:"exchange_rate" json:"exchange_rate"`
+	Items         []PresentmentLine `bson:"items" json:"items"`
+	Subtotal      money.Amount      `bson:"subtotal" json:"subtotal"`
+	DiscountTotal money.Amount      `bson:"discount_total" json:"discount_total"`
+	ShippingCost  money.Amount      `bson:"shipping_cost" json:"shipping_cost"`
+	TaxAmount     money.Amount      `bson:"tax_amount" json:"tax_amount"`
+	Total         money.Amount      `bson:"total" json:"total"`
+}
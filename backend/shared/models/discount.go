@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -40,7 +41,7 @@ type DiscountUsage struct {
 	CustomerID primitive.ObjectID `bson:"customer_id" json:"customer_id"`
 	UsageCount int                `bson:"usage_count" json:"usage_count"`
 	LastUsedAt time.Time          `bson:"last_used_at" json:"last_used_at"`
-	TotalSpent float64            `bson:"total_spent" json:"total_spent"`
+	TotalSpent money.Amount       `bson:"total_spent" json:"total_spent"`
 }
 
 type Discount struct {
@@ -57,6 +58,10 @@ type Discount struct {
 	ShopID   primitive.ObjectID `bson:"shop_id" json:"shop_id"`
 	SellerID primitive.ObjectID `bson:"seller_id" json:"seller_id"`
 
+	// Code names the discount to customers, e.g. in a cart recovery email.
+	// Discounts apply automatically to eligible customers, so it is never entered.
+	Code string `bson:"code,omitempty" json:"code,omitempty"`
+
 	// Product-level targets only
 	AppliesToProducts []primitive.ObjectID `bson:"applies_to_products,omitempty"    json:"applies_to_products,omitempty"`
 	AppliesToVariants []primitive.ObjectID `bson:"applies_to_variants,omitempty"    json:"applies_to_variants,omitempty"`
@@ -166,7 +171,7 @@ func (d *Discount) CanUse(customerID primitive.ObjectID) bool {
 }
 
 // RecordUsage records a usage of this discount by a customer
-func (d *Discount) RecordUsage(customerID primitive.ObjectID, amount float64) {
+func (d *Discount) RecordUsage(customerID primitive.ObjectID, amount money.Amount) {
 	d.CurrentUsage++
 	now := time.Now()
 
@@ -243,18 +248,16 @@ func (d *Discount) AppliesToVariant(variantID primitive.ObjectID) bool {
 	return false
 }
 
-// CalculateDiscount calculates the discount amount for a given price
-func (d *Discount) CalculateDiscount(price float64) float64 {
+// CalculateDiscount calculates the discount amount for a given price.
+// Percentages are rounded half up to whole minor units.
+func (d *Discount) CalculateDiscount(price money.Amount) money.Amount {
 	switch d.Type {
 	case DiscountTypeFixed:
 		// For fixed amount discounts, apply the discount amount directly
 		// This represents a fixed amount off the total price
-		if d.Value > price {
-			return price
-		}
-		return d.Value
+		return money.Min(d.FixedAmount(), price)
 	case DiscountTypePercentage:
-		return price * (d.Value / 100)
+		return price.Percent(d.Value, money.HalfUp)
 	default:
 		return 0
 	}
@@ -262,24 +265,25 @@ func (d *Discount) CalculateDiscount(price float64) float64 {
 
 // CalculateDiscountForQuantity calculates the discount amount for a given price and quantity
 // This is useful for fixed amount discounts that should be applied per unit
-func (d *Discount) CalculateDiscountForQuantity(unitPrice float64, quantity int) float64 {
+func (d *Discount) CalculateDiscountForQuantity(unitPrice money.Amount, quantity int) money.Amount {
 	switch d.Type {
 	case DiscountTypeFixed:
 		// For fixed amount discounts, apply per unit
-		discountPerUnit := d.Value
-		if discountPerUnit > unitPrice {
-			discountPerUnit = unitPrice
-		}
-		return discountPerUnit * float64(quantity)
+		return money.Min(d.FixedAmount(), unitPrice).Mul(quantity)
 	case DiscountTypePercentage:
 		// For percentage discounts, apply to the total line price
-		totalPrice := unitPrice * float64(quantity)
-		return totalPrice * (d.Value / 100)
+		return unitPrice.Mul(quantity).Percent(d.Value, money.HalfUp)
 	default:
 		return 0
 	}
 }
 
+// FixedAmount is Value as an amount off, for fixed discounts. Value stays a
+// plain number because percentage discounts use it too.
+func (d *Discount) FixedAmount() money.Amount {
+	return money.FromFloat(d.Value, money.HalfUp)
+}
+
 // Validate checks if the discount configuration is valid
 func (d *Discount) Validate() error {
 	if d.Name == "" {
@@ -317,7 +321,7 @@ func (d *Discount) GetUsageCountForCustomer(customerID primitive.ObjectID) int {
 }
 
 // GetTotalSpentByCustomer returns the total amount spent by a customer using this discount
-func (d *Discount) GetTotalSpentByCustomer(customerID primitive.ObjectID) float64 {
+func (d *Discount) GetTotalSpentByCustomer(customerID primitive.ObjectID) money.Amount {
 	for _, usage := range d.UsageTracking {
 		if usage.CustomerID == customerID {
 			return usage.TotalSpent
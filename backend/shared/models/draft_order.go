@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DraftOrderStatus is where a draft order is in its life: open while the
+// seller edits it and the customer has yet to pay, completed once paying its
+// checkout link turned it into an order.
+type DraftOrderStatus string
+
+const (
+	DraftOrderStatusOpen      DraftOrderStatus = "open"
+	DraftOrderStatusCompleted DraftOrderStatus = "completed"
+)
+
+// DraftDiscountType is how a seller's manual discount is expressed.
+type DraftDiscountType string
+
+const (
+	DraftDiscountPercentage DraftDiscountType = "percentage" // Value is a percentage, e.g. 10
+	DraftDiscountFixed      DraftDiscountType = "fixed"      // Value is an amount off
+)
+
+// DraftDiscount is a discount the seller grants by hand on a draft order or
+// one of its lines. It applies after any automatic discounts.
+type DraftDiscount struct {
+	Type   DraftDiscountType `bson:"type" json:"type"`
+	Value  float64           `bson:"value" json:"value"`
+	Reason string            `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// DraftOrderLine is what the seller put on a draft: either a product (and
+// variant) from the shop, or, with no ProductID, a custom item the seller
+// names and prices.
+type DraftOrderLine struct {
+	ProductID primitive.ObjectID `bson:"product_id,omitempty" json:"product_id,omitempty"`
+	VariantID primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+
+	// Custom items only
+	Name      string       `bson:"name,omitempty" json:"name,omitempty"`
+	UnitPrice money.Amount `bson:"unit_price,omitempty" json:"unit_price,omitempty"`
+	TaxClass  string       `bson:"tax_class,omitempty" json:"tax_class,omitempty"`
+
+	Discount *DraftDiscount `bson:"discount,omitempty" json:"discount,omitempty"`
+}
+
+// DraftOrder is an order a seller builds on the customer's behalf, e.g. for a
+// phone or social-media sale, and sends to the customer as a checkout link.
+// The priced fields are worked out the same way checkout prices an order and
+// are refreshed whenever the draft changes or its link is opened.
+type DraftOrder struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID     primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	CustomerID primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	Number     string             `bson:"number" json:"number"`
+	Status     DraftOrderStatus   `bson:"status" json:"status"`
+	Note       string             `bson:"note,omitempty" json:"note,omitempty"`
+
+	// What the seller entered
+	Lines            []DraftOrderLine       `bson:"lines" json:"lines"`
+	Discount         *DraftDiscount         `bson:"discount,omitempty" json:"discount,omitempty"`
+	ShippingAddress  map[string]interface{} `bson:"shipping_address,omitempty" json:"shipping_address,omitempty"`
+	ShippingMethodID string                 `bson:"shipping_method_id,omitempty" json:"shipping_method_id,omitempty"`
+
+	// Pricing
+	Items           []OrderItem     `bson:"items" json:"items"`
+	Subtotal        money.Amount    `bson:"subtotal" json:"subtotal"`
+	DiscountTotal   money.Amount    `bson:"discount_total" json:"discount_total"`
+	ShippingOptions []ShippingQuote `bson:"shipping_options,omitempty" json:"shipping_options,omitempty"`
+	ShippingMethod  *ShippingQuote  `bson:"shipping_method,omitempty" json:"shipping_method,omitempty"`
+	ShippingCost    money.Amount    `bson:"shipping_cost" json:"shipping_cost"`
+	TaxAmount       money.Amount    `bson:"tax_amount" json:"tax_amount"`
+	Tax             *OrderTax       `bson:"tax,omitempty" json:"tax,omitempty"`
+	Total           money.Amount    `bson:"total" json:"total"`
+
+	// LinkNonce is signed into the checkout link; replacing it revokes links
+	// sent earlier
+	LinkNonce     string     `bson:"link_nonce,omitempty" json:"-"`
+	LinkExpiresAt *time.Time `bson:"link_expires_at,omitempty" json:"link_expires_at,omitempty"`
+
+	// OrderID is the order the draft became
+	OrderID     primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	CompletedAt *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdempotencyKeyStatus tracks whether the first request for a key has finished.
+type IdempotencyKeyStatus string
+
+const (
+	IdempotencyKeyInProgress IdempotencyKeyStatus = "in_progress"
+	IdempotencyKeyCompleted  IdempotencyKeyStatus = "completed"
+)
+
+// IdempotencyKey records the first request made with an Idempotency-Key header
+// and the response it produced, so a retry can be answered with the same
+// response instead of being executed again.
+type IdempotencyKey struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// Scope is who sent the key and to which endpoint, so keys from different
+	// users or endpoints never collide.
+	Scope       string               `bson:"scope" json:"scope"`
+	Key         string               `bson:"key" json:"key"`
+	RequestHash string               `bson:"request_hash" json:"request_hash"`
+	Status      IdempotencyKeyStatus `bson:"status" json:"status"`
+
+	ResponseStatus      int    `bson:"response_status,omitempty" json:"response_status,omitempty"`
+	ResponseContentType string `bson:"response_content_type,omitempty" json:"response_content_type,omitempty"`
+	ResponseBody        []byte `bson:"response_body,omitempty" json:"-"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
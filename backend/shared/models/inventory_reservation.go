@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReservationStatus is the lifecycle state of an inventory hold.
+type ReservationStatus string
+
+const (
+	ReservationStatusActive    ReservationStatus = "active"    // holding stock until ExpiresAt
+	ReservationStatusConverted ReservationStatus = "converted" // turned into a permanent decrement by an order
+	ReservationStatusReleased  ReservationStatus = "released"  // given back before expiry (cart cleared, re-reserved)
+)
+
+// InventoryReservation is a time-limited hold on product or variant stock placed
+// while a customer checks out. Expired active holds no longer count against
+// available stock and are removed by a TTL index.
+type InventoryReservation struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ShopID     primitive.ObjectID  `bson:"shop_id" json:"shop_id"`
+	CartID     primitive.ObjectID  `bson:"cart_id" json:"cart_id"`
+	CustomerID *primitive.ObjectID `bson:"customer_id,omitempty" json:"customer_id,omitempty"`
+	ProductID  primitive.ObjectID  `bson:"product_id" json:"product_id"`
+	VariantID  primitive.ObjectID  `bson:"variant_id" json:"variant_id,omitempty"`
+	Quantity   int                 `bson:"quantity" json:"quantity"`
+	Status     ReservationStatus   `bson:"status" json:"status"`
+	OrderID    primitive.ObjectID  `bson:"order_id,omitempty" json:"order_id,omitempty"`
+
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationType says what a notification is about.
+type NotificationType string
+
+const (
+	NotificationOrderCancelled  NotificationType = "order_cancelled"
+	NotificationReturnRequested NotificationType = "return_requested"
+	NotificationOrderShipped    NotificationType = "order_shipped"
+	NotificationDraftOrderLink  NotificationType = "draft_order_link"
+	NotificationOrderHeld       NotificationType = "order_held"
+)
+
+// Notification is a message for a seller (about their shop) or a customer.
+// It is stored so it can be listed in the dashboard, and also handed to the
+// configured Notifier for delivery.
+type Notification struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// RecipientRole is the same vocabulary as order actors: seller or customer.
+	RecipientRole OrderActorRole     `bson:"recipient_role" json:"recipient_role"`
+	RecipientID   primitive.ObjectID `bson:"recipient_id" json:"recipient_id"`
+	ShopID        primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	OrderID       primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Type          NotificationType   `bson:"type" json:"type"`
+	Title         string             `bson:"title" json:"title"`
+	Message       string             `bson:"message" json:"message"`
+	ReadAt        *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
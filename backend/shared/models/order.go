@@ -4,18 +4,60 @@ package models
 import (
 	"time"
 
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// OrderStatus is the lifecycle state of an order. Changes go through the
+// order state machine in the services layer, never through raw updates.
+type OrderStatus string
+
+const (
+	OrderStatusReview            OrderStatus = "review"
+	OrderStatusPending           OrderStatus = "pending"
+	OrderStatusPaid              OrderStatus = "paid"
+	OrderStatusProcessing        OrderStatus = "processing"
+	OrderStatusPartiallyShipped  OrderStatus = "partially_shipped"
+	OrderStatusShipped           OrderStatus = "shipped"
+	OrderStatusDelivered         OrderStatus = "delivered"
+	OrderStatusCancelled         OrderStatus = "cancelled"
+	OrderStatusRefunded          OrderStatus = "refunded"
+	OrderStatusPartiallyRefunded OrderStatus = "partially_refunded"
+)
+
+// Payment statuses recorded on an order.
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusPaid              = "paid"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
 // OrderItem represents a line in an order.
 type OrderItem struct {
 	ProductID  primitive.ObjectID `bson:"product_id"   json:"product_id"`
 	VariantID  primitive.ObjectID `bson:"variant_id"   json:"variant_id,omitempty"` // omitempty will hide zero ObjectID
 	Name       string             `bson:"name"         json:"name"`
 	Quantity   int                `bson:"quantity"     json:"quantity"`
-	UnitPrice  float64            `bson:"unit_price"   json:"unit_price"`
-	TotalPrice float64            `bson:"total_price"  json:"total_price"`
+	UnitPrice  money.Amount       `bson:"unit_price"   json:"unit_price"`
+	TotalPrice money.Amount       `bson:"total_price"  json:"total_price"`
 	Image      string             `bson:"image"        json:"image"` // Product or variant image
+
+	// Tax charged on TotalPrice; included in it when the shop's prices include tax
+	TaxClass  string       `bson:"tax_class,omitempty"  json:"tax_class,omitempty"`
+	TaxRate   float64      `bson:"tax_rate,omitempty"   json:"tax_rate,omitempty"`
+	TaxAmount money.Amount `bson:"tax_amount,omitempty" json:"tax_amount,omitempty"`
+
+	// Custom lines come from draft orders and are not products: ProductID only
+	// identifies the line, and there is no stock to take or give back
+	Custom bool `bson:"custom,omitempty" json:"custom,omitempty"`
+}
+
+// OrderDiscountUsage is one discount use counted against a discount's limits
+// when the order was placed. Amount is the order value the use was recorded for.
+type OrderDiscountUsage struct {
+	DiscountID primitive.ObjectID `bson:"discount_id" json:"discount_id"`
+	Amount     money.Amount       `bson:"amount" json:"amount"`
 }
 
 // Order represents a shop order.
@@ -24,28 +66,63 @@ type Order struct {
 	ShopID      primitive.ObjectID `bson:"shop_id" json:"shop_id"`
 	CustomerID  primitive.ObjectID `bson:"customer_id" json:"customer_id"`
 	OrderNumber string             `bson:"order_number" json:"order_number"`
-	Status      string             `bson:"status" json:"status"`
+	Status      OrderStatus        `bson:"status" json:"status"`
+
+	// InvoiceNumber is assigned the first time the order's invoice is produced
+	InvoiceNumber string `bson:"invoice_number,omitempty" json:"invoice_number,omitempty"`
 
 	// Items
 	Items []OrderItem `bson:"items" json:"items"`
 
 	// Pricing
-	Subtotal      float64 `bson:"subtotal" json:"subtotal"`
-	DiscountTotal float64 `bson:"discount_total" json:"discount_total"`
-	ShippingCost  float64 `bson:"shipping_cost" json:"shipping_cost"`
-	TaxAmount     float64 `bson:"tax_amount" json:"tax_amount"`
-	Total         float64 `bson:"total" json:"total"`
+	Subtotal      money.Amount `bson:"subtotal" json:"subtotal"`
+	DiscountTotal money.Amount `bson:"discount_total" json:"discount_total"`
+	ShippingCost  money.Amount `bson:"shipping_cost" json:"shipping_cost"`
+	TaxAmount     money.Amount `bson:"tax_amount" json:"tax_amount"`
+	Total         money.Amount `bson:"total" json:"total"`
+	// Tax is nil if no tax region covered the shipping address
+	Tax *OrderTax `bson:"tax,omitempty" json:"tax,omitempty"`
+
+	// Currency is the shop's currency, which the amounts above are in;
+	// Presentment is the order as priced in the currency the customer shopped in
+	Currency    string       `bson:"currency,omitempty" json:"currency,omitempty"`
+	Presentment *Presentment `bson:"presentment,omitempty" json:"presentment,omitempty"`
 
 	// Applied discounts
 	AppliedDiscountIDs []primitive.ObjectID `bson:"applied_discount_ids,omitempty" json:"applied_discount_ids,omitempty"`
+	// DiscountUsages are given back to the customer if the order is cancelled
+	DiscountUsages []OrderDiscountUsage `bson:"discount_usages,omitempty" json:"-"`
 
 	// Shipping
 	ShippingAddress map[string]interface{} `bson:"shipping_address" json:"shipping_address"`
+	ShippingMethod  *ShippingQuote         `bson:"shipping_method,omitempty" json:"shipping_method,omitempty"`
 	BillingAddress  map[string]interface{} `bson:"billing_address" json:"billing_address"`
 
 	// Payment
 	PaymentMethod string `bson:"payment_method" json:"payment_method"`
 	PaymentStatus string `bson:"payment_status" json:"payment_status"`
+	// RefundedTotal is the sum of the order's pending and succeeded refunds,
+	// other than those paying back what an edit took off the total
+	RefundedTotal money.Amount `bson:"refunded_total,omitempty" json:"refunded_total"`
+	// AmountDue is what the customer still owes after an edit raised the
+	// total of an order they had paid for
+	AmountDue money.Amount `bson:"amount_due,omitempty" json:"amount_due,omitempty"`
+
+	// Guest is set on orders placed at guest checkout, without signing in
+	Guest bool `bson:"guest,omitempty" json:"guest,omitempty"`
+
+	// DraftOrderID is set on orders created from a seller's draft order
+	DraftOrderID primitive.ObjectID `bson:"draft_order_id,omitempty" json:"draft_order_id,omitempty"`
+
+	// Risk is the fraud assessment made when the order was placed
+	Risk *OrderRisk `bson:"risk,omitempty" json:"risk,omitempty"`
+
+	// InventoryCommitted is true while the order's items are deducted from stock
+	InventoryCommitted bool `bson:"inventory_committed,omitempty" json:"-"`
+
+	// ShipmentCount counts the order's shipments; adding one is conditional on
+	// it, so concurrent shipments cannot both ship the same units
+	ShipmentCount int `bson:"shipment_count,omitempty" json:"-"`
 
 	// Timestamps
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
@@ -75,3 +152,16 @@ type Customer struct {
 	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
+
+// NetTotal is what the shop keeps from the order after refunds.
+func (o *Order) NetTotal() money.Amount {
+	return o.Total - o.RefundedTotal
+}
+
+// ForCustomer returns a copy of the order without what only the seller may
+// see, for storefront responses.
+func (o *Order) ForCustomer() *Order {
+	c := *o
+	c.Risk = nil
+	return &c
+}
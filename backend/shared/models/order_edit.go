@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderEditStatus is where an order edit stands. An order has at most one
+// open edit, whose changes are staged until it is committed or discarded.
+type OrderEditStatus string
+
+const (
+	OrderEditStatusOpen      OrderEditStatus = "open"
+	OrderEditStatusCommitted OrderEditStatus = "committed"
+	OrderEditStatusDiscarded OrderEditStatus = "discarded"
+)
+
+// OrderEditChangeType is what a staged change does to the order's lines.
+type OrderEditChangeType string
+
+const (
+	OrderEditAdd         OrderEditChangeType = "add"          // add Quantity units, as a new line or onto an existing one
+	OrderEditRemove      OrderEditChangeType = "remove"       // remove the line
+	OrderEditSetQuantity OrderEditChangeType = "set_quantity" // set the line's quantity; 0 removes it
+)
+
+// OrderEditChange is one staged change to an order line, identified by
+// product and variant.
+type OrderEditChange struct {
+	Type      OrderEditChangeType `bson:"type" json:"type"`
+	ProductID primitive.ObjectID  `bson:"product_id" json:"product_id"`
+	VariantID primitive.ObjectID  `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Quantity  int                 `bson:"quantity,omitempty" json:"quantity,omitempty"`
+}
+
+// OrderEdit stages changes to a placed order's items. The priced fields are
+// the order as it would be with the changes applied, worked out like
+// checkout: lines already on the order keep the price they were sold at and
+// added items are priced as they are today. The difference to the order's
+// total becomes an amount due or a refund when the edit is committed.
+type OrderEdit struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID  primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	OrderID primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Status  OrderEditStatus    `bson:"status" json:"status"`
+	Reason  string             `bson:"reason,omitempty" json:"reason,omitempty"`
+
+	Changes []OrderEditChange `bson:"changes" json:"changes"`
+	// ShippingMethodID switches the order to another of the options quoted for
+	// its address; empty keeps the current method
+	ShippingMethodID string `bson:"shipping_method_id,omitempty" json:"shipping_method_id,omitempty"`
+
+	// Pricing with the changes applied
+	Items          []OrderItem    `bson:"items" json:"items"`
+	Subtotal       money.Amount   `bson:"subtotal" json:"subtotal"`
+	DiscountTotal  money.Amount   `bson:"discount_total" json:"discount_total"`
+	ShippingMethod *ShippingQuote `bson:"shipping_method,omitempty" json:"shipping_method,omitempty"`
+	ShippingCost   money.Amount   `bson:"shipping_cost" json:"shipping_cost"`
+	TaxAmount      money.Amount   `bson:"tax_amount" json:"tax_amount"`
+	Tax            *OrderTax      `bson:"tax,omitempty" json:"tax,omitempty"`
+	Total          money.Amount   `bson:"total" json:"total"`
+
+	// TotalBefore is the order's total when the edit was priced. For orders
+	// already paid, AmountDue is what the customer owes on top and RefundDue
+	// what they get back
+	TotalBefore money.Amount `bson:"total_before" json:"total_before"`
+	AmountDue   money.Amount `bson:"amount_due" json:"amount_due"`
+	RefundDue   money.Amount `bson:"refund_due" json:"refund_due"`
+
+	// RefundID is the refund issued when the edit lowered a paid order's total
+	RefundID *primitive.ObjectID `bson:"refund_id,omitempty" json:"refund_id,omitempty"`
+
+	Actor       OrderActor `bson:"actor" json:"actor"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	CommittedAt *time.Time `bson:"committed_at,omitempty" json:"committed_at,omitempty"`
+}
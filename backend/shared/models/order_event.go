@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderEventType is the kind of entry in an order's timeline.
+type OrderEventType string
+
+const (
+	OrderEventCreated       OrderEventType = "created"
+	OrderEventStatusChanged OrderEventType = "status_changed"
+	OrderEventPayment       OrderEventType = "payment"
+	OrderEventEdited        OrderEventType = "edited"
+	OrderEventNote          OrderEventType = "note"
+	OrderEventRefund        OrderEventType = "refund"
+	OrderEventReturn        OrderEventType = "return"
+	OrderEventShipment      OrderEventType = "shipment"
+)
+
+// OrderActorRole says who caused an order event.
+type OrderActorRole string
+
+const (
+	OrderActorAdmin    OrderActorRole = "admin"
+	OrderActorSeller   OrderActorRole = "seller"
+	OrderActorCustomer OrderActorRole = "customer"
+	OrderActorSystem   OrderActorRole = "system" // background jobs, webhooks
+)
+
+// OrderActor identifies the admin, seller or customer behind a change.
+type OrderActor struct {
+	Role OrderActorRole     `bson:"role" json:"role"`
+	ID   primitive.ObjectID `bson:"id,omitempty" json:"id,omitempty"`
+}
+
+// OrderFieldChange is the before/after value of one field touched by an event.
+type OrderFieldChange struct {
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
+
+// OrderEvent is an append-only timeline entry for an order. Events are never
+// updated or deleted once written.
+type OrderEvent struct {
+	ID      primitive.ObjectID          `bson:"_id,omitempty" json:"id"`
+	OrderID primitive.ObjectID          `bson:"order_id" json:"order_id"`
+	ShopID  primitive.ObjectID          `bson:"shop_id" json:"shop_id"`
+	Type    OrderEventType              `bson:"type" json:"type"`
+	Actor   OrderActor                  `bson:"actor" json:"actor"`
+	Message string                      `bson:"message,omitempty" json:"message,omitempty"`
+	Changes map[string]OrderFieldChange `bson:"changes,omitempty" json:"changes,omitempty"`
+
+	// CustomerVisible marks notes the seller chose to share with the customer
+	CustomerVisible bool `bson:"customer_visible,omitempty" json:"customer_visible,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
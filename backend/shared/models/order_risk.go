@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// OrderRiskSignal names a rule that raised an order's risk score.
+type OrderRiskSignal string
+
+const (
+	RiskSignalCustomerVelocity OrderRiskSignal = "customer_velocity"
+	RiskSignalIPVelocity       OrderRiskSignal = "ip_velocity"
+	RiskSignalEmailVelocity    OrderRiskSignal = "email_velocity"
+	RiskSignalCountryMismatch  OrderRiskSignal = "country_mismatch"
+	RiskSignalFirstOrderValue  OrderRiskSignal = "first_order_high_value"
+	RiskSignalFailedOTP        OrderRiskSignal = "failed_otp_attempts"
+	RiskSignalDiscountStacking OrderRiskSignal = "discount_stacking"
+)
+
+// OrderRiskReason is one rule that fired, with the points it added.
+type OrderRiskReason struct {
+	Signal  OrderRiskSignal `bson:"signal" json:"signal"`
+	Points  int             `bson:"points" json:"points"`
+	Message string          `bson:"message" json:"message"`
+}
+
+// OrderRisk is the fraud assessment of an order: a score from 0 to 100 and
+// the reasons behind it. IP and Email are what later orders are compared
+// against for velocity.
+type OrderRisk struct {
+	Score      int               `bson:"score" json:"score"`
+	Reasons    []OrderRiskReason `bson:"reasons" json:"reasons"`
+	Held       bool              `bson:"held,omitempty" json:"held,omitempty"`
+	IP         string            `bson:"ip,omitempty" json:"ip,omitempty"`
+	Email      string            `bson:"email,omitempty" json:"-"`
+	AssessedAt time.Time         `bson:"assessed_at" json:"assessed_at"`
+
+	// Set when a held order is approved or cancelled
+	ReviewedBy *OrderActor `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time  `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+}
+
+// OTPFailure records a wrong or expired sign-in code entered for an email.
+// Failures expire on their own after a day.
+type OTPFailure struct {
+	Email     string    `bson:"email" json:"email"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
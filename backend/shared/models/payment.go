@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentAttemptStatus is where one attempt to pay for an order stands.
+type PaymentAttemptStatus string
+
+const (
+	PaymentAttemptPending   PaymentAttemptStatus = "pending"
+	PaymentAttemptSucceeded PaymentAttemptStatus = "succeeded"
+	PaymentAttemptFailed    PaymentAttemptStatus = "failed"
+)
+
+// Payment is one attempt to pay for an order through a payment provider.
+// Reference is the provider's ID for it, unique per provider.
+type Payment struct {
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	ShopID        primitive.ObjectID   `bson:"shop_id" json:"shop_id"`
+	OrderID       primitive.ObjectID   `bson:"order_id" json:"order_id"`
+	Provider      string               `bson:"provider" json:"provider"`
+	Reference     string               `bson:"reference" json:"reference"`
+	Amount        money.Amount         `bson:"amount" json:"amount"`
+	Currency      string               `bson:"currency,omitempty" json:"currency,omitempty"`
+	Status        PaymentAttemptStatus `bson:"status" json:"status"`
+	Instructions  string               `bson:"instructions,omitempty" json:"instructions,omitempty"`
+	RedirectURL   string               `bson:"redirect_url,omitempty" json:"redirect_url,omitempty"`
+	FailureReason string               `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	CreatedAt     time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time            `bson:"updated_at" json:"updated_at"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,16 +19,18 @@ type Variant struct {
 	Options   []Option           `bson:"options"             json:"options"`
 
 	// Price is the base price; DisplayPrice can override it in the UI
-	Price float64 `bson:"price"                json:"price"`
-	Stock int     `bson:"stock"                json:"stock"`
-	Image string  `bson:"image,omitempty"      json:"image,omitempty"`
+	Price money.Amount `bson:"price"                json:"price"`
+	Stock int          `bson:"stock"                json:"stock"`
+	Image string       `bson:"image,omitempty"      json:"image,omitempty"`
+	// Weight in kg for shipping; 0 falls back to the product's weight
+	Weight float64 `bson:"weight,omitempty"     json:"weight,omitempty"`
 
 	// Discount display fields (not stored in DB)
-	DisplayPrice      *float64 `bson:"-" json:"display_price,omitempty"`
-	AppliedDiscountID *string  `bson:"-" json:"applied_discount_id,omitempty"`
+	DisplayPrice      *money.Amount `bson:"-" json:"display_price,omitempty"`
+	AppliedDiscountID *string       `bson:"-" json:"applied_discount_id,omitempty"`
 
 	// Total could represent price * quantity, or any calculated total
-	Total *float64 `bson:"total,omitempty"      json:"total,omitempty"`
+	Total *money.Amount `bson:"total,omitempty"      json:"total,omitempty"`
 
 	CreatedAt time.Time `bson:"createdAt,omitempty"  json:"createdAt,omitempty"`
 	UpdatedAt time.Time `bson:"updatedAt,omitempty"  json:"updatedAt,omitempty"`
@@ -56,12 +59,14 @@ type Product struct {
 
 	// Pricing & inventory
 	CollectionIDs []primitive.ObjectID `bson:"collection_ids,omitempty" json:"collection_ids,omitempty"`
-	Price         float64              `bson:"price"                     json:"price"`
+	Price         money.Amount         `bson:"price"                     json:"price"`
 	Stock         int                  `bson:"stock"                     json:"stock"`
+	Weight        float64              `bson:"weight,omitempty"          json:"weight,omitempty"`    // kg, for shipping
+	TaxClass      string               `bson:"tax_class,omitempty"       json:"tax_class,omitempty"` // empty means standard
 
 	// Discount display fields (not stored in DB)
-	DisplayPrice      *float64 `bson:"-" json:"display_price,omitempty"`
-	AppliedDiscountID *string  `bson:"-" json:"applied_discount_id,omitempty"`
+	DisplayPrice      *money.Amount `bson:"-" json:"display_price,omitempty"`
+	AppliedDiscountID *string       `bson:"-" json:"applied_discount_id,omitempty"`
 
 	// Variants & ratings
 	Variants      []Variant `bson:"variants,omitempty"        json:"variants,omitempty"`
@@ -69,7 +74,7 @@ type Product struct {
 	ReviewCount   int       `bson:"review_count,omitempty"    json:"review_count,omitempty"`
 
 	// Totals (e.g. sum of all variant totals, or other calculated field)
-	Total *float64 `bson:"total,omitempty"           json:"total,omitempty"`
+	Total *money.Amount `bson:"total,omitempty"           json:"total,omitempty"`
 
 	// Recommendations
 	RelatedProducts     []primitive.ObjectID `bson:"related_products,omitempty"     json:"related_products,omitempty"`
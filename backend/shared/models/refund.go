@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefundType says how a refund amount was chosen.
+type RefundType string
+
+const (
+	RefundTypeFull    RefundType = "full"    // everything not yet refunded
+	RefundTypePartial RefundType = "partial" // an arbitrary amount
+	RefundTypeLine    RefundType = "line"    // specific order lines and quantities
+	// RefundTypeEdit pays back what an order edit took off the total. The
+	// order's total already excludes it, so it is not part of RefundedTotal.
+	RefundTypeEdit RefundType = "edit"
+)
+
+// RefundStatus is the outcome of sending a refund to the payment provider.
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+)
+
+// RefundLine is the part of a refund attributed to one order line.
+type RefundLine struct {
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	VariantID primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+	Amount    money.Amount       `bson:"amount" json:"amount"`
+}
+
+// Refund is an entry in the refund ledger. Entries are only ever appended and
+// then moved from pending to succeeded or failed; an order's refunded total
+// and payment status are derived from its entries.
+type Refund struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID  primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	OrderID primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Type    RefundType         `bson:"type" json:"type"`
+	Status  RefundStatus       `bson:"status" json:"status"`
+
+	Lines          []RefundLine `bson:"lines,omitempty" json:"lines,omitempty"`
+	ShippingAmount money.Amount `bson:"shipping_amount,omitempty" json:"shipping_amount,omitempty"`
+	Amount         money.Amount `bson:"amount" json:"amount"` // total, including shipping
+	Reason         string       `bson:"reason,omitempty" json:"reason,omitempty"`
+
+	// ReturnID links the refund to the return it pays out, if any
+	ReturnID *primitive.ObjectID `bson:"return_id,omitempty" json:"return_id,omitempty"`
+
+	Provider          string `bson:"provider,omitempty" json:"provider,omitempty"`
+	ProviderReference string `bson:"provider_reference,omitempty" json:"provider_reference,omitempty"`
+	FailureReason     string `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+
+	Actor     OrderActor `bson:"actor" json:"actor"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReturnStatus is the lifecycle state of a return (RMA).
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "requested"
+	ReturnStatusApproved  ReturnStatus = "approved"
+	ReturnStatusRejected  ReturnStatus = "rejected"
+	ReturnStatusReceived  ReturnStatus = "received"
+)
+
+// ReturnDisposition is what the seller does with a returned item once received.
+type ReturnDisposition string
+
+const (
+	ReturnDispositionRestock  ReturnDisposition = "restock"
+	ReturnDispositionWriteOff ReturnDisposition = "write_off"
+)
+
+// ReturnItem is a quantity of one order line the customer wants to send back.
+type ReturnItem struct {
+	ProductID   primitive.ObjectID `bson:"product_id" json:"product_id"`
+	VariantID   primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Name        string             `bson:"name" json:"name"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	UnitPrice   money.Amount       `bson:"unit_price" json:"unit_price"`
+	Disposition ReturnDisposition  `bson:"disposition,omitempty" json:"disposition,omitempty"`
+}
+
+// ReturnRequest is a customer's request to return items from an order.
+type ReturnRequest struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID      primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	OrderID     primitive.ObjectID `bson:"order_id" json:"order_id"`
+	OrderNumber string             `bson:"order_number" json:"order_number"`
+	CustomerID  primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	Items       []ReturnItem       `bson:"items" json:"items"`
+	Reason      string             `bson:"reason" json:"reason"`
+	Status      ReturnStatus       `bson:"status" json:"status"`
+	SellerNote  string             `bson:"seller_note,omitempty" json:"seller_note,omitempty"`
+
+	// RefundID links an approved return to the refund issued for it
+	RefundID *primitive.ObjectID `bson:"refund_id,omitempty" json:"refund_id,omitempty"`
+
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+	DecidedAt  *time.Time `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	ReceivedAt *time.Time `bson:"received_at,omitempty" json:"received_at,omitempty"`
+}
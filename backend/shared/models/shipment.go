@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShipmentItem is a quantity of one order line sent in a shipment.
+type ShipmentItem struct {
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	VariantID primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+}
+
+// Shipment is one parcel sent for an order. An order may be fulfilled by
+// several shipments; its shipped/partially_shipped status follows from them.
+type Shipment struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID  primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	OrderID primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Items   []ShipmentItem     `bson:"items" json:"items"`
+
+	Carrier        string `bson:"carrier" json:"carrier"`
+	TrackingNumber string `bson:"tracking_number,omitempty" json:"tracking_number,omitempty"`
+	// TrackingURLTemplate contains {tracking_number}; TrackingURL is it filled in
+	TrackingURLTemplate string `bson:"tracking_url_template,omitempty" json:"tracking_url_template,omitempty"`
+	TrackingURL         string `bson:"tracking_url,omitempty" json:"tracking_url,omitempty"`
+
+	CreatedBy OrderActor `bson:"created_by" json:"created_by"`
+	ShippedAt time.Time  `bson:"shipped_at" json:"shipped_at"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
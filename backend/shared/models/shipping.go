@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShippingRateType is how a shipping method's price is worked out.
+type ShippingRateType string
+
+const (
+	ShippingRateFlat     ShippingRateType = "flat"      // Rate per order
+	ShippingRateWeight   ShippingRateType = "weight"    // Tiers on total weight (kg)
+	ShippingRatePrice    ShippingRateType = "price"     // Tiers on order subtotal
+	ShippingRateFreeOver ShippingRateType = "free_over" // Rate, or free from FreeOver upwards
+)
+
+// ShippingRateTier charges Rate when the measured value is at least Min and,
+// if Max is set, below Max.
+type ShippingRateTier struct {
+	Min  float64      `bson:"min" json:"min"`
+	Max  float64      `bson:"max,omitempty" json:"max,omitempty"` // 0 means no upper bound
+	Rate money.Amount `bson:"rate" json:"rate"`
+}
+
+// ShippingMethod is one way of shipping to a zone, e.g. "Standard" or "Express".
+type ShippingMethod struct {
+	ID            primitive.ObjectID `bson:"id" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	Type          ShippingRateType   `bson:"type" json:"type"`
+	Rate          money.Amount       `bson:"rate,omitempty" json:"rate,omitempty"`
+	Tiers         []ShippingRateTier `bson:"tiers,omitempty" json:"tiers,omitempty"`
+	FreeOver      money.Amount       `bson:"free_over,omitempty" json:"free_over,omitempty"`
+	EstimatedDays string             `bson:"estimated_days,omitempty" json:"estimated_days,omitempty"`
+}
+
+// ShippingZone groups destinations that share shipping methods. Countries are
+// ISO 3166-1 alpha-2 codes; Regions, if set, narrow the zone to those
+// states/provinces of the listed countries.
+type ShippingZone struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID    primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	Name      string             `bson:"name" json:"name"`
+	Countries []string           `bson:"countries" json:"countries"`
+	Regions   []string           `bson:"regions,omitempty" json:"regions,omitempty"`
+	Methods   []ShippingMethod   `bson:"methods" json:"methods"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ShippingQuote is a priced shipping option for a cart or order. ID is unique
+// across providers, e.g. "zones:<method id>".
+type ShippingQuote struct {
+	ID            string       `bson:"id" json:"id"`
+	Provider      string       `bson:"provider" json:"provider"`
+	Name          string       `bson:"name" json:"name"`
+	Amount        money.Amount `bson:"amount" json:"amount"`
+	EstimatedDays string       `bson:"estimated_days,omitempty" json:"estimated_days,omitempty"`
+}
@@ -23,6 +23,31 @@ type Shop struct {
 	Address    string             `bson:"address,omitempty" json:"address,omitempty"`   // Business address
 	Currency   string             `bson:"currency,omitempty" json:"currency,omitempty"` // Default currency (USD, EUR, etc.)
 
+	// PresentmentCurrencies are the other currencies customers may shop in;
+	// prices are converted from Currency at the shop's exchange rates
+	PresentmentCurrencies []PresentmentCurrency `bson:"presentmentCurrencies,omitempty" json:"presentmentCurrencies,omitempty"`
+
+	// Order numbering; nil means DefaultOrderNumberFormat
+	OrderNumbering *OrderNumberFormat `bson:"orderNumbering,omitempty" json:"orderNumbering,omitempty"`
+
+	// How long after placing a paid order a customer may still cancel it
+	// themselves; nil means DefaultCustomerCancelWindowHours, 0 disables it
+	CustomerCancelWindowHours *int `bson:"customerCancelWindowHours,omitempty" json:"customerCancelWindowHours,omitempty"`
+
+	// Orders whose risk score reaches this are held for review before they
+	// can be paid; nil means DefaultRiskReviewThreshold, 0 disables review
+	RiskReviewThreshold *int `bson:"riskReviewThreshold,omitempty" json:"riskReviewThreshold,omitempty"`
+
+	// CartRecovery controls abandoned cart emails; nil means DefaultCartRecovery
+	CartRecovery *CartRecoverySettings `bson:"cartRecovery,omitempty" json:"cartRecovery,omitempty"`
+
+	// PricesIncludeTax means product and shipping prices already contain tax
+	PricesIncludeTax bool `bson:"pricesIncludeTax,omitempty" json:"pricesIncludeTax"`
+
+	// PaymentMethods are the payment provider names customers may pay with, as
+	// in ShopSettings.PaymentMethods; empty means manual payment only
+	PaymentMethods []string `bson:"paymentMethods,omitempty" json:"paymentMethods,omitempty"`
+
 	// Business Status
 	Status     string `bson:"status,omitempty" json:"status,omitempty"`         // Shop status (active, inactive, suspended)
 	IsVerified bool   `bson:"isVerified,omitempty" json:"isVerified,omitempty"` // Shop verification status
@@ -44,3 +69,33 @@ type Shop struct {
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 }
+
+// OrderNumberReset controls how often a shop's order sequence restarts at 1.
+type OrderNumberReset string
+
+const (
+	OrderNumberResetNever  OrderNumberReset = "never"
+	OrderNumberResetYearly OrderNumberReset = "yearly"
+	OrderNumberResetDaily  OrderNumberReset = "daily"
+)
+
+// OrderNumberFormat describes how a shop's order numbers are rendered:
+// Prefix, then the period (YYYY or YYYYMMDD) when the sequence resets, then the
+// sequence zero-padded to Padding digits. e.g. "ORD-20240131-00042".
+type OrderNumberFormat struct {
+	Prefix  string           `bson:"prefix" json:"prefix"`
+	Padding int              `bson:"padding" json:"padding"`
+	Reset   OrderNumberReset `bson:"reset" json:"reset"`
+}
+
+// DefaultOrderNumberFormat matches the numbering used before shops could
+// configure their own.
+var DefaultOrderNumberFormat = OrderNumberFormat{Prefix: "ORD-", Padding: 5, Reset: OrderNumberResetDaily}
+
+// DefaultCustomerCancelWindowHours applies when a shop has not set its own
+// customer cancellation window.
+const DefaultCustomerCancelWindowHours = 24
+
+// DefaultRiskReviewThreshold applies when a shop has not set its own risk
+// review threshold. Scores run from 0 to 100.
+const DefaultRiskReviewThreshold = 70
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Product tax classes. A product without a class is taxed at the standard
+// rate; any other class a region has no rate for falls back to standard too.
+const (
+	TaxClassStandard = "standard"
+	TaxClassReduced  = "reduced"
+	TaxClassZero     = "zero"
+	TaxClassExempt   = "exempt" // never taxed, whatever the region says
+)
+
+// TaxRegion is where a shop collects tax, and at what rates. Rates are
+// fractions (0.2 for 20%). A region with Region set applies only to that
+// state/province of Country and wins over a country-wide region.
+type TaxRegion struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShopID     primitive.ObjectID `bson:"shop_id" json:"shop_id"`
+	Name       string             `bson:"name" json:"name"`
+	Country    string             `bson:"country" json:"country"`
+	Region     string             `bson:"region,omitempty" json:"region,omitempty"`
+	Rate       float64            `bson:"rate" json:"rate"`
+	ClassRates map[string]float64 `bson:"class_rates,omitempty" json:"class_rates,omitempty"`
+	// TaxShipping charges the standard rate on shipping too
+	TaxShipping bool      `bson:"tax_shipping" json:"tax_shipping"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// OrderTax records how an order was taxed, so reports do not depend on the
+// shop's current regions.
+type OrderTax struct {
+	RegionID         primitive.ObjectID `bson:"region_id" json:"region_id"`
+	RegionName       string             `bson:"region_name" json:"region_name"`
+	Country          string             `bson:"country" json:"country"`
+	Region           string             `bson:"region,omitempty" json:"region,omitempty"`
+	PricesIncludeTax bool               `bson:"prices_include_tax" json:"prices_include_tax"`
+	ShippingRate     float64            `bson:"shipping_rate,omitempty" json:"shipping_rate,omitempty"`
+	ShippingTax      money.Amount       `bson:"shipping_tax,omitempty" json:"shipping_tax,omitempty"`
+}
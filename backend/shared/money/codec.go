@@ -0,0 +1,87 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// MarshalJSON writes the amount as a decimal number of currency units, with
+// trailing zeros dropped: 1250 is 12.5.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := strings.TrimRight(strings.TrimRight(a.String(), "0"), ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON reads a decimal number of currency units, or the same as a
+// string. The number is read exactly, not through a float64; null is zero.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*a = 0
+		return nil
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// MarshalBSONValue stores the amount as a 64-bit integer of minor units.
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.TypeInt64, bsoncore.AppendInt64(nil, int64(a)), nil
+}
+
+// UnmarshalBSONValue reads minor units stored as an integer. Doubles are
+// amounts written before amounts were exact, in currency units, and are
+// rounded half up to minor units; decimals are read as currency units too.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bson.TypeInt64:
+		v, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return fmt.Errorf("%w: truncated int64", ErrInvalidAmount)
+		}
+		*a = Amount(v)
+	case bson.TypeInt32:
+		v, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return fmt.Errorf("%w: truncated int32", ErrInvalidAmount)
+		}
+		*a = Amount(v)
+	case bson.TypeDouble:
+		v, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return fmt.Errorf("%w: truncated double", ErrInvalidAmount)
+		}
+		*a = FromFloat(v, HalfUp)
+	case bson.TypeDecimal128:
+		v, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return fmt.Errorf("%w: truncated decimal", ErrInvalidAmount)
+		}
+		parsed, err := Parse(v.String())
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case bson.TypeNull, bson.TypeUndefined:
+		*a = 0
+	default:
+		return fmt.Errorf("%w: cannot decode BSON %s", ErrInvalidAmount, t)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0"},
+		{5, "0.05"},
+		{1000, "10"},
+		{1250, "12.5"},
+		{1999, "19.99"},
+		{-1250, "-12.5"},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.in)
+		if err != nil || string(data) != tt.want {
+			t.Errorf("json.Marshal(%d) = %s, %v; want %s", tt.in, data, err, tt.want)
+			continue
+		}
+		var back Amount
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.in {
+			t.Errorf("json round trip of %d = %d, %v", tt.in, back, err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: `19.99`, want: 1999},
+		{in: `"19.99"`, want: 1999},
+		{in: `12`, want: 1200},
+		{in: `0.125`, want: 13},
+		{in: `null`, want: 0},
+		{in: `"twelve"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		a := Amount(7)
+		err := json.Unmarshal([]byte(tt.in), &a)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("json.Unmarshal(%s) = %d, want an error", tt.in, a)
+			}
+			continue
+		}
+		if err != nil || a != tt.want {
+			t.Errorf("json.Unmarshal(%s) = %d, %v; want %d", tt.in, a, err, tt.want)
+		}
+	}
+}
+
+type bsonDoc struct {
+	Price Amount `bson:"price"`
+}
+
+func TestBSONRoundTrip(t *testing.T) {
+	for _, in := range []Amount{0, 1, 1999, -1250, 1 << 40} {
+		data, err := bson.Marshal(bsonDoc{Price: in})
+		if err != nil {
+			t.Fatalf("bson.Marshal(%d): %v", in, err)
+		}
+		if got := bson.Raw(data).Lookup("price").Type; got != bson.TypeInt64 {
+			t.Errorf("amount %d stored as %s, want int64", in, got)
+		}
+		var back bsonDoc
+		if err := bson.Unmarshal(data, &back); err != nil || back.Price != in {
+			t.Errorf("bson round trip of %d = %d, %v", in, back.Price, err)
+		}
+	}
+}
+
+func TestUnmarshalBSONLegacy(t *testing.T) {
+	dec, err := primitive.ParseDecimal128("12.345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		stored  interface{}
+		want    Amount
+		wantErr bool
+	}{
+		{name: "int32", stored: int32(250), want: 250},
+		{name: "double in currency units", stored: 19.99, want: 1999},
+		{name: "double rounds half up", stored: 0.125, want: 13},
+		{name: "decimal in currency units", stored: dec, want: 1235},
+		{name: "null", stored: nil, want: 0},
+		{name: "string", stored: "19.99", wantErr: true},
+	}
+	for _, tt := range tests {
+		data, err := bson.Marshal(bson.M{"price": tt.stored})
+		if err != nil {
+			t.Fatalf("%s: bson.Marshal: %v", tt.name, err)
+		}
+		var got bsonDoc
+		err = bson.Unmarshal(data, &got)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("%s: error = %v, want ErrInvalidAmount", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || got.Price != tt.want {
+			t.Errorf("%s: decoded %d, %v; want %d", tt.name, got.Price, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package money
+
+import (
+	"math/big"
+	"strings"
+)
+
+// zeroDecimalCurrencies have no minor unit in use, so their amounts are
+// always whole currency units.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+	"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// fineDecimalCurrencies have more decimals than an Amount holds: three, or
+// four for units of account like CLF.
+var fineDecimalCurrencies = map[string]bool{
+	"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true,
+	"TND": true, "CLF": true, "UYW": true,
+}
+
+// Decimals returns how many decimals the currency is shown and charged
+// with: 0 for currencies like JPY, otherwise 2.
+func Decimals(currency string) int {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return 0
+	}
+	return 2
+}
+
+// Supported reports whether amounts in the currency fit an Amount, which
+// holds hundredths. Currencies with three or four decimals, like KWD, do not:
+// they cannot be priced or charged exactly and must not be accepted.
+func Supported(currency string) bool {
+	return !fineDecimalCurrencies[strings.ToUpper(currency)]
+}
+
+// RoundTo rounds the amount to what the currency can be charged in, e.g.
+// whole yen for JPY.
+func (a Amount) RoundTo(currency string, mode Rounding) Amount {
+	if Decimals(currency) == 2 {
+		return a
+	}
+	return a.Whole(mode)
+}
+
+// Whole rounds the amount to whole currency units.
+func (a Amount) Whole(mode Rounding) Amount {
+	return fromRat(big.NewRat(int64(a), Scale), mode) * Scale
+}
+
+// Convert returns the amount times an exchange rate, rounded once with mode
+// to what the target currency can be charged in.
+func (a Amount) Convert(rate float64, currency string, mode Rounding) Amount {
+	r := rat(rate)
+	r.Mul(r, big.NewRat(int64(a), 1))
+	if Decimals(currency) == 0 {
+		return fromRat(r.Quo(r, big.NewRat(Scale, 1)), mode) * Scale
+	}
+	return fromRat(r, mode)
+}
@@ -0,0 +1,49 @@
+package money
+
+import "testing"
+
+func TestCurrencies(t *testing.T) {
+	tests := []struct {
+		currency  string
+		decimals  int
+		supported bool
+	}{
+		{"USD", 2, true},
+		{"eur", 2, true},
+		{"JPY", 0, true},
+		{"krw", 0, true},
+		{"KWD", 2, false},
+		{"bhd", 2, false},
+		{"CLF", 2, false},
+	}
+	for _, tt := range tests {
+		if got := Decimals(tt.currency); got != tt.decimals {
+			t.Errorf("Decimals(%q) = %d, want %d", tt.currency, got, tt.decimals)
+		}
+		if got := Supported(tt.currency); got != tt.supported {
+			t.Errorf("Supported(%q) = %v, want %v", tt.currency, got, tt.supported)
+		}
+	}
+}
+
+func TestRoundToAndConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want Amount
+	}{
+		{"RoundTo USD", Amount(12345).RoundTo("USD", HalfUp), 12345},
+		{"RoundTo JPY", Amount(12345).RoundTo("JPY", HalfUp), 12300},
+		{"RoundTo JPY half", Amount(12350).RoundTo("JPY", HalfUp), 12400},
+		{"Whole up", Amount(12301).Whole(Up), 12400},
+		{"Convert to EUR", Amount(1000).Convert(0.92, "EUR", HalfUp), 920},
+		{"Convert to EUR rounds once", Amount(999).Convert(0.915, "EUR", HalfUp), 914},
+		{"Convert to JPY", Amount(1000).Convert(150.5, "JPY", HalfUp), 150500},
+		{"Convert to JPY rounds to yen", Amount(999).Convert(150.5, "JPY", HalfUp), 150300},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
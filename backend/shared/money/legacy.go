@@ -0,0 +1,67 @@
+package money
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ConvertLegacyAmounts rewrites, in place, amounts stored as doubles in
+// currency units at path in doc, as they were before amounts were exact. A
+// path names nested fields with dots and marks arrays with "[]":
+// "items[].unit_price" is the unit price of every item. It reports whether
+// anything was converted.
+func ConvertLegacyAmounts(doc bson.M, path string) bool {
+	_, ok := convertLegacyAmount(doc, strings.Split(path, "."))
+	return ok
+}
+
+// convertLegacyAmount converts the double at path in v, or in every element
+// of the arrays along it, to an amount in place. ok is false if there was
+// nothing to convert.
+func convertLegacyAmount(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		if f, isDouble := v.(float64); isDouble {
+			return FromFloat(f, HalfUp), true
+		}
+		return v, false
+	}
+	name, isArray := strings.CutSuffix(path[0], "[]")
+	if d, isD := v.(bson.D); isD {
+		// Embedded documents may decode ordered; convert them in place too.
+		for i := range d {
+			if d[i].Key == name {
+				wrapped := bson.M{name: d[i].Value}
+				_, ok := convertLegacyAmount(wrapped, path)
+				d[i].Value = wrapped[name]
+				return v, ok
+			}
+		}
+		return v, false
+	}
+	doc, isDoc := v.(bson.M)
+	if !isDoc {
+		return v, false
+	}
+	child, exists := doc[name]
+	if !exists {
+		return v, false
+	}
+	if !isArray {
+		var ok bool
+		doc[name], ok = convertLegacyAmount(child, path[1:])
+		return v, ok
+	}
+	arr, isArr := child.(bson.A)
+	if !isArr {
+		return v, false
+	}
+	converted := false
+	for i := range arr {
+		var ok bool
+		if arr[i], ok = convertLegacyAmount(arr[i], path[1:]); ok {
+			converted = true
+		}
+	}
+	return v, converted
+}
@@ -0,0 +1,93 @@
+package money
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConvertLegacyAmounts(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  bson.M
+		path string
+		want bson.M
+		ok   bool
+	}{
+		{
+			name: "top level double",
+			doc:  bson.M{"total": 19.99},
+			path: "total",
+			want: bson.M{"total": Amount(1999)},
+			ok:   true,
+		},
+		{
+			name: "already converted",
+			doc:  bson.M{"total": int64(1999)},
+			path: "total",
+			want: bson.M{"total": int64(1999)},
+		},
+		{
+			name: "missing field",
+			doc:  bson.M{"subtotal": 19.99},
+			path: "total",
+			want: bson.M{"subtotal": 19.99},
+		},
+		{
+			name: "nested document",
+			doc:  bson.M{"tax": bson.M{"amount": 0.3}},
+			path: "tax.amount",
+			want: bson.M{"tax": bson.M{"amount": Amount(30)}},
+			ok:   true,
+		},
+		{
+			name: "ordered nested document",
+			doc:  bson.M{"tax": bson.D{{Key: "rate", Value: 0.2}, {Key: "amount", Value: 0.3}}},
+			path: "tax.amount",
+			want: bson.M{"tax": bson.D{{Key: "rate", Value: 0.2}, {Key: "amount", Value: Amount(30)}}},
+			ok:   true,
+		},
+		{
+			name: "array elements, some already converted",
+			doc: bson.M{"items": bson.A{
+				bson.M{"unit_price": 1.5},
+				bson.M{"unit_price": int64(150)},
+				bson.M{"name": "no price"},
+			}},
+			path: "items[].unit_price",
+			want: bson.M{"items": bson.A{
+				bson.M{"unit_price": Amount(150)},
+				bson.M{"unit_price": int64(150)},
+				bson.M{"name": "no price"},
+			}},
+			ok: true,
+		},
+		{
+			name: "array field that is not an array",
+			doc:  bson.M{"items": 1.5},
+			path: "items[].unit_price",
+			want: bson.M{"items": 1.5},
+		},
+		{
+			name: "array of arrays",
+			doc: bson.M{"shipments": bson.A{
+				bson.M{"lines": bson.A{bson.M{"amount": 2.675}}},
+			}},
+			path: "shipments[].lines[].amount",
+			want: bson.M{"shipments": bson.A{
+				bson.M{"lines": bson.A{bson.M{"amount": Amount(268)}}},
+			}},
+			ok: true,
+		},
+	}
+	for _, tt := range tests {
+		ok := ConvertLegacyAmounts(tt.doc, tt.path)
+		if ok != tt.ok {
+			t.Errorf("%s: converted = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if !reflect.DeepEqual(tt.doc, tt.want) {
+			t.Errorf("%s: doc = %v, want %v", tt.name, tt.doc, tt.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package money does exact arithmetic on amounts of money. An Amount is a
+// whole number of hundredths of a currency unit (cents, for most
+// currencies), so sums never drift the way float64 sums do; anything that
+// produces fractions of a cent, like percentages and tax rates, is computed
+// exactly and then rounded once, with an explicit rounding mode. Amounts are
+// in the currency of the document holding them (the shop's, or a
+// presentment's); currencies with finer minor units than hundredths are not
+// supported, see Supported.
+//
+// Amounts are written to JSON as plain decimal numbers (12.5 for 1250), as
+// the API always has, and stored in BSON as 64-bit integers of minor units.
+// Documents written before amounts were exact hold doubles in major units;
+// those still decode, and repositories.MigrateLegacyAmounts rewrites them at
+// startup.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is a sum of money in minor units: hundredths of the currency unit.
+type Amount int64
+
+// Scale is how many minor units make one currency unit.
+const Scale = 100
+
+// Zero is no money.
+const Zero Amount = 0
+
+// Rounding says which way a fraction of a minor unit goes.
+type Rounding int
+
+const (
+	// HalfUp rounds to the nearest minor unit, halves away from zero. It is
+	// the rounding customers expect on prices and the default here.
+	HalfUp Rounding = iota
+	// HalfEven rounds to the nearest minor unit, halves to the even one
+	// (banker's rounding), which does not bias long sums upwards.
+	HalfEven
+	// Down truncates towards zero.
+	Down
+	// Up rounds away from zero.
+	Up
+)
+
+var ErrInvalidAmount = errors.New("money: invalid amount")
+
+// FromMinor returns the amount of n minor units.
+func FromMinor(n int64) Amount {
+	return Amount(n)
+}
+
+// FromFloat converts an amount in currency units, such as 19.99, rounding
+// to whole minor units. The float is read as the shortest decimal that
+// represents it, so 19.99 is exactly 1999 and not 1998.9999999.
+func FromFloat(f float64, mode Rounding) Amount {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return 0
+	}
+	return fromRat(r.Mul(r, big.NewRat(Scale, 1)), mode)
+}
+
+// Parse reads a decimal amount in currency units, such as "12.50" or "-3",
+// rounding half up to whole minor units.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("%w: empty", ErrInvalidAmount)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	r.Mul(r, big.NewRat(Scale, 1))
+	if new(big.Rat).Abs(r).Cmp(big.NewRat(math.MaxInt64, 1)) > 0 {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+	return fromRat(r, HalfUp), nil
+}
+
+// fromRat rounds r, a number of minor units, to a whole Amount.
+func fromRat(r *big.Rat, mode Rounding) Amount {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	neg := num.Sign() < 0
+	num.Abs(num)
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Lsh(rem, 1)
+		switch mode {
+		case HalfUp:
+			if twice.Cmp(den) >= 0 {
+				q.Add(q, big.NewInt(1))
+			}
+		case HalfEven:
+			if c := twice.Cmp(den); c > 0 || (c == 0 && q.Bit(0) == 1) {
+				q.Add(q, big.NewInt(1))
+			}
+		case Up:
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return Amount(q.Int64())
+}
+
+// Minor returns the amount in minor units.
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Float returns the amount in currency units. Use it only for display and
+// ratios, never to compute other amounts.
+func (a Amount) Float() float64 {
+	return float64(a) / Scale
+}
+
+// String formats the amount in currency units with two decimals: "12.50".
+func (a Amount) String() string {
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/Scale, n%Scale)
+}
+
+// Mul returns the amount times a whole number, e.g. a unit price times a
+// quantity.
+func (a Amount) Mul(n int) Amount {
+	return a * Amount(n)
+}
+
+// MulRate returns the amount times a rate, such as a tax rate of 0.0725,
+// rounded with mode. The rate is taken as the shortest decimal that
+// represents it.
+func (a Amount) MulRate(rate float64, mode Rounding) Amount {
+	return a.mulRat(rat(rate), mode)
+}
+
+// Percent returns p percent of the amount, rounded with mode.
+func (a Amount) Percent(p float64, mode Rounding) Amount {
+	r := rat(p)
+	return a.mulRat(r.Quo(r, big.NewRat(100, 1)), mode)
+}
+
+// IncludedRate returns the part of a price that already includes a rate
+// that is the rate itself: for tax included in a price, gross × r / (1 + r).
+func (a Amount) IncludedRate(rate float64, mode Rounding) Amount {
+	r := rat(rate)
+	den := new(big.Rat).Add(big.NewRat(1, 1), r)
+	if den.Sign() == 0 {
+		return 0
+	}
+	return a.mulRat(r.Quo(r, den), mode)
+}
+
+// Ratio returns the amount times num/den, rounded with mode; a zero den
+// gives zero. It scales one amount by how two others compare, e.g. a line's
+// share of a discount.
+func (a Amount) Ratio(num, den Amount, mode Rounding) Amount {
+	if den == 0 {
+		return 0
+	}
+	return a.mulRat(big.NewRat(int64(num), int64(den)), mode)
+}
+
+// Part returns n of every `of` units of the amount, rounded with mode; a zero
+// `of` gives zero. It prices some of a line's quantity, e.g. 2 of 3 units.
+func (a Amount) Part(n, of int, mode Rounding) Amount {
+	if of == 0 {
+		return 0
+	}
+	return a.mulRat(big.NewRat(int64(n), int64(of)), mode)
+}
+
+func (a Amount) mulRat(r *big.Rat, mode Rounding) Amount {
+	return fromRat(r.Mul(r, big.NewRat(int64(a), 1)), mode)
+}
+
+// rat reads f as the shortest decimal that represents it.
+func rat(f float64) *big.Rat {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return new(big.Rat)
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// Neg returns -a.
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+// Abs returns the amount without its sign.
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// IsZero reports whether the amount is zero.
+func (a Amount) IsZero() bool {
+	return a == 0
+}
+
+// Min returns the smaller of two amounts.
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of two amounts.
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Sum adds amounts up.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+// Allocate splits total across parts in proportion to weights, so that the
+// parts add up to total exactly: each part is rounded down and the minor
+// units left over go to the parts with the largest remainders, earlier parts
+// first on ties. Parts with zero or negative weight get nothing; if no
+// weight is positive, nothing is allocated.
+func Allocate(total Amount, weights []Amount) []Amount {
+	parts := make([]Amount, len(weights))
+	var sum int64
+	for _, w := range weights {
+		if w > 0 {
+			sum += int64(w)
+		}
+	}
+	if sum == 0 || total == 0 {
+		return parts
+	}
+
+	neg := total < 0
+	t := big.NewInt(int64(total.Abs()))
+	s := big.NewInt(sum)
+	rems := make([]*big.Int, len(weights))
+	allocated := Amount(0)
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(t, big.NewInt(int64(w))), s, new(big.Int))
+		parts[i] = Amount(q.Int64())
+		rems[i] = r
+		allocated += parts[i]
+	}
+	for left := total.Abs() - allocated; left > 0; left-- {
+		best := -1
+		for i, r := range rems {
+			if r != nil && (best < 0 || r.Cmp(rems[best]) > 0) {
+				best = i
+			}
+		}
+		parts[best]++
+		rems[best] = new(big.Int).Sub(rems[best], s)
+	}
+	if neg {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts
+}
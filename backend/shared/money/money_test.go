@@ -0,0 +1,159 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: "12.50", want: 1250},
+		{in: " 12.5 ", want: 1250},
+		{in: "-3", want: -300},
+		{in: "0.004", want: 0},
+		{in: "0.005", want: 1},
+		{in: "-0.005", want: -1},
+		{in: "1e2", want: 10000},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "100000000000000000000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q) error = %v, want ErrInvalidAmount", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{100, "1.00"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		mode Rounding
+		want Amount
+	}{
+		{19.99, HalfUp, 1999},
+		{0.1 + 0.2, HalfUp, 30},
+		{0.015, HalfUp, 2},
+		{0.025, HalfUp, 3},
+		{0.025, HalfEven, 2},
+		{0.015, HalfEven, 2},
+		{0.019, Down, 1},
+		{0.011, Up, 2},
+		{-0.015, HalfUp, -2},
+		{-0.011, Up, -2},
+		{math.NaN(), HalfUp, 0},
+		{math.Inf(1), HalfUp, 0},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.in, tt.mode); got != tt.want {
+			t.Errorf("FromFloat(%v, %d) = %d, want %d", tt.in, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestRoundingModes(t *testing.T) {
+	// Each amount is halved, so odd amounts land exactly on a half.
+	tests := []struct {
+		in                         Amount
+		halfUp, halfEven, down, up Amount
+	}{
+		{5, 3, 2, 2, 3},
+		{7, 4, 4, 3, 4},
+		{-5, -3, -2, -2, -3},
+		{4, 2, 2, 2, 2},
+	}
+	for _, tt := range tests {
+		for mode, want := range map[Rounding]Amount{HalfUp: tt.halfUp, HalfEven: tt.halfEven, Down: tt.down, Up: tt.up} {
+			if got := tt.in.Ratio(1, 2, mode); got != want {
+				t.Errorf("Amount(%d).Ratio(1, 2, %d) = %d, want %d", tt.in, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestRates(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want Amount
+	}{
+		{"MulRate", Amount(1999).MulRate(0.0725, HalfUp), 145},
+		{"Percent half up", Amount(1999).Percent(15, HalfUp), 300},
+		{"Percent down", Amount(1999).Percent(15, Down), 299},
+		{"IncludedRate", Amount(1200).IncludedRate(0.2, HalfUp), 200},
+		{"IncludedRate of -100%", Amount(1200).IncludedRate(-1, HalfUp), 0},
+		{"Ratio by zero", Amount(1200).Ratio(1, 0, HalfUp), 0},
+		{"Part", Amount(1000).Part(2, 3, HalfUp), 667},
+		{"Part of zero", Amount(1000).Part(2, 0, HalfUp), 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Amount
+		weights []Amount
+		want    []Amount
+	}{
+		{"even split, remainder to the first", 100, []Amount{1, 1, 1}, []Amount{34, 33, 33}},
+		{"largest remainder first", 5, []Amount{1, 2}, []Amount{2, 3}},
+		{"remainders to the largest fractions", 10, []Amount{1, 1, 1, 1, 1, 1, 4}, []Amount{1, 1, 1, 1, 1, 1, 4}},
+		{"negative total", -100, []Amount{1, 1, 1}, []Amount{-34, -33, -33}},
+		{"zero and negative weights get nothing", 10, []Amount{3, 0, -2, 7}, []Amount{3, 0, 0, 7}},
+		{"no positive weight", 100, []Amount{0, 0}, []Amount{0, 0}},
+		{"zero total", 0, []Amount{1, 2}, []Amount{0, 0}},
+		{"no parts", 100, []Amount{}, []Amount{}},
+	}
+	for _, tt := range tests {
+		got := Allocate(tt.total, tt.weights)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Allocate(%d, %v) = %v, want %v", tt.name, tt.total, tt.weights, got, tt.want)
+		}
+	}
+}
+
+func TestAllocateAddsUp(t *testing.T) {
+	weights := []Amount{1999, 1, 333, 4250, 7}
+	for total := Amount(-1000); total <= 1000; total += 7 {
+		if got := Sum(Allocate(total, weights)...); got != total {
+			t.Fatalf("Allocate(%d) parts add up to %d", total, got)
+		}
+	}
+}
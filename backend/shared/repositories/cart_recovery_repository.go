@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var cartRecoveryCol *mongo.Collection = config.GetCollection("DRPS", "cart_recoveries")
+
+// EnsureCartRecoveryIndexes creates the indexes used to report a shop's
+// recoveries and to find a customer's open one when they order.
+func EnsureCartRecoveryIndexes(ctx context.Context) error {
+	_, err := cartRecoveryCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "sent_at", Value: -1}}},
+		{Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "customer_id", Value: 1}, {Key: "sent_at", Value: -1}}},
+	})
+	return err
+}
+
+// CreateCartRecovery inserts a record of a recovery email.
+func CreateCartRecovery(ctx context.Context, r *models.CartRecovery) error {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	_, err := cartRecoveryCol.InsertOne(ctx, r)
+	return err
+}
+
+// FindOpenCartRecovery returns the customer's newest recovery email from the
+// shop sent since the given time that has not recovered an order yet, or nil.
+func FindOpenCartRecovery(ctx context.Context, shopID, customerID primitive.ObjectID, since time.Time) (*models.CartRecovery, error) {
+	var r models.CartRecovery
+	err := cartRecoveryCol.FindOne(ctx, bson.M{
+		"shop_id":      shopID,
+		"customer_id":  customerID,
+		"sent_at":      bson.M{"$gte": since},
+		"recovered_at": bson.M{"$exists": false},
+	}, options.FindOne().SetSort(bson.D{{Key: "sent_at", Value: -1}})).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// MarkCartRecovered attributes an order to a recovery email. It matches only
+// while the recovery has no order yet.
+func MarkCartRecovered(ctx context.Context, id, orderID primitive.ObjectID, orderTotal money.Amount, at time.Time) (*mongo.UpdateResult, error) {
+	return cartRecoveryCol.UpdateOne(ctx,
+		bson.M{"_id": id, "recovered_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"recovered_at": at, "order_id": orderID, "order_total": orderTotal}})
+}
+
+// ListCartRecoveries returns the shop's recovery emails, newest first.
+func ListCartRecoveries(ctx context.Context, shopID primitive.ObjectID) ([]models.CartRecovery, error) {
+	cur, err := cartRecoveryCol.Find(ctx, bson.M{"shop_id": shopID}, options.Find().SetSort(bson.D{{Key: "sent_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var out []models.CartRecovery
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -15,6 +15,16 @@ import (
 
 var cartCollection *mongo.Collection = config.GetCollection("DRPS", "carts")
 
+// EnsureCartIndexes lets a guest session have only one cart per shop.
+func EnsureCartIndexes(ctx context.Context) error {
+	_, err := cartCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "session_id", Value: 1}, {Key: "shop_id", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"session_id": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
 // CreateCart inserts a new Cart document.
 func CreateCart(cart *models.Cart) (*mongo.InsertOneResult, error) {
 	cart.ID = primitive.NewObjectID()
@@ -57,9 +67,89 @@ func GetCartBySessionID(shopID primitive.ObjectID, sessionID string) (*models.Ca
 	return &cart, nil
 }
 
-// UpdateCart replaces the cart document (used when items change).
+// GetCartsBySessionID returns a guest session's carts, one per shop it shopped in.
+func GetCartsBySessionID(sessionID string) ([]models.Cart, error) {
+	cursor, err := cartCollection.Find(context.Background(), bson.M{"session_id": sessionID})
+	if err != nil {
+		return nil, err
+	}
+	var carts []models.Cart
+	if err := cursor.All(context.Background(), &carts); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+// cartLastActivity is when the customer last changed the cart; carts saved
+// before that was recorded fall back to last_updated.
+var cartLastActivity = bson.M{"$ifNull": bson.A{"$customer_activity_at", "$last_updated"}}
+
+// awaitingRecoveryEmail matches carts the customer changed since their last
+// recovery email, or never sent one.
+var awaitingRecoveryEmail = bson.M{"$or": []bson.M{
+	{"recovery_emailed_at": bson.M{"$exists": false}},
+	{"$expr": bson.M{"$lt": bson.A{"$recovery_emailed_at", cartLastActivity}}},
+}}
+
+// ListAbandonedCarts returns the shop's customer carts that still have items,
+// were last changed by the customer in [notBefore, before) and have not been
+// emailed about since.
+func ListAbandonedCarts(ctx context.Context, shopID primitive.ObjectID, before, notBefore time.Time) ([]models.Cart, error) {
+	filter := bson.M{
+		"shop_id":     shopID,
+		"customer_id": bson.M{"$ne": nil},
+		"items.0":     bson.M{"$exists": true},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"customer_activity_at": bson.M{"$lt": before, "$gte": notBefore}},
+				{"customer_activity_at": bson.M{"$exists": false}, "last_updated": bson.M{"$lt": before, "$gte": notBefore}},
+			}},
+			awaitingRecoveryEmail,
+		},
+	}
+	cursor, err := cartCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var carts []models.Cart
+	if err := cursor.All(ctx, &carts); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+// ClaimCartForRecovery records that a recovery email is being sent for the
+// cart. It reports false if the customer changed the cart since it was listed
+// or another run already claimed it.
+func ClaimCartForRecovery(ctx context.Context, cart *models.Cart, at time.Time) (bool, error) {
+	filter := bson.M{"_id": cart.ID, "$and": []bson.M{awaitingRecoveryEmail}}
+	if cart.CustomerActivityAt.IsZero() {
+		filter["customer_activity_at"] = bson.M{"$exists": false}
+		filter["last_updated"] = cart.LastUpdated
+	} else {
+		filter["customer_activity_at"] = cart.CustomerActivityAt
+	}
+	res, err := cartCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"recovery_emailed_at": at}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// ReleaseCartRecoveryClaim undoes ClaimCartForRecovery when the email could
+// not be sent, so the next run tries again.
+func ReleaseCartRecoveryClaim(ctx context.Context, cart *models.Cart, at time.Time) error {
+	update := bson.M{"$unset": bson.M{"recovery_emailed_at": ""}}
+	if cart.RecoveryEmailedAt != nil {
+		update = bson.M{"$set": bson.M{"recovery_emailed_at": *cart.RecoveryEmailedAt}}
+	}
+	_, err := cartCollection.UpdateOne(ctx, bson.M{"_id": cart.ID, "recovery_emailed_at": at}, update)
+	return err
+}
+
+// UpdateCart replaces the cart document (used when items change). The caller
+// sets LastUpdated.
 func UpdateCart(cart *models.Cart) (*mongo.UpdateResult, error) {
-	cart.LastUpdated = time.Now()
 	update := bson.M{"$set": cart}
 	return cartCollection.UpdateOne(
 		context.Background(),
@@ -68,6 +158,16 @@ func UpdateCart(cart *models.Cart) (*mongo.UpdateResult, error) {
 	)
 }
 
+// UpdateCartIfUnchanged replaces the cart document if its last_updated is
+// still the cart's. MatchedCount is 0 if the cart was changed since it was read.
+func UpdateCartIfUnchanged(cart *models.Cart) (*mongo.UpdateResult, error) {
+	return cartCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": cart.ID, "last_updated": cart.LastUpdated},
+		bson.M{"$set": cart},
+	)
+}
+
 // DeleteCart deletes a cart by its ID.
 func DeleteCart(id primitive.ObjectID) (*mongo.DeleteResult, error) {
 	return cartCollection.DeleteOne(context.Background(), bson.M{"_id": id})
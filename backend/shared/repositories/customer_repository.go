@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"errors"
+	"regexp"
 	"time"
 
 	custModel "github.com/Endale2/DRPS/customers/models"
@@ -23,6 +24,12 @@ func CreateCustomer(customer *custModel.Customer) (*mongo.InsertOneResult, error
 	return customerCollection.InsertOne(context.Background(), customer)
 }
 
+// InsertCustomer inserts a customer whose ID and timestamps are already set,
+// using ctx so it can be part of a transaction.
+func InsertCustomer(ctx context.Context, customer *custModel.Customer) (*mongo.InsertOneResult, error) {
+	return customerCollection.InsertOne(ctx, customer)
+}
+
 // GetCustomerByID retrieves a customer by its ID.
 func GetCustomerByID(id string) (*custModel.Customer, error) {
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -38,6 +45,24 @@ func GetCustomerByID(id string) (*custModel.Customer, error) {
 	return &customer, nil
 }
 
+// ListGuestCustomersByEmail returns the guest checkout records made with an
+// email, ignoring case.
+func ListGuestCustomersByEmail(ctx context.Context, email string) ([]custModel.Customer, error) {
+	filter := bson.M{
+		"email": bson.M{"$regex": "^" + regexp.QuoteMeta(email) + "$", "$options": "i"},
+		"guest": true,
+	}
+	cursor, err := customerCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var customers []custModel.Customer
+	if err := cursor.All(ctx, &customers); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
 // GetAllCustomers returns all customers in the collection.
 func GetAllCustomers() ([]custModel.Customer, error) {
 	cursor, err := customerCollection.Find(context.Background(), bson.M{})
@@ -6,6 +6,7 @@ import (
 
 	"github.com/Endale2/DRPS/config"
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -27,9 +28,9 @@ func CreateDiscount(d *models.Discount) (*mongo.InsertOneResult, error) {
 	return discountColl.InsertOne(context.Background(), d)
 }
 
-func GetDiscountByID(id primitive.ObjectID) (*models.Discount, error) {
+func GetDiscountByID(ctx context.Context, id primitive.ObjectID) (*models.Discount, error) {
 	var d models.Discount
-	err := discountColl.FindOne(context.Background(), bson.M{"_id": id}).Decode(&d)
+	err := discountColl.FindOne(ctx, bson.M{"_id": id}).Decode(&d)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -164,3 +165,69 @@ func GetActiveDiscountsForProduct(shopID, productID, variantID primitive.ObjectI
 
 	return results, nil
 }
+
+// IncrementDiscountUsage records one use of a discount by a customer. The update
+// only matches while the overall usage limit has room, so concurrent orders cannot
+// push current_usage past usage_limit. MatchedCount is 0 when the limit is reached.
+func IncrementDiscountUsage(ctx context.Context, id, customerID primitive.ObjectID, amount money.Amount) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	underLimit := bson.M{"$or": []bson.M{
+		{"usage_limit": bson.M{"$exists": false}},
+		{"usage_limit": nil},
+		{"$expr": bson.M{"$lt": bson.A{"$current_usage", "$usage_limit"}}},
+	}}
+
+	// Existing usage record for this customer
+	res, err := discountColl.UpdateOne(ctx,
+		bson.M{"_id": id, "usage_tracking.customer_id": customerID, "$and": []bson.M{underLimit}},
+		bson.M{
+			"$inc": bson.M{
+				"current_usage":                1,
+				"usage_tracking.$.usage_count": 1,
+				"usage_tracking.$.total_spent": amount,
+			},
+			"$set": bson.M{"usage_tracking.$.last_used_at": now, "updated_at": now},
+		},
+	)
+	if err != nil || res.MatchedCount > 0 {
+		return res, err
+	}
+
+	// First use by this customer
+	return discountColl.UpdateOne(ctx,
+		bson.M{"_id": id, "usage_tracking.customer_id": bson.M{"$ne": customerID}, "$and": []bson.M{underLimit}},
+		bson.M{
+			"$inc": bson.M{"current_usage": 1},
+			"$push": bson.M{"usage_tracking": models.DiscountUsage{
+				CustomerID: customerID,
+				UsageCount: 1,
+				LastUsedAt: now,
+				TotalSpent: amount,
+			}},
+			"$set": bson.M{"updated_at": now},
+		},
+	)
+}
+
+// DecrementDiscountUsage gives back one use of a discount previously recorded
+// for a customer, e.g. when an order is rolled back or cancelled.
+func DecrementDiscountUsage(ctx context.Context, id, customerID primitive.ObjectID, amount money.Amount) (*mongo.UpdateResult, error) {
+	return discountColl.UpdateOne(ctx,
+		bson.M{
+			"_id":           id,
+			"current_usage": bson.M{"$gt": 0},
+			"usage_tracking": bson.M{"$elemMatch": bson.M{
+				"customer_id": customerID,
+				"usage_count": bson.M{"$gt": 0},
+			}},
+		},
+		bson.M{
+			"$inc": bson.M{
+				"current_usage":                -1,
+				"usage_tracking.$.usage_count": -1,
+				"usage_tracking.$.total_spent": -amount,
+			},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+}
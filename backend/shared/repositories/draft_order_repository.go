@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var draftOrderCol *mongo.Collection = config.GetCollection("DRPS", "draft_orders")
+
+// EnsureDraftOrderIndexes creates the index used to list a shop's drafts.
+func EnsureDraftOrderIndexes(ctx context.Context) error {
+	_, err := draftOrderCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// CreateDraftOrder inserts a draft order.
+func CreateDraftOrder(ctx context.Context, d *models.DraftOrder) error {
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	_, err := draftOrderCol.InsertOne(ctx, d)
+	return err
+}
+
+// GetDraftOrder returns one of a shop's drafts, or nil if it does not exist.
+func GetDraftOrder(ctx context.Context, shopID, id primitive.ObjectID) (*models.DraftOrder, error) {
+	var d models.DraftOrder
+	err := draftOrderCol.FindOne(ctx, bson.M{"_id": id, "shop_id": shopID}).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDraftOrdersByShop returns a shop's drafts, newest first, optionally
+// only those in one status.
+func ListDraftOrdersByShop(ctx context.Context, shopID primitive.ObjectID, status models.DraftOrderStatus) ([]models.DraftOrder, error) {
+	filter := bson.M{"shop_id": shopID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cur, err := draftOrderCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.DraftOrder
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceOpenDraftOrder overwrites a draft that is still open. MatchedCount is
+// 0 if the draft was completed or removed in the meantime.
+func ReplaceOpenDraftOrder(ctx context.Context, d *models.DraftOrder) (*mongo.UpdateResult, error) {
+	return draftOrderCol.ReplaceOne(ctx, bson.M{"_id": d.ID, "shop_id": d.ShopID, "status": models.DraftOrderStatusOpen}, d)
+}
+
+// CompleteDraftOrder marks an open draft as turned into orderID. MatchedCount
+// is 0 if the draft was no longer open, so only one order is ever made from it.
+func CompleteDraftOrder(ctx context.Context, id, orderID primitive.ObjectID, at time.Time) (*mongo.UpdateResult, error) {
+	return draftOrderCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.DraftOrderStatusOpen},
+		bson.M{"$set": bson.M{
+			"status":       models.DraftOrderStatusCompleted,
+			"order_id":     orderID,
+			"completed_at": at,
+			"updated_at":   at,
+		}})
+}
+
+// ReopenDraftOrder reverses CompleteDraftOrder. It exists only to compensate
+// a failed multi-step write on deployments without transactions.
+func ReopenDraftOrder(ctx context.Context, id primitive.ObjectID, updatedAt time.Time) (*mongo.UpdateResult, error) {
+	return draftOrderCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.DraftOrderStatusCompleted},
+		bson.M{
+			"$set":   bson.M{"status": models.DraftOrderStatusOpen, "updated_at": updatedAt},
+			"$unset": bson.M{"order_id": "", "completed_at": ""},
+		})
+}
+
+// DeleteOpenDraftOrder removes one of a shop's drafts that is still open.
+func DeleteOpenDraftOrder(ctx context.Context, shopID, id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return draftOrderCol.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID, "status": models.DraftOrderStatusOpen})
+}
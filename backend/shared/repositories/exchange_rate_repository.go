@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var exchangeRateCol *mongo.Collection = config.GetCollection("DRPS", "exchange_rates")
+
+// EnsureExchangeRateIndexes makes each currency pair unique among the rates
+// for all shops and among each shop's own.
+func EnsureExchangeRateIndexes(ctx context.Context) error {
+	_, err := exchangeRateCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "shop_id", Value: 1}, {Key: "base", Value: 1}, {Key: "quote", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// UpsertExchangeRate stores the rate for its pair, replacing the one there
+// was. A nil ShopID stores a rate for all shops.
+func UpsertExchangeRate(ctx context.Context, r *models.ExchangeRate) error {
+	if r.UpdatedAt.IsZero() {
+		r.UpdatedAt = time.Now()
+	}
+	_, err := exchangeRateCol.UpdateOne(ctx,
+		bson.M{"shop_id": r.ShopID, "base": r.Base, "quote": r.Quote},
+		bson.M{
+			"$set":         bson.M{"rate": r.Rate, "source": r.Source, "updated_at": r.UpdatedAt},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// ListExchangeRates returns a shop's own rates, or those for all shops if
+// shopID is nil.
+func ListExchangeRates(ctx context.Context, shopID *primitive.ObjectID) ([]models.ExchangeRate, error) {
+	cur, err := exchangeRateCol.Find(ctx, bson.M{"shop_id": shopID},
+		options.Find().SetSort(bson.D{{Key: "base", Value: 1}, {Key: "quote", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.ExchangeRate
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteExchangeRate removes a shop's own rate for a pair.
+func DeleteExchangeRate(ctx context.Context, shopID primitive.ObjectID, base, quote string) (*mongo.DeleteResult, error) {
+	return exchangeRateCol.DeleteOne(ctx, bson.M{"shop_id": shopID, "base": base, "quote": quote})
+}
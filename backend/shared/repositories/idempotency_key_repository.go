@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var idempotencyKeyCol *mongo.Collection = config.GetCollection("DRPS", "idempotency_keys")
+
+// EnsureIdempotencyKeyIndexes makes a key unique within its scope and expires
+// stored keys once expires_at has passed.
+func EnsureIdempotencyKeyIndexes(ctx context.Context) error {
+	_, err := idempotencyKeyCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "scope", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// CreateIdempotencyKey inserts a new key. It fails with a duplicate key error
+// if the scope already has a record for the key.
+func CreateIdempotencyKey(ctx context.Context, k *models.IdempotencyKey) error {
+	if k.ID.IsZero() {
+		k.ID = primitive.NewObjectID()
+	}
+	_, err := idempotencyKeyCol.InsertOne(ctx, k)
+	return err
+}
+
+// GetIdempotencyKey returns the record for a key in a scope, or nil.
+func GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	var k models.IdempotencyKey
+	err := idempotencyKeyCol.FindOne(ctx, bson.M{"scope": scope, "key": key}).Decode(&k)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// CompleteIdempotencyKey stores the response produced for a key.
+func CompleteIdempotencyKey(ctx context.Context, id primitive.ObjectID, status int, contentType string, body []byte) error {
+	_, err := idempotencyKeyCol.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"status":                models.IdempotencyKeyCompleted,
+			"response_status":       status,
+			"response_content_type": contentType,
+			"response_body":         body,
+		}},
+	)
+	return err
+}
+
+// DeleteIdempotencyKey forgets a key so the request may be retried.
+func DeleteIdempotencyKey(ctx context.Context, id primitive.ObjectID) error {
+	_, err := idempotencyKeyCol.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,247 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reservationCol *mongo.Collection = config.GetCollection("DRPS", "inventory_reservations")
+
+// EnsureReservationIndexes creates the lookup index and the TTL index that
+// deletes active holds once they have expired.
+func EnsureReservationIndexes(ctx context.Context) error {
+	_, err := reservationCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "product_id", Value: 1},
+				{Key: "variant_id", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "expires_at", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "cart_id", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().
+				SetExpireAfterSeconds(0).
+				SetPartialFilterExpression(bson.M{"status": models.ReservationStatusActive}),
+		},
+	})
+	return err
+}
+
+// activeReservationFilter matches holds that currently count against stock.
+func activeReservationFilter() bson.M {
+	return bson.M{
+		"status":     models.ReservationStatusActive,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+}
+
+func CreateReservation(ctx context.Context, r *models.InventoryReservation) (*mongo.InsertOneResult, error) {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	return reservationCol.InsertOne(ctx, r)
+}
+
+func DeleteReservation(ctx context.Context, id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return reservationCol.DeleteOne(ctx, bson.M{"_id": id})
+}
+
+// ListActiveReservationsByCart returns the unexpired holds placed for a cart.
+func ListActiveReservationsByCart(ctx context.Context, cartID primitive.ObjectID) ([]models.InventoryReservation, error) {
+	filter := activeReservationFilter()
+	filter["cart_id"] = cartID
+	cur, err := reservationCol.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.InventoryReservation
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SumActiveReservations totals the held quantity for a product/variant, leaving
+// out holds that belong to excludeCartID (pass NilObjectID to count all).
+func SumActiveReservations(ctx context.Context, productID, variantID, excludeCartID primitive.ObjectID) (int, error) {
+	match := activeReservationFilter()
+	match["product_id"] = productID
+	match["variant_id"] = variantID
+	if !excludeCartID.IsZero() {
+		match["cart_id"] = bson.M{"$ne": excludeCartID}
+	}
+	cur, err := reservationCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "held": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		Held int `bson:"held"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Held, nil
+}
+
+// SumActiveReservationsByVariant returns held quantities for every variant of
+// a product, keyed by variant ID (NilObjectID for the product itself).
+func SumActiveReservationsByVariant(ctx context.Context, productID, excludeCartID primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	match := activeReservationFilter()
+	match["product_id"] = productID
+	if !excludeCartID.IsZero() {
+		match["cart_id"] = bson.M{"$ne": excludeCartID}
+	}
+	cur, err := reservationCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": "$variant_id", "held": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		VariantID primitive.ObjectID `bson:"_id"`
+		Held      int                `bson:"held"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make(map[primitive.ObjectID]int, len(rows))
+	for _, r := range rows {
+		out[r.VariantID] = r.Held
+	}
+	return out, nil
+}
+
+// SumActiveReservationsByProducts returns held quantities for every variant of
+// the given products in one query, keyed by product ID and then by variant ID
+// (NilObjectID for the product itself).
+func SumActiveReservationsByProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]map[primitive.ObjectID]int, error) {
+	out := make(map[primitive.ObjectID]map[primitive.ObjectID]int)
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+	match := activeReservationFilter()
+	match["product_id"] = bson.M{"$in": productIDs}
+	cur, err := reservationCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  bson.M{"product_id": "$product_id", "variant_id": "$variant_id"},
+			"held": bson.M{"$sum": "$quantity"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		Key struct {
+			ProductID primitive.ObjectID `bson:"product_id"`
+			VariantID primitive.ObjectID `bson:"variant_id"`
+		} `bson:"_id"`
+		Held int `bson:"held"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if out[r.Key.ProductID] == nil {
+			out[r.Key.ProductID] = make(map[primitive.ObjectID]int)
+		}
+		out[r.Key.ProductID][r.Key.VariantID] = r.Held
+	}
+	return out, nil
+}
+
+// SetCartReservationsStatus moves every hold of a cart that is in status from
+// to status to, optionally recording the order that consumed them.
+func SetCartReservationsStatus(ctx context.Context, cartID primitive.ObjectID, from, to models.ReservationStatus, orderID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	set := bson.M{"status": to, "updated_at": time.Now()}
+	if !orderID.IsZero() {
+		set["order_id"] = orderID
+	}
+	return reservationCol.UpdateMany(ctx,
+		bson.M{"cart_id": cartID, "status": from},
+		bson.M{"$set": set},
+	)
+}
+
+// ListCartItemReservations returns a cart's unexpired holds on one product or
+// variant.
+func ListCartItemReservations(ctx context.Context, cartID, productID, variantID primitive.ObjectID) ([]models.InventoryReservation, error) {
+	filter := activeReservationFilter()
+	filter["cart_id"] = cartID
+	filter["product_id"] = productID
+	filter["variant_id"] = variantID
+	cur, err := reservationCol.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.InventoryReservation
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConvertReservation marks an active hold as consumed by the order.
+func ConvertReservation(ctx context.Context, id, orderID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return reservationCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.ReservationStatusActive},
+		bson.M{"$set": bson.M{"status": models.ReservationStatusConverted, "order_id": orderID, "updated_at": time.Now()}},
+	)
+}
+
+// ShrinkReservation takes by off an active hold's quantity, provided the hold
+// still holds quantity. MatchedCount is 0 if it changed in the meantime.
+func ShrinkReservation(ctx context.Context, id primitive.ObjectID, quantity, by int) (*mongo.UpdateResult, error) {
+	return reservationCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.ReservationStatusActive, "quantity": quantity},
+		bson.M{
+			"$inc": bson.M{"quantity": -by},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+}
+
+// ReleaseReservation gives back an active hold. MatchedCount is 0 if it was no
+// longer active.
+func ReleaseReservation(ctx context.Context, id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return reservationCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.ReservationStatusActive},
+		bson.M{"$set": bson.M{"status": models.ReservationStatusReleased, "updated_at": time.Now()}},
+	)
+}
+
+// ReactivateOrderReservations puts holds converted by an order back to active.
+// It is the compensation for a checkout that failed after conversion.
+func ReactivateOrderReservations(ctx context.Context, orderID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return reservationCol.UpdateMany(ctx,
+		bson.M{"order_id": orderID, "status": models.ReservationStatusConverted},
+		bson.M{
+			"$set":   bson.M{"status": models.ReservationStatusActive, "updated_at": time.Now()},
+			"$unset": bson.M{"order_id": ""},
+		},
+	)
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// orderItemAmounts and orderTaxAmounts are the amount fields of documents
+// embedded in several collections.
+var (
+	orderItemAmounts = []string{"unit_price", "total_price", "tax_amount"}
+	orderTaxAmounts  = []string{"shipping_tax"}
+)
+
+// legacyAmountFields lists, per collection, the fields holding amounts of
+// money. "[]" marks an array: "items[].unit_price" is the unit price of every
+// item.
+func legacyAmountFields() map[*mongo.Collection][]string {
+	with := func(prefix string, fields []string) []string {
+		out := make([]string, len(fields))
+		for i, f := range fields {
+			out[i] = prefix + f
+		}
+		return out
+	}
+	join := func(lists ...[]string) []string {
+		var out []string
+		for _, l := range lists {
+			out = append(out, l...)
+		}
+		return out
+	}
+	totals := []string{"subtotal", "discount_total", "shipping_cost", "tax_amount", "total", "shipping_method.amount"}
+	return map[*mongo.Collection][]string{
+		productCollection: {"price", "total", "variants[].price", "variants[].total"},
+		cartCollection: join(
+			[]string{"subtotal", "total_discounts", "shipping_cost", "tax_amount", "grand_total", "shipping_options[].amount"},
+			with("items[].", []string{"unit_price", "line_total", "discount_amount", "final_line_total", "tax_amount"})),
+		orderCol: join(totals, with("items[].", orderItemAmounts), with("tax.", orderTaxAmounts),
+			[]string{"refunded_total", "amount_due", "discount_usages[].amount"}),
+		orderEditCol: join(totals, with("items[].", orderItemAmounts), with("tax.", orderTaxAmounts),
+			[]string{"total_before", "amount_due", "refund_due"}),
+		draftOrderCol: join(totals, with("items[].", orderItemAmounts), with("tax.", orderTaxAmounts),
+			[]string{"lines[].unit_price", "shipping_options[].amount"}),
+		refundCol:       {"amount", "shipping_amount", "lines[].amount"},
+		paymentCol:      {"amount"},
+		returnCol:       {"items[].unit_price"},
+		shippingZoneCol: {"methods[].rate", "methods[].free_over", "methods[].tiers[].rate"},
+		discountColl:    {"usage_tracking[].total_spent"},
+	}
+}
+
+// MigrateLegacyAmounts rewrites amounts stored as doubles in currency units,
+// as they were before amounts were exact, as integers of minor units. Each
+// changed field is only written if it still holds what was read, so the
+// migration is safe to run while serving and does nothing once done. It
+// returns how many documents it changed.
+func MigrateLegacyAmounts(ctx context.Context) (int, error) {
+	changed := 0
+	for col, paths := range legacyAmountFields() {
+		n, err := migrateLegacyAmounts(ctx, col, paths)
+		changed += n
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+func migrateLegacyAmounts(ctx context.Context, col *mongo.Collection, paths []string) (int, error) {
+	anyDouble := bson.A{}
+	for _, p := range paths {
+		anyDouble = append(anyDouble, bson.M{strings.ReplaceAll(p, "[]", ""): bson.M{"$type": "double"}})
+	}
+	cur, err := col.Find(ctx, bson.M{"$or": anyDouble})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	changed := 0
+	for cur.Next(ctx) {
+		raw := cur.Current
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return changed, err
+		}
+		filter := bson.M{"_id": doc["_id"]}
+		set := bson.M{}
+		for _, p := range paths {
+			if money.ConvertLegacyAmounts(doc, p) {
+				top := strings.TrimSuffix(strings.Split(p, ".")[0], "[]")
+				filter[top] = raw.Lookup(top)
+				set[top] = doc[top]
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		res, err := col.UpdateOne(ctx, filter, bson.M{"$set": set})
+		if err != nil {
+			return changed, err
+		}
+		changed += int(res.ModifiedCount)
+	}
+	return changed, cur.Err()
+}
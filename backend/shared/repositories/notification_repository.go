@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var notificationCol *mongo.Collection = config.GetCollection("DRPS", "notifications")
+
+// EnsureNotificationIndexes creates the index used to list a shop's inbox.
+func EnsureNotificationIndexes(ctx context.Context) error {
+	_, err := notificationCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "shop_id", Value: 1},
+			{Key: "recipient_role", Value: 1},
+			{Key: "created_at", Value: -1},
+		},
+	})
+	return err
+}
+
+// CreateNotification stores a notification.
+func CreateNotification(ctx context.Context, n *models.Notification) error {
+	if n.ID.IsZero() {
+		n.ID = primitive.NewObjectID()
+	}
+	_, err := notificationCol.InsertOne(ctx, n)
+	return err
+}
+
+// ListNotifications returns the newest notifications for a recipient in a
+// shop, optionally only the unread ones.
+func ListNotifications(ctx context.Context, shopID primitive.ObjectID, role models.OrderActorRole, recipientID primitive.ObjectID, unreadOnly bool, limit int64) ([]models.Notification, error) {
+	filter := bson.M{"shop_id": shopID, "recipient_role": role, "recipient_id": recipientID}
+	if unreadOnly {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+	cur, err := notificationCol.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Notification
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MarkNotificationRead stamps a recipient's notification as read.
+func MarkNotificationRead(ctx context.Context, id, recipientID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return notificationCol.UpdateOne(ctx,
+		bson.M{"_id": id, "recipient_id": recipientID, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": time.Now()}},
+	)
+}
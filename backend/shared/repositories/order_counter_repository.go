@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orderCounterCol *mongo.Collection = config.GetCollection("DRPS", "order_counters")
+
+// orderCounter is one shop's sequence for one numbering period.
+type orderCounter struct {
+	ShopID primitive.ObjectID `bson:"shop_id"`
+	Period string             `bson:"period"`
+	Seq    int64              `bson:"seq"`
+}
+
+// EnsureOrderCounterIndexes makes (shop_id, period) unique so concurrent
+// first-use upserts cannot create two counters for the same sequence.
+func EnsureOrderCounterIndexes(ctx context.Context) error {
+	_, err := orderCounterCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "shop_id", Value: 1}, {Key: "period", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// NextOrderSequence atomically increments and returns a shop's counter for
+// period, creating it at 1 on first use. An empty period is a sequence that
+// never resets.
+func NextOrderSequence(ctx context.Context, shopID primitive.ObjectID, period string) (int64, error) {
+	return incOrderCounter(ctx, shopID, period, 1)
+}
+
+// SeedOrderCounters moves every shop's counters past the order numbers issued
+// before counters existed. Numbers are split into the prefix before their
+// trailing digits, which is the counter key, and the sequence; each counter is
+// raised to the highest sequence with $max, so running it again changes
+// nothing. The unique counter index is ensured first so instances starting
+// together cannot seed the same counter twice. It returns how many counters
+// were created or raised.
+func SeedOrderCounters(ctx context.Context) (int, error) {
+	if err := EnsureOrderCounterIndexes(ctx); err != nil {
+		return 0, err
+	}
+	cur, err := orderCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"order_number": bson.M{"$regex": `\D\d+$`}}}},
+		{{Key: "$project", Value: bson.M{
+			"shop_id": 1,
+			"number":  bson.M{"$regexFind": bson.M{"input": "$order_number", "regex": `^(.*\D)(\d+)$`}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"shop_id": "$shop_id", "period": bson.M{"$arrayElemAt": bson.A{"$number.captures", 0}}},
+			"seq": bson.M{"$max": bson.M{"$convert": bson.M{
+				"input":   bson.M{"$arrayElemAt": bson.A{"$number.captures", 1}},
+				"to":      "long",
+				"onError": 0,
+			}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		Key struct {
+			ShopID primitive.ObjectID `bson:"shop_id"`
+			Period string             `bson:"period"`
+		} `bson:"_id"`
+		Seq int64 `bson:"seq"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return 0, err
+	}
+
+	seeded := 0
+	for _, r := range rows {
+		if r.Seq <= 0 {
+			continue
+		}
+		filter := bson.M{"shop_id": r.Key.ShopID, "period": r.Key.Period}
+		update := bson.M{"$max": bson.M{"seq": r.Seq}}
+		res, err := orderCounterCol.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			// Another instance created the counter first; raise it instead.
+			res, err = orderCounterCol.UpdateOne(ctx, filter, update)
+		}
+		if err != nil {
+			return seeded, err
+		}
+		if res.ModifiedCount > 0 || res.UpsertedCount > 0 {
+			seeded++
+		}
+	}
+	return seeded, nil
+}
+
+// invoiceCounterPeriod keys a shop's invoice sequence. Order number prefixes
+// cannot contain ':', so it never collides with an order counter.
+const invoiceCounterPeriod = "invoice:"
+
+// NextInvoiceSequence atomically increments and returns a shop's invoice
+// counter, which never resets.
+func NextInvoiceSequence(ctx context.Context, shopID primitive.ObjectID) (int64, error) {
+	return incOrderCounter(ctx, shopID, invoiceCounterPeriod, 1)
+}
+
+// draftOrderCounterPeriod keys a shop's draft order sequence, like
+// invoiceCounterPeriod.
+const draftOrderCounterPeriod = "draft:"
+
+// NextDraftOrderSequence atomically increments and returns a shop's draft
+// order counter, which never resets.
+func NextDraftOrderSequence(ctx context.Context, shopID primitive.ObjectID) (int64, error) {
+	return incOrderCounter(ctx, shopID, draftOrderCounterPeriod, 1)
+}
+
+func incOrderCounter(ctx context.Context, shopID primitive.ObjectID, period string, n int64) (int64, error) {
+	filter := bson.M{"shop_id": shopID, "period": period}
+	update := bson.M{"$inc": bson.M{"seq": n}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var c orderCounter
+	err := orderCounterCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&c)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost a first-use upsert race; the counter exists now.
+		err = orderCounterCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&c)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return c.Seq, nil
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orderEditCol *mongo.Collection = config.GetCollection("DRPS", "order_edits")
+
+// EnsureOrderEditIndexes creates the index used to list an order's edits and
+// a partial unique index so an order has at most one open edit.
+func EnsureOrderEditIndexes(ctx context.Context) error {
+	_, err := orderEditCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.OrderEditStatusOpen}).
+				SetName("order_id_open_edit"),
+		},
+	})
+	return err
+}
+
+// CreateOrderEdit inserts an order edit. Opening a second edit on the same
+// order fails with a duplicate key error.
+func CreateOrderEdit(ctx context.Context, e *models.OrderEdit) error {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	_, err := orderEditCol.InsertOne(ctx, e)
+	return err
+}
+
+// GetOrderEdit returns one of an order's edits, or nil if it does not exist.
+func GetOrderEdit(ctx context.Context, orderID, id primitive.ObjectID) (*models.OrderEdit, error) {
+	var e models.OrderEdit
+	err := orderEditCol.FindOne(ctx, bson.M{"_id": id, "order_id": orderID}).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetOpenOrderEdit returns an order's open edit, or nil if there is none.
+func GetOpenOrderEdit(ctx context.Context, orderID primitive.ObjectID) (*models.OrderEdit, error) {
+	var e models.OrderEdit
+	err := orderEditCol.FindOne(ctx, bson.M{"order_id": orderID, "status": models.OrderEditStatusOpen}).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListOrderEdits returns an order's edits, oldest first.
+func ListOrderEdits(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEdit, error) {
+	cur, err := orderEditCol.Find(ctx, bson.M{"order_id": orderID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.OrderEdit
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceOpenOrderEdit overwrites an edit that is still open. MatchedCount is
+// 0 if it was committed or discarded in the meantime.
+func ReplaceOpenOrderEdit(ctx context.Context, e *models.OrderEdit) (*mongo.UpdateResult, error) {
+	return orderEditCol.ReplaceOne(ctx, bson.M{"_id": e.ID, "status": models.OrderEditStatusOpen}, e)
+}
+
+// SetOrderEditStatus moves an edit from one status to another and sets
+// fields with it. MatchedCount is 0 if the edit was no longer in from.
+func SetOrderEditStatus(ctx context.Context, id primitive.ObjectID, from, to models.OrderEditStatus, set bson.M) (*mongo.UpdateResult, error) {
+	fields := bson.M{"status": to}
+	for k, v := range set {
+		fields[k] = v
+	}
+	return orderEditCol.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": fields})
+}
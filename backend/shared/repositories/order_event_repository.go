@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orderEventCol *mongo.Collection = config.GetCollection("DRPS", "order_events")
+
+// EnsureOrderEventIndexes creates the index used to read an order's timeline.
+func EnsureOrderEventIndexes(ctx context.Context) error {
+	_, err := orderEventCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// CreateOrderEvent appends an event to an order's timeline.
+func CreateOrderEvent(ctx context.Context, e *models.OrderEvent) (*mongo.InsertOneResult, error) {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	return orderEventCol.InsertOne(ctx, e)
+}
+
+// DeleteOrderEvent removes an event. It exists only to compensate a failed
+// multi-step write on deployments without transactions.
+func DeleteOrderEvent(ctx context.Context, id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return orderEventCol.DeleteOne(ctx, bson.M{"_id": id})
+}
+
+// ListOrderEvents returns an order's timeline, oldest first.
+func ListOrderEvents(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEvent, error) {
+	cur, err := orderEventCol.Find(ctx, bson.M{"order_id": orderID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.OrderEvent
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -3,9 +3,11 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/Endale2/DRPS/config"
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,6 +16,30 @@ import (
 
 var orderCol *mongo.Collection = config.GetCollection("DRPS", "orders")
 
+// EnsureOrderIndexes makes order numbers unique within a shop. Orders without
+// a number are left out of the index. It also indexes what risk checks count
+// recent orders by: customer, IP and email.
+func EnsureOrderIndexes(ctx context.Context) error {
+	_, err := orderCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "order_number", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"order_number": bson.M{"$gt": ""}}),
+		},
+		{Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "customer_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "shop_id", Value: 1}, {Key: "risk.ip", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"risk.ip": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys:    bson.D{{Key: "shop_id", Value: 1}, {Key: "risk.email", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"risk.email": bson.M{"$gt": ""}}),
+		},
+	})
+	return err
+}
+
 func CreateOrder(ctx context.Context, o *models.Order) (*mongo.InsertOneResult, error) {
 	return orderCol.InsertOne(ctx, o)
 }
@@ -80,6 +106,41 @@ func ListOrdersPaginated(ctx context.Context, filter bson.M, page, limit int) ([
 	return out, total, err
 }
 
+// EachOrder calls fn with every order matching filter, oldest first, reading
+// them from the database as it goes. It stops at the first error fn returns.
+func EachOrder(ctx context.Context, filter bson.M, fn func(*models.Order) error) error {
+	cur, err := orderCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetBatchSize(200))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var o models.Order
+		if err := cur.Decode(&o); err != nil {
+			return err
+		}
+		if err := fn(&o); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// ListOrdersLimited returns at most limit orders matching filter, newest
+// first.
+func ListOrdersLimited(ctx context.Context, filter bson.M, limit int) ([]models.Order, error) {
+	cur, err := orderCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.Order
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func UpdateOrder(ctx context.Context, hexID string, upd bson.M) (*mongo.UpdateResult, error) {
 	id, _ := primitive.ObjectIDFromHex(hexID)
 	return orderCol.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": upd})
@@ -93,3 +154,154 @@ func DeleteOrder(ctx context.Context, hexID string) (*mongo.DeleteResult, error)
 func CountOrders(ctx context.Context, filter bson.M) (int64, error) {
 	return orderCol.CountDocuments(ctx, filter)
 }
+
+// UpdateOrderStatus moves an order from one status to another. The filter on
+// the current status makes concurrent transitions of the same order fail
+// instead of overwriting each other; MatchedCount is 0 in that case.
+func UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus, set bson.M) (*mongo.UpdateResult, error) {
+	upd := bson.M{"status": to}
+	for k, v := range set {
+		upd[k] = v
+	}
+	return orderCol.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": upd})
+}
+
+// SetOrderFields sets fields on an order inside ctx, which may carry a session.
+func SetOrderFields(ctx context.Context, id primitive.ObjectID, set bson.M) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+// DuplicateOrderNumber is an order number that several orders of one shop
+// share, with those orders oldest first.
+type DuplicateOrderNumber struct {
+	ShopID      primitive.ObjectID   `bson:"shop_id"`
+	OrderNumber string               `bson:"order_number"`
+	OrderIDs    []primitive.ObjectID `bson:"order_ids"`
+}
+
+// ListDuplicateOrderNumbers finds the order numbers used more than once within
+// a shop, as they could be before numbers came from counters.
+func ListDuplicateOrderNumbers(ctx context.Context) ([]DuplicateOrderNumber, error) {
+	cur, err := orderCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"order_number": bson.M{"$gt": ""}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"shop_id": "$shop_id", "order_number": "$order_number"},
+			"order_ids": bson.M{"$push": "$_id"},
+			"count":     bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$project", Value: bson.M{
+			"shop_id":      "$_id.shop_id",
+			"order_number": "$_id.order_number",
+			"order_ids":    1,
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []DuplicateOrderNumber
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrderNumberExists reports whether a shop has an order with the number.
+func OrderNumberExists(ctx context.Context, shopID primitive.ObjectID, number string) (bool, error) {
+	n, err := orderCol.CountDocuments(ctx, bson.M{"shop_id": shopID, "order_number": number}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// RenumberOrder changes an order's number from one value to another. MatchedCount
+// is 0 if the order no longer has the old number.
+func RenumberOrder(ctx context.Context, id primitive.ObjectID, from, to string) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateOne(ctx,
+		bson.M{"_id": id, "order_number": from},
+		bson.M{"$set": bson.M{"order_number": to, "updated_at": time.Now()}})
+}
+
+// ListCustomerOrderShopIDs returns the shops a customer has ordered from.
+func ListCustomerOrderShopIDs(ctx context.Context, customerID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := orderCol.Distinct(ctx, "shop_id", bson.M{"customer_id": customerID})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ReassignCustomerOrders moves every order of one customer to another.
+func ReassignCustomerOrders(ctx context.Context, from, to primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateMany(ctx,
+		bson.M{"customer_id": from},
+		bson.M{"$set": bson.M{"customer_id": to, "updated_at": time.Now()}})
+}
+
+// IncrementOrderShipmentCount adds one to an order's shipment count if it is
+// still count. MatchedCount is 0 if another shipment was added first.
+func IncrementOrderShipmentCount(ctx context.Context, id primitive.ObjectID, count int) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id, "shipment_count": count}
+	if count == 0 {
+		filter["shipment_count"] = bson.M{"$in": []interface{}{nil, 0}}
+	}
+	return orderCol.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"shipment_count": 1}})
+}
+
+// DecrementOrderShipmentCount takes one off an order's shipment count.
+func DecrementOrderShipmentCount(ctx context.Context, id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"shipment_count": -1}})
+}
+
+// SetOrderInvoiceNumber sets an order's invoice number unless it already has
+// one. MatchedCount is 0 if another request numbered it first.
+func SetOrderInvoiceNumber(ctx context.Context, id primitive.ObjectID, number string) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateOne(ctx,
+		bson.M{"_id": id, "invoice_number": bson.M{"$in": []interface{}{nil, ""}}},
+		bson.M{"$set": bson.M{"invoice_number": number}})
+}
+
+// AdjustOrderRefundedTotal adds delta to an order's refunded total and sets its
+// payment status, only if the refunded total is still expected. MatchedCount
+// is 0 if another refund changed it first.
+func AdjustOrderRefundedTotal(ctx context.Context, id primitive.ObjectID, expected, delta money.Amount, paymentStatus string) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id, "refunded_total": expected}
+	if expected == 0 {
+		filter = bson.M{"_id": id, "$or": bson.A{
+			bson.M{"refunded_total": 0},
+			bson.M{"refunded_total": bson.M{"$exists": false}},
+		}}
+	}
+	return orderCol.UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{"refunded_total": delta},
+		"$set": bson.M{"payment_status": paymentStatus, "updated_at": time.Now()},
+	})
+}
+
+// SetOrderFieldsIfUnchanged sets fields on an order only if it has not been
+// updated since expectedUpdatedAt. MatchedCount is 0 if it was.
+func SetOrderFieldsIfUnchanged(ctx context.Context, id primitive.ObjectID, expectedUpdatedAt time.Time, set bson.M) (*mongo.UpdateResult, error) {
+	return orderCol.UpdateOne(ctx, bson.M{"_id": id, "updated_at": expectedUpdatedAt}, bson.M{"$set": set})
+}
+
+// AdjustOrderAmountDue adds delta to what is owed on an order, only if the
+// amount due is still expected. MatchedCount is 0 if it changed first.
+func AdjustOrderAmountDue(ctx context.Context, id primitive.ObjectID, expected, delta money.Amount) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id, "amount_due": expected}
+	if expected == 0 {
+		filter = bson.M{"_id": id, "$or": bson.A{
+			bson.M{"amount_due": 0},
+			bson.M{"amount_due": bson.M{"$exists": false}},
+		}}
+	}
+	return orderCol.UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{"amount_due": delta},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var otpFailureCol *mongo.Collection = config.GetCollection("DRPS", "otp_failures")
+
+// otpFailureRetention is how long failed sign-in attempts are kept.
+const otpFailureRetention = 24 * time.Hour
+
+// EnsureOTPFailureIndexes indexes failures by email and expires them after
+// otpFailureRetention.
+func EnsureOTPFailureIndexes(ctx context.Context) error {
+	_, err := otpFailureCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(otpFailureRetention.Seconds())),
+		},
+	})
+	return err
+}
+
+// RecordOTPFailure notes a failed sign-in attempt for an email.
+func RecordOTPFailure(ctx context.Context, email string) error {
+	_, err := otpFailureCol.InsertOne(ctx, models.OTPFailure{
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// CountOTPFailures counts the failed sign-in attempts for an email since a
+// time.
+func CountOTPFailures(ctx context.Context, email string, since time.Time) (int64, error) {
+	return otpFailureCol.CountDocuments(ctx, bson.M{
+		"email":      strings.ToLower(strings.TrimSpace(email)),
+		"created_at": bson.M{"$gte": since},
+	})
+}
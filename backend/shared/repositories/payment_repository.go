@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var paymentCol *mongo.Collection = config.GetCollection("DRPS", "payments")
+
+// EnsurePaymentIndexes creates the unique index webhooks look payments up by,
+// and the index used to list an order's payments.
+func EnsurePaymentIndexes(ctx context.Context) error {
+	_, err := paymentCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "reference", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	})
+	return err
+}
+
+// CreatePayment inserts a payment.
+func CreatePayment(ctx context.Context, p *models.Payment) error {
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	_, err := paymentCol.InsertOne(ctx, p)
+	return err
+}
+
+// GetPaymentByReference returns the payment a provider knows by reference, or
+// nil if there is none.
+func GetPaymentByReference(ctx context.Context, provider, reference string) (*models.Payment, error) {
+	var p models.Payment
+	err := paymentCol.FindOne(ctx, bson.M{"provider": provider, "reference": reference}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPaymentsByOrder returns an order's payments, oldest first.
+func ListPaymentsByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Payment, error) {
+	cur, err := paymentCol.Find(ctx, bson.M{"order_id": orderID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Payment
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdatePaymentStatus moves a payment from one status to another and sets the
+// given fields, only if it is still in status from. MatchedCount is 0 if a
+// concurrent change got there first.
+func UpdatePaymentStatus(ctx context.Context, id primitive.ObjectID, from, to models.PaymentAttemptStatus, set bson.M) (*mongo.UpdateResult, error) {
+	fields := bson.M{"status": to}
+	for k, v := range set {
+		fields[k] = v
+	}
+	return paymentCol.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": fields})
+}
+
+// DeletePayment removes a payment. It exists only to compensate a failed
+// multi-step write on deployments without transactions.
+func DeletePayment(ctx context.Context, id primitive.ObjectID) error {
+	_, err := paymentCol.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
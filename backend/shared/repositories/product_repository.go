@@ -177,3 +177,63 @@ func GetProductsByFilterPaginated(filter bson.M, page, limit int) ([]models.Prod
 	}
 	return products, total, nil
 }
+
+// IncrementProductStock adds delta (which may be negative) to a product's stock.
+func IncrementProductStock(ctx context.Context, productID primitive.ObjectID, delta int) (*mongo.UpdateResult, error) {
+	return productCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": productID},
+		bson.M{
+			"$inc": bson.M{"stock": delta},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+	)
+}
+
+// IncrementVariantStock adds delta (which may be negative) to a variant's stock
+// and to the product's aggregate stock in a single update.
+func IncrementVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, delta int) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	return productCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": productID, "variants.variant_id": variantID},
+		bson.M{
+			"$inc": bson.M{"variants.$.stock": delta, "stock": delta},
+			"$set": bson.M{"variants.$.updatedAt": now, "updatedAt": now},
+		},
+	)
+}
+
+// DecrementProductStock takes quantity off a product's stock only if at least
+// that much is available. MatchedCount is 0 when the stock would go negative.
+func DecrementProductStock(ctx context.Context, productID primitive.ObjectID, quantity int) (*mongo.UpdateResult, error) {
+	return productCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": productID, "stock": bson.M{"$gte": quantity}},
+		bson.M{
+			"$inc": bson.M{"stock": -quantity},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+	)
+}
+
+// DecrementVariantStock takes quantity off a variant's stock, and off the
+// product's aggregate stock, only if the variant has at least that much.
+// MatchedCount is 0 when the variant stock would go negative.
+func DecrementVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	return productCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": productID,
+			"variants": bson.M{"$elemMatch": bson.M{
+				"variant_id": variantID,
+				"stock":      bson.M{"$gte": quantity},
+			}},
+		},
+		bson.M{
+			"$inc": bson.M{"variants.$.stock": -quantity, "stock": -quantity},
+			"$set": bson.M{"variants.$.updatedAt": now, "updatedAt": now},
+		},
+	)
+}
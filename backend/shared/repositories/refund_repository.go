@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var refundCol *mongo.Collection = config.GetCollection("DRPS", "refunds")
+
+// EnsureRefundIndexes creates the indexes used to read an order's and a
+// shop's refund ledger.
+func EnsureRefundIndexes(ctx context.Context) error {
+	_, err := refundCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// CreateRefund appends an entry to the refund ledger.
+func CreateRefund(ctx context.Context, r *models.Refund) error {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	_, err := refundCol.InsertOne(ctx, r)
+	return err
+}
+
+// DeleteRefund removes a ledger entry. It exists only to compensate a failed
+// multi-step write on deployments without transactions.
+func DeleteRefund(ctx context.Context, id primitive.ObjectID) error {
+	_, err := refundCol.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// SetRefundOutcome moves a pending refund to succeeded or failed.
+func SetRefundOutcome(ctx context.Context, id primitive.ObjectID, status models.RefundStatus, set bson.M) (*mongo.UpdateResult, error) {
+	fields := bson.M{"status": status, "updated_at": time.Now()}
+	for k, v := range set {
+		fields[k] = v
+	}
+	return refundCol.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.RefundStatusPending},
+		bson.M{"$set": fields},
+	)
+}
+
+// ListRefunds returns the ledger entries matching filter, oldest first.
+func ListRefunds(ctx context.Context, filter bson.M) ([]models.Refund, error) {
+	cur, err := refundCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Refund
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var returnCol *mongo.Collection = config.GetCollection("DRPS", "returns")
+
+// EnsureReturnIndexes creates the indexes used to list a shop's and an
+// order's returns.
+func EnsureReturnIndexes(ctx context.Context) error {
+	_, err := returnCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+	})
+	return err
+}
+
+// CreateReturn inserts a return request.
+func CreateReturn(ctx context.Context, r *models.ReturnRequest) error {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	_, err := returnCol.InsertOne(ctx, r)
+	return err
+}
+
+// DeleteReturn removes a return request. It exists only to compensate a failed
+// multi-step write on deployments without transactions.
+func DeleteReturn(ctx context.Context, id primitive.ObjectID) error {
+	_, err := returnCol.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// GetReturnByID returns a return request, or nil if it does not exist.
+func GetReturnByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	var r models.ReturnRequest
+	err := returnCol.FindOne(ctx, bson.M{"_id": id}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListReturns returns the return requests matching filter, newest first.
+func ListReturns(ctx context.Context, filter bson.M) ([]models.ReturnRequest, error) {
+	cur, err := returnCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.ReturnRequest
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateReturnStatus moves a return from one status to another and sets the
+// given fields, only if it is still in status from. MatchedCount is 0 if a
+// concurrent change got there first.
+func UpdateReturnStatus(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, set bson.M) (*mongo.UpdateResult, error) {
+	fields := bson.M{"status": to}
+	for k, v := range set {
+		fields[k] = v
+	}
+	return returnCol.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": fields})
+}
+
+// SetReturnFields sets fields on a return without any status guard.
+func SetReturnFields(ctx context.Context, id primitive.ObjectID, set bson.M) (*mongo.UpdateResult, error) {
+	return returnCol.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+}
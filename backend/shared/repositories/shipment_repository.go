@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var shipmentCol *mongo.Collection = config.GetCollection("DRPS", "shipments")
+
+// EnsureShipmentIndexes creates the index used to list an order's shipments.
+func EnsureShipmentIndexes(ctx context.Context) error {
+	_, err := shipmentCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// CreateShipment inserts a shipment.
+func CreateShipment(ctx context.Context, s *models.Shipment) error {
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	_, err := shipmentCol.InsertOne(ctx, s)
+	return err
+}
+
+// DeleteShipment removes a shipment. It exists only to compensate a failed
+// multi-step write on deployments without transactions.
+func DeleteShipment(ctx context.Context, id primitive.ObjectID) error {
+	_, err := shipmentCol.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// ListShipmentsByOrder returns an order's shipments, oldest first.
+func ListShipmentsByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	cur, err := shipmentCol.Find(ctx, bson.M{"order_id": orderID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Shipment
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var shippingZoneCol *mongo.Collection = config.GetCollection("DRPS", "shipping_zones")
+
+// EnsureShippingZoneIndexes creates the index used to load a shop's zones.
+func EnsureShippingZoneIndexes(ctx context.Context) error {
+	_, err := shippingZoneCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// CreateShippingZone inserts a shipping zone.
+func CreateShippingZone(ctx context.Context, z *models.ShippingZone) error {
+	if z.ID.IsZero() {
+		z.ID = primitive.NewObjectID()
+	}
+	_, err := shippingZoneCol.InsertOne(ctx, z)
+	return err
+}
+
+// GetShippingZone returns one of a shop's zones, or nil if it does not exist.
+func GetShippingZone(ctx context.Context, shopID, id primitive.ObjectID) (*models.ShippingZone, error) {
+	var z models.ShippingZone
+	err := shippingZoneCol.FindOne(ctx, bson.M{"_id": id, "shop_id": shopID}).Decode(&z)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &z, nil
+}
+
+// ListShippingZonesByShop returns a shop's zones, oldest first.
+func ListShippingZonesByShop(ctx context.Context, shopID primitive.ObjectID) ([]models.ShippingZone, error) {
+	cur, err := shippingZoneCol.Find(ctx, bson.M{"shop_id": shopID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.ShippingZone
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceShippingZone overwrites one of a shop's zones.
+func ReplaceShippingZone(ctx context.Context, z *models.ShippingZone) (*mongo.UpdateResult, error) {
+	return shippingZoneCol.ReplaceOne(ctx, bson.M{"_id": z.ID, "shop_id": z.ShopID}, z)
+}
+
+// DeleteShippingZone removes one of a shop's zones.
+func DeleteShippingZone(ctx context.Context, shopID, id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return shippingZoneCol.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID})
+}
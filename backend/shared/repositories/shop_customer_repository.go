@@ -22,6 +22,12 @@ func CreateShopCustomerLink(link *models.ShopCustomer) (*mongo.InsertOneResult,
     return shopCustomerColl.InsertOne(context.Background(), link)
 }
 
+// InsertShopCustomerLink adds a link whose ID and timestamps are already set,
+// using ctx so it can be part of a transaction.
+func InsertShopCustomerLink(ctx context.Context, link *models.ShopCustomer) (*mongo.InsertOneResult, error) {
+    return shopCustomerColl.InsertOne(ctx, link)
+}
+
 // GetCustomersByShop returns all ShopCustomer links for one shop.
 func GetShopCustomerLinks(shopID primitive.ObjectID) ([]models.ShopCustomer, error) {
     cursor, err := shopCustomerColl.Find(context.Background(), bson.M{"shopId": shopID})
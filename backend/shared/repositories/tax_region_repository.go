@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var taxRegionCol *mongo.Collection = config.GetCollection("DRPS", "tax_regions")
+
+// EnsureTaxRegionIndexes creates the index used to load a shop's tax regions.
+func EnsureTaxRegionIndexes(ctx context.Context) error {
+	_, err := taxRegionCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "shop_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// CreateTaxRegion inserts a tax region.
+func CreateTaxRegion(ctx context.Context, r *models.TaxRegion) error {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	_, err := taxRegionCol.InsertOne(ctx, r)
+	return err
+}
+
+// GetTaxRegion returns one of a shop's tax regions, or nil if it does not exist.
+func GetTaxRegion(ctx context.Context, shopID, id primitive.ObjectID) (*models.TaxRegion, error) {
+	var r models.TaxRegion
+	err := taxRegionCol.FindOne(ctx, bson.M{"_id": id, "shop_id": shopID}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListTaxRegionsByShop returns a shop's tax regions, oldest first.
+func ListTaxRegionsByShop(ctx context.Context, shopID primitive.ObjectID) ([]models.TaxRegion, error) {
+	cur, err := taxRegionCol.Find(ctx, bson.M{"shop_id": shopID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.TaxRegion
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceTaxRegion overwrites one of a shop's tax regions.
+func ReplaceTaxRegion(ctx context.Context, r *models.TaxRegion) (*mongo.UpdateResult, error) {
+	return taxRegionCol.ReplaceOne(ctx, bson.M{"_id": r.ID, "shop_id": r.ShopID}, r)
+}
+
+// DeleteTaxRegion removes one of a shop's tax regions.
+func DeleteTaxRegion(ctx context.Context, shopID, id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return taxRegionCol.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID})
+}
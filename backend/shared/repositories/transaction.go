@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Endale2/DRPS/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrTransactionsUnsupported is returned by WithTransaction when the connected
+// deployment is a standalone server that cannot run multi-document transactions.
+var ErrTransactionsUnsupported = errors.New("transactions are not supported by this deployment")
+
+var (
+	txnSupportMu     sync.Mutex
+	txnSupportProbed bool
+	txnSupported     bool
+)
+
+// SupportsTransactions reports whether the MongoDB deployment is a replica set
+// or sharded cluster, as answered by the hello command. The answer is cached;
+// when the probe fails its error is returned and the probe is retried on the
+// next call, so an unreachable server is never taken for a standalone one.
+func SupportsTransactions() (bool, error) {
+	txnSupportMu.Lock()
+	defer txnSupportMu.Unlock()
+	if txnSupportProbed {
+		return txnSupported, nil
+	}
+
+	var hello bson.M
+	err := config.DB.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, fmt.Errorf("probe transaction support: %w", err)
+	}
+	_, isReplicaSet := hello["setName"]
+	msg, _ := hello["msg"].(string)
+	txnSupported = isReplicaSet || msg == "isdbgrid"
+	txnSupportProbed = true
+	return txnSupported, nil
+}
+
+// WithTransaction runs fn inside a multi-document transaction. The context passed
+// to fn carries the session and must be used for every read and write that belongs
+// to the transaction. Transient errors are retried by the driver. It returns
+// ErrTransactionsUnsupported only when the server reports a standalone
+// deployment; if that cannot be determined the probe error is returned.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	supported, err := SupportsTransactions()
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return ErrTransactionsUnsupported
+	}
+
+	session, err := config.DB.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
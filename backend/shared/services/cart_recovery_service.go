@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrInvalidCartRecovery = errors.New("invalid cart recovery settings")
+
+// Carts left untouched longer than this are past recovering and are not
+// emailed about, however long the shop waits before calling a cart abandoned.
+const cartRecoveryMaxAge = 7 * 24 * time.Hour
+
+// An order placed within this long of a recovery email is credited to it.
+const cartRecoveryAttributionWindow = 7 * 24 * time.Hour
+
+// CartRecoveryMetrics summarises a shop's abandoned cart emails for analytics.
+type CartRecoveryMetrics struct {
+	EmailsSent       int          `json:"emails_sent"`
+	Recovered        int          `json:"recovered"`
+	RecoveryRate     float64      `json:"recovery_rate"`   // recovered / emails sent
+	AbandonedValue   money.Amount `json:"abandoned_value"` // cart totals when emailed
+	RecoveredRevenue money.Amount `json:"recovered_revenue"`
+	DiscountsOffered int          `json:"discounts_offered"`
+}
+
+// CartRecoverySettingsFor returns the shop's cart recovery settings.
+func CartRecoverySettingsFor(shop *models.Shop) models.CartRecoverySettings {
+	if shop.CartRecovery != nil {
+		return *shop.CartRecovery
+	}
+	return models.DefaultCartRecovery
+}
+
+// ValidateCartRecoverySettings checks seller-supplied cart recovery settings.
+func ValidateCartRecoverySettings(s models.CartRecoverySettings) error {
+	maxHours := int(cartRecoveryMaxAge / time.Hour)
+	if s.AbandonedAfterHours < 1 || s.AbandonedAfterHours > maxHours {
+		return fmt.Errorf("%w: abandonedAfterHours must be between 1 and %d", ErrInvalidCartRecovery, maxHours)
+	}
+	if s.DiscountPercent == 0 {
+		return nil
+	}
+	if err := ValidateDiscountValue(models.DiscountTypePercentage, s.DiscountPercent); err != nil {
+		return fmt.Errorf("%w: discountPercent: %v", ErrInvalidCartRecovery, err)
+	}
+	if s.DiscountValidHours < 1 {
+		return fmt.Errorf("%w: discountValidHours must be at least 1 when a discount is offered", ErrInvalidCartRecovery)
+	}
+	return nil
+}
+
+// cartRecoveryInterval is how often abandoned carts are looked for:
+// CART_RECOVERY_INTERVAL_MINUTES or hourly.
+func cartRecoveryInterval() time.Duration {
+	if v := os.Getenv("CART_RECOVERY_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Minute
+		}
+	}
+	return time.Hour
+}
+
+// StartCartRecovery looks for abandoned carts now and then periodically, in
+// the background, emailing their customers.
+func StartCartRecovery() {
+	run := func() {
+		if n, err := RunCartRecoveryService(time.Now()); err != nil {
+			log.Printf("cart recovery: run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("cart recovery: emailed %d abandoned carts", n)
+		}
+	}
+	go func() {
+		run()
+		ticker := time.NewTicker(cartRecoveryInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
+
+// RunCartRecoveryService emails the customers of every shop's abandoned carts
+// and returns how many were emailed. A cart that fails is logged and left for
+// the next run.
+func RunCartRecoveryService(now time.Time) (int, error) {
+	shops, err := repositories.GetAllShops()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for i := range shops {
+		shop := &shops[i]
+		settings := CartRecoverySettingsFor(shop)
+		if !settings.Enabled {
+			continue
+		}
+		before := now.Add(-time.Duration(settings.AbandonedAfterHours) * time.Hour)
+		carts, err := repositories.ListAbandonedCarts(context.Background(), shop.ID, before, before.Add(-cartRecoveryMaxAge))
+		if err != nil {
+			log.Printf("cart recovery: shop %s: %v", shop.ID.Hex(), err)
+			continue
+		}
+		for j := range carts {
+			ok, err := recoverCart(shop, &carts[j], settings, now)
+			if err != nil {
+				log.Printf("cart recovery: cart %s: %v", carts[j].ID.Hex(), err)
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// recoverCart emails the customer about their abandoned cart, with a discount
+// if the shop offers one, and records it. It reports whether an email was
+// sent; carts whose customer ordered since, or has no email, are skipped.
+func recoverCart(shop *models.Shop, cart *models.Cart, settings models.CartRecoverySettings, now time.Time) (bool, error) {
+	ctx := context.Background()
+	customerID := cartCustomerID(cart)
+	ordered, err := repositories.CountOrders(ctx, bson.M{
+		"shop_id":     shop.ID,
+		"customer_id": customerID,
+		"created_at":  bson.M{"$gte": cart.LastActivity()},
+	})
+	if err != nil || ordered > 0 {
+		return false, err
+	}
+	customer, err := repositories.GetCustomerByID(customerID.Hex())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(customer.Email) == "" {
+		return false, nil
+	}
+
+	claimed, err := repositories.ClaimCartForRecovery(ctx, cart, now)
+	if err != nil || !claimed {
+		return false, err
+	}
+	recovery := &models.CartRecovery{
+		ShopID:     shop.ID,
+		CartID:     cart.ID,
+		CustomerID: customerID,
+		Email:      customer.Email,
+		CartTotal:  cart.GrandTotal,
+		SentAt:     now,
+	}
+	var discount *models.Discount
+	if settings.DiscountPercent > 0 {
+		discount, err = createRecoveryDiscount(shop, cart, settings, now)
+		if err != nil {
+			_ = repositories.ReleaseCartRecoveryClaim(ctx, cart, now)
+			return false, err
+		}
+		recovery.DiscountID = discount.ID
+		recovery.DiscountCode = discount.Code
+		recovery.DiscountExpiresAt = &discount.EndAt
+	}
+
+	email := &Email{
+		To:      customer.Email,
+		Subject: fmt.Sprintf("You left something in your cart at %s", shop.Name),
+		Body:    cartRecoveryEmailBody(shop, cart, customer.FirstName, discount),
+	}
+	if err := SendEmail(email); err != nil {
+		if discount != nil {
+			_ = DeleteDiscountService(discount.ID.Hex())
+		}
+		_ = repositories.ReleaseCartRecoveryClaim(ctx, cart, now)
+		return false, err
+	}
+	// The email is out; failing to record it only loses it from analytics
+	if err := repositories.CreateCartRecovery(ctx, recovery); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// createRecoveryDiscount creates a discount on the cart's products for the
+// cart's customer alone, usable once until it expires.
+func createRecoveryDiscount(shop *models.Shop, cart *models.Cart, settings models.CartRecoverySettings, now time.Time) (*models.Discount, error) {
+	code, err := recoveryDiscountCode()
+	if err != nil {
+		return nil, err
+	}
+	var productIDs []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{}
+	for _, item := range cart.Items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+	once := 1
+	return CreateDiscountService(&models.Discount{
+		Name:               "Cart recovery " + code,
+		Description:        "Offered in an abandoned cart email",
+		Code:               code,
+		Category:           models.DiscountCategoryProduct,
+		Type:               models.DiscountTypePercentage,
+		Value:              settings.DiscountPercent,
+		ShopID:             shop.ID,
+		SellerID:           shop.OwnerID,
+		AppliesToProducts:  productIDs,
+		EligibilityType:    models.DiscountEligibilitySpecific,
+		AllowedCustomerIDs: []primitive.ObjectID{cartCustomerID(cart)},
+		PerCustomerLimit:   &once,
+		StartAt:            now,
+		EndAt:              now.Add(time.Duration(settings.DiscountValidHours) * time.Hour),
+		Active:             true,
+	})
+}
+
+// recoveryDiscountCode returns a code like "BACK-7KQ2XM".
+func recoveryDiscountCode() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return "BACK-" + string(b), nil
+}
+
+// cartRecoveryEmailBody lists what is in the cart and links back to it.
+func cartRecoveryEmailBody(shop *models.Shop, cart *models.Cart, firstName string, discount *models.Discount) string {
+	var b strings.Builder
+	if firstName == "" {
+		firstName = "there"
+	}
+	fmt.Fprintf(&b, "Hi %s,\n\nYou left these in your cart at %s:\n\n", firstName, shop.Name)
+	for _, item := range cart.Items {
+		fmt.Fprintf(&b, "  %d x %s", item.Quantity, item.ProductName)
+		if len(item.VariantOptions) > 0 {
+			options := make([]string, 0, len(item.VariantOptions))
+			for name, value := range item.VariantOptions {
+				options = append(options, name+": "+value)
+			}
+			sort.Strings(options)
+			fmt.Fprintf(&b, " (%s)", strings.Join(options, ", "))
+		}
+		b.WriteString("\n")
+	}
+	total, currency := cart.GrandTotal, ShopCurrency(shop)
+	if cart.Presentment != nil {
+		total, currency = cart.Presentment.Total, cart.Currency
+	}
+	fmt.Fprintf(&b, "\nCart total: %s\n", formatMoney(total, currency))
+	if discount != nil {
+		fmt.Fprintf(&b, "\nTake %g%% off these items until %s with code %s. It is applied automatically when you check out signed in.\n",
+			discount.Value, discount.EndAt.Format("Jan 2, 2006 15:04 MST"), discount.Code)
+	}
+	fmt.Fprintf(&b, "\nReturn to your cart: %s\n", cartRecoveryURL(shop))
+	return b.String()
+}
+
+// cartRecoveryURL is where the customer picks up their cart. STOREFRONT_URL,
+// if set, makes it absolute.
+func cartRecoveryURL(shop *models.Shop) string {
+	base := strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/")
+	return fmt.Sprintf("%s/shops/%s/cart", base, url.PathEscape(shop.Slug))
+}
+
+// attributeCartRecovery credits a newly placed order to the recovery email
+// that brought its customer back, if one was sent recently. It is
+// best-effort: failures are only logged.
+func attributeCartRecovery(order *models.Order) {
+	ctx := context.Background()
+	recovery, err := repositories.FindOpenCartRecovery(ctx, order.ShopID, order.CustomerID, time.Now().Add(-cartRecoveryAttributionWindow))
+	if err == nil && recovery != nil {
+		_, err = repositories.MarkCartRecovered(ctx, recovery.ID, order.ID, order.Total, time.Now())
+	}
+	if err != nil {
+		log.Printf("cart recovery: order %s not attributed: %v", order.ID.Hex(), err)
+	}
+}
+
+// CartRecoveryMetricsService computes the shop's cart recovery metrics.
+func CartRecoveryMetricsService(shopID primitive.ObjectID) (*CartRecoveryMetrics, error) {
+	recoveries, err := repositories.ListCartRecoveries(context.Background(), shopID)
+	if err != nil {
+		return nil, err
+	}
+	m := &CartRecoveryMetrics{}
+	for _, r := range recoveries {
+		m.EmailsSent++
+		m.AbandonedValue += r.CartTotal
+		if !r.DiscountID.IsZero() {
+			m.DiscountsOffered++
+		}
+		if r.RecoveredAt != nil {
+			m.Recovered++
+			m.RecoveredRevenue += r.OrderTotal
+		}
+	}
+	if m.EmailsSent > 0 {
+		m.RecoveryRate = float64(m.Recovered) / float64(m.EmailsSent)
+	}
+	return m, nil
+}
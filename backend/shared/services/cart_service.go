@@ -1,16 +1,22 @@
 package services
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 
 	"time"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var ErrCartNotFound = errors.New("cart not found")
+var ErrShippingAddressInvalid = errors.New("shipping address must include a country")
+var ErrShippingMethodUnavailable = errors.New("shipping method is not available for this address")
 
 // CartWithDiscountDetails represents cart data with detailed discount information
 type CartWithDiscountDetails struct {
@@ -28,7 +34,7 @@ type ItemDiscountDetail struct {
 	Type       models.DiscountType     `json:"type"`
 	Value      float64                 `json:"value"`
 	Category   models.DiscountCategory `json:"category"`
-	Amount     float64                 `json:"amount"`
+	Amount     money.Amount            `json:"amount"`
 	Status     DiscountStatus          `json:"status,omitempty"`
 }
 
@@ -54,6 +60,28 @@ func (s *CartService) AddItem(cart *models.Cart, productID, variantID primitive.
 		return errors.New("product not found")
 	}
 
+	// Check the requested total against available-to-sell stock. Holds placed by
+	// other carts are subtracted; this cart's own holds are not.
+	stock := product.Stock
+	if !variantID.IsZero() {
+		stock = 0
+		for _, variant := range product.Variants {
+			if variant.VariantID == variantID {
+				stock = variant.Stock
+				break
+			}
+		}
+	}
+	requested := quantity
+	for _, item := range cart.Items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			requested += item.Quantity
+		}
+	}
+	if requested > AvailableStock(productID, variantID, cart.ID, stock) {
+		return ErrInsufficientStock
+	}
+
 	found := false
 	for i := range cart.Items {
 		item := &cart.Items[i]
@@ -91,11 +119,12 @@ func (s *CartService) AddItem(cart *models.Cart, productID, variantID primitive.
 		cart.Items = append(cart.Items, cartItem)
 	}
 
-	cart.LastUpdated = time.Now()
-	return s.CalculateTotals(cart, *cart.CustomerID)
+	customerChangedCart(cart)
+	return s.CalculateTotals(cart, cartCustomerID(cart))
 }
 
-// UpdateItem updates the quantity of a cart item.
+// UpdateItem updates the quantity of a cart item. Lowering it gives back
+// whatever stock is held beyond the new quantity.
 func (s *CartService) UpdateItem(cart *models.Cart, productID, variantID primitive.ObjectID, quantity int) error {
 	if quantity < 0 {
 		return errors.New("quantity cannot be negative")
@@ -103,36 +132,57 @@ func (s *CartService) UpdateItem(cart *models.Cart, productID, variantID primiti
 	for i := range cart.Items {
 		item := &cart.Items[i]
 		if item.ProductID == productID && item.VariantID == variantID {
+			if quantity < item.Quantity {
+				if err := shrinkCartItemHolds(cart.ID, productID, variantID, quantity); err != nil {
+					return err
+				}
+			}
 			if quantity == 0 {
 				// Remove item
 				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
 			} else {
 				item.Quantity = quantity
 			}
-			cart.LastUpdated = time.Now()
-			return s.CalculateTotals(cart, *cart.CustomerID)
+			customerChangedCart(cart)
+			return s.CalculateTotals(cart, cartCustomerID(cart))
 		}
 	}
 	return errors.New("item not found in cart")
 }
 
-// RemoveItem removes a product/variant from the cart.
+// RemoveItem removes a product/variant from the cart and releases its holds.
 func (s *CartService) RemoveItem(cart *models.Cart, productID, variantID primitive.ObjectID) error {
 	for i := range cart.Items {
 		item := &cart.Items[i]
 		if item.ProductID == productID && item.VariantID == variantID {
+			if err := shrinkCartItemHolds(cart.ID, productID, variantID, 0); err != nil {
+				return err
+			}
 			cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
-			cart.LastUpdated = time.Now()
-			return s.CalculateTotals(cart, *cart.CustomerID)
+			customerChangedCart(cart)
+			return s.CalculateTotals(cart, cartCustomerID(cart))
 		}
 	}
 	return errors.New("item not found in cart")
 }
 
-// CalculateTotals recalculates subtotal, discounts, and grand total for the cart.
+// CalculateTotals re-checks the cart's lines against the shop and recalculates
+// subtotal, discounts, shipping options, tax and grand total. Lines whose
+// product, variant or stock is gone are removed and quantities are cut to the
+// stock left; every such change, and any line now priced differently from
+// when it was added, is recorded in the cart's warnings. Shipping and tax are
+// worked out only once the cart has an address; a chosen method that is no
+// longer offered is dropped.
 func (s *CartService) CalculateTotals(cart *models.Cart, customerID primitive.ObjectID) error {
-	subtotal := 0.0
-	totalItemDiscounts := 0.0
+	products, err := s.revalidate(cart)
+	if err != nil {
+		return err
+	}
+
+	var subtotal, totalItemDiscounts money.Amount
+	weight := 0.0
+	itemCount := 0
+	taxClasses := make([]string, len(cart.Items))
 
 	// Get customer segments for proper discount validation
 	customerSegmentIDs, err := s.getCustomerSegmentIDs(cart.ShopID, customerID)
@@ -144,13 +194,9 @@ func (s *CartService) CalculateTotals(cart *models.Cart, customerID primitive.Ob
 	// Calculate subtotal and apply item-level discounts
 	for i := range cart.Items {
 		item := &cart.Items[i]
-		// Fetch product/variant price
-		product, err := GetProductByIDService(item.ProductID.Hex())
-		if err != nil || product == nil {
-			continue // skip missing products
-		}
+		product := products[i]
 
-		var price float64
+		var price money.Amount
 		if !item.VariantID.IsZero() {
 			for _, v := range product.Variants {
 				if v.VariantID == item.VariantID {
@@ -163,10 +209,19 @@ func (s *CartService) CalculateTotals(cart *models.Cart, customerID primitive.Ob
 		}
 
 		item.UnitPrice = price
-		item.LineTotal = price * float64(item.Quantity)
+		if item.AddedPrice == nil {
+			// New lines, and lines added before carts kept the price
+			added := price
+			item.AddedPrice = &added
+		}
+		item.LineTotal = price.Mul(item.Quantity)
+		weight += itemWeight(product, item.VariantID) * float64(item.Quantity)
+		itemCount += item.Quantity
+		taxClasses[i] = product.TaxClass
 
 		// Apply item-level discounts
-		itemDiscountAmount := 0.0
+		var itemDiscountAmount money.Amount
+		discountBefore, appliedBefore := item.DiscountAmount, item.AppliedDiscountIDs
 		item.AppliedDiscountIDs = []primitive.ObjectID{} // Reset applied discounts
 
 		// Get collection IDs for this product (for future collection support)
@@ -187,24 +242,303 @@ func (s *CartService) CalculateTotals(cart *models.Cart, customerID primitive.Ob
 			}
 		}
 
+		if itemDiscountAmount < discountBefore && lostDiscount(appliedBefore, item.AppliedDiscountIDs) {
+			addCartWarning(cart, models.CartWarning{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Name:      item.ProductName,
+				Reason:    models.CartWarningDiscountExpired,
+				Before:    discountBefore.Float(),
+				After:     itemDiscountAmount.Float(),
+			})
+		}
 		item.DiscountAmount = itemDiscountAmount
 		item.FinalLineTotal = item.LineTotal - itemDiscountAmount
 		totalItemDiscounts += itemDiscountAmount
 		subtotal += item.LineTotal
 	}
 
+	warnPriceChanges(cart)
+
 	// Calculate final totals (product-level discounts only)
+	// Without the shop the cart goes untaxed and unconverted; checkout works
+	// both out again before charging
+	shop, _ := repositories.GetShopByID(cart.ShopID.Hex())
 	cart.Subtotal = subtotal
 	cart.TotalDiscounts = totalItemDiscounts
-	cart.GrandTotal = subtotal - cart.TotalDiscounts + cart.ShippingCost + cart.TaxAmount
+	s.quoteShipping(cart, weight, itemCount)
+	taxAdded := s.applyTax(cart, shop, taxClasses)
+	cart.GrandTotal = subtotal - cart.TotalDiscounts + cart.ShippingCost + taxAdded
+	s.present(cart, shop)
+
+	return nil
+}
+
+// revalidate removes lines whose product or variant no longer exists or has
+// no stock left and cuts quantities down to the stock available, warning
+// about each. It returns the product of every remaining line, in order.
+func (s *CartService) revalidate(cart *models.Cart) ([]*models.Product, error) {
+	kept := make([]models.CartItem, 0, len(cart.Items))
+	products := make([]*models.Product, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		warning := models.CartWarning{ProductID: item.ProductID, VariantID: item.VariantID, Name: item.ProductName, Before: float64(item.Quantity)}
+
+		product, err := GetProductByIDService(item.ProductID.Hex())
+		if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && product == nil) {
+			warning.Reason = models.CartWarningProductDeleted
+			addCartWarning(cart, warning)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stock := product.Stock
+		if !item.VariantID.IsZero() {
+			found := false
+			for _, v := range product.Variants {
+				if v.VariantID == item.VariantID {
+					stock = v.Stock
+					found = true
+					break
+				}
+			}
+			if !found {
+				warning.Reason = models.CartWarningVariantRemoved
+				addCartWarning(cart, warning)
+				continue
+			}
+		}
+
+		available := AvailableStock(item.ProductID, item.VariantID, cart.ID, stock)
+		if available <= 0 {
+			warning.Reason = models.CartWarningOutOfStock
+			addCartWarning(cart, warning)
+			continue
+		}
+		if available < item.Quantity {
+			warning.Reason = models.CartWarningQuantityReduced
+			warning.After = float64(available)
+			addCartWarning(cart, warning)
+			item.Quantity = available
+		}
+		kept = append(kept, item)
+		products = append(products, product)
+	}
+	cart.Items = kept
+	return products, nil
+}
+
+// addCartWarning records w on the cart. A warning already there for the same
+// line and reason keeps its Before and takes w's After, so the customer sees
+// the whole change since they last acknowledged the cart.
+func addCartWarning(cart *models.Cart, w models.CartWarning) {
+	for i := range cart.Warnings {
+		existing := &cart.Warnings[i]
+		if existing.ProductID == w.ProductID && existing.VariantID == w.VariantID && existing.Reason == w.Reason {
+			existing.After = w.After
+			return
+		}
+	}
+	cart.Warnings = append(cart.Warnings, w)
+}
+
+// warnPriceChanges replaces the cart's price warnings with one for every line
+// priced differently from when it was added. Warnings about lines the
+// customer has since removed are dropped.
+func warnPriceChanges(cart *models.Cart) {
+	inCart := func(w models.CartWarning) bool {
+		for _, item := range cart.Items {
+			if item.ProductID == w.ProductID && item.VariantID == w.VariantID {
+				return true
+			}
+		}
+		return false
+	}
+	warnings := make([]models.CartWarning, 0, len(cart.Warnings))
+	for _, w := range cart.Warnings {
+		switch w.Reason {
+		case models.CartWarningPriceChanged:
+			continue
+		case models.CartWarningQuantityReduced, models.CartWarningDiscountExpired:
+			if !inCart(w) {
+				continue
+			}
+		}
+		warnings = append(warnings, w)
+	}
+	for _, item := range cart.Items {
+		if item.AddedPrice != nil && *item.AddedPrice != item.UnitPrice {
+			warnings = append(warnings, models.CartWarning{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Name:      item.ProductName,
+				Reason:    models.CartWarningPriceChanged,
+				Before:    item.AddedPrice.Float(),
+				After:     item.UnitPrice.Float(),
+			})
+		}
+	}
+	if len(warnings) == 0 {
+		warnings = nil
+	}
+	cart.Warnings = warnings
+}
+
+// lostDiscount reports whether a discount in before is missing from after.
+func lostDiscount(before, after []primitive.ObjectID) bool {
+	for _, id := range before {
+		found := false
+		for _, other := range after {
+			if other == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+// Revalidate re-checks and re-prices the cart for whoever it belongs to, so
+// its warnings reflect the shop as it is now. It reports whether anything the
+// customer sees of the cart changed.
+func (s *CartService) Revalidate(cart *models.Cart) (bool, error) {
+	before, err := json.Marshal(cart)
+	if err != nil {
+		return false, err
+	}
+	if err := s.CalculateTotals(cart, cartCustomerID(cart)); err != nil {
+		return false, err
+	}
+	after, err := json.Marshal(cart)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(before, after), nil
+}
+
+// AcknowledgeChanges records that the customer has seen the cart's warnings:
+// they are cleared, and every line's added price becomes its current price.
+func (s *CartService) AcknowledgeChanges(cart *models.Cart) {
+	for i := range cart.Items {
+		price := cart.Items[i].UnitPrice
+		cart.Items[i].AddedPrice = &price
+	}
+	cart.Warnings = nil
+	cart.LastUpdated = time.Now()
+}
 
+// present prices the cart in the customer's currency. A currency the shop no
+// longer offers, or has no rate for, falls back to the shop's own.
+func (s *CartService) present(cart *models.Cart, shop *models.Shop) {
+	cart.Presentment = nil
+	if shop == nil {
+		return
+	}
+	converter, err := PresentmentConverterService(shop, cart.Currency)
+	if err != nil {
+		converter, _ = PresentmentConverterService(shop, "")
+	}
+	cart.Currency = converter.To
+	lines := make([]presentLine, len(cart.Items))
+	for i, item := range cart.Items {
+		lines[i] = presentLine{UnitPrice: item.UnitPrice, Quantity: item.Quantity, Discount: item.DiscountAmount, Tax: item.TaxAmount}
+	}
+	cart.Presentment = converter.Present(lines, cart.ShippingCost, cart.TaxAmount, cart.TaxIncluded)
+}
+
+// SetCurrency switches the currency the cart is shown in and re-prices it.
+func (s *CartService) SetCurrency(cart *models.Cart, shop *models.Shop, currency string) error {
+	converter, err := PresentmentConverterService(shop, currency)
+	if err != nil {
+		return err
+	}
+	cart.Currency = converter.To
+	customerChangedCart(cart)
+	return s.CalculateTotals(cart, cartCustomerID(cart))
+}
+
+// quoteShipping refreshes the cart's shipping options for its address and the
+// cost of the chosen method.
+func (s *CartService) quoteShipping(cart *models.Cart, weight float64, itemCount int) {
+	cart.ShippingOptions = nil
+	cart.ShippingCost = 0
+	dest, ok := ShippingDestinationFromAddress(cart.ShippingAddress)
+	if !ok || len(cart.Items) == 0 {
+		return
+	}
+	cart.ShippingOptions = QuoteShippingService(ShippingQuoteRequest{
+		ShopID:      cart.ShopID,
+		Destination: dest,
+		Subtotal:    cart.Subtotal - cart.TotalDiscounts,
+		Weight:      weight,
+		ItemCount:   itemCount,
+	})
+	if chosen := findShippingQuote(cart.ShippingOptions, cart.ShippingMethodID); chosen != nil {
+		cart.ShippingCost = chosen.Amount
+	} else {
+		cart.ShippingMethodID = ""
+	}
+}
+
+// applyTax works out the tax on every line and on shipping for the cart's
+// address and returns how much it adds to the grand total. Tax that cannot be
+// worked out is left at zero; checkout computes it again before charging.
+func (s *CartService) applyTax(cart *models.Cart, shop *models.Shop, classes []string) money.Amount {
+	cart.TaxAmount = 0
+	cart.TaxIncluded = false
+	for i := range cart.Items {
+		cart.Items[i].TaxAmount = 0
+	}
+	dest, ok := ShippingDestinationFromAddress(cart.ShippingAddress)
+	if !ok || shop == nil {
+		return 0
+	}
+	lines := make([]TaxableLine, len(cart.Items))
+	for i, item := range cart.Items {
+		lines[i] = TaxableLine{Class: classes[i], Amount: item.FinalLineTotal}
+	}
+	tax, err := CalculateTaxService(shop, dest, lines, cart.ShippingCost)
+	if err != nil {
+		return 0
+	}
+	for i := range cart.Items {
+		cart.Items[i].TaxAmount = tax.Lines[i].Amount
+	}
+	cart.TaxAmount = tax.Total
+	cart.TaxIncluded = tax.Inclusive
+	return tax.Added()
+}
+
+// SetShipping sets the cart's shipping address and, optionally, the shipping
+// method to use, then re-prices the cart. An empty methodID keeps the current
+// choice if it is still offered for the new address.
+func (s *CartService) SetShipping(cart *models.Cart, address map[string]interface{}, methodID string) error {
+	if _, ok := ShippingDestinationFromAddress(address); !ok {
+		return ErrShippingAddressInvalid
+	}
+	cart.ShippingAddress = address
+	if methodID != "" {
+		cart.ShippingMethodID = methodID
+	}
+	// The address is kept even if the method is not offered for it
+	customerChangedCart(cart)
+	if err := s.CalculateTotals(cart, cartCustomerID(cart)); err != nil {
+		return err
+	}
+	if methodID != "" && cart.ShippingMethodID != methodID {
+		return ErrShippingMethodUnavailable
+	}
 	return nil
 }
 
 // findBestDiscount finds the discount that provides the highest savings
-func (s *CartService) findBestDiscount(discounts []models.Discount, price float64) *models.Discount {
+func (s *CartService) findBestDiscount(discounts []models.Discount, price money.Amount) *models.Discount {
 	var bestDiscount *models.Discount
-	bestSavings := 0.0
+	var bestSavings money.Amount
 
 	for i := range discounts {
 		discount := &discounts[i]
@@ -221,9 +555,9 @@ func (s *CartService) findBestDiscount(discounts []models.Discount, price float6
 }
 
 // findBestEligibleDiscount finds the discount that provides the highest savings for a customer
-func (s *CartService) findBestEligibleDiscount(discounts []models.Discount, unitPrice float64, quantity int, customerID primitive.ObjectID, customerSegmentIDs []primitive.ObjectID) *models.Discount {
+func (s *CartService) findBestEligibleDiscount(discounts []models.Discount, unitPrice money.Amount, quantity int, customerID primitive.ObjectID, customerSegmentIDs []primitive.ObjectID) *models.Discount {
 	var bestDiscount *models.Discount
-	bestSavings := 0.0
+	var bestSavings money.Amount
 
 	for i := range discounts {
 		discount := &discounts[i]
@@ -246,14 +580,24 @@ func (s *CartService) findBestEligibleDiscount(discounts []models.Discount, unit
 	return bestDiscount
 }
 
-// ClearCart removes all items and discounts from the cart.
+// ClearCart removes all items and discounts from the cart and releases any
+// stock held for it.
 func (s *CartService) ClearCart(cart *models.Cart) error {
+	if err := ReleaseCartReservationsService(cart.ID); err != nil {
+		return err
+	}
 	cart.Items = nil
 	cart.AppliedDiscountIDs = nil
+	cart.ShippingOptions = nil
+	cart.ShippingMethodID = ""
+	cart.ShippingCost = 0
+	cart.TaxAmount = 0
 	cart.Subtotal = 0
 	cart.TotalDiscounts = 0
 	cart.GrandTotal = 0
-	cart.LastUpdated = time.Now()
+	cart.Presentment = nil
+	cart.Warnings = nil
+	customerChangedCart(cart)
 	return nil
 }
 
@@ -264,11 +608,12 @@ func GetOrCreateCartService(shopID, customerID primitive.ObjectID) (*models.Cart
 		return nil, err
 	}
 	if cart == nil {
+		shop, _ := repositories.GetShopByID(shopID.Hex())
 		cart = &models.Cart{
 			ShopID:      shopID,
 			CustomerID:  &customerID,
 			Items:       []models.CartItem{},
-			Currency:    "USD",
+			Currency:    ShopCurrency(shop),
 			CreatedAt:   time.Now(),
 			LastUpdated: time.Now(),
 		}
@@ -280,12 +625,135 @@ func GetOrCreateCartService(shopID, customerID primitive.ObjectID) (*models.Cart
 	return cart, nil
 }
 
-// SaveCartService updates the cart in the database.
+// GetOrCreateGuestCartService fetches the cart a guest session has in a shop,
+// creating it if there is none.
+func GetOrCreateGuestCartService(shopID primitive.ObjectID, sessionID string) (*models.Cart, error) {
+	cart, err := repositories.GetCartBySessionID(shopID, sessionID)
+	if err != nil || cart != nil {
+		return cart, err
+	}
+	shop, _ := repositories.GetShopByID(shopID.Hex())
+	cart = &models.Cart{
+		ShopID:      shopID,
+		SessionID:   &sessionID,
+		Items:       []models.CartItem{},
+		Currency:    ShopCurrency(shop),
+		CreatedAt:   time.Now(),
+		LastUpdated: time.Now(),
+	}
+	if _, err := repositories.CreateCart(cart); err != nil {
+		// Another request from the same session created it first
+		if mongo.IsDuplicateKeyError(err) {
+			return repositories.GetCartBySessionID(shopID, sessionID)
+		}
+		return nil, err
+	}
+	return cart, nil
+}
+
+// customerChangedCart records that the customer changed the cart; abandoned
+// carts are timed from it, not from re-pricing.
+func customerChangedCart(cart *models.Cart) {
+	now := time.Now()
+	cart.LastUpdated = now
+	cart.CustomerActivityAt = now
+}
+
+// cartCustomerID is the customer a cart belongs to; guest carts have none
+// and are priced like any customer without segments or discount history.
+func cartCustomerID(cart *models.Cart) primitive.ObjectID {
+	if cart.CustomerID == nil {
+		return primitive.NilObjectID
+	}
+	return *cart.CustomerID
+}
+
+// MergeGuestCartsService moves a guest session's carts into the customer's
+// own cart in each shop, once the guest has signed in. Lines for the same
+// product and variant are combined, the guest's shipping and currency choices
+// are kept where the customer's cart has none, warnings the guest had not yet
+// acknowledged carry over, and the merged cart is priced again for the
+// customer. The guest carts and their stock holds are dropped.
+func MergeGuestCartsService(sessionID string, customerID primitive.ObjectID) error {
+	guestCarts, err := repositories.GetCartsBySessionID(sessionID)
+	if err != nil {
+		return err
+	}
+	cartService := NewCartService()
+	for i := range guestCarts {
+		guest := &guestCarts[i]
+		// Released first, or the guest's holds would count against the
+		// merged lines when they are priced
+		if err := ReleaseCartReservationsService(guest.ID); err != nil {
+			return err
+		}
+		if len(guest.Items) > 0 {
+			if _, _, err := LinkIfNotLinked(guest.ShopID, customerID); err != nil {
+				return err
+			}
+			cart, err := GetOrCreateCartService(guest.ShopID, customerID)
+			if err != nil {
+				return err
+			}
+			if len(cart.Items) == 0 {
+				cart.Currency = guest.Currency
+			}
+			if cart.ShippingAddress == nil {
+				cart.ShippingAddress = guest.ShippingAddress
+				cart.ShippingMethodID = guest.ShippingMethodID
+			}
+			mergeCartItems(cart, guest.Items)
+			for _, w := range guest.Warnings {
+				addCartWarning(cart, w)
+			}
+			customerChangedCart(cart)
+			if err := cartService.CalculateTotals(cart, customerID); err != nil {
+				return err
+			}
+			if err := SaveCartService(cart); err != nil {
+				return err
+			}
+		}
+		if _, err := repositories.DeleteCart(guest.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeCartItems adds items to the cart, combining lines for the same product
+// and variant.
+func mergeCartItems(cart *models.Cart, items []models.CartItem) {
+	for _, item := range items {
+		found := false
+		for i := range cart.Items {
+			if cart.Items[i].ProductID == item.ProductID && cart.Items[i].VariantID == item.VariantID {
+				cart.Items[i].Quantity += item.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			cart.Items = append(cart.Items, item)
+		}
+	}
+}
+
+// SaveCartService updates the cart in the database. Changes the customer
+// made set LastUpdated before it is called.
 func SaveCartService(cart *models.Cart) error {
 	_, err := repositories.UpdateCart(cart)
 	return err
 }
 
+// SaveRevalidatedCartService saves a cart the system re-priced, without
+// marking it as updated. If the cart changed since it was read, the newer
+// cart is left as it is and nothing is saved.
+func SaveRevalidatedCartService(cart *models.Cart) error {
+	_, err := repositories.UpdateCartIfUnchanged(cart)
+	return err
+}
+
 // GetCartWithDiscountDetails returns cart with detailed discount information
 func (s *CartService) GetCartWithDiscountDetails(cart *models.Cart) (*CartWithDiscountDetails, error) {
 	if cart == nil {
@@ -297,7 +765,7 @@ func (s *CartService) GetCartWithDiscountDetails(cart *models.Cart) (*CartWithDi
 	}
 
 	// Get customer segments for proper validation
-	customerSegmentIDs, err := s.getCustomerSegmentIDs(cart.ShopID, *cart.CustomerID)
+	customerSegmentIDs, err := s.getCustomerSegmentIDs(cart.ShopID, cartCustomerID(cart))
 	if err != nil {
 		customerSegmentIDs = []primitive.ObjectID{}
 	}
@@ -308,12 +776,12 @@ func (s *CartService) GetCartWithDiscountDetails(cart *models.Cart) (*CartWithDi
 			discount, err := GetDiscountByIDService(discountID.Hex())
 			if err == nil && discount != nil && discount.IsActive() {
 				// Use the improved validation function
-				if canUse, err := CanCustomerUseDiscount(discount, *cart.CustomerID, customerSegmentIDs); err == nil && canUse {
+				if canUse, err := CanCustomerUseDiscount(discount, cartCustomerID(cart), customerSegmentIDs); err == nil && canUse {
 					// Calculate the actual discount amount for this item
 					discountAmount := discount.CalculateDiscountForQuantity(item.UnitPrice, item.Quantity)
 
 					// Get detailed status for this discount
-					status := GetDiscountStatusForCustomer(discount, *cart.CustomerID)
+					status := GetDiscountStatusForCustomer(discount, cartCustomerID(cart))
 
 					result.ItemDiscountDetails = append(result.ItemDiscountDetails, ItemDiscountDetail{
 						ProductID:  item.ProductID,
@@ -341,7 +809,7 @@ func (s *CartService) GetCartWithDiscountDetails(cart *models.Cart) (*CartWithDi
 
 		discounts, err := GetActiveDiscountsForProductService(cart.ShopID, item.ProductID, item.VariantID, collectionIDs)
 		if err == nil && len(discounts) > 0 {
-			_, allStatuses := GetBestEligibleDiscountForProduct(item.ProductID, item.VariantID, *cart.CustomerID, customerSegmentIDs, discounts)
+			_, allStatuses := GetBestEligibleDiscountForProduct(item.ProductID, item.VariantID, cartCustomerID(cart), customerSegmentIDs, discounts)
 
 			// Add unique statuses to the result
 			for _, status := range allStatuses {
@@ -0,0 +1,121 @@
+//go:build mongo
+
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlaceOrderNeverOversells(t *testing.T) {
+	requireMongo(t)
+
+	t.Run("transaction", func(t *testing.T) {
+		supported, err := repositories.SupportsTransactions()
+		if err != nil {
+			t.Fatalf("probe transaction support: %v", err)
+		}
+		if !supported {
+			t.Skip("MongoDB is not a replica set or sharded cluster")
+		}
+		testConcurrentPlaceOrder(t, NewCheckoutService())
+	})
+
+	t.Run("standalone with undo", func(t *testing.T) {
+		testConcurrentPlaceOrder(t, &CheckoutService{commitSteps: applyStepsWithUndo})
+	})
+}
+
+// testConcurrentPlaceOrder has more customers than there is stock check out
+// one variant at the same time. Each order also takes a product with plenty
+// of stock first, so every order that loses the race has a decrement to undo.
+func testConcurrentPlaceOrder(t *testing.T, checkout *CheckoutService) {
+	const stock, buyers, plentyStock = 3, 12, 100
+
+	shop := &models.Shop{ID: primitive.NewObjectID(), Name: "Concurrency test"}
+	variantID := primitive.NewObjectID()
+	scarce := &models.Product{
+		ShopID:   shop.ID,
+		Name:     "Scarce",
+		Price:    1000,
+		Stock:    stock,
+		Variants: []models.Variant{{VariantID: variantID, Price: 1000, Stock: stock}},
+	}
+	plenty := &models.Product{ShopID: shop.ID, Name: "Plenty", Price: 500, Stock: plentyStock}
+	for _, p := range []*models.Product{scarce, plenty} {
+		if _, err := repositories.CreateProduct(p); err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		byShop := bson.M{"shop_id": shop.ID}
+		for _, name := range []string{"orders", "order_events", "order_counters"} {
+			_, _ = config.GetCollection("DRPS", name).DeleteMany(ctx, byShop)
+		}
+		_, _ = config.GetCollection("DRPS", "products").DeleteMany(ctx, byShop)
+	})
+
+	errs := make([]error, buyers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			lines := []CheckoutLine{
+				{ProductID: plenty.ID, Quantity: 1},
+				{ProductID: scarce.ID, VariantID: variantID, Quantity: 1},
+			}
+			_, errs[i] = checkout.PlaceOrder(shop, primitive.NewObjectID(), lines, CheckoutShipping{}, CheckoutClient{})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case errors.Is(err, ErrCheckoutInsufficientStock):
+		default:
+			t.Errorf("unexpected checkout error: %v", err)
+		}
+	}
+	if placed != stock {
+		t.Errorf("placed %d orders, want exactly %d", placed, stock)
+	}
+
+	got, err := repositories.GetProductByID(scarce.ID.Hex())
+	if err != nil {
+		t.Fatalf("reload scarce product: %v", err)
+	}
+	if got.Stock != 0 || got.Variants[0].Stock != 0 {
+		t.Errorf("scarce stock = %d, variant stock = %d, want 0 and 0", got.Stock, got.Variants[0].Stock)
+	}
+	got, err = repositories.GetProductByID(plenty.ID.Hex())
+	if err != nil {
+		t.Fatalf("reload plenty product: %v", err)
+	}
+	if want := plentyStock - placed; got.Stock != want {
+		t.Errorf("plenty stock = %d, want %d: failed orders were not undone", got.Stock, want)
+	}
+
+	orders, err := config.GetCollection("DRPS", "orders").CountDocuments(context.Background(), bson.M{"shop_id": shop.ID})
+	if err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if orders != int64(placed) {
+		t.Errorf("%d orders stored, want %d", orders, placed)
+	}
+}
@@ -0,0 +1,694 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	customerModels "github.com/Endale2/DRPS/customers/models"
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrCheckoutEmpty = errors.New("no items in order")
+var ErrCheckoutInvalidItem = errors.New("invalid order item")
+var ErrCheckoutInsufficientStock = errors.New("insufficient stock")
+var ErrCheckoutDiscountUnavailable = errors.New("discount is no longer available")
+var ErrCheckoutCartChanged = errors.New("cart has changes that must be acknowledged")
+var ErrCheckoutShippingRequired = errors.New("a shipping address and method are required")
+var ErrCheckoutShippingUnavailable = errors.New("shipping method is not available for this address")
+var ErrCheckoutCurrencyUnavailable = errors.New("currency is not available")
+var ErrCheckoutFailed = errors.New("checkout failed")
+
+// CheckoutError describes why a checkout could not be completed. Kind is one of
+// the ErrCheckout* sentinels so callers can branch on it with errors.Is.
+type CheckoutError struct {
+	Kind      error
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Detail    string
+	Err       error
+	// Changes lists the cart's unacknowledged warnings for ErrCheckoutCartChanged.
+	Changes []models.CartWarning
+}
+
+func (e *CheckoutError) Error() string {
+	msg := e.Kind.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CheckoutError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// CheckoutLine is a product/variant and quantity requested by the customer.
+// Prices are never taken from the client; they are resolved server-side.
+type CheckoutLine struct {
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Quantity  int
+}
+
+// CheckoutShipping is where the customer wants the order shipped and which of
+// the quoted shipping options they picked.
+type CheckoutShipping struct {
+	Address  map[string]interface{}
+	MethodID string
+}
+
+// CheckoutResult is the committed order together with the per-line pricing
+// breakdown that was used to build it.
+type CheckoutResult struct {
+	Order               *models.Order
+	ItemDiscountDetails []map[string]interface{}
+}
+
+// checkoutQuote holds server-calculated pricing for a set of checkout lines.
+type checkoutQuote struct {
+	Items               []models.OrderItem
+	ItemDiscountDetails []map[string]interface{}
+	Subtotal            money.Amount
+	DiscountTotal       money.Amount
+	Total               money.Amount
+	AppliedDiscountIDs  []primitive.ObjectID
+	Weight              float64
+	ItemCount           int
+	usages              []models.OrderDiscountUsage
+}
+
+// CheckoutService turns priced checkout lines into a committed order.
+type CheckoutService struct {
+	// commitSteps writes an order's steps; nil uses commitSteps. Tests set
+	// it to take the standalone path on a deployment with transactions.
+	commitSteps func([]writeStep) error
+}
+
+func NewCheckoutService() *CheckoutService {
+	return &CheckoutService{}
+}
+
+// PlaceOrder prices lines and shipping for the customer and writes the order,
+// its discount usage and the stock decrements as one unit. Either everything
+// is written or nothing is; failures are returned as *CheckoutError.
+func (s *CheckoutService) PlaceOrder(shop *models.Shop, customerID primitive.ObjectID, lines []CheckoutLine, shipping CheckoutShipping, client CheckoutClient) (*CheckoutResult, error) {
+	// Stock held for the customer's own cart is theirs to buy
+	cartID := primitive.NilObjectID
+	if cart, err := repositories.GetCartByCustomerID(shop.ID, customerID); err == nil && cart != nil {
+		cartID = cart.ID
+	}
+	return s.placeOrder(shop, customerID, cartID, lines, shipping, client, nil)
+}
+
+// CheckoutCart turns the customer's saved cart into an order. The cart is
+// re-checked first; while it has warnings the customer has not acknowledged,
+// from that check or earlier, the refreshed cart is saved and an
+// ErrCheckoutCartChanged error listing them is returned instead of an order.
+// The cart is emptied only once the order has committed.
+func (s *CheckoutService) CheckoutCart(shop *models.Shop, customerID primitive.ObjectID, client CheckoutClient) (*CheckoutResult, error) {
+	cart, err := repositories.GetCartByCustomerID(shop.ID, customerID)
+	if err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not load cart", Err: err}
+	}
+	return s.checkoutCart(shop, cart, customerID, client, nil)
+}
+
+// GuestCheckout is what a guest gives at checkout in place of an account.
+type GuestCheckout struct {
+	Email            string
+	ShippingAddress  map[string]interface{}
+	ShippingMethodID string
+}
+
+// CheckoutGuestCart turns a guest session's cart into an order placed for a
+// new guest customer with the guest's email; the order becomes an account's
+// once someone signs in with that email. The address and method replace the
+// cart's; if that changes shipping or tax, it is warned about and must be
+// acknowledged like any other change before the order is placed. The guest
+// customer is written with the order, so a checkout that fails leaves none.
+func (s *CheckoutService) CheckoutGuestCart(shop *models.Shop, sessionID string, guest GuestCheckout, client CheckoutClient) (*CheckoutResult, error) {
+	if _, ok := ShippingDestinationFromAddress(guest.ShippingAddress); !ok {
+		return nil, &CheckoutError{Kind: ErrCheckoutShippingRequired, Err: ErrShippingAddressInvalid}
+	}
+	cart, err := repositories.GetCartBySessionID(shop.ID, sessionID)
+	if err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not load cart", Err: err}
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return nil, &CheckoutError{Kind: ErrCheckoutEmpty}
+	}
+
+	// Priced with the address the cart had, so review reports what it changes
+	cart.ShippingAddress = guest.ShippingAddress
+	if guest.ShippingMethodID != "" {
+		cart.ShippingMethodID = guest.ShippingMethodID
+	}
+	client.Guest = true
+	customer := newGuestCustomer(guest.Email)
+	return s.checkoutCart(shop, cart, customer.ID, client, guestCustomerSteps(shop.ID, customer))
+}
+
+// newGuestCustomer builds the guest customer for one guest checkout. The
+// email has not been verified, so it is never matched to an existing account;
+// the order is given to the account when someone signs in with the email.
+func newGuestCustomer(email string) *customerModels.Customer {
+	now := time.Now()
+	return &customerModels.Customer{
+		ID:        primitive.NewObjectID(),
+		Email:     strings.TrimSpace(email),
+		Guest:     true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// guestCustomerSteps records the guest customer and links it to the shop, as
+// part of the writes that place the guest's order.
+func guestCustomerSteps(shopID primitive.ObjectID, customer *customerModels.Customer) []writeStep {
+	link := &models.ShopCustomer{
+		ID:         primitive.NewObjectID(),
+		ShopID:     shopID,
+		CustomerID: customer.ID,
+		CreatedAt:  customer.CreatedAt,
+		UpdatedAt:  customer.CreatedAt,
+	}
+	return []writeStep{
+		{
+			name: "create guest customer",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.InsertCustomer(ctx, customer)
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.DeleteCustomer(customer.ID.Hex())
+				return err
+			},
+		},
+		{
+			name: "link guest customer to shop",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.InsertShopCustomerLink(ctx, link)
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.DeleteShopCustomerLink(link.ID)
+				return err
+			},
+		},
+	}
+}
+
+// checkoutCart reviews and places cart for the customer and empties it once
+// the order has committed. extra steps are committed together with the order.
+func (s *CheckoutService) checkoutCart(shop *models.Shop, cart *models.Cart, customerID primitive.ObjectID, client CheckoutClient, extra []writeStep) (*CheckoutResult, error) {
+	if cart == nil || len(cart.Items) == 0 {
+		return nil, &CheckoutError{Kind: ErrCheckoutEmpty}
+	}
+
+	if err := s.reviewCart(cart, customerID); err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not reprice cart", Err: err}
+	}
+	if len(cart.Warnings) > 0 {
+		if err := SaveRevalidatedCartService(cart); err != nil {
+			return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not save repriced cart", Err: err}
+		}
+		return nil, &CheckoutError{Kind: ErrCheckoutCartChanged, Changes: cart.Warnings}
+	}
+	if len(cart.Items) == 0 {
+		return nil, &CheckoutError{Kind: ErrCheckoutEmpty}
+	}
+
+	lines := make([]CheckoutLine, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		lines = append(lines, CheckoutLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	shipping := CheckoutShipping{Address: cart.ShippingAddress, MethodID: cart.ShippingMethodID}
+	if client.Currency == "" {
+		client.Currency = cart.Currency
+	}
+	result, err := s.placeOrder(shop, customerID, cart.ID, lines, shipping, client, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	// The order stands even if emptying the cart fails; its holds are already
+	// converted, so the worst case is a stale cart the customer can clear.
+	cartService := NewCartService()
+	if err := cartService.ClearCart(cart); err == nil {
+		if err := SaveCartService(cart); err != nil {
+			log.Printf("checkout: order %s placed but cart %s not cleared: %v", result.Order.ID.Hex(), cart.ID.Hex(), err)
+		}
+	} else {
+		log.Printf("checkout: order %s placed but cart %s not cleared: %v", result.Order.ID.Hex(), cart.ID.Hex(), err)
+	}
+	return result, nil
+}
+
+// reviewCart re-prices cart in place, which warns about every line whose
+// price, discount or availability changed, and adds a warning if the chosen
+// shipping method's price moved or it stopped being offered, or tax moved.
+func (s *CheckoutService) reviewCart(cart *models.Cart, customerID primitive.ObjectID) error {
+	shippingMethodBefore, shippingCostBefore := cart.ShippingMethodID, cart.ShippingCost
+	taxBefore := cart.TaxAmount
+
+	if err := NewCartService().CalculateTotals(cart, customerID); err != nil {
+		return err
+	}
+
+	if shippingMethodBefore != "" && (cart.ShippingMethodID != shippingMethodBefore || shippingCostBefore != cart.ShippingCost) {
+		warning := models.CartWarning{Reason: models.CartWarningShippingChanged, Before: shippingCostBefore.Float(), After: cart.ShippingCost.Float()}
+		if chosen := findShippingQuote(cart.ShippingOptions, cart.ShippingMethodID); chosen != nil {
+			warning.Name = chosen.Name
+		}
+		addCartWarning(cart, warning)
+	}
+	if taxBefore != cart.TaxAmount {
+		addCartWarning(cart, models.CartWarning{Reason: models.CartWarningTaxChanged, Before: taxBefore.Float(), After: cart.TaxAmount.Float()})
+	}
+	return nil
+}
+
+// placeOrder quotes lines and shipping and commits the resulting order. extra
+// steps run after the stock is taken, in the same unit as the order.
+func (s *CheckoutService) placeOrder(shop *models.Shop, customerID, cartID primitive.ObjectID, lines []CheckoutLine, shipping CheckoutShipping, client CheckoutClient, extra []writeStep) (*CheckoutResult, error) {
+	converter, err := PresentmentConverterService(shop, client.Currency)
+	if err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutCurrencyUnavailable, Detail: client.Currency, Err: err}
+	}
+	quote, err := s.quote(shop.ID, customerID, cartID, lines)
+	if err != nil {
+		return nil, err
+	}
+	method, err := s.shippingMethod(shop.ID, quote, shipping)
+	if err != nil {
+		return nil, err
+	}
+	var shippingCost money.Amount
+	if method != nil {
+		shippingCost = method.Amount
+	}
+	tax, err := s.tax(shop, quote, shipping.Address, shippingCost)
+	if err != nil {
+		return nil, err
+	}
+
+	order := newPendingOrder(shop, customerID, quote, shipping.Address, method, tax)
+	order.BillingAddress = client.BillingAddress
+	order.Guest = client.Guest
+	order.Presentment = presentOrder(converter, order, tax.Inclusive)
+	if err := prepareOrder(order, shop); err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not assign order number", Err: err}
+	}
+
+	// Risky orders are placed, holding their stock, but cannot be paid until
+	// the seller approves them
+	order.Risk = assessOrderRisk(shop, order, client)
+	steps := append(s.orderSteps(order, customerID, cartID, quote), extra...)
+	if holdForReview(shop, order.Risk) {
+		order.Status = models.OrderStatusReview
+		order.Risk.Held = true
+		steps = append(steps, orderEventStep(newOrderEvent(order, models.OrderEventNote,
+			models.OrderActor{Role: models.OrderActorSystem}, "Held for review, "+riskSummary(order.Risk), nil)))
+	}
+
+	if err := s.commit(steps); err != nil {
+		return nil, err
+	}
+	attributeCartRecovery(order)
+	if order.Status == models.OrderStatusReview {
+		message := fmt.Sprintf("Order %s is held for review (%s). Approve it so the customer can pay, or cancel it.", order.OrderNumber, riskSummary(order.Risk))
+		if err := NotifySellerService(shop, models.NotificationOrderHeld, order.ID, "Order held for review", message); err != nil {
+			log.Printf("checkout: order %s held but seller not notified: %v", order.ID.Hex(), err)
+		}
+	}
+
+	return &CheckoutResult{Order: order, ItemDiscountDetails: quote.ItemDiscountDetails}, nil
+}
+
+// newPendingOrder builds the order for a priced checkout, ready to be
+// numbered and committed.
+func newPendingOrder(shop *models.Shop, customerID primitive.ObjectID, q *checkoutQuote, address map[string]interface{}, method *models.ShippingQuote, tax *TaxResult) *models.Order {
+	var shippingCost money.Amount
+	if method != nil {
+		shippingCost = method.Amount
+	}
+	return &models.Order{
+		ID:                 primitive.NewObjectID(),
+		ShopID:             shop.ID,
+		CustomerID:         customerID,
+		Currency:           ShopCurrency(shop),
+		Items:              q.Items,
+		Subtotal:           q.Subtotal,
+		DiscountTotal:      q.DiscountTotal,
+		ShippingCost:       shippingCost,
+		TaxAmount:          tax.Total,
+		Tax:                tax.OrderTax(),
+		Total:              q.Total + shippingCost + tax.Added(),
+		ShippingAddress:    address,
+		ShippingMethod:     method,
+		Status:             models.OrderStatusPending,
+		PaymentStatus:      models.PaymentStatusPending,
+		AppliedDiscountIDs: q.AppliedDiscountIDs,
+		DiscountUsages:     q.usages,
+		InventoryCommitted: true,
+	}
+}
+
+// presentOrder prices an order in the currency the customer shops in.
+func presentOrder(converter *CurrencyConverter, order *models.Order, taxIncluded bool) *models.Presentment {
+	lines := make([]presentLine, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = presentLine{
+			UnitPrice: item.UnitPrice,
+			Quantity:  item.Quantity,
+			Discount:  item.UnitPrice.Mul(item.Quantity) - item.TotalPrice,
+			Tax:       item.TaxAmount,
+		}
+	}
+	return converter.Present(lines, order.ShippingCost, order.TaxAmount, taxIncluded)
+}
+
+// shippingMethod re-quotes shipping for the order and returns the option the
+// customer picked. Orders without an address ship nothing, as do destinations
+// no provider quotes for; once options exist, one of them must be picked.
+func (s *CheckoutService) shippingMethod(shopID primitive.ObjectID, q *checkoutQuote, shipping CheckoutShipping) (*models.ShippingQuote, error) {
+	if len(shipping.Address) == 0 && shipping.MethodID == "" {
+		return nil, nil
+	}
+	dest, ok := ShippingDestinationFromAddress(shipping.Address)
+	if !ok {
+		return nil, &CheckoutError{Kind: ErrCheckoutShippingRequired, Detail: "shipping address must include a country"}
+	}
+	quotes := QuoteShippingService(ShippingQuoteRequest{
+		ShopID:      shopID,
+		Destination: dest,
+		Subtotal:    q.Total,
+		Weight:      q.Weight,
+		ItemCount:   q.ItemCount,
+	})
+	if shipping.MethodID == "" {
+		if len(quotes) == 0 {
+			return nil, nil
+		}
+		return nil, &CheckoutError{Kind: ErrCheckoutShippingRequired, Detail: "choose a shipping method"}
+	}
+	method := findShippingQuote(quotes, shipping.MethodID)
+	if method == nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutShippingUnavailable, Detail: shipping.MethodID}
+	}
+	return method, nil
+}
+
+// tax works out the order's tax for its shipping address and records each
+// line's share on the quoted items. Orders without an address are untaxed.
+func (s *CheckoutService) tax(shop *models.Shop, q *checkoutQuote, address map[string]interface{}, shippingCost money.Amount) (*TaxResult, error) {
+	dest, ok := ShippingDestinationFromAddress(address)
+	if !ok {
+		return &TaxResult{Inclusive: shop.PricesIncludeTax}, nil
+	}
+	lines := make([]TaxableLine, len(q.Items))
+	for i, item := range q.Items {
+		lines[i] = TaxableLine{Class: item.TaxClass, Amount: item.TotalPrice}
+	}
+	tax, err := CalculateTaxService(shop, dest, lines, shippingCost)
+	if err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not calculate tax", Err: err}
+	}
+	for i := range q.Items {
+		q.Items[i].TaxRate = tax.Lines[i].Rate
+		q.Items[i].TaxAmount = tax.Lines[i].Amount
+	}
+	return tax, nil
+}
+
+// quote resolves prices, stock and the best eligible discount for every line.
+// Stock held by carts other than cartID is not available to this checkout.
+func (s *CheckoutService) quote(shopID, customerID, cartID primitive.ObjectID, lines []CheckoutLine) (*checkoutQuote, error) {
+	if len(lines) == 0 {
+		return nil, &CheckoutError{Kind: ErrCheckoutEmpty}
+	}
+
+	// Get customer segments for discount validation
+	customerSegmentIDs, err := GetCustomerSegmentIDs(shopID, customerID)
+	if err != nil {
+		customerSegmentIDs = []primitive.ObjectID{}
+	}
+
+	q := &checkoutQuote{}
+	appliedDiscountIDsMap := make(map[primitive.ObjectID]struct{})
+
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return nil, &CheckoutError{Kind: ErrCheckoutInvalidItem, ProductID: line.ProductID, Detail: "quantity must be positive"}
+		}
+
+		product, err := GetProductByIDService(line.ProductID.Hex())
+		if err != nil || product == nil || product.ShopID != shopID {
+			return nil, &CheckoutError{Kind: ErrCheckoutInvalidItem, ProductID: line.ProductID, Detail: "product not found: " + line.ProductID.Hex()}
+		}
+
+		// Determine unit price and product details
+		var unitPrice money.Amount
+		var productName string
+		var productImage string
+		var stock int
+		orderVariantID := primitive.NilObjectID
+
+		if len(product.Variants) > 0 && !line.VariantID.IsZero() {
+			var foundVariant *models.Variant
+			for i := range product.Variants {
+				if product.Variants[i].VariantID == line.VariantID {
+					foundVariant = &product.Variants[i]
+					break
+				}
+			}
+			if foundVariant == nil {
+				return nil, &CheckoutError{
+					Kind:      ErrCheckoutInvalidItem,
+					ProductID: line.ProductID,
+					VariantID: line.VariantID,
+					Detail:    "variant not found: " + line.VariantID.Hex() + " for product: " + line.ProductID.Hex(),
+				}
+			}
+			unitPrice = foundVariant.Price
+			productName = variantDisplayName(product.Name, foundVariant.Options)
+			productImage = foundVariant.Image
+			if productImage == "" {
+				productImage = product.MainImage
+			}
+			stock = foundVariant.Stock
+			orderVariantID = line.VariantID
+		} else {
+			unitPrice = product.Price
+			productName = product.Name
+			productImage = product.MainImage
+			stock = product.Stock
+		}
+
+		if AvailableStock(line.ProductID, orderVariantID, cartID, stock) < line.Quantity {
+			return nil, &CheckoutError{
+				Kind:      ErrCheckoutInsufficientStock,
+				ProductID: line.ProductID,
+				VariantID: orderVariantID,
+				Detail:    "product/variant: " + line.ProductID.Hex(),
+			}
+		}
+
+		lineTotal := unitPrice.Mul(line.Quantity)
+		q.Subtotal += lineTotal
+		q.Weight += itemWeight(product, orderVariantID) * float64(line.Quantity)
+		q.ItemCount += line.Quantity
+
+		// Find best eligible discount
+		collectionIDs, err := GetCollectionIDsForProduct(line.ProductID)
+		if err != nil {
+			collectionIDs = []primitive.ObjectID{}
+		}
+		discounts, err := GetActiveDiscountsForProductService(shopID, line.ProductID, line.VariantID, collectionIDs)
+		if err != nil {
+			discounts = []models.Discount{}
+		}
+		bestDiscount, _ := GetBestEligibleDiscountForProduct(line.ProductID, line.VariantID, customerID, customerSegmentIDs, discounts)
+
+		var itemDiscountAmount money.Amount
+		appliedDiscountIDs := []primitive.ObjectID{}
+		if bestDiscount != nil {
+			if savings := bestDiscount.CalculateDiscountForQuantity(unitPrice, line.Quantity); savings > 0 {
+				itemDiscountAmount = savings
+				appliedDiscountIDs = append(appliedDiscountIDs, bestDiscount.ID)
+				if _, seen := appliedDiscountIDsMap[bestDiscount.ID]; !seen {
+					appliedDiscountIDsMap[bestDiscount.ID] = struct{}{}
+					q.AppliedDiscountIDs = append(q.AppliedDiscountIDs, bestDiscount.ID)
+				}
+				q.usages = append(q.usages, models.OrderDiscountUsage{DiscountID: bestDiscount.ID, Amount: lineTotal})
+			}
+		}
+
+		q.DiscountTotal += itemDiscountAmount
+		finalLineTotal := lineTotal - itemDiscountAmount
+		if finalLineTotal < 0 {
+			finalLineTotal = 0
+		}
+
+		q.ItemDiscountDetails = append(q.ItemDiscountDetails, map[string]interface{}{
+			"product_id":           line.ProductID.Hex(),
+			"variant_id":           line.VariantID.Hex(),
+			"unit_price":           unitPrice,
+			"quantity":             line.Quantity,
+			"line_total":           lineTotal,
+			"discount":             itemDiscountAmount,
+			"final_line_total":     finalLineTotal,
+			"applied_discount_ids": appliedDiscountIDs,
+		})
+
+		q.Items = append(q.Items, models.OrderItem{
+			ProductID:  line.ProductID,
+			VariantID:  orderVariantID,
+			Name:       productName,
+			Quantity:   line.Quantity,
+			UnitPrice:  unitPrice,
+			TotalPrice: finalLineTotal,
+			Image:      productImage,
+			TaxClass:   product.TaxClass,
+		})
+	}
+
+	q.Total = q.Subtotal - q.DiscountTotal
+	if q.Total < 0 {
+		q.Total = 0
+	}
+	return q, nil
+}
+
+// orderSteps lists the writes that make up a checkout: stock first, since it is
+// the most likely to fail, then discount usage, then the cart's holds on what
+// was bought are marked converted, then the timeline entry and the order itself.
+func (s *CheckoutService) orderSteps(order *models.Order, customerID, cartID primitive.ObjectID, q *checkoutQuote) []writeStep {
+	var steps []writeStep
+
+	for _, item := range order.Items {
+		if item.Custom {
+			continue
+		}
+		item := item
+		steps = append(steps, writeStep{
+			name: "reduce stock",
+			apply: func(ctx context.Context) error {
+				var err error
+				if item.VariantID.IsZero() {
+					err = ReduceProductStock(ctx, item.ProductID, item.Quantity)
+				} else {
+					err = ReduceVariantStock(ctx, item.ProductID, item.VariantID, item.Quantity)
+				}
+				if errors.Is(err, ErrInsufficientStock) {
+					return &CheckoutError{Kind: ErrCheckoutInsufficientStock, ProductID: item.ProductID, VariantID: item.VariantID, Detail: "product/variant: " + item.ProductID.Hex()}
+				}
+				if errors.Is(err, ErrProductNotFound) || errors.Is(err, ErrVariantNotFound) {
+					return &CheckoutError{Kind: ErrCheckoutInvalidItem, ProductID: item.ProductID, VariantID: item.VariantID, Err: err}
+				}
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				if item.VariantID.IsZero() {
+					return RestoreProductStock(ctx, item.ProductID, item.Quantity)
+				}
+				return RestoreVariantStock(ctx, item.ProductID, item.VariantID, item.Quantity)
+			},
+		})
+	}
+
+	for _, usage := range order.DiscountUsages {
+		usage := usage
+		steps = append(steps, writeStep{
+			name: "record discount usage",
+			apply: func(ctx context.Context) error {
+				if err := recordDiscountUsage(ctx, usage.DiscountID, customerID, usage.Amount); err != nil {
+					return &CheckoutError{Kind: ErrCheckoutDiscountUnavailable, Detail: usage.DiscountID.Hex(), Err: err}
+				}
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				return ReleaseDiscountUsage(ctx, usage.DiscountID, customerID, usage.Amount)
+			},
+		})
+	}
+
+	if !cartID.IsZero() {
+		steps = append(steps, writeStep{
+			name: "convert reservations",
+			apply: func(ctx context.Context) error {
+				return convertOrderReservations(ctx, cartID, order)
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.ReactivateOrderReservations(ctx, order.ID)
+				return err
+			},
+		})
+	}
+
+	steps = append(steps, orderEventStep(newOrderEvent(order, models.OrderEventCreated,
+		models.OrderActor{Role: models.OrderActorCustomer, ID: customerID}, "Order placed", nil)))
+
+	steps = append(steps, writeStep{
+		name: "create order",
+		apply: func(ctx context.Context) error {
+			_, err := repositories.CreateOrder(ctx, order)
+			return err
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.DeleteOrder(ctx, order.ID.Hex())
+			return err
+		},
+	})
+
+	return steps
+}
+
+// commit runs the checkout writes as one unit and types any failure.
+func (s *CheckoutService) commit(steps []writeStep) error {
+	commit := s.commitSteps
+	if commit == nil {
+		commit = commitSteps
+	}
+	return asCheckoutError(commit(steps))
+}
+
+// asCheckoutError makes sure every failure leaving the service is typed.
+func asCheckoutError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var checkoutErr *CheckoutError
+	if errors.As(err, &checkoutErr) {
+		return checkoutErr
+	}
+	return &CheckoutError{Kind: ErrCheckoutFailed, Err: err}
+}
+
+// variantDisplayName renders e.g. "T-Shirt - Size: M, Color: Red".
+func variantDisplayName(productName string, options []models.Option) string {
+	if len(options) == 0 {
+		return productName
+	}
+	name := productName + " - "
+	for i, opt := range options {
+		if i > 0 {
+			name += ", "
+		}
+		name += fmt.Sprintf("%s: %s", opt.Name, opt.Value)
+	}
+	return name
+}
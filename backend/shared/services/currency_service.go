@@ -0,0 +1,501 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency")
+var ErrCurrencyNotEnabled = errors.New("currency is not enabled for this shop")
+var ErrExchangeRateNotFound = errors.New("no exchange rate for this currency")
+var ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+var ErrShopExchangeRateNotFound = errors.New("shop has no exchange rate of its own for this currency")
+var ErrExchangeRatesNotConfigured = errors.New("no exchange rate API is configured")
+
+// maxExchangeRateTableSize bounds how much of a rates file or API response is read.
+const maxExchangeRateTableSize = 1 << 20
+
+// ShopCurrency returns the currency the shop prices in.
+func ShopCurrency(shop *models.Shop) string {
+	if shop == nil || strings.TrimSpace(shop.Currency) == "" {
+		return models.DefaultShopCurrency
+	}
+	return strings.ToUpper(strings.TrimSpace(shop.Currency))
+}
+
+// normalizeCurrency upper-cases a currency code and checks it is three letters
+// and a currency amounts can hold.
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+		}
+	}
+	if !money.Supported(code) {
+		return "", fmt.Errorf("%w: %s has more than two decimals, which is not supported", ErrInvalidCurrency, code)
+	}
+	return code, nil
+}
+
+// ValidateShopCurrency checks a currency a shop is to price in.
+func ValidateShopCurrency(code string) (string, error) {
+	return normalizeCurrency(code)
+}
+
+// CurrencyConverter converts a shop's amounts into the currency a customer
+// shops in. Converting into the shop's own currency changes nothing.
+type CurrencyConverter struct {
+	From     string
+	To       string
+	Rate     float64
+	Rounding models.PriceRounding
+}
+
+// Price converts a price the seller set, such as a product's, and applies the
+// shop's rounding rule for the currency.
+func (c *CurrencyConverter) Price(a money.Amount) money.Amount {
+	v := c.Amount(a)
+	if v <= 0 {
+		return v
+	}
+	switch c.Rounding {
+	case models.PriceRoundingWhole:
+		return v.Whole(money.Up)
+	case models.PriceRoundingCharm:
+		if money.Decimals(c.To) == 0 {
+			return v.Whole(money.Up)
+		}
+		// The smallest price ending in .99 that is not below v
+		return (v + 1).Whole(money.Up) - 1
+	}
+	return v
+}
+
+// Amount converts a worked-out amount, such as a discount, shipping or tax,
+// rounded half up to what the currency can be charged in.
+func (c *CurrencyConverter) Amount(a money.Amount) money.Amount {
+	return a.Convert(c.Rate, c.To, money.HalfUp)
+}
+
+// presentLine is a cart or order line to price in a presentment currency.
+type presentLine struct {
+	UnitPrice money.Amount
+	Quantity  int
+	Discount  money.Amount
+	Tax       money.Amount
+}
+
+// Present prices lines, shipping and tax in the presentment currency. Unit
+// prices are converted as prices and multiplied out again, so a line costs
+// its quantity times the unit price the customer sees; other amounts are
+// converted on their own and the totals are the sums of the converted parts.
+// tax is the total tax, including any on shipping.
+func (c *CurrencyConverter) Present(lines []presentLine, shipping, tax money.Amount, taxIncluded bool) *models.Presentment {
+	p := &models.Presentment{Currency: c.To, ExchangeRate: c.Rate, Items: make([]models.PresentmentLine, len(lines))}
+	lineTax := money.Zero
+	for i, l := range lines {
+		unit := c.Price(l.UnitPrice)
+		pl := models.PresentmentLine{
+			UnitPrice:      unit,
+			LineTotal:      unit.Mul(l.Quantity),
+			DiscountAmount: c.Amount(l.Discount),
+			TaxAmount:      c.Amount(l.Tax),
+		}
+		p.Items[i] = pl
+		p.Subtotal += pl.LineTotal
+		p.DiscountTotal += pl.DiscountAmount
+		p.TaxAmount += pl.TaxAmount
+		lineTax += l.Tax
+	}
+	p.ShippingCost = c.Amount(shipping)
+	p.TaxAmount += c.Amount(tax - lineTax)
+	p.Total = p.Subtotal - p.DiscountTotal + p.ShippingCost
+	if !taxIncluded {
+		p.Total += p.TaxAmount
+	}
+	return p
+}
+
+// PresentmentConverterService returns the converter into currency for the
+// shop's customers. An empty currency, or the shop's own, converts nothing;
+// any other must be one the shop has enabled and has a rate for.
+func PresentmentConverterService(shop *models.Shop, currency string) (*CurrencyConverter, error) {
+	from := ShopCurrency(shop)
+	if strings.TrimSpace(currency) == "" || strings.EqualFold(strings.TrimSpace(currency), from) {
+		return &CurrencyConverter{From: from, To: from, Rate: 1}, nil
+	}
+	to, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	enabled := findPresentmentCurrency(shop, to)
+	if enabled == nil {
+		return nil, fmt.Errorf("%w: %s", ErrCurrencyNotEnabled, to)
+	}
+	rate, _, err := exchangeRate(shop, to)
+	if err != nil {
+		return nil, err
+	}
+	return &CurrencyConverter{From: from, To: to, Rate: rate, Rounding: enabled.Rounding}, nil
+}
+
+// orderConverter converts at the rate an order was placed at, so an edited
+// order is shown the way the rest of it was. The order must have a
+// presentment.
+func orderConverter(shop *models.Shop, order *models.Order) *CurrencyConverter {
+	c := &CurrencyConverter{From: order.Currency, To: order.Presentment.Currency, Rate: order.Presentment.ExchangeRate}
+	if enabled := findPresentmentCurrency(shop, c.To); enabled != nil {
+		c.Rounding = enabled.Rounding
+	}
+	return c
+}
+
+func findPresentmentCurrency(shop *models.Shop, currency string) *models.PresentmentCurrency {
+	for i := range shop.PresentmentCurrencies {
+		if strings.EqualFold(shop.PresentmentCurrencies[i].Currency, currency) {
+			return &shop.PresentmentCurrencies[i]
+		}
+	}
+	return nil
+}
+
+// exchangeRate is how many units of currency one unit of the shop's currency
+// buys, and where the rate came from: the shop's own rate if it set one,
+// otherwise the rate for all shops, directly, inverted or through a third
+// currency.
+func exchangeRate(shop *models.Shop, currency string) (float64, string, error) {
+	from := ShopCurrency(shop)
+	ctx := context.Background()
+	own, err := repositories.ListExchangeRates(ctx, &shop.ID)
+	if err != nil {
+		return 0, "", err
+	}
+	if rate, source, ok := pairRate(own, from, currency); ok {
+		return rate, source, nil
+	}
+	shared, err := repositories.ListExchangeRates(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	if rate, source, ok := crossRate(shared, from, currency); ok {
+		return rate, source, nil
+	}
+	return 0, "", fmt.Errorf("%w: %s to %s", ErrExchangeRateNotFound, from, currency)
+}
+
+// pairRate finds the rate from one currency to another among rates, as
+// stored or as the inverse of the opposite pair, and where it came from.
+func pairRate(rates []models.ExchangeRate, from, to string) (float64, string, bool) {
+	for _, r := range rates {
+		if r.Base == from && r.Quote == to && r.Rate > 0 {
+			return r.Rate, r.Source, true
+		}
+	}
+	for _, r := range rates {
+		if r.Base == to && r.Quote == from && r.Rate > 0 {
+			return 1 / r.Rate, r.Source, true
+		}
+	}
+	return 0, "", false
+}
+
+// crossRate is pairRate, falling back to going through a third currency, as
+// when rates are loaded against USD and the shop prices in EUR.
+func crossRate(rates []models.ExchangeRate, from, to string) (float64, string, bool) {
+	if rate, source, ok := pairRate(rates, from, to); ok {
+		return rate, source, true
+	}
+	for _, r := range rates {
+		for _, via := range []string{r.Base, r.Quote} {
+			if via == from || via == to {
+				continue
+			}
+			first, _, ok1 := pairRate(rates, from, via)
+			second, source, ok2 := pairRate(rates, via, to)
+			if ok1 && ok2 {
+				return first * second, source, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// ShopCurrencyRate is one of a shop's presentment currencies and the rate it
+// is priced at. Rate is zero, and Source empty, when no rate is known.
+type ShopCurrencyRate struct {
+	Currency string               `json:"currency"`
+	Rounding models.PriceRounding `json:"rounding,omitempty"`
+	Rate     float64              `json:"rate,omitempty"`
+	Source   string               `json:"source,omitempty"`
+}
+
+// ShopCurrencies is a shop's own currency and those customers may shop in.
+type ShopCurrencies struct {
+	Currency    string             `json:"currency"`
+	Presentment []ShopCurrencyRate `json:"presentment"`
+}
+
+// ShopCurrenciesService lists the shop's presentment currencies with their
+// current rates.
+func ShopCurrenciesService(shop *models.Shop) (*ShopCurrencies, error) {
+	out := &ShopCurrencies{Currency: ShopCurrency(shop), Presentment: []ShopCurrencyRate{}}
+	for _, pc := range shop.PresentmentCurrencies {
+		row := ShopCurrencyRate{Currency: pc.Currency, Rounding: pc.Rounding}
+		rate, source, err := exchangeRate(shop, pc.Currency)
+		if err != nil && !errors.Is(err, ErrExchangeRateNotFound) {
+			return nil, err
+		}
+		row.Rate, row.Source = rate, source
+		out.Presentment = append(out.Presentment, row)
+	}
+	return out, nil
+}
+
+// SetPresentmentCurrenciesService replaces the currencies the shop's
+// customers may shop in. Every one needs a known exchange rate from the
+// shop's currency, loaded for all shops or set by the shop.
+func SetPresentmentCurrenciesService(shop *models.Shop, currencies []models.PresentmentCurrency) (*ShopCurrencies, error) {
+	from := ShopCurrency(shop)
+	seen := map[string]bool{}
+	cleaned := make([]models.PresentmentCurrency, 0, len(currencies))
+	for _, pc := range currencies {
+		code, err := normalizeCurrency(pc.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if code == from || seen[code] {
+			continue
+		}
+		switch pc.Rounding {
+		case models.PriceRoundingNone, models.PriceRoundingWhole, models.PriceRoundingCharm:
+		default:
+			return nil, fmt.Errorf("%w: unknown rounding %q for %s", ErrInvalidCurrency, pc.Rounding, code)
+		}
+		if _, _, err := exchangeRate(shop, code); err != nil {
+			return nil, err
+		}
+		seen[code] = true
+		cleaned = append(cleaned, models.PresentmentCurrency{Currency: code, Rounding: pc.Rounding})
+	}
+	if _, err := UpdateShopService(shop.ID.Hex(), bson.M{"presentmentCurrencies": cleaned}); err != nil {
+		return nil, err
+	}
+	shop.PresentmentCurrencies = cleaned
+	return ShopCurrenciesService(shop)
+}
+
+// SetShopExchangeRateService sets the shop's own rate from its currency to
+// currency, overriding the rate for all shops.
+func SetShopExchangeRateService(shop *models.Shop, currency string, rate float64) (*ShopCurrencies, error) {
+	code, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if code == ShopCurrency(shop) {
+		return nil, fmt.Errorf("%w: %s is the shop's own currency", ErrInvalidCurrency, code)
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("%w: rate must be positive", ErrInvalidExchangeRate)
+	}
+	err = repositories.UpsertExchangeRate(context.Background(), &models.ExchangeRate{
+		ShopID: &shop.ID,
+		Base:   ShopCurrency(shop),
+		Quote:  code,
+		Rate:   rate,
+		Source: models.ExchangeRateSourceManual,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ShopCurrenciesService(shop)
+}
+
+// DeleteShopExchangeRateService removes the shop's own rate for currency, so
+// the rate for all shops applies again.
+func DeleteShopExchangeRateService(shop *models.Shop, currency string) (*ShopCurrencies, error) {
+	code, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	res, err := repositories.DeleteExchangeRate(context.Background(), shop.ID, ShopCurrency(shop), code)
+	if err != nil {
+		return nil, err
+	}
+	if res.DeletedCount == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrShopExchangeRateNotFound, code)
+	}
+	return ShopCurrenciesService(shop)
+}
+
+// ExchangeRateTable is the format rates are loaded in, from a file or the
+// rates API: how many units of each currency one unit of Base buys. Most
+// exchange rate APIs answer in it.
+type ExchangeRateTable struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// ListExchangeRatesService returns the rates loaded for all shops.
+func ListExchangeRatesService() ([]models.ExchangeRate, error) {
+	rates, err := repositories.ListExchangeRates(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if rates == nil {
+		rates = []models.ExchangeRate{}
+	}
+	return rates, nil
+}
+
+// ImportExchangeRatesService loads an ExchangeRateTable as the rates for all
+// shops, replacing those for the same pairs. The whole table is checked
+// before anything is stored; currencies amounts cannot hold are skipped. It
+// returns how many rates were stored.
+func ImportExchangeRatesService(r io.Reader, source string) (int, error) {
+	var table ExchangeRateTable
+	if err := json.NewDecoder(io.LimitReader(r, maxExchangeRateTableSize)).Decode(&table); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidExchangeRate, err)
+	}
+	base, err := normalizeCurrency(table.Base)
+	if err != nil {
+		return 0, err
+	}
+	if len(table.Rates) == 0 {
+		return 0, fmt.Errorf("%w: no rates", ErrInvalidExchangeRate)
+	}
+	quotes := make([]string, 0, len(table.Rates))
+	rates := map[string]float64{}
+	for code, rate := range table.Rates {
+		if !money.Supported(code) {
+			// Published tables list every currency; those amounts cannot
+			// hold are never offered, so their rates are not needed
+			continue
+		}
+		quote, err := normalizeCurrency(code)
+		if err != nil {
+			return 0, err
+		}
+		if rate <= 0 {
+			return 0, fmt.Errorf("%w: rate for %s must be positive", ErrInvalidExchangeRate, quote)
+		}
+		if quote == base {
+			continue
+		}
+		quotes = append(quotes, quote)
+		rates[quote] = rate
+	}
+	sort.Strings(quotes)
+
+	now := time.Now()
+	for i, quote := range quotes {
+		err := repositories.UpsertExchangeRate(context.Background(), &models.ExchangeRate{
+			Base: base, Quote: quote, Rate: rates[quote], Source: source, UpdatedAt: now,
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(quotes), nil
+}
+
+// RefreshExchangeRatesService loads the rates for all shops from the API at
+// EXCHANGE_RATES_URL, which must answer with an ExchangeRateTable.
+func RefreshExchangeRatesService() (int, error) {
+	url := os.Getenv("EXCHANGE_RATES_URL")
+	if url == "" {
+		return 0, ErrExchangeRatesNotConfigured
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("exchange rate API answered %s", resp.Status)
+	}
+	return ImportExchangeRatesService(resp.Body, models.ExchangeRateSourceAPI)
+}
+
+// exchangeRateRefreshInterval is how often rates are reloaded from the API,
+// EXCHANGE_RATES_REFRESH_HOURS or daily.
+func exchangeRateRefreshInterval() time.Duration {
+	if v := os.Getenv("EXCHANGE_RATES_REFRESH_HOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Hour
+		}
+	}
+	return 24 * time.Hour
+}
+
+// StartExchangeRateRefresh loads rates from the API now and then
+// periodically, in the background. It does nothing if no API is configured.
+func StartExchangeRateRefresh() {
+	if os.Getenv("EXCHANGE_RATES_URL") == "" {
+		return
+	}
+	refresh := func() {
+		if n, err := RefreshExchangeRatesService(); err != nil {
+			log.Printf("exchange rates: refresh failed: %v", err)
+		} else {
+			log.Printf("exchange rates: loaded %d rates", n)
+		}
+	}
+	go func() {
+		refresh()
+		ticker := time.NewTicker(exchangeRateRefreshInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+// PresentProductResponse converts the prices in a storefront product
+// response, as built by ProductToAPIResponse, into the converter's currency
+// and records which currency they are in.
+func PresentProductResponse(resp map[string]interface{}, c *CurrencyConverter) map[string]interface{} {
+	if v, ok := resp["price"].(money.Amount); ok {
+		resp["price"] = c.Price(v)
+	}
+	if v, ok := resp["starting_price"].(money.Amount); ok {
+		resp["starting_price"] = c.Price(v)
+	}
+	if variants, ok := resp["variants"].([]models.Variant); ok {
+		converted := make([]models.Variant, len(variants))
+		for i, v := range variants {
+			v.Price = c.Price(v.Price)
+			if v.DisplayPrice != nil {
+				p := c.Price(*v.DisplayPrice)
+				v.DisplayPrice = &p
+			}
+			if v.Total != nil {
+				t := c.Amount(*v.Total)
+				v.Total = &t
+			}
+			converted[i] = v
+		}
+		resp["variants"] = converted
+	}
+	resp["currency"] = c.To
+	return resp
+}
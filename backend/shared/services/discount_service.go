@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	sellerRepo "github.com/Endale2/DRPS/sellers/repositories"
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -66,7 +68,7 @@ func GetDiscountByIDService(idStr string) (*models.Discount, error) {
 	if err != nil {
 		return nil, errors.New("invalid discount ID")
 	}
-	d, err := repositories.GetDiscountByID(id)
+	d, err := repositories.GetDiscountByID(context.Background(), id)
 	if err != nil {
 		return nil, err
 	}
@@ -278,7 +280,7 @@ func ApplyDiscountsToProduct(product *models.Product, discounts []models.Discoun
 	// Helper: get best discount for a variant or product
 	getBestDiscount := func(productID, variantID primitive.ObjectID) *models.Discount {
 		var best *models.Discount
-		var maxSavings float64
+		var maxSavings money.Amount
 
 		for i := range discounts {
 			d := &discounts[i]
@@ -306,14 +308,7 @@ func ApplyDiscountsToProduct(product *models.Product, discounts []models.Discoun
 
 			if applies {
 				// Calculate actual savings for comparison
-				var estimatedSavings float64
-				if d.Type == models.DiscountTypePercentage {
-					// For percentage discounts, estimate based on typical price
-					estimatedSavings = 100 * (d.Value / 100)
-				} else {
-					// For fixed discounts, the value is the savings
-					estimatedSavings = d.Value
-				}
+				estimatedSavings := estimatedDiscountSavings(d)
 
 				if best == nil || estimatedSavings > maxSavings {
 					best = d
@@ -366,10 +361,19 @@ func ApplyDiscountsToProduct(product *models.Product, discounts []models.Discoun
 	}
 }
 
+// estimatedDiscountSavings ranks discounts without a price to apply them to:
+// a percentage is taken of a typical price of 100, a fixed amount as it is.
+func estimatedDiscountSavings(d *models.Discount) money.Amount {
+	if d.Type == models.DiscountTypePercentage {
+		return money.Amount(100*money.Scale).Percent(d.Value, money.HalfUp)
+	}
+	return d.FixedAmount()
+}
+
 // GetBestProductDiscount returns the best discount for a product or variant.
 func GetBestProductDiscount(productID, variantID primitive.ObjectID, discounts []models.Discount) *models.Discount {
 	var best *models.Discount
-	var maxSavings float64
+	var maxSavings money.Amount
 
 	for i := range discounts {
 		d := &discounts[i]
@@ -397,14 +401,7 @@ func GetBestProductDiscount(productID, variantID primitive.ObjectID, discounts [
 
 		if applies && d.IsActive() {
 			// Calculate actual savings for comparison
-			var estimatedSavings float64
-			if d.Type == models.DiscountTypePercentage {
-				// Estimate savings based on a typical product price (e.g., $100)
-				estimatedSavings = 100 * (d.Value / 100)
-			} else {
-				// Fixed discount - the value is the savings
-				estimatedSavings = d.Value
-			}
+			estimatedSavings := estimatedDiscountSavings(d)
 
 			if best == nil || estimatedSavings > maxSavings {
 				best = d
@@ -456,62 +453,46 @@ func ValidateDiscountValue(discountType models.DiscountType, value float64) erro
 
 // RecordDiscountUsageAtomic safely records discount usage with atomic operations
 // This prevents race conditions when multiple orders use the same discount
-func RecordDiscountUsageAtomic(discountID string, customerID primitive.ObjectID, amount float64) error {
+func RecordDiscountUsageAtomic(discountID string, customerID primitive.ObjectID, amount money.Amount) error {
 	id, err := primitive.ObjectIDFromHex(discountID)
 	if err != nil {
 		return errors.New("invalid discount ID")
 	}
+	return recordDiscountUsage(context.Background(), id, customerID, amount)
+}
 
-	// First, check if we can still use this discount
-	discount, err := GetDiscountByIDService(discountID)
+// recordDiscountUsage records one use of a discount inside ctx, which may carry
+// a transaction session. The overall usage limit is enforced by the update filter.
+func recordDiscountUsage(ctx context.Context, id, customerID primitive.ObjectID, amount money.Amount) error {
+	// First, check if we can still use this discount; read in ctx so the
+	// check sees the transaction's own writes and takes part in it
+	discount, err := repositories.GetDiscountByID(ctx, id)
 	if err != nil {
 		return err
 	}
+	if discount == nil {
+		return ErrDiscountNotFound
+	}
 
-	// Validate usage limits before recording
+	// Per-customer limits are checked here; the total limit is re-checked atomically below
 	if !discount.CanUse(customerID) {
 		return ErrDiscountUsageLimitExceeded
 	}
 
-	// Use atomic operations to safely update usage
-	now := time.Now()
-
-	// Find existing usage record for this customer
-	found := false
-	for i := range discount.UsageTracking {
-		if discount.UsageTracking[i].CustomerID == customerID {
-			// Update existing record
-			discount.UsageTracking[i].UsageCount++
-			discount.UsageTracking[i].LastUsedAt = now
-			discount.UsageTracking[i].TotalSpent += amount
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		// Create new usage record
-		newUsage := models.DiscountUsage{
-			CustomerID: customerID,
-			UsageCount: 1,
-			LastUsedAt: now,
-			TotalSpent: amount,
-		}
-		discount.UsageTracking = append(discount.UsageTracking, newUsage)
+	res, err := repositories.IncrementDiscountUsage(ctx, id, customerID, amount)
+	if err != nil {
+		return err
 	}
-
-	// Single atomic operation that increments current_usage and updates usage_tracking
-	atomicUpdate := bson.M{
-		"$inc": bson.M{
-			"current_usage": 1,
-		},
-		"$set": bson.M{
-			"usage_tracking": discount.UsageTracking,
-			"updated_at":     now,
-		},
+	if res.MatchedCount == 0 {
+		return ErrDiscountUsageLimitExceeded
 	}
+	return nil
+}
 
-	_, err = repositories.UpdateDiscountWithOperators(id, atomicUpdate)
+// ReleaseDiscountUsage reverses a usage previously recorded with
+// RecordDiscountUsageAtomic, giving the use back to the customer.
+func ReleaseDiscountUsage(ctx context.Context, discountID, customerID primitive.ObjectID, amount money.Amount) error {
+	_, err := repositories.DecrementDiscountUsage(ctx, discountID, customerID, amount)
 	return err
 }
 
@@ -620,7 +601,7 @@ func GetDiscountStatusForCustomer(discount *models.Discount, customerID primitiv
 // Now returns detailed status information
 func GetBestEligibleDiscountForProduct(productID, variantID primitive.ObjectID, customerID primitive.ObjectID, customerSegmentIDs []primitive.ObjectID, discounts []models.Discount) (*models.Discount, []DiscountStatus) {
 	var best *models.Discount
-	var maxSavings float64
+	var maxSavings money.Amount
 	var allStatuses []DiscountStatus
 
 	for i := range discounts {
@@ -646,13 +627,7 @@ func GetBestEligibleDiscountForProduct(productID, variantID primitive.ObjectID,
 		}
 
 		// Calculate estimated savings for comparison
-		var estimatedSavings float64
-		if d.Type == models.DiscountTypePercentage {
-			// Estimate based on typical price
-			estimatedSavings = 100 * (d.Value / 100)
-		} else {
-			estimatedSavings = d.Value
-		}
+		estimatedSavings := estimatedDiscountSavings(d)
 
 		if best == nil || estimatedSavings > maxSavings {
 			best = d
@@ -0,0 +1,594 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidDraftOrder = errors.New("invalid draft order")
+var ErrDraftOrderNotFound = errors.New("draft order not found")
+var ErrDraftOrderCompleted = errors.New("draft order is already completed")
+var ErrDraftOrderLinkInvalid = errors.New("checkout link is invalid or has expired")
+var ErrDraftOrderChanged = errors.New("draft order total has changed")
+
+// Draft numbers are "D" and the shop's draft sequence, e.g. "D12".
+const draftOrderNumberPrefix = "D"
+
+// defaultDraftOrderLinkTTL is how long a checkout link works when
+// DRAFT_ORDER_LINK_TTL_HOURS is not set.
+const defaultDraftOrderLinkTTL = 7 * 24 * time.Hour
+
+// DraftOrderLinkTTL returns how long a draft order's checkout link works.
+func DraftOrderLinkTTL() time.Duration {
+	if v := os.Getenv("DRAFT_ORDER_LINK_TTL_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return defaultDraftOrderLinkTTL
+}
+
+// draftOrderLinkSecret signs checkout links. DRAFT_ORDER_LINK_SECRET lets it
+// be rotated on its own; otherwise the JWT secret is used.
+func draftOrderLinkSecret() ([]byte, error) {
+	secret := os.Getenv("DRAFT_ORDER_LINK_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("DRAFT_ORDER_LINK_SECRET is not set")
+	}
+	return []byte(secret), nil
+}
+
+// DraftOrderLink is a signed checkout link for a draft order. The token is
+// what the storefront sends back to view and pay the draft.
+type DraftOrderLink struct {
+	URL       string    `json:"url"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// draftOrderLinkSignature signs the draft's ID, current nonce and the link's
+// expiry time.
+func draftOrderLinkSignature(secret []byte, d *models.DraftOrder, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%s:%d", d.ID.Hex(), d.LinkNonce, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDraftOrderLink checks a token from a checkout link against the draft.
+func verifyDraftOrderLink(d *models.DraftOrder, token string, now time.Time) error {
+	expiresPart, sig, ok := strings.Cut(token, ".")
+	if !ok || d.LinkNonce == "" {
+		return ErrDraftOrderLinkInvalid
+	}
+	expires, err := strconv.ParseInt(expiresPart, 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return ErrDraftOrderLinkInvalid
+	}
+	secret, err := draftOrderLinkSecret()
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(sig), []byte(draftOrderLinkSignature(secret, d, expires))) {
+		return ErrDraftOrderLinkInvalid
+	}
+	return nil
+}
+
+// draftOrderLinkURL is where the customer opens the draft. STOREFRONT_URL,
+// if set, makes it absolute.
+func draftOrderLinkURL(shop *models.Shop, d *models.DraftOrder, token string) string {
+	base := strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/")
+	return fmt.Sprintf("%s/shops/%s/draft-orders/%s?token=%s", base, url.PathEscape(shop.Slug), d.ID.Hex(), url.QueryEscape(token))
+}
+
+// validateDraftOrder normalises what the seller entered and checks it. Product
+// lines are checked against the catalogue when the draft is priced.
+func validateDraftOrder(d *models.DraftOrder) error {
+	if d.CustomerID.IsZero() {
+		return fmt.Errorf("%w: customer_id is required", ErrInvalidDraftOrder)
+	}
+	if c, err := repositories.GetCustomerByID(d.CustomerID.Hex()); err != nil || c == nil {
+		return fmt.Errorf("%w: customer not found", ErrInvalidDraftOrder)
+	}
+	if len(d.Lines) == 0 {
+		return fmt.Errorf("%w: at least one line is required", ErrInvalidDraftOrder)
+	}
+	for i := range d.Lines {
+		l := &d.Lines[i]
+		if l.Quantity <= 0 {
+			return fmt.Errorf("%w: line %d: quantity must be positive", ErrInvalidDraftOrder, i+1)
+		}
+		if l.ProductID.IsZero() {
+			l.VariantID = primitive.NilObjectID
+			l.Name = strings.TrimSpace(l.Name)
+			if l.Name == "" {
+				return fmt.Errorf("%w: line %d: custom items need a name", ErrInvalidDraftOrder, i+1)
+			}
+			if l.UnitPrice < 0 {
+				return fmt.Errorf("%w: line %d: unit_price cannot be negative", ErrInvalidDraftOrder, i+1)
+			}
+		} else {
+			// Products are priced from the catalogue
+			l.Name, l.UnitPrice, l.TaxClass = "", 0, ""
+		}
+		if err := validateDraftDiscount(l.Discount); err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrInvalidDraftOrder, i+1, err)
+		}
+	}
+	if err := validateDraftDiscount(d.Discount); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDraftOrder, err)
+	}
+	d.Note = strings.TrimSpace(d.Note)
+	return nil
+}
+
+func validateDraftDiscount(dd *models.DraftDiscount) error {
+	if dd == nil {
+		return nil
+	}
+	switch dd.Type {
+	case models.DraftDiscountPercentage:
+		if dd.Value < 0 || dd.Value > 100 {
+			return errors.New("percentage discount must be between 0 and 100")
+		}
+	case models.DraftDiscountFixed:
+		if dd.Value < 0 {
+			return errors.New("fixed discount cannot be negative")
+		}
+	default:
+		return errors.New("discount type must be percentage or fixed")
+	}
+	dd.Reason = strings.TrimSpace(dd.Reason)
+	return nil
+}
+
+// draftDiscountOn is how much a manual discount takes off amount. Percentages
+// are rounded half up to the cent.
+func draftDiscountOn(dd *models.DraftDiscount, amount money.Amount) money.Amount {
+	if dd == nil || amount <= 0 {
+		return 0
+	}
+	off := money.FromFloat(dd.Value, money.HalfUp)
+	if dd.Type == models.DraftDiscountPercentage {
+		off = amount.Percent(dd.Value, money.HalfUp)
+	}
+	return money.Min(off, amount)
+}
+
+// quoteDraftOrder prices a draft's lines the way checkout does: product lines
+// get catalogue prices and automatic discounts, custom lines their entered
+// price, and then the seller's manual discounts come off. An order-wide
+// discount is shared out across lines by value so tax and refunds per line
+// stay right.
+func (s *CheckoutService) quoteDraftOrder(shop *models.Shop, d *models.DraftOrder) (*checkoutQuote, error) {
+	var productLines []CheckoutLine
+	for _, l := range d.Lines {
+		if !l.ProductID.IsZero() {
+			productLines = append(productLines, CheckoutLine{ProductID: l.ProductID, VariantID: l.VariantID, Quantity: l.Quantity})
+		}
+	}
+	products := &checkoutQuote{}
+	if len(productLines) > 0 {
+		var err error
+		// Drafts hold no stock, so nothing is reserved for them
+		if products, err = s.quote(shop.ID, d.CustomerID, primitive.NilObjectID, productLines); err != nil {
+			return nil, err
+		}
+	}
+
+	q := &checkoutQuote{
+		AppliedDiscountIDs: products.AppliedDiscountIDs,
+		Weight:             products.Weight,
+		usages:             products.usages,
+	}
+	next := 0
+	for _, l := range d.Lines {
+		var item models.OrderItem
+		if l.ProductID.IsZero() {
+			item = models.OrderItem{
+				ProductID:  primitive.NewObjectID(),
+				Name:       l.Name,
+				Quantity:   l.Quantity,
+				UnitPrice:  l.UnitPrice,
+				TotalPrice: l.UnitPrice.Mul(l.Quantity),
+				TaxClass:   l.TaxClass,
+				Custom:     true,
+			}
+		} else {
+			item = products.Items[next]
+			next++
+		}
+		item.TotalPrice -= draftDiscountOn(l.Discount, item.TotalPrice)
+		q.Subtotal += item.UnitPrice.Mul(item.Quantity)
+		q.ItemCount += item.Quantity
+		q.Items = append(q.Items, item)
+	}
+
+	lineTotals := make([]money.Amount, len(q.Items))
+	for i, item := range q.Items {
+		lineTotals[i] = item.TotalPrice
+	}
+	if off := draftDiscountOn(d.Discount, money.Sum(lineTotals...)); off > 0 {
+		for i, share := range money.Allocate(off, lineTotals) {
+			q.Items[i].TotalPrice -= share
+		}
+	}
+
+	for _, item := range q.Items {
+		q.Total += item.TotalPrice
+	}
+	q.DiscountTotal = q.Subtotal - q.Total
+	return q, nil
+}
+
+// priceDraftOrder re-prices a draft in place: lines, the shipping options for
+// its address and the chosen method's cost, and tax. It returns the quote and
+// tax an order made from the draft now would be built from.
+func (s *CheckoutService) priceDraftOrder(shop *models.Shop, d *models.DraftOrder) (*checkoutQuote, *TaxResult, error) {
+	q, err := s.quoteDraftOrder(shop, d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.ShippingOptions, d.ShippingMethod, d.ShippingCost = nil, nil, 0
+	if len(d.ShippingAddress) > 0 || d.ShippingMethodID != "" {
+		dest, ok := ShippingDestinationFromAddress(d.ShippingAddress)
+		if !ok {
+			return nil, nil, &CheckoutError{Kind: ErrCheckoutShippingRequired, Detail: "shipping address must include a country"}
+		}
+		d.ShippingOptions = QuoteShippingService(ShippingQuoteRequest{
+			ShopID:      shop.ID,
+			Destination: dest,
+			Subtotal:    q.Total,
+			Weight:      q.Weight,
+			ItemCount:   q.ItemCount,
+		})
+		if d.ShippingMethodID != "" {
+			if d.ShippingMethod = findShippingQuote(d.ShippingOptions, d.ShippingMethodID); d.ShippingMethod == nil {
+				return nil, nil, &CheckoutError{Kind: ErrCheckoutShippingUnavailable, Detail: d.ShippingMethodID}
+			}
+			d.ShippingCost = d.ShippingMethod.Amount
+		}
+	}
+
+	tax, err := s.tax(shop, q, d.ShippingAddress, d.ShippingCost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.Items = q.Items
+	d.Subtotal = q.Subtotal
+	d.DiscountTotal = q.DiscountTotal
+	d.TaxAmount = tax.Total
+	d.Tax = tax.OrderTax()
+	d.Total = q.Total + d.ShippingCost + tax.Added()
+	return q, tax, nil
+}
+
+// readyToSend checks that a priced draft can be turned into an order: once
+// shipping options exist for its address, one of them must be chosen.
+func readyToSend(d *models.DraftOrder) error {
+	if len(d.ShippingOptions) > 0 && d.ShippingMethod == nil {
+		return &CheckoutError{Kind: ErrCheckoutShippingRequired, Detail: "choose a shipping method"}
+	}
+	return nil
+}
+
+// CreateDraftOrderService validates, prices and stores a new draft order.
+func CreateDraftOrderService(shop *models.Shop, in *models.DraftOrder) (*models.DraftOrder, error) {
+	if err := validateDraftOrder(in); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	d := &models.DraftOrder{
+		ID:               primitive.NewObjectID(),
+		ShopID:           shop.ID,
+		CustomerID:       in.CustomerID,
+		Status:           models.DraftOrderStatusOpen,
+		Note:             in.Note,
+		Lines:            in.Lines,
+		Discount:         in.Discount,
+		ShippingAddress:  in.ShippingAddress,
+		ShippingMethodID: in.ShippingMethodID,
+	}
+	if _, _, err := NewCheckoutService().priceDraftOrder(shop, d); err != nil {
+		return nil, err
+	}
+
+	seq, err := repositories.NextDraftOrderSequence(ctx, shop.ID)
+	if err != nil {
+		return nil, err
+	}
+	d.Number = fmt.Sprintf("%s%d", draftOrderNumberPrefix, seq)
+	now := time.Now()
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	if err := repositories.CreateDraftOrder(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDraftOrdersService returns a shop's drafts, newest first, optionally
+// only those in one status.
+func ListDraftOrdersService(shopID primitive.ObjectID, status models.DraftOrderStatus) ([]models.DraftOrder, error) {
+	drafts, err := repositories.ListDraftOrdersByShop(context.Background(), shopID, status)
+	if err != nil {
+		return nil, err
+	}
+	if drafts == nil {
+		drafts = []models.DraftOrder{}
+	}
+	return drafts, nil
+}
+
+// GetDraftOrderService returns one of a shop's drafts.
+func GetDraftOrderService(shopID primitive.ObjectID, idHex string) (*models.DraftOrder, error) {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return nil, ErrDraftOrderNotFound
+	}
+	d, err := repositories.GetDraftOrder(context.Background(), shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrDraftOrderNotFound
+	}
+	return d, nil
+}
+
+// getOpenDraftOrder returns one of a shop's drafts that can still be changed.
+func getOpenDraftOrder(shopID primitive.ObjectID, idHex string) (*models.DraftOrder, error) {
+	d, err := GetDraftOrderService(shopID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != models.DraftOrderStatusOpen {
+		return nil, ErrDraftOrderCompleted
+	}
+	return d, nil
+}
+
+// saveDraftOrder stores a re-priced open draft.
+func saveDraftOrder(d *models.DraftOrder) error {
+	d.UpdatedAt = time.Now()
+	res, err := repositories.ReplaceOpenDraftOrder(context.Background(), d)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrDraftOrderCompleted
+	}
+	return nil
+}
+
+// UpdateDraftOrderService replaces what the seller entered on an open draft
+// and re-prices it. Links already sent keep working and show the new draft.
+func UpdateDraftOrderService(shop *models.Shop, idHex string, in *models.DraftOrder) (*models.DraftOrder, error) {
+	d, err := getOpenDraftOrder(shop.ID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDraftOrder(in); err != nil {
+		return nil, err
+	}
+	d.CustomerID = in.CustomerID
+	d.Note = in.Note
+	d.Lines = in.Lines
+	d.Discount = in.Discount
+	d.ShippingAddress = in.ShippingAddress
+	d.ShippingMethodID = in.ShippingMethodID
+	if _, _, err := NewCheckoutService().priceDraftOrder(shop, d); err != nil {
+		return nil, err
+	}
+	if err := saveDraftOrder(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DeleteDraftOrderService removes an open draft. Completed drafts are kept
+// as the record of where their order came from.
+func DeleteDraftOrderService(shopID primitive.ObjectID, idHex string) error {
+	d, err := getOpenDraftOrder(shopID, idHex)
+	if err != nil {
+		return err
+	}
+	res, err := repositories.DeleteOpenDraftOrder(context.Background(), shopID, d.ID)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrDraftOrderCompleted
+	}
+	return nil
+}
+
+// SendDraftOrderLinkService re-prices an open draft and issues a new signed
+// checkout link for it, revoking any link sent before. The customer is
+// notified with the link; the seller can also pass it on themselves.
+func SendDraftOrderLinkService(shop *models.Shop, idHex string) (*DraftOrderLink, error) {
+	d, err := getOpenDraftOrder(shop.ID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := NewCheckoutService().priceDraftOrder(shop, d); err != nil {
+		return nil, err
+	}
+	if err := readyToSend(d); err != nil {
+		return nil, err
+	}
+	secret, err := draftOrderLinkSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(DraftOrderLinkTTL()).Truncate(time.Second)
+	d.LinkNonce = hex.EncodeToString(nonce)
+	d.LinkExpiresAt = &expiresAt
+	if err := saveDraftOrder(d); err != nil {
+		return nil, err
+	}
+
+	token := fmt.Sprintf("%d.%s", expiresAt.Unix(), draftOrderLinkSignature(secret, d, expiresAt.Unix()))
+	link := &DraftOrderLink{URL: draftOrderLinkURL(shop, d, token), Token: token, ExpiresAt: expiresAt}
+
+	message := fmt.Sprintf("%s has prepared an order for you totalling %s. Review and pay: %s",
+		shop.Name, formatMoney(d.Total, shop.Currency), link.URL)
+	if err := NotifyCustomerService(shop, d.CustomerID, models.NotificationDraftOrderLink, primitive.NilObjectID,
+		"Your order from "+shop.Name, message); err != nil {
+		log.Printf("draft orders: could not notify customer of draft %s: %v", d.ID.Hex(), err)
+	}
+	return link, nil
+}
+
+// OpenDraftOrderLinkService returns the draft behind a checkout link,
+// re-priced so the customer sees what they would pay now. A completed draft
+// is returned as it was completed.
+func OpenDraftOrderLinkService(shop *models.Shop, idHex, token string) (*models.DraftOrder, error) {
+	d, err := GetDraftOrderService(shop.ID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDraftOrderLink(d, token, time.Now()); err != nil {
+		return nil, err
+	}
+	if d.Status != models.DraftOrderStatusOpen {
+		return d, nil
+	}
+	if _, _, err := NewCheckoutService().priceDraftOrder(shop, d); err != nil {
+		return nil, err
+	}
+	if err := saveDraftOrder(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// PayDraftOrderService pays for a draft through its checkout link. The first
+// call turns the draft into a pending order, exactly as a checkout would, and
+// starts payment with the chosen provider; the order is paid once the
+// provider confirms. If the price moved since the customer last opened the
+// link, the re-priced draft is saved and ErrDraftOrderChanged returned so they
+// can review it. Calling again after the order was made resumes its payment.
+func PayDraftOrderService(shop *models.Shop, idHex, token, providerName string) (*models.Order, *models.Payment, error) {
+	d, err := GetDraftOrderService(shop.ID, idHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verifyDraftOrderLink(d, token, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	provider := PaymentProviderByName(providerName)
+	if provider == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, providerName)
+	}
+	if !shopAcceptsPaymentMethod(shop, provider.Name()) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPaymentMethodNotEnabled, provider.Name())
+	}
+	actor := models.OrderActor{Role: models.OrderActorCustomer, ID: d.CustomerID}
+
+	var order *models.Order
+	if d.Status == models.DraftOrderStatusOpen {
+		if order, err = NewCheckoutService().completeDraftOrder(shop, d); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if order, err = repositories.GetOrderByID(context.Background(), d.OrderID.Hex()); err != nil {
+			return nil, nil, err
+		}
+		if order == nil || order.Status != models.OrderStatusPending {
+			return nil, nil, ErrDraftOrderCompleted
+		}
+	}
+
+	payment, err := StartOrderPaymentService(shop, order, provider.Name(), actor)
+	if err != nil {
+		return order, nil, err
+	}
+	return order, payment, nil
+}
+
+// completeDraftOrder re-prices an open draft and commits it as an order
+// together with the draft's completion, so a link paid twice at once still
+// makes one order.
+func (s *CheckoutService) completeDraftOrder(shop *models.Shop, d *models.DraftOrder) (*models.Order, error) {
+	totalBefore := d.Total
+	quote, tax, err := s.priceDraftOrder(shop, d)
+	if err != nil {
+		return nil, err
+	}
+	if err := readyToSend(d); err != nil {
+		return nil, err
+	}
+	if totalBefore != d.Total {
+		if err := saveDraftOrder(d); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: was %s, now %s", ErrDraftOrderChanged, totalBefore, d.Total)
+	}
+
+	order := newPendingOrder(shop, d.CustomerID, quote, d.ShippingAddress, d.ShippingMethod, tax)
+	order.DraftOrderID = d.ID
+	// Draft orders are priced, and so presented, in the shop's currency
+	sameCurrency, _ := PresentmentConverterService(shop, "")
+	order.Presentment = presentOrder(sameCurrency, order, tax.Inclusive)
+	if err := prepareOrder(order, shop); err != nil {
+		return nil, &CheckoutError{Kind: ErrCheckoutFailed, Detail: "could not assign order number", Err: err}
+	}
+
+	now := time.Now()
+	steps := []writeStep{{
+		name: "complete draft order",
+		apply: func(ctx context.Context) error {
+			res, err := repositories.CompleteDraftOrder(ctx, d.ID, order.ID, now)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return ErrDraftOrderCompleted
+			}
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.ReopenDraftOrder(ctx, d.ID, d.UpdatedAt)
+			return err
+		},
+	}}
+	steps = append(steps, s.orderSteps(order, d.CustomerID, primitive.NilObjectID, quote)...)
+	if err := commitSteps(steps); err != nil {
+		if errors.Is(err, ErrDraftOrderCompleted) {
+			return nil, err
+		}
+		return nil, asCheckoutError(err)
+	}
+
+	if _, _, err := LinkIfNotLinked(shop.ID, d.CustomerID); err != nil {
+		log.Printf("draft orders: order %s placed but customer not linked to shop: %v", order.ID.Hex(), err)
+	}
+	return order, nil
+}
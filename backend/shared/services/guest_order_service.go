@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrGuestOrderLinkInvalid = errors.New("order link is invalid")
+
+// guestOrderLinkSecret signs guest order tokens. GUEST_ORDER_LINK_SECRET lets
+// it be rotated on its own; otherwise the JWT secret is used.
+func guestOrderLinkSecret() ([]byte, error) {
+	secret := os.Getenv("GUEST_ORDER_LINK_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("GUEST_ORDER_LINK_SECRET is not set")
+	}
+	return []byte(secret), nil
+}
+
+// guestOrderSignature signs the order's ID and the customer it belongs to, so
+// the token stops working once a signed-in customer claims the order.
+func guestOrderSignature(secret []byte, order *models.Order) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "guest-order:%s:%s", order.ID.Hex(), order.CustomerID.Hex())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GuestOrderToken returns the token a guest sends back to view and pay for an
+// order placed at guest checkout.
+func GuestOrderToken(order *models.Order) (string, error) {
+	if !order.Guest {
+		return "", ErrGuestOrderLinkInvalid
+	}
+	secret, err := guestOrderLinkSecret()
+	if err != nil {
+		return "", err
+	}
+	return guestOrderSignature(secret, order), nil
+}
+
+// OpenGuestOrderService loads one of the shop's guest orders for the holder of
+// its token.
+func OpenGuestOrderService(shop *models.Shop, orderIDHex, token string) (*models.Order, error) {
+	order, err := repositories.GetOrderByID(context.Background(), orderIDHex)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.ShopID != shop.ID {
+		return nil, ErrOrderNotFound
+	}
+	want, err := GuestOrderToken(order)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(token), []byte(want)) {
+		return nil, ErrGuestOrderLinkInvalid
+	}
+	return order, nil
+}
+
+// ClaimGuestOrdersService gives a customer who has just verified their email
+// the orders placed at guest checkout with it. The guest records and their
+// shop links are removed once their orders have moved. It returns how many
+// orders were claimed.
+func ClaimGuestOrdersService(email string, customerID primitive.ObjectID) (int, error) {
+	ctx := context.Background()
+	guests, err := repositories.ListGuestCustomersByEmail(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	claimed := 0
+	for _, guest := range guests {
+		if guest.ID == customerID {
+			continue
+		}
+		shopIDs, err := repositories.ListCustomerOrderShopIDs(ctx, guest.ID)
+		if err != nil {
+			return claimed, err
+		}
+		for _, shopID := range shopIDs {
+			if _, _, err := LinkIfNotLinked(shopID, customerID); err != nil {
+				return claimed, err
+			}
+		}
+		res, err := repositories.ReassignCustomerOrders(ctx, guest.ID, customerID)
+		if err != nil {
+			return claimed, err
+		}
+		claimed += int(res.ModifiedCount)
+
+		for _, shopID := range shopIDs {
+			links, err := repositories.GetShopCustomerLinks(shopID)
+			if err != nil {
+				return claimed, err
+			}
+			for _, l := range links {
+				if l.CustomerID != guest.ID {
+					continue
+				}
+				if _, err := repositories.DeleteShopCustomerLink(l.ID); err != nil {
+					return claimed, err
+				}
+			}
+		}
+		if _, err := repositories.DeleteCustomer(guest.ID.Hex()); err != nil {
+			return claimed, err
+		}
+	}
+	return claimed, nil
+}
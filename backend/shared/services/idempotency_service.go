@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrIdempotencyKeyMismatch = errors.New("idempotency key was already used with a different request")
+var ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+
+// defaultIdempotencyKeyTTL is how long keys are kept when
+// IDEMPOTENCY_KEY_TTL_HOURS is not set.
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKeyTTL returns how long a stored key and its response are kept.
+func IdempotencyKeyTTL() time.Duration {
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return defaultIdempotencyKeyTTL
+}
+
+// BeginIdempotentRequestService claims key within scope for a request whose
+// body hashes to requestHash. It returns the claimed record and replay=false
+// when the request should run, or the stored record and replay=true when an
+// identical request already completed. A key reused for a different request
+// returns ErrIdempotencyKeyMismatch; one whose first request is still running
+// returns ErrIdempotencyKeyInProgress.
+func BeginIdempotentRequestService(scope, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	ctx := context.Background()
+	now := time.Now()
+	record := &models.IdempotencyKey{
+		ID:          primitive.NewObjectID(),
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      models.IdempotencyKeyInProgress,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyKeyTTL()),
+	}
+
+	// Two attempts: the existing record may expire between insert and read.
+	for attempt := 0; attempt < 2; attempt++ {
+		err := repositories.CreateIdempotencyKey(ctx, record)
+		if err == nil {
+			return record, false, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, false, err
+		}
+
+		existing, err := repositories.GetIdempotencyKey(ctx, scope, key)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing == nil {
+			continue
+		}
+		if existing.RequestHash != requestHash {
+			return nil, false, ErrIdempotencyKeyMismatch
+		}
+		if existing.Status != models.IdempotencyKeyCompleted {
+			return nil, false, ErrIdempotencyKeyInProgress
+		}
+		return existing, true, nil
+	}
+	return nil, false, ErrIdempotencyKeyInProgress
+}
+
+// CompleteIdempotentRequestService stores the response for a claimed key.
+func CompleteIdempotentRequestService(record *models.IdempotencyKey, status int, contentType string, body []byte) error {
+	return repositories.CompleteIdempotencyKey(context.Background(), record.ID, status, contentType, body)
+}
+
+// AbandonIdempotentRequestService releases a claimed key without storing a
+// response, so the client may retry the request with the same key.
+func AbandonIdempotentRequestService(record *models.IdempotencyKey) error {
+	return repositories.DeleteIdempotencyKey(context.Background(), record.ID)
+}
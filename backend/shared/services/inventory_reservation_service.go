@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultReservationHold is how long checkout holds stock when
+// RESERVATION_HOLD_MINUTES is not set.
+const defaultReservationHold = 15 * time.Minute
+
+// ReservationHoldDuration returns how long a checkout hold lasts.
+func ReservationHoldDuration() time.Duration {
+	if v := os.Getenv("RESERVATION_HOLD_MINUTES"); v != "" {
+		if minutes, err := strconv.Atoi(v); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute
+		}
+	}
+	return defaultReservationHold
+}
+
+// ReserveCartService places holds on the stock for every line of the cart. Any
+// earlier holds for the cart are released first so the holds always mirror the
+// current cart contents. If any line cannot be held, no holds are kept.
+func ReserveCartService(cart *models.Cart) ([]models.InventoryReservation, error) {
+	ctx := context.Background()
+	if err := ReleaseCartReservationsService(cart.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ReservationHoldDuration())
+	var placed []models.InventoryReservation
+
+	rollback := func() {
+		for _, r := range placed {
+			_, _ = repositories.DeleteReservation(ctx, r.ID)
+		}
+	}
+
+	for _, item := range cart.Items {
+		stock, err := physicalStock(item.ProductID, item.VariantID)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+
+		r := models.InventoryReservation{
+			ShopID:     cart.ShopID,
+			CartID:     cart.ID,
+			CustomerID: cart.CustomerID,
+			ProductID:  item.ProductID,
+			VariantID:  item.VariantID,
+			Quantity:   item.Quantity,
+			Status:     models.ReservationStatusActive,
+			ExpiresAt:  expiresAt,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if _, err := repositories.CreateReservation(ctx, &r); err != nil {
+			rollback()
+			return nil, err
+		}
+		placed = append(placed, r)
+
+		// Insert first, then verify: if concurrent holds push the total past
+		// the stock, every contender backs off and nobody oversells.
+		held, err := repositories.SumActiveReservations(ctx, item.ProductID, item.VariantID, primitive.NilObjectID)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if held > stock {
+			rollback()
+			return nil, ErrInsufficientStock
+		}
+	}
+
+	return placed, nil
+}
+
+// ReleaseCartReservationsService gives back every active hold of a cart.
+func ReleaseCartReservationsService(cartID primitive.ObjectID) error {
+	_, err := repositories.SetCartReservationsStatus(context.Background(), cartID,
+		models.ReservationStatusActive, models.ReservationStatusReleased, primitive.NilObjectID)
+	return err
+}
+
+// shrinkCartItemHolds cuts the cart's holds on one product or variant down to
+// keep units, releasing whole holds and shrinking the one that straddles the
+// limit, so removing a line or lowering its quantity gives the stock back.
+func shrinkCartItemHolds(cartID, productID, variantID primitive.ObjectID, keep int) error {
+	ctx := context.Background()
+	holds, err := repositories.ListCartItemReservations(ctx, cartID, productID, variantID)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if keep >= hold.Quantity {
+			keep -= hold.Quantity
+			continue
+		}
+		if keep == 0 {
+			if _, err := repositories.ReleaseReservation(ctx, hold.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := repositories.ShrinkReservation(ctx, hold.ID, hold.Quantity, hold.Quantity-keep); err != nil {
+			return err
+		}
+		keep = 0
+	}
+	return nil
+}
+
+// convertOrderReservations turns the cart's holds on what the order bought
+// into converted holds for the order. Holds on other lines, and whatever a
+// hold covers beyond the quantity ordered, keep protecting the cart; a hold
+// larger than the order needs is split in two.
+func convertOrderReservations(ctx context.Context, cartID primitive.ObjectID, order *models.Order) error {
+	for _, item := range order.Items {
+		if item.Custom {
+			continue
+		}
+		holds, err := repositories.ListCartItemReservations(ctx, cartID, item.ProductID, item.VariantID)
+		if err != nil {
+			return err
+		}
+		remaining := item.Quantity
+		for _, hold := range holds {
+			if remaining == 0 {
+				break
+			}
+			if hold.Quantity <= remaining {
+				if _, err := repositories.ConvertReservation(ctx, hold.ID, order.ID); err != nil {
+					return err
+				}
+				remaining -= hold.Quantity
+				continue
+			}
+
+			res, err := repositories.ShrinkReservation(ctx, hold.ID, hold.Quantity, remaining)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				continue
+			}
+			converted := hold
+			converted.ID = primitive.NilObjectID
+			converted.Quantity = remaining
+			converted.Status = models.ReservationStatusConverted
+			converted.OrderID = order.ID
+			converted.UpdatedAt = time.Now()
+			if _, err := repositories.CreateReservation(ctx, &converted); err != nil {
+				return err
+			}
+			remaining = 0
+		}
+	}
+	return nil
+}
+
+// ListCartReservationsService returns the unexpired holds of a cart.
+func ListCartReservationsService(cartID primitive.ObjectID) ([]models.InventoryReservation, error) {
+	return repositories.ListActiveReservationsByCart(context.Background(), cartID)
+}
+
+// AvailableStock returns stock minus quantities held by other carts. Holds of
+// excludeCartID are not subtracted, so a customer can buy what they reserved.
+func AvailableStock(productID, variantID, excludeCartID primitive.ObjectID, stock int) int {
+	held, err := repositories.SumActiveReservations(context.Background(), productID, variantID, excludeCartID)
+	if err != nil {
+		return stock
+	}
+	return availableAfterHolds(stock, held)
+}
+
+// physicalStock reads the on-hand stock for a product or one of its variants.
+func physicalStock(productID, variantID primitive.ObjectID) (int, error) {
+	product, err := repositories.GetProductByID(productID.Hex())
+	if err != nil || product == nil {
+		return 0, ErrProductNotFound
+	}
+	if variantID.IsZero() {
+		return product.Stock, nil
+	}
+	for _, v := range product.Variants {
+		if v.VariantID == variantID {
+			return v.Stock, nil
+		}
+	}
+	return 0, ErrVariantNotFound
+}
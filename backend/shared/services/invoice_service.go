@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/pdf"
+	"github.com/Endale2/DRPS/shared/repositories"
+)
+
+var ErrInvoiceNotAvailable = errors.New("invoice is available once the order is paid")
+
+// Invoice numbers are "INV-" and the shop's invoice sequence, zero-padded.
+const (
+	invoiceNumberPrefix  = "INV-"
+	invoiceNumberPadding = 6
+)
+
+// Layout of generated documents, in points.
+const (
+	docMarginLeft    = 50.0
+	docMarginRight   = pdf.PageWidth - 50
+	docBottom        = pdf.PageHeight - 70
+	docLineHeight    = 14.0
+	docFontSize      = 10.0
+	docSmallFontSize = 9.0
+)
+
+// invoiceable reports whether money was taken for the order, so an invoice
+// can be issued for it.
+func invoiceable(order *models.Order) bool {
+	switch order.PaymentStatus {
+	case models.PaymentStatusPaid, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// ensureInvoiceNumber gives the order the shop's next invoice number the first
+// time its invoice is produced and returns the number it keeps from then on.
+func ensureInvoiceNumber(order *models.Order) (string, error) {
+	if order.InvoiceNumber != "" {
+		return order.InvoiceNumber, nil
+	}
+	ctx := context.Background()
+	seq, err := repositories.NextInvoiceSequence(ctx, order.ShopID)
+	if err != nil {
+		return "", err
+	}
+	number := fmt.Sprintf("%s%0*d", invoiceNumberPrefix, invoiceNumberPadding, seq)
+	res, err := repositories.SetOrderInvoiceNumber(ctx, order.ID, number)
+	if err != nil {
+		return "", err
+	}
+	if res.MatchedCount == 0 {
+		// A concurrent request numbered it first; use that number
+		fresh, err := repositories.GetOrderByID(ctx, order.ID.Hex())
+		if err != nil {
+			return "", err
+		}
+		if fresh == nil || fresh.InvoiceNumber == "" {
+			return "", ErrOrderNotFound
+		}
+		number = fresh.InvoiceNumber
+	}
+	order.InvoiceNumber = number
+	return number, nil
+}
+
+// InvoicePDFService renders the customer invoice for a paid order, numbering
+// it on first use.
+func InvoicePDFService(shop *models.Shop, order *models.Order) ([]byte, error) {
+	if !invoiceable(order) {
+		return nil, ErrInvoiceNotAvailable
+	}
+	number, err := ensureInvoiceNumber(order)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := pdf.New("Invoice " + number)
+	doc.AddPage()
+	y := documentHeader(doc, shop, "INVOICE", []string{
+		"Invoice " + number,
+		"Order " + order.OrderNumber,
+		"Date " + order.CreatedAt.Format("2 Jan 2006"),
+	})
+
+	y = addressBlocks(doc, y, "Bill to", order.BillingAddress, "Ship to", order.ShippingAddress)
+
+	currency := shop.Currency
+	cols := []docColumn{
+		{Title: "Item", X: docMarginLeft},
+		{Title: "Qty", X: 330, Right: true},
+		{Title: "Unit price", X: 410, Right: true},
+		{Title: "Tax", X: 470, Right: true},
+		{Title: "Amount", X: docMarginRight, Right: true},
+	}
+	y = tableHeader(doc, y, cols)
+	for _, item := range order.Items {
+		if y > docBottom {
+			doc.AddPage()
+			y = tableHeader(doc, 60, cols)
+		}
+		doc.Text(docMarginLeft, y, docFontSize, pdf.Regular, pdf.Truncate(item.Name, 240, docFontSize, pdf.Regular))
+		doc.TextRight(cols[1].X, y, docFontSize, pdf.Regular, fmt.Sprint(item.Quantity))
+		doc.TextRight(cols[2].X, y, docFontSize, pdf.Regular, formatMoney(item.UnitPrice, currency))
+		doc.TextRight(cols[3].X, y, docFontSize, pdf.Regular, formatMoney(item.TaxAmount, currency))
+		doc.TextRight(cols[4].X, y, docFontSize, pdf.Regular, formatMoney(item.TotalPrice, currency))
+		y += docLineHeight
+		if discount := item.UnitPrice.Mul(item.Quantity) - item.TotalPrice; discount > 0 {
+			doc.Text(docMarginLeft+10, y, docSmallFontSize, pdf.Regular, "Discount -"+formatMoney(discount, currency))
+			y += docLineHeight
+		}
+	}
+
+	type totalLine struct {
+		label  string
+		amount string
+		bold   bool
+	}
+	totals := []totalLine{{label: "Subtotal", amount: formatMoney(order.Subtotal, currency)}}
+	if order.DiscountTotal > 0 {
+		totals = append(totals, totalLine{label: "Discounts", amount: "-" + formatMoney(order.DiscountTotal, currency)})
+	}
+	if order.ShippingMethod != nil || order.ShippingCost > 0 {
+		label := "Shipping"
+		if order.ShippingMethod != nil {
+			label += " (" + order.ShippingMethod.Name + ")"
+		}
+		totals = append(totals, totalLine{label: label, amount: formatMoney(order.ShippingCost, currency)})
+	}
+	if order.TaxAmount > 0 {
+		label := "Tax"
+		if order.Tax != nil {
+			label += " (" + order.Tax.RegionName + ")"
+			if order.Tax.PricesIncludeTax {
+				label += ", included"
+			}
+		}
+		totals = append(totals, totalLine{label: label, amount: formatMoney(order.TaxAmount, currency)})
+	}
+	totals = append(totals, totalLine{label: "Total", amount: formatMoney(order.Total, currency), bold: true})
+	if order.RefundedTotal > 0 {
+		totals = append(totals,
+			totalLine{label: "Refunded", amount: "-" + formatMoney(order.RefundedTotal, currency)},
+			totalLine{label: "Net paid", amount: formatMoney(order.NetTotal(), currency), bold: true})
+	}
+
+	if y+float64(len(totals)+1)*docLineHeight > docBottom {
+		doc.AddPage()
+		y = 60
+	}
+	doc.Line(330, y-4, docMarginRight, y-4)
+	y += docLineHeight / 2
+	for _, t := range totals {
+		font := pdf.Regular
+		if t.bold {
+			font = pdf.Bold
+		}
+		doc.Text(330, y, docFontSize, font, pdf.Truncate(t.label, 130, docFontSize, font))
+		doc.TextRight(docMarginRight, y, docFontSize, font, t.amount)
+		y += docLineHeight
+	}
+
+	if order.PaymentMethod != "" {
+		y += docLineHeight
+		doc.Text(docMarginLeft, y, docSmallFontSize, pdf.Regular, "Paid with "+order.PaymentMethod)
+	}
+	return doc.Bytes(), nil
+}
+
+// PackingSlipsPDFService renders one packing slip page per order, in the order
+// given, as a single document for batch fulfillment.
+func PackingSlipsPDFService(shop *models.Shop, orders []*models.Order) []byte {
+	doc := pdf.New("Packing slips")
+	cols := []docColumn{
+		{Title: "Item", X: docMarginLeft},
+		{Title: "Qty", X: docMarginRight, Right: true},
+	}
+	for _, order := range orders {
+		doc.AddPage()
+		header := []string{
+			"Order " + order.OrderNumber,
+			"Date " + order.CreatedAt.Format("2 Jan 2006"),
+		}
+		if order.ShippingMethod != nil {
+			header = append(header, order.ShippingMethod.Name)
+		}
+		y := documentHeader(doc, shop, "PACKING SLIP", header)
+		y = addressBlocks(doc, y, "Ship to", order.ShippingAddress, "", nil)
+
+		y = tableHeader(doc, y, cols)
+		for _, item := range order.Items {
+			if y > docBottom {
+				doc.AddPage()
+				y = tableHeader(doc, 60, cols)
+			}
+			doc.Text(docMarginLeft, y, docFontSize, pdf.Regular, pdf.Truncate(item.Name, 420, docFontSize, pdf.Regular))
+			doc.TextRight(docMarginRight, y, docFontSize, pdf.Regular, fmt.Sprint(item.Quantity))
+			y += docLineHeight
+		}
+	}
+	return doc.Bytes()
+}
+
+// docColumn is a table column; Right columns are right-aligned at X.
+type docColumn struct {
+	Title string
+	X     float64
+	Right bool
+}
+
+// tableHeader draws column titles and a rule at y and returns where the first
+// row goes.
+func tableHeader(doc *pdf.Document, y float64, cols []docColumn) float64 {
+	for _, col := range cols {
+		if col.Right {
+			doc.TextRight(col.X, y, docFontSize, pdf.Bold, col.Title)
+		} else {
+			doc.Text(col.X, y, docFontSize, pdf.Bold, col.Title)
+		}
+	}
+	doc.Line(docMarginLeft, y+5, docMarginRight, y+5)
+	return y + docLineHeight + 6
+}
+
+// documentHeader draws the shop's details on the left and the document title
+// and reference lines on the right, and returns where the body starts.
+func documentHeader(doc *pdf.Document, shop *models.Shop, title string, refs []string) float64 {
+	doc.Text(docMarginLeft, 60, 16, pdf.Bold, pdf.Truncate(shop.Name, 280, 16, pdf.Bold))
+	left := 78.0
+	for _, line := range []string{shop.Address, shop.Email, shop.Phone} {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		doc.Text(docMarginLeft, left, docSmallFontSize, pdf.Regular, pdf.Truncate(line, 280, docSmallFontSize, pdf.Regular))
+		left += 12
+	}
+
+	doc.TextRight(docMarginRight, 60, 18, pdf.Bold, title)
+	right := 78.0
+	for _, ref := range refs {
+		doc.TextRight(docMarginRight, right, docSmallFontSize, pdf.Regular, ref)
+		right += 12
+	}
+
+	y := left
+	if right > y {
+		y = right
+	}
+	return y + 20
+}
+
+// addressBlocks draws up to two labelled addresses side by side and returns
+// where the body continues.
+func addressBlocks(doc *pdf.Document, y float64, leftLabel string, left map[string]interface{}, rightLabel string, right map[string]interface{}) float64 {
+	bottom := y
+	draw := func(x float64, label string, address map[string]interface{}) {
+		if label == "" {
+			return
+		}
+		lines := formatAddress(address)
+		if len(lines) == 0 {
+			return
+		}
+		doc.Text(x, y, docFontSize, pdf.Bold, label)
+		lineY := y + docLineHeight
+		for _, line := range lines {
+			doc.Text(x, lineY, docFontSize, pdf.Regular, pdf.Truncate(line, 230, docFontSize, pdf.Regular))
+			lineY += 12
+		}
+		if lineY > bottom {
+			bottom = lineY
+		}
+	}
+	draw(docMarginLeft, leftLabel, left)
+	draw(300, rightLabel, right)
+	return bottom + 16
+}
+
+// addressLineKeys are the address fields printed first, in this order; any
+// other text fields follow alphabetically.
+var addressLineKeys = [][]string{
+	{"name", "full_name"},
+	{"company"},
+	{"line1", "address1", "address", "street"},
+	{"line2", "address2"},
+	{"city"},
+	{"region", "state", "province"},
+	{"postal_code", "postalCode", "zip"},
+	{"country"},
+}
+
+// formatAddress turns a stored address into printable lines.
+func formatAddress(address map[string]interface{}) []string {
+	used := map[string]bool{}
+	text := func(k string) string {
+		s, _ := address[k].(string)
+		return strings.TrimSpace(s)
+	}
+
+	var lines []string
+	first, last := text("first_name"), text("last_name")
+	used["first_name"], used["last_name"] = true, true
+	if name := strings.TrimSpace(first + " " + last); name != "" {
+		lines = append(lines, name)
+	}
+	for i, keys := range addressLineKeys {
+		for _, k := range keys {
+			used[k] = true
+		}
+		if i == 0 && len(lines) > 0 {
+			// Already named from first_name/last_name
+			continue
+		}
+		for _, k := range keys {
+			if v := text(k); v != "" {
+				lines = append(lines, v)
+				break
+			}
+		}
+	}
+
+	var rest []string
+	for k := range address {
+		if !used[k] && text(k) != "" {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		lines = append(lines, text(k))
+	}
+	return lines
+}
+
+// formatMoney prints an amount with the shop's currency code.
+func formatMoney(amount money.Amount, currency string) string {
+	if currency == "" {
+		return amount.String()
+	}
+	return currency + " " + amount.String()
+}
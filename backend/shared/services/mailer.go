@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a plain-text message to one recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email to customers.
+type Mailer interface {
+	Send(e *Email) error
+}
+
+// logMailer only writes the email to the server log, like OTPs are during
+// development. It is used when no SMTP server is configured.
+type logMailer struct{}
+
+func (logMailer) Send(e *Email) error {
+	log.Printf("[MAIL] to %s: %s\n%s", e.To, e.Subject, e.Body)
+	return nil
+}
+
+// smtpMailer sends through an SMTP server.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m smtpMailer) Send(e *Email) error {
+	to, err := mail.ParseAddress(e.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", e.To, err)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", headerLineBreaks.Replace(m.from))
+	fmt.Fprintf(&msg, "To: %s\r\n", to.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(e.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(e.Body, "\n", "\r\n"))
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to.Address}, []byte(msg.String()))
+}
+
+// headerLineBreaks turns line breaks, which would start new headers, into
+// spaces.
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// headerValue makes text safe to put in a header: line breaks become spaces
+// and anything outside ASCII is encoded. Subjects carry text sellers control,
+// such as the shop name.
+func headerValue(s string) string {
+	return mime.QEncoding.Encode("utf-8", headerLineBreaks.Replace(s))
+}
+
+// mailerFromEnv uses SMTP_HOST (with SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+// and MAIL_FROM) if it is set, and the log otherwise.
+func mailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return logMailer{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USERNAME")
+	}
+	m := smtpMailer{addr: host + ":" + port, from: from}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+var (
+	mailerMu sync.Mutex
+	mailer   Mailer
+)
+
+// SetMailer replaces how email is sent.
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = m
+}
+
+// SendEmail sends an email with the configured Mailer.
+func SendEmail(e *Email) error {
+	mailerMu.Lock()
+	if mailer == nil {
+		mailer = mailerFromEnv()
+	}
+	m := mailer
+	mailerMu.Unlock()
+	return m.Send(e)
+}
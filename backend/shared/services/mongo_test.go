@@ -0,0 +1,26 @@
+//go:build mongo
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+)
+
+// Tests built with the mongo tag write to the MongoDB at MONGO_URI; point it
+// at a disposable deployment and run
+//
+//	MONGO_URI=mongodb://localhost:27017 go test -tags mongo ./shared/services/
+//
+// Cases that need transactions also need a replica set.
+func requireMongo(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := config.DB.Ping(ctx, nil); err != nil {
+		t.Fatalf("MongoDB unreachable: %v", err)
+	}
+}
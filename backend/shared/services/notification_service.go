@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notifier delivers a stored notification over some channel (email, push, ...).
+type Notifier interface {
+	Notify(n *models.Notification) error
+}
+
+// logNotifier is the default Notifier: it only writes the notification to the
+// server log, like OTPs are during development.
+type logNotifier struct{}
+
+func (logNotifier) Notify(n *models.Notification) error {
+	log.Printf("[NOTIFY] %s %s: %s - %s", n.RecipientRole, n.RecipientID.Hex(), n.Title, n.Message)
+	return nil
+}
+
+var notifier Notifier = logNotifier{}
+
+// SetNotifier replaces the delivery channel for notifications.
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+// defaultNotificationListLimit caps how many notifications are listed at once.
+const defaultNotificationListLimit = 50
+
+// NotifySellerService stores a notification for the shop's owner and hands it
+// to the Notifier. Notifications are best-effort: callers should not fail the
+// action that triggered them if this returns an error.
+func NotifySellerService(shop *models.Shop, notificationType models.NotificationType, orderID primitive.ObjectID, title, message string) error {
+	n := &models.Notification{
+		RecipientRole: models.OrderActorSeller,
+		RecipientID:   shop.OwnerID,
+		ShopID:        shop.ID,
+		OrderID:       orderID,
+		Type:          notificationType,
+		Title:         title,
+		Message:       message,
+		CreatedAt:     time.Now(),
+	}
+	if err := repositories.CreateNotification(context.Background(), n); err != nil {
+		return err
+	}
+	return notifier.Notify(n)
+}
+
+// NotifyCustomerService stores a notification for a customer of the shop and
+// hands it to the Notifier. Like NotifySellerService it is best-effort.
+func NotifyCustomerService(shop *models.Shop, customerID primitive.ObjectID, notificationType models.NotificationType, orderID primitive.ObjectID, title, message string) error {
+	n := &models.Notification{
+		RecipientRole: models.OrderActorCustomer,
+		RecipientID:   customerID,
+		ShopID:        shop.ID,
+		OrderID:       orderID,
+		Type:          notificationType,
+		Title:         title,
+		Message:       message,
+		CreatedAt:     time.Now(),
+	}
+	if err := repositories.CreateNotification(context.Background(), n); err != nil {
+		return err
+	}
+	return notifier.Notify(n)
+}
+
+// ListSellerNotificationsService returns the newest notifications for the
+// seller of a shop.
+func ListSellerNotificationsService(shop *models.Shop, unreadOnly bool) ([]models.Notification, error) {
+	out, err := repositories.ListNotifications(context.Background(), shop.ID, models.OrderActorSeller, shop.OwnerID, unreadOnly, defaultNotificationListLimit)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.Notification{}
+	}
+	return out, nil
+}
+
+// MarkNotificationReadService marks one of the recipient's notifications read.
+func MarkNotificationReadService(id, recipientID primitive.ObjectID) error {
+	_, err := repositories.MarkNotificationRead(context.Background(), id, recipientID)
+	return err
+}
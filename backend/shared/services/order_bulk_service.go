@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxBulkOrders bounds how many orders one bulk operation may touch.
+const MaxBulkOrders = 100
+
+var ErrTooManyOrders = errors.New("too many orders")
+var ErrNothingToShip = errors.New("every item has already been shipped")
+
+// BulkOrderResult is the outcome of a bulk operation for one order. Orders are
+// handled one at a time, so some may succeed while others fail.
+type BulkOrderResult struct {
+	OrderID     string             `json:"order_id"`
+	OrderNumber string             `json:"order_number,omitempty"`
+	OK          bool               `json:"ok"`
+	Status      models.OrderStatus `json:"status,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// eachShopOrder loads each of the shop's orders by ID and passes it to fn,
+// collecting a result per ID. IDs that are not the shop's orders fail alone.
+func eachShopOrder(shopID primitive.ObjectID, idHexes []string, fn func(order *models.Order) (*models.Order, error)) ([]BulkOrderResult, error) {
+	if len(idHexes) > MaxBulkOrders {
+		return nil, fmt.Errorf("%w: at most %d per request", ErrTooManyOrders, MaxBulkOrders)
+	}
+	results := make([]BulkOrderResult, 0, len(idHexes))
+	seen := map[string]bool{}
+	for _, idHex := range idHexes {
+		if seen[idHex] {
+			continue
+		}
+		seen[idHex] = true
+		result := BulkOrderResult{OrderID: idHex}
+		order, err := repositories.GetOrderByID(context.Background(), idHex)
+		if err == nil && (order == nil || order.ShopID != shopID) {
+			err = ErrOrderNotFound
+		}
+		if err == nil {
+			result.OrderNumber = order.OrderNumber
+			var updated *models.Order
+			if updated, err = fn(order); err == nil {
+				result.OK = true
+				result.Status = updated.Status
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// BulkTransitionOrdersService moves each order to a new status through the
+// order state machine, exactly as a single status change would.
+func BulkTransitionOrdersService(shopID primitive.ObjectID, idHexes []string, to models.OrderStatus, actor models.OrderActor) ([]BulkOrderResult, error) {
+	return eachShopOrder(shopID, idHexes, func(order *models.Order) (*models.Order, error) {
+		return TransitionOrderStatusService(order.ID.Hex(), to, actor)
+	})
+}
+
+// BulkFulfillOrdersService ships everything still unshipped on each order in
+// one shipment with the given carrier, marking the orders shipped.
+func BulkFulfillOrdersService(shop *models.Shop, idHexes []string, carrier string, actor models.OrderActor) ([]BulkOrderResult, error) {
+	return eachShopOrder(shop.ID, idHexes, func(order *models.Order) (*models.Order, error) {
+		if !shippableOrderStatuses[order.Status] {
+			return nil, fmt.Errorf("%w: order is %s", ErrOrderNotShippable, order.Status)
+		}
+		lines, err := unshippedLines(context.Background(), order)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			return nil, ErrNothingToShip
+		}
+		if _, err := CreateShipmentService(shop, order, ShipmentRequest{Lines: lines, Carrier: carrier}, actor); err != nil {
+			return nil, err
+		}
+		fresh, err := repositories.GetOrderByID(context.Background(), order.ID.Hex())
+		if err != nil || fresh == nil {
+			return order, err
+		}
+		return fresh, nil
+	})
+}
+
+// FindShopOrdersService returns the shop's orders matching the filter, newest
+// first, failing with ErrTooManyOrders if more than max match.
+func FindShopOrdersService(shopID primitive.ObjectID, f OrderFilter, max int) ([]*models.Order, error) {
+	found, err := repositories.ListOrdersLimited(context.Background(), f.query(shopID), max+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) > max {
+		return nil, fmt.Errorf("%w: more than %d match the filter", ErrTooManyOrders, max)
+	}
+	orders := make([]*models.Order, len(found))
+	for i := range found {
+		orders[i] = &found[i]
+	}
+	return orders, nil
+}
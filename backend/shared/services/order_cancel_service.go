@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrOrderNotCancellable = errors.New("order can no longer be cancelled")
+var ErrCancelRefundFailed = errors.New("order was cancelled but its refund failed")
+
+// CustomerCancelWindow returns how long after placing a paid order the
+// customer may still cancel it.
+func CustomerCancelWindow(shop *models.Shop) time.Duration {
+	hours := models.DefaultCustomerCancelWindowHours
+	if shop.CustomerCancelWindowHours != nil {
+		hours = *shop.CustomerCancelWindowHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CanCustomerCancelOrder reports whether the customer may cancel the order
+// now: always while it is unpaid, and while it is paid but not yet shipped
+// as long as the shop's cancellation window has not passed.
+func CanCustomerCancelOrder(shop *models.Shop, order *models.Order, now time.Time) bool {
+	switch order.Status {
+	case models.OrderStatusReview, models.OrderStatusPending:
+		return true
+	case models.OrderStatusPaid, models.OrderStatusProcessing:
+		return now.Before(order.CreatedAt.Add(CustomerCancelWindow(shop)))
+	}
+	return false
+}
+
+// CancelOrderByCustomerService cancels one of the customer's own orders. Stock
+// and discount uses are given back by the state machine, the reason is added
+// to the timeline and the seller is notified. A paid order is refunded in full
+// through its payment provider; if its payment cannot be refunded that way
+// the order is not cancelled, and if the refund fails after cancelling,
+// ErrCancelRefundFailed is returned and the seller is told to refund it.
+func CancelOrderByCustomerService(shop *models.Shop, orderIDHex string, customerID primitive.ObjectID, reason string) (*models.Order, error) {
+	order, err := repositories.GetOrderByID(context.Background(), orderIDHex)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.ShopID != shop.ID || order.CustomerID != customerID {
+		return nil, ErrOrderNotFound
+	}
+	if !CanCustomerCancelOrder(shop, order, time.Now()) {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotCancellable, order.Status)
+	}
+	paid := order.PaymentStatus == models.PaymentStatusPaid || order.PaymentStatus == models.PaymentStatusPartiallyRefunded
+	if paid {
+		if err := checkAutomaticRefund(order); err != nil {
+			if errors.Is(err, ErrRefundNotAutomatic) {
+				return nil, fmt.Errorf("%w: it was paid outside the platform, so the shop has to cancel and refund it", ErrOrderNotCancellable)
+			}
+			return nil, err
+		}
+	}
+
+	actor := models.OrderActor{Role: models.OrderActorCustomer, ID: customerID}
+	cancelled, err := TransitionOrderStatusService(orderIDHex, models.OrderStatusCancelled, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason != "" {
+		if _, err := AddOrderNoteService(cancelled, actor, "Cancellation reason: "+reason, true); err != nil {
+			log.Printf("cancel order %s: could not record reason: %v", order.ID.Hex(), err)
+		}
+	}
+
+	var refundErr error
+	if paid {
+		if _, refundErr = IssueRefundService(cancelled, RefundRequest{Type: models.RefundTypeFull, Reason: "Cancelled by the customer"}, actor); refundErr == nil {
+			if reloaded, err := repositories.GetOrderByID(context.Background(), orderIDHex); err == nil && reloaded != nil {
+				cancelled = reloaded
+			}
+		}
+	}
+
+	message := fmt.Sprintf("Order %s was cancelled by the customer.", order.OrderNumber)
+	if reason != "" {
+		message += " Reason: " + reason
+	}
+	switch {
+	case refundErr != nil:
+		message += fmt.Sprintf(" The automatic refund failed (%v); refund the order from its page.", refundErr)
+	case paid:
+		message += " The payment was refunded in full."
+	}
+	if err := NotifySellerService(shop, models.NotificationOrderCancelled, order.ID, "Order cancelled", message); err != nil {
+		log.Printf("cancel order %s: could not notify seller: %v", order.ID.Hex(), err)
+	}
+	if refundErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCancelRefundFailed, refundErr)
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,689 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrOrderNotEditable = errors.New("order cannot be edited")
+var ErrInvalidOrderEdit = errors.New("invalid order edit")
+var ErrOrderEditNotFound = errors.New("order edit not found")
+var ErrOrderEditClosed = errors.New("order edit is no longer open")
+var ErrOrderEditChanged = errors.New("order edit total has changed")
+var ErrOrderEditConflict = errors.New("order changed while the edit was applied, please retry")
+
+// editableOrderStatuses are the statuses in which nothing has shipped yet, so
+// the items can still change.
+var editableOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPending:    true,
+	models.OrderStatusPaid:       true,
+	models.OrderStatusProcessing: true,
+}
+
+// checkOrderEditable reports why an order's items cannot be edited, if so.
+// Orders with refunds are refunded further rather than edited, so refund
+// lines always match the items sold.
+func checkOrderEditable(order *models.Order) error {
+	if !editableOrderStatuses[order.Status] {
+		return fmt.Errorf("%w: order is %s", ErrOrderNotEditable, order.Status)
+	}
+	if order.RefundedTotal > 0 {
+		return fmt.Errorf("%w: order has refunds", ErrOrderNotEditable)
+	}
+	return nil
+}
+
+// orderEditStock is how much one product line's stock moves when an edit is
+// committed: positive takes stock, negative gives it back.
+type orderEditStock struct {
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Delta     int
+}
+
+// orderEditPlan is a priced edit: the order's new lines and totals and what
+// committing it has to write besides the order.
+type orderEditPlan struct {
+	quote  *checkoutQuote
+	method *models.ShippingQuote
+	cost   money.Amount
+	tax    *TaxResult
+	stock  []orderEditStock
+}
+
+// priceOrderEdit applies the edit's staged changes to the order's lines and
+// prices the result the way checkout would, filling in the edit's priced
+// fields. Lines already on the order keep what the customer paid per unit;
+// added lines are quoted afresh, with any automatic discounts.
+func (s *CheckoutService) priceOrderEdit(shop *models.Shop, order *models.Order, e *models.OrderEdit) (*orderEditPlan, error) {
+	quantities := map[string]int{}
+	original := map[string]models.OrderItem{}
+	var keys []string
+	for _, item := range order.Items {
+		key := orderLineKey(item.ProductID, item.VariantID)
+		original[key] = item
+		quantities[key] = item.Quantity
+		keys = append(keys, key)
+	}
+	added := map[string]models.OrderEditChange{}
+	for i, c := range e.Changes {
+		key := orderLineKey(c.ProductID, c.VariantID)
+		_, exists := quantities[key]
+		switch c.Type {
+		case models.OrderEditAdd:
+			if c.Quantity <= 0 {
+				return nil, fmt.Errorf("%w: change %d: quantity must be positive", ErrInvalidOrderEdit, i+1)
+			}
+			if !exists {
+				added[key] = c
+				keys = append(keys, key)
+			}
+			quantities[key] += c.Quantity
+		case models.OrderEditRemove:
+			if !exists {
+				return nil, fmt.Errorf("%w: change %d: product %s is not in this order", ErrInvalidOrderEdit, i+1, c.ProductID.Hex())
+			}
+			quantities[key] = 0
+		case models.OrderEditSetQuantity:
+			if !exists {
+				return nil, fmt.Errorf("%w: change %d: product %s is not in this order", ErrInvalidOrderEdit, i+1, c.ProductID.Hex())
+			}
+			if c.Quantity < 0 {
+				return nil, fmt.Errorf("%w: change %d: quantity cannot be negative", ErrInvalidOrderEdit, i+1)
+			}
+			quantities[key] = c.Quantity
+		default:
+			return nil, fmt.Errorf("%w: change %d: type must be add, remove or set_quantity", ErrInvalidOrderEdit, i+1)
+		}
+	}
+
+	// Added products are quoted together, as one checkout would quote them
+	var newLines []CheckoutLine
+	for _, key := range keys {
+		if c, ok := added[key]; ok && quantities[key] > 0 {
+			newLines = append(newLines, CheckoutLine{ProductID: c.ProductID, VariantID: c.VariantID, Quantity: quantities[key]})
+		}
+	}
+	fresh := &checkoutQuote{}
+	if len(newLines) > 0 {
+		var err error
+		// Edits hold no stock: it is taken when the edit is committed
+		if fresh, err = s.quote(shop.ID, order.CustomerID, primitive.NilObjectID, newLines); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &orderEditPlan{quote: &checkoutQuote{
+		Weight:             fresh.Weight,
+		AppliedDiscountIDs: order.AppliedDiscountIDs,
+		usages:             fresh.usages,
+	}}
+	q := plan.quote
+	seenDiscount := map[primitive.ObjectID]bool{}
+	for _, id := range order.AppliedDiscountIDs {
+		seenDiscount[id] = true
+	}
+	for _, id := range fresh.AppliedDiscountIDs {
+		if !seenDiscount[id] {
+			seenDiscount[id] = true
+			q.AppliedDiscountIDs = append(q.AppliedDiscountIDs, id)
+		}
+	}
+
+	next := 0
+	for _, key := range keys {
+		qty := quantities[key]
+		if _, isNew := added[key]; isNew {
+			if qty == 0 {
+				continue
+			}
+			item := fresh.Items[next]
+			next++
+			q.Items = append(q.Items, item)
+			if !item.Custom {
+				plan.stock = append(plan.stock, orderEditStock{ProductID: item.ProductID, VariantID: item.VariantID, Delta: qty})
+			}
+			continue
+		}
+
+		item := original[key]
+		if delta := qty - item.Quantity; delta != 0 && !item.Custom {
+			plan.stock = append(plan.stock, orderEditStock{ProductID: item.ProductID, VariantID: item.VariantID, Delta: delta})
+		}
+		if qty == 0 {
+			continue
+		}
+		if qty != item.Quantity {
+			item.TotalPrice = item.TotalPrice.Part(qty, item.Quantity, money.HalfUp)
+			item.Quantity = qty
+		}
+		if !item.Custom {
+			if product, err := GetProductByIDService(item.ProductID.Hex()); err == nil && product != nil {
+				q.Weight += itemWeight(product, item.VariantID) * float64(qty)
+			}
+		}
+		q.Items = append(q.Items, item)
+	}
+	if len(q.Items) == 0 {
+		return nil, fmt.Errorf("%w: an order needs at least one item; cancel it instead", ErrInvalidOrderEdit)
+	}
+	if !order.InventoryCommitted {
+		// Stock was never taken for this order, so there is none to move
+		plan.stock = nil
+	}
+
+	for _, item := range q.Items {
+		q.Subtotal += item.UnitPrice.Mul(item.Quantity)
+		q.Total += item.TotalPrice
+		q.ItemCount += item.Quantity
+	}
+	q.DiscountTotal = q.Subtotal - q.Total
+
+	// Shipping is re-quoted for the order's method, or the one the edit
+	// switches to; orders placed without a method keep what they were charged
+	methodID := e.ShippingMethodID
+	if methodID == "" && order.ShippingMethod != nil {
+		methodID = order.ShippingMethod.ID
+	}
+	if methodID == "" {
+		plan.cost = order.ShippingCost
+	} else {
+		method, err := s.shippingMethod(shop.ID, q, CheckoutShipping{Address: order.ShippingAddress, MethodID: methodID})
+		if err != nil {
+			return nil, err
+		}
+		plan.method = method
+		plan.cost = method.Amount
+	}
+
+	// Tax follows the pricing mode the order was placed under
+	taxShop := *shop
+	if order.Tax != nil {
+		taxShop.PricesIncludeTax = order.Tax.PricesIncludeTax
+	}
+	tax, err := s.tax(&taxShop, q, order.ShippingAddress, plan.cost)
+	if err != nil {
+		return nil, err
+	}
+	plan.tax = tax
+
+	e.Items = q.Items
+	e.Subtotal = q.Subtotal
+	e.DiscountTotal = q.DiscountTotal
+	e.ShippingMethod = plan.method
+	e.ShippingCost = plan.cost
+	e.TaxAmount = tax.Total
+	e.Tax = tax.OrderTax()
+	e.Total = q.Total + plan.cost + tax.Added()
+	e.TotalBefore = order.Total
+
+	// Unpaid orders are simply paid at the new total
+	e.AmountDue, e.RefundDue = 0, 0
+	if order.Status != models.OrderStatusPending {
+		owed := order.AmountDue + e.Total - order.Total
+		if owed > 0 {
+			e.AmountDue = owed
+		} else {
+			e.RefundDue = -owed
+		}
+	}
+	return plan, nil
+}
+
+// BeginOrderEditService opens an edit on the order, or returns the edit
+// already open on it.
+func BeginOrderEditService(shop *models.Shop, order *models.Order, actor models.OrderActor) (*models.OrderEdit, error) {
+	if err := checkOrderEditable(order); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if open, err := repositories.GetOpenOrderEdit(ctx, order.ID); err != nil || open != nil {
+		return open, err
+	}
+
+	now := time.Now()
+	e := &models.OrderEdit{
+		ID:        primitive.NewObjectID(),
+		ShopID:    order.ShopID,
+		OrderID:   order.ID,
+		Status:    models.OrderEditStatusOpen,
+		Changes:   []models.OrderEditChange{},
+		Actor:     actor,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	resetOrderEditPricing(e, order)
+	if err := repositories.CreateOrderEdit(ctx, e); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// Opened concurrently; use that one
+			return repositories.GetOpenOrderEdit(ctx, order.ID)
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+// resetOrderEditPricing makes an edit without changes show the order as it is.
+func resetOrderEditPricing(e *models.OrderEdit, order *models.Order) {
+	e.Items = order.Items
+	e.Subtotal = order.Subtotal
+	e.DiscountTotal = order.DiscountTotal
+	e.ShippingMethod = order.ShippingMethod
+	e.ShippingCost = order.ShippingCost
+	e.TaxAmount = order.TaxAmount
+	e.Tax = order.Tax
+	e.Total = order.Total
+	e.TotalBefore = order.Total
+	e.AmountDue = order.AmountDue
+	e.RefundDue = 0
+}
+
+// GetOrderEditService returns one of an order's edits.
+func GetOrderEditService(orderID primitive.ObjectID, idHex string) (*models.OrderEdit, error) {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return nil, ErrOrderEditNotFound
+	}
+	e, err := repositories.GetOrderEdit(context.Background(), orderID, id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrOrderEditNotFound
+	}
+	return e, nil
+}
+
+// getOpenOrderEdit returns one of an order's edits that is still open.
+func getOpenOrderEdit(orderID primitive.ObjectID, idHex string) (*models.OrderEdit, error) {
+	e, err := GetOrderEditService(orderID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != models.OrderEditStatusOpen {
+		return nil, ErrOrderEditClosed
+	}
+	return e, nil
+}
+
+// ListOrderEditsService returns an order's edits, oldest first.
+func ListOrderEditsService(orderID primitive.ObjectID) ([]models.OrderEdit, error) {
+	out, err := repositories.ListOrderEdits(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.OrderEdit{}
+	}
+	return out, nil
+}
+
+// StageOrderEditService replaces the changes staged on an open edit and
+// re-prices it, so the seller can review the new totals before committing.
+func StageOrderEditService(shop *models.Shop, order *models.Order, idHex string, changes []models.OrderEditChange, shippingMethodID, reason string) (*models.OrderEdit, error) {
+	if err := checkOrderEditable(order); err != nil {
+		return nil, err
+	}
+	e, err := getOpenOrderEdit(order.ID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		changes = []models.OrderEditChange{}
+	}
+	e.Changes = changes
+	e.ShippingMethodID = strings.TrimSpace(shippingMethodID)
+	e.Reason = strings.TrimSpace(reason)
+	if len(e.Changes) == 0 && e.ShippingMethodID == "" {
+		resetOrderEditPricing(e, order)
+	} else if _, err := NewCheckoutService().priceOrderEdit(shop, order, e); err != nil {
+		return nil, err
+	}
+	if err := saveOrderEdit(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// saveOrderEdit stores an open edit after its changes or pricing moved.
+func saveOrderEdit(e *models.OrderEdit) error {
+	e.UpdatedAt = time.Now()
+	res, err := repositories.ReplaceOpenOrderEdit(context.Background(), e)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrOrderEditClosed
+	}
+	return nil
+}
+
+// DiscardOrderEditService drops an open edit without touching the order.
+func DiscardOrderEditService(orderID primitive.ObjectID, idHex string) (*models.OrderEdit, error) {
+	e, err := getOpenOrderEdit(orderID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	res, err := repositories.SetOrderEditStatus(context.Background(), e.ID, models.OrderEditStatusOpen, models.OrderEditStatusDiscarded,
+		bson.M{"updated_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrOrderEditClosed
+	}
+	e.Status = models.OrderEditStatusDiscarded
+	return e, nil
+}
+
+// CommitOrderEditService applies an open edit to its order. The edit is
+// re-priced first; if the total moved since it was staged, the re-priced edit
+// is saved and ErrOrderEditChanged returned for review. When the edit lowers
+// a paid order's total, the difference is refunded before anything else is
+// written, and a declined refund leaves the order as it was. The new items
+// and totals, stock, discount usage and the timeline entry are then written
+// as one unit; a higher total on a paid order is left as the order's amount
+// due, to be paid like the order was.
+func CommitOrderEditService(shop *models.Shop, order *models.Order, idHex string, actor models.OrderActor) (*models.OrderEdit, *models.Order, error) {
+	if err := checkOrderEditable(order); err != nil {
+		return nil, nil, err
+	}
+	e, err := getOpenOrderEdit(order.ID, idHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Changes) == 0 && e.ShippingMethodID == "" {
+		return nil, nil, fmt.Errorf("%w: nothing to change", ErrInvalidOrderEdit)
+	}
+
+	s := NewCheckoutService()
+	totalBefore, dueBefore, refundBefore := e.Total, e.AmountDue, e.RefundDue
+	plan, err := s.priceOrderEdit(shop, order, e)
+	if err != nil {
+		return nil, nil, err
+	}
+	if totalBefore != e.Total || dueBefore != e.AmountDue || refundBefore != e.RefundDue {
+		if err := saveOrderEdit(e); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%w: was %s, now %s", ErrOrderEditChanged, totalBefore, e.Total)
+	}
+
+	var refund *models.Refund
+	if e.RefundDue > 0 {
+		if refund, err = issueOrderEditRefund(order, e, actor); err != nil {
+			return nil, nil, err
+		}
+		e.RefundID = &refund.ID
+	}
+
+	updated := *order
+	updated.Items = e.Items
+	updated.Subtotal = e.Subtotal
+	updated.DiscountTotal = e.DiscountTotal
+	updated.ShippingMethod = e.ShippingMethod
+	updated.ShippingCost = e.ShippingCost
+	updated.TaxAmount = e.TaxAmount
+	updated.Tax = e.Tax
+	updated.Total = e.Total
+	updated.AmountDue = e.AmountDue
+	updated.AppliedDiscountIDs = plan.quote.AppliedDiscountIDs
+	updated.DiscountUsages = append(append([]models.OrderDiscountUsage{}, order.DiscountUsages...), plan.quote.usages...)
+	if order.Presentment != nil {
+		updated.Presentment = presentOrder(orderConverter(shop, order), &updated, updated.Tax != nil && updated.Tax.PricesIncludeTax)
+	}
+	updated.UpdatedAt = time.Now()
+
+	if err := commitSteps(orderEditSteps(order, &updated, e, plan, refund, actor)); err != nil {
+		if refund != nil {
+			log.Printf("order edit %s: refund %s of %s issued but the edit was not applied: %v", e.ID.Hex(), refund.ID.Hex(), refund.Amount, err)
+		}
+		return nil, nil, asCheckoutError(err)
+	}
+	e.Status = models.OrderEditStatusCommitted
+	e.CommittedAt = &updated.UpdatedAt
+	e.Actor = actor
+
+	syncPendingPayments(&updated)
+	return e, &updated, nil
+}
+
+// orderEditSteps lists the writes that commit an edit: the edit is closed
+// first so it is only ever applied once, then stock moves, new discount uses
+// are recorded, and the order itself is rewritten, provided nothing else
+// changed it since it was loaded.
+func orderEditSteps(order, updated *models.Order, e *models.OrderEdit, plan *orderEditPlan, refund *models.Refund, actor models.OrderActor) []writeStep {
+	committedAt := updated.UpdatedAt
+	steps := []writeStep{{
+		name: "commit order edit",
+		apply: func(ctx context.Context) error {
+			set := bson.M{
+				"updated_at":   committedAt,
+				"committed_at": committedAt,
+				"actor":        actor,
+				"items":        e.Items,
+				"total":        e.Total,
+				"amount_due":   e.AmountDue,
+				"refund_due":   e.RefundDue,
+			}
+			if e.RefundID != nil {
+				set["refund_id"] = *e.RefundID
+			}
+			res, err := repositories.SetOrderEditStatus(ctx, e.ID, models.OrderEditStatusOpen, models.OrderEditStatusCommitted, set)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return ErrOrderEditClosed
+			}
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.SetOrderEditStatus(ctx, e.ID, models.OrderEditStatusCommitted, models.OrderEditStatusOpen,
+				bson.M{"updated_at": e.UpdatedAt})
+			return err
+		},
+	}}
+
+	for _, st := range plan.stock {
+		st := st
+		take := func(ctx context.Context, n int) error {
+			var err error
+			if st.VariantID.IsZero() {
+				err = ReduceProductStock(ctx, st.ProductID, n)
+			} else {
+				err = ReduceVariantStock(ctx, st.ProductID, st.VariantID, n)
+			}
+			if errors.Is(err, ErrInsufficientStock) {
+				return &CheckoutError{Kind: ErrCheckoutInsufficientStock, ProductID: st.ProductID, VariantID: st.VariantID, Detail: "product/variant: " + st.ProductID.Hex()}
+			}
+			return err
+		}
+		give := func(ctx context.Context, n int) error {
+			if st.VariantID.IsZero() {
+				return RestoreProductStock(ctx, st.ProductID, n)
+			}
+			return RestoreVariantStock(ctx, st.ProductID, st.VariantID, n)
+		}
+		if st.Delta > 0 {
+			steps = append(steps, writeStep{
+				name:  "reduce stock",
+				apply: func(ctx context.Context) error { return take(ctx, st.Delta) },
+				undo:  func(ctx context.Context) error { return give(ctx, st.Delta) },
+			})
+		} else {
+			steps = append(steps, writeStep{
+				name:  "restock item",
+				apply: func(ctx context.Context) error { return give(ctx, -st.Delta) },
+				undo:  func(ctx context.Context) error { return take(ctx, -st.Delta) },
+			})
+		}
+	}
+
+	for _, usage := range plan.quote.usages {
+		usage := usage
+		steps = append(steps, writeStep{
+			name: "record discount usage",
+			apply: func(ctx context.Context) error {
+				if err := recordDiscountUsage(ctx, usage.DiscountID, order.CustomerID, usage.Amount); err != nil {
+					return &CheckoutError{Kind: ErrCheckoutDiscountUnavailable, Detail: usage.DiscountID.Hex(), Err: err}
+				}
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				return ReleaseDiscountUsage(ctx, usage.DiscountID, order.CustomerID, usage.Amount)
+			},
+		})
+	}
+
+	steps = append(steps, writeStep{
+		name: "apply order edit",
+		apply: func(ctx context.Context) error {
+			res, err := repositories.SetOrderFieldsIfUnchanged(ctx, order.ID, order.UpdatedAt, orderEditFields(updated))
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return ErrOrderEditConflict
+			}
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.SetOrderFields(ctx, order.ID, orderEditFields(order))
+			return err
+		},
+	})
+
+	changes := map[string]models.OrderFieldChange{
+		"items": {Before: orderItemsSummary(order.Items), After: orderItemsSummary(updated.Items)},
+		"total": amountChange(order.Total, updated.Total),
+	}
+	if order.ShippingCost != updated.ShippingCost {
+		changes["shipping_cost"] = amountChange(order.ShippingCost, updated.ShippingCost)
+	}
+	if order.TaxAmount != updated.TaxAmount {
+		changes["tax_amount"] = amountChange(order.TaxAmount, updated.TaxAmount)
+	}
+	if order.AmountDue != updated.AmountDue {
+		changes["amount_due"] = amountChange(order.AmountDue, updated.AmountDue)
+	}
+	message := "Order edited"
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	steps = append(steps, orderEventStep(newOrderEvent(order, models.OrderEventEdited, actor, message, changes)))
+	if refund != nil {
+		steps = append(steps, orderEventStep(newOrderEvent(order, models.OrderEventRefund, actor,
+			fmt.Sprintf("Refunded %s after the order was edited", refund.Amount), nil)))
+	}
+	return steps
+}
+
+// orderEditFields are the order fields an edit rewrites.
+func orderEditFields(o *models.Order) bson.M {
+	return bson.M{
+		"items":                o.Items,
+		"subtotal":             o.Subtotal,
+		"discount_total":       o.DiscountTotal,
+		"shipping_method":      o.ShippingMethod,
+		"shipping_cost":        o.ShippingCost,
+		"tax_amount":           o.TaxAmount,
+		"tax":                  o.Tax,
+		"total":                o.Total,
+		"amount_due":           o.AmountDue,
+		"applied_discount_ids": o.AppliedDiscountIDs,
+		"discount_usages":      o.DiscountUsages,
+		"presentment":          o.Presentment,
+		"updated_at":           o.UpdatedAt,
+	}
+}
+
+// orderItemsSummary renders lines as "2 × Name" for the timeline.
+func orderItemsSummary(items []models.OrderItem) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, fmt.Sprintf("%d × %s", item.Quantity, item.Name))
+	}
+	return out
+}
+
+// issueOrderEditRefund pays back what an edit takes off a paid order. The
+// refund goes in the ledger but not in the order's refunded total, since the
+// edited total already leaves the amount out.
+func issueOrderEditRefund(order *models.Order, e *models.OrderEdit, actor models.OrderActor) (*models.Refund, error) {
+	ctx := context.Background()
+	now := time.Now()
+	reason := "Order edited"
+	if e.Reason != "" {
+		reason += ": " + e.Reason
+	}
+	refund := &models.Refund{
+		ID:        primitive.NewObjectID(),
+		ShopID:    order.ShopID,
+		OrderID:   order.ID,
+		Type:      models.RefundTypeEdit,
+		Status:    models.RefundStatusPending,
+		Amount:    e.RefundDue,
+		Reason:    reason,
+		Actor:     actor,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repositories.CreateRefund(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	provider, reference, procErr := refundProcessor.ProcessRefund(order, refund)
+	if procErr != nil {
+		if _, err := repositories.SetRefundOutcome(ctx, refund.ID, models.RefundStatusFailed, bson.M{"provider": provider, "failure_reason": procErr.Error()}); err != nil {
+			log.Printf("refund %s: could not mark failed: %v", refund.ID.Hex(), err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRefundFailed, procErr)
+	}
+	refund.Status = models.RefundStatusSucceeded
+	refund.Provider = provider
+	refund.ProviderReference = reference
+	if _, err := repositories.SetRefundOutcome(ctx, refund.ID, models.RefundStatusSucceeded, bson.M{"provider": provider, "provider_reference": reference}); err != nil {
+		log.Printf("refund %s: succeeded at provider but not recorded: %v", refund.ID.Hex(), err)
+	}
+	return refund, nil
+}
+
+// syncPendingPayments brings payments still under way in line with what the
+// edited order now asks for: the new total while it is unpaid, otherwise the
+// amount due. Payments for an amount no longer owed are failed.
+func syncPendingPayments(order *models.Order) {
+	ctx := context.Background()
+	payments, err := repositories.ListPaymentsByOrder(ctx, order.ID)
+	if err != nil {
+		log.Printf("order edit: could not load payments of order %s: %v", order.ID.Hex(), err)
+		return
+	}
+	owed := payableAmount(order)
+	for _, p := range payments {
+		if p.Status != models.PaymentAttemptPending || p.Amount == owed {
+			continue
+		}
+		if owed > 0 {
+			_, err = repositories.UpdatePaymentStatus(ctx, p.ID, models.PaymentAttemptPending, models.PaymentAttemptPending,
+				bson.M{"amount": owed, "updated_at": time.Now()})
+		} else {
+			_, err = repositories.UpdatePaymentStatus(ctx, p.ID, models.PaymentAttemptPending, models.PaymentAttemptFailed,
+				bson.M{"failure_reason": "order was edited and nothing is owed", "updated_at": time.Now()})
+		}
+		if err != nil {
+			log.Printf("order edit: could not update payment %s of order %s: %v", p.ID.Hex(), order.ID.Hex(), err)
+		}
+	}
+}
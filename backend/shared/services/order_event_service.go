@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CustomerOrderEvent is the customer-safe view of a timeline entry: no actor
+// IDs, no field diffs and no private seller notes.
+type CustomerOrderEvent struct {
+	Type      models.OrderEventType `json:"type"`
+	Message   string                `json:"message,omitempty"`
+	Status    models.OrderStatus    `json:"status,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// newOrderEvent builds a timeline entry for an order.
+func newOrderEvent(order *models.Order, eventType models.OrderEventType, actor models.OrderActor, message string, changes map[string]models.OrderFieldChange) *models.OrderEvent {
+	return &models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		ShopID:    order.ShopID,
+		Type:      eventType,
+		Actor:     actor,
+		Message:   message,
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+}
+
+// amountChange records a change of amount in the timeline. Changes hold
+// untyped values, so amounts go in as currency units, as the API shows them.
+func amountChange(before, after money.Amount) models.OrderFieldChange {
+	return models.OrderFieldChange{Before: before.Float(), After: after.Float()}
+}
+
+// orderEventStep appends an event as part of a multi-step write, so the event
+// is only visible if the change it describes was committed.
+func orderEventStep(e *models.OrderEvent) writeStep {
+	return writeStep{
+		name: "record order event",
+		apply: func(ctx context.Context) error {
+			_, err := repositories.CreateOrderEvent(ctx, e)
+			return err
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.DeleteOrderEvent(ctx, e.ID)
+			return err
+		},
+	}
+}
+
+// AddOrderNoteService appends a free-text note to an order's timeline.
+func AddOrderNoteService(order *models.Order, actor models.OrderActor, note string, customerVisible bool) (*models.OrderEvent, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, errors.New("note is required")
+	}
+	e := newOrderEvent(order, models.OrderEventNote, actor, note, nil)
+	e.CustomerVisible = customerVisible
+	if _, err := repositories.CreateOrderEvent(context.Background(), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ListOrderTimelineService returns the full timeline of an order, oldest first.
+func ListOrderTimelineService(orderID primitive.ObjectID) ([]models.OrderEvent, error) {
+	events, err := repositories.ListOrderEvents(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.OrderEvent{}
+	}
+	return events, nil
+}
+
+// CustomerOrderTimelineService returns the timeline entries a customer may see.
+func CustomerOrderTimelineService(orderID primitive.ObjectID) ([]CustomerOrderEvent, error) {
+	events, err := repositories.ListOrderEvents(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []CustomerOrderEvent{}
+	for _, e := range events {
+		ce := CustomerOrderEvent{Type: e.Type, CreatedAt: e.CreatedAt}
+		switch e.Type {
+		case models.OrderEventCreated, models.OrderEventPayment, models.OrderEventRefund, models.OrderEventReturn, models.OrderEventShipment:
+			ce.Message = e.Message
+		case models.OrderEventStatusChanged:
+			if change, ok := e.Changes["status"]; ok {
+				if s, ok := change.After.(string); ok {
+					ce.Status = models.OrderStatus(s)
+				}
+			}
+		case models.OrderEventNote:
+			if !e.CustomerVisible {
+				continue
+			}
+			ce.Message = e.Message
+		case models.OrderEventEdited:
+			ce.Message = "Order details updated"
+		default:
+			continue
+		}
+		out = append(out, ce)
+	}
+	return out, nil
+}
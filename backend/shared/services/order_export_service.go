@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"github.com/Endale2/DRPS/shared/xlsx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderExportFormat is the file format of an order export.
+type OrderExportFormat string
+
+const (
+	OrderExportCSV  OrderExportFormat = "csv"
+	OrderExportXLSX OrderExportFormat = "xlsx"
+)
+
+var ErrInvalidExportFormat = errors.New("format must be csv or xlsx")
+
+// orderExportFlushEvery is how many orders are written between flushes, so a
+// long export reaches the client steadily instead of all at the end.
+const orderExportFlushEvery = 100
+
+// orderExportColumns head an export. Each row is one line item; the order
+// columns from "Subtotal" on are filled on an order's first row only, so
+// summing a column never counts an order twice.
+var orderExportColumns = []string{
+	"Order number", "Date", "Status", "Payment status", "Payment method", "Invoice number",
+	"Customer email", "Customer name",
+	"Item", "Product ID", "Variant ID", "Quantity", "Unit price", "Line discount", "Line tax", "Line total",
+	"Subtotal", "Discounts", "Shipping", "Tax", "Total", "Refunded", "Currency",
+}
+
+// exportRowWriter writes rows in one of the export formats.
+type exportRowWriter interface {
+	WriteRow(values ...interface{}) error
+	Flush() error
+	Close() error
+}
+
+// csvRowWriter writes export rows as CSV.
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c csvRowWriter) WriteRow(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			record[i] = csvSafe(v)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case money.Amount:
+			record[i] = v.String()
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c csvRowWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c csvRowWriter) Close() error {
+	return c.Flush()
+}
+
+// csvSafe stops spreadsheet programs from running text that starts like a
+// formula, e.g. a product named "=HYPERLINK(...)".
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// ExportOrdersService writes the shop's orders matching the filter to w, one
+// row per line item, oldest first. Orders are read and written as they
+// stream from the database, so exports of any size use little memory.
+func ExportOrdersService(shop *models.Shop, f OrderFilter, format OrderExportFormat, w io.Writer) error {
+	var rows exportRowWriter
+	switch format {
+	case OrderExportCSV:
+		rows = csvRowWriter{w: csv.NewWriter(w)}
+	case OrderExportXLSX:
+		xw, err := xlsx.NewWriter(w, "Orders")
+		if err != nil {
+			return err
+		}
+		rows = xw
+	default:
+		return ErrInvalidExportFormat
+	}
+
+	header := make([]interface{}, len(orderExportColumns))
+	for i, col := range orderExportColumns {
+		header[i] = col
+	}
+	if err := rows.WriteRow(header...); err != nil {
+		return err
+	}
+
+	type exportCustomer struct{ email, name string }
+	customers := map[primitive.ObjectID]exportCustomer{}
+	customerFor := func(id primitive.ObjectID) exportCustomer {
+		if c, ok := customers[id]; ok {
+			return c
+		}
+		var c exportCustomer
+		if cust, err := repositories.GetCustomerByID(id.Hex()); err == nil && cust != nil {
+			c = exportCustomer{email: cust.Email, name: strings.TrimSpace(cust.FirstName + " " + cust.LastName)}
+		}
+		customers[id] = c
+		return c
+	}
+
+	written := 0
+	err := repositories.EachOrder(context.Background(), f.query(shop.ID), func(order *models.Order) error {
+		customer := customerFor(order.CustomerID)
+		for i, item := range order.Items {
+			variantID := ""
+			if !item.VariantID.IsZero() {
+				variantID = item.VariantID.Hex()
+			}
+			productID := item.ProductID.Hex()
+			if item.Custom {
+				productID = ""
+			}
+			row := []interface{}{
+				order.OrderNumber, order.CreatedAt.UTC().Format("2006-01-02 15:04:05"), string(order.Status),
+				order.PaymentStatus, order.PaymentMethod, order.InvoiceNumber,
+				customer.email, customer.name,
+				item.Name, productID, variantID, item.Quantity, item.UnitPrice,
+				item.UnitPrice.Mul(item.Quantity) - item.TotalPrice, item.TaxAmount, item.TotalPrice,
+			}
+			if i == 0 {
+				row = append(row, order.Subtotal, order.DiscountTotal, order.ShippingCost, order.TaxAmount,
+					order.Total, order.RefundedTotal, shop.Currency)
+			}
+			if err := rows.WriteRow(row...); err != nil {
+				return err
+			}
+		}
+		written++
+		if written%orderExportFlushEvery == 0 {
+			if err := rows.Flush(); err != nil {
+				return err
+			}
+			if fl, ok := w.(interface{ Flush() }); ok {
+				fl.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
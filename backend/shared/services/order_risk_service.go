@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Risk rules. Each rule that fires adds its points; the total is capped at
+// maxRiskScore.
+const (
+	maxRiskScore = 100
+
+	// Orders placed in the last riskVelocityWindow by the same customer, IP
+	// or email, at or above riskVelocityLimit, look like card testing
+	riskVelocityWindow      = time.Hour
+	riskVelocityLimit       = 3
+	riskCustomerVelocityPts = 25
+	riskIPVelocityPts       = 20
+	riskEmailVelocityPts    = 20
+
+	riskCountryMismatchPts = 15
+
+	// A customer's first order worth riskFirstOrderMultiple times the shop's
+	// average order or more, once the shop has riskBaselineMinOrders sold
+	// orders to average over
+	riskFirstOrderMultiple = 3.0
+	riskBaselineOrders     = 50
+	riskBaselineMinOrders  = 5
+	riskFirstOrderValuePts = 25
+	riskFailedOTPWindow    = 24 * time.Hour
+	riskFailedOTPLimit     = 3
+	riskFailedOTPPts       = 20
+	riskStackedDiscounts   = 2
+	riskStackedDiscountPts = 10
+	riskDeepDiscountRatio  = 0.5
+	riskDeepDiscountPts    = 15
+)
+
+// CheckoutClient is what checkout knows about who is placing an order,
+// beyond the customer account: used for risk checks, and the currency they
+// shop in, empty for the shop's own.
+type CheckoutClient struct {
+	IP             string
+	BillingAddress map[string]interface{}
+	Currency       string
+	// Guest is set when the customer checked out without signing in
+	Guest bool
+}
+
+// RiskReviewThreshold returns the score at which the shop's orders are held
+// for review; 0 means orders are never held.
+func RiskReviewThreshold(shop *models.Shop) int {
+	if shop.RiskReviewThreshold != nil {
+		return *shop.RiskReviewThreshold
+	}
+	return models.DefaultRiskReviewThreshold
+}
+
+// ValidateRiskReviewThreshold checks a seller-supplied threshold.
+func ValidateRiskReviewThreshold(threshold int) error {
+	if threshold < 0 || threshold > maxRiskScore {
+		return fmt.Errorf("riskReviewThreshold must be between 0 and %d", maxRiskScore)
+	}
+	return nil
+}
+
+// normalizeRiskEmail folds the ways one mailbox can be written into one key:
+// case, "+tag" suffixes, and dots in Gmail addresses.
+func normalizeRiskEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// assessOrderRisk scores an order about to be placed. A rule whose data
+// cannot be read is skipped and logged, so checkout never fails on it.
+func assessOrderRisk(shop *models.Shop, order *models.Order, client CheckoutClient) *models.OrderRisk {
+	ctx := context.Background()
+	now := time.Now()
+	risk := &models.OrderRisk{IP: strings.TrimSpace(client.IP), AssessedAt: now, Reasons: []models.OrderRiskReason{}}
+	add := func(signal models.OrderRiskSignal, points int, message string) {
+		risk.Reasons = append(risk.Reasons, models.OrderRiskReason{Signal: signal, Points: points, Message: message})
+		risk.Score += points
+	}
+	count := func(rule string, filter bson.M) int64 {
+		n, err := repositories.CountOrders(ctx, filter)
+		if err != nil {
+			log.Printf("risk: order %s: %s skipped: %v", order.ID.Hex(), rule, err)
+			return 0
+		}
+		return n
+	}
+	since := bson.M{"$gte": now.Add(-riskVelocityWindow)}
+
+	email := ""
+	if customer, err := repositories.GetCustomerByID(order.CustomerID.Hex()); err != nil {
+		log.Printf("risk: order %s: could not load customer: %v", order.ID.Hex(), err)
+	} else if customer != nil {
+		email = customer.Email
+		risk.Email = normalizeRiskEmail(email)
+	}
+
+	// Velocity
+	if n := count("customer velocity", bson.M{"shop_id": shop.ID, "customer_id": order.CustomerID, "created_at": since}); n >= riskVelocityLimit {
+		add(models.RiskSignalCustomerVelocity, riskCustomerVelocityPts,
+			fmt.Sprintf("%d orders from this customer in the last hour", n))
+	}
+	if risk.IP != "" {
+		if n := count("IP velocity", bson.M{"shop_id": shop.ID, "risk.ip": risk.IP, "created_at": since}); n >= riskVelocityLimit {
+			add(models.RiskSignalIPVelocity, riskIPVelocityPts,
+				fmt.Sprintf("%d orders from IP %s in the last hour", n, risk.IP))
+		}
+	}
+	if risk.Email != "" {
+		// Other accounts sharing the mailbox, e.g. through +tags
+		filter := bson.M{"shop_id": shop.ID, "risk.email": risk.Email, "customer_id": bson.M{"$ne": order.CustomerID}, "created_at": since}
+		if n := count("email velocity", filter); n >= riskVelocityLimit {
+			add(models.RiskSignalEmailVelocity, riskEmailVelocityPts,
+				fmt.Sprintf("%d orders from other accounts using %s in the last hour", n, risk.Email))
+		}
+	}
+
+	// Billing and shipping in different countries
+	if len(client.BillingAddress) > 0 && len(order.ShippingAddress) > 0 {
+		billing, okB := ShippingDestinationFromAddress(client.BillingAddress)
+		shipping, okS := ShippingDestinationFromAddress(order.ShippingAddress)
+		if okB && okS && billing.Country != shipping.Country {
+			add(models.RiskSignalCountryMismatch, riskCountryMismatchPts,
+				fmt.Sprintf("billing country %s differs from shipping country %s", billing.Country, shipping.Country))
+		}
+	}
+
+	// A first order far above what the shop usually sells
+	if count("first order", bson.M{"shop_id": shop.ID, "customer_id": order.CustomerID}) == 0 {
+		if avg, ok := averageOrderValue(ctx, shop.ID); ok && avg > 0 && order.Total >= avg.MulRate(riskFirstOrderMultiple, money.HalfUp) {
+			add(models.RiskSignalFirstOrderValue, riskFirstOrderValuePts,
+				fmt.Sprintf("first order of %s is %.1f times the shop's average of %s", order.Total, order.Total.Float()/avg.Float(), avg))
+		}
+	}
+
+	// Someone struggling to sign in to the account
+	if email != "" {
+		n, err := repositories.CountOTPFailures(ctx, email, now.Add(-riskFailedOTPWindow))
+		if err != nil {
+			log.Printf("risk: order %s: failed OTP check skipped: %v", order.ID.Hex(), err)
+		} else if n >= riskFailedOTPLimit {
+			add(models.RiskSignalFailedOTP, riskFailedOTPPts,
+				fmt.Sprintf("%d failed sign-in codes for this email in the last day", n))
+		}
+	}
+
+	// Discounts
+	if len(order.AppliedDiscountIDs) >= riskStackedDiscounts {
+		add(models.RiskSignalDiscountStacking, riskStackedDiscountPts,
+			fmt.Sprintf("%d discounts combined", len(order.AppliedDiscountIDs)))
+	}
+	if order.Subtotal > 0 && order.DiscountTotal >= order.Subtotal.MulRate(riskDeepDiscountRatio, money.HalfUp) {
+		add(models.RiskSignalDiscountStacking, riskDeepDiscountPts,
+			fmt.Sprintf("discounts take %.0f%% off the subtotal", order.DiscountTotal.Float()/order.Subtotal.Float()*100))
+	}
+
+	if risk.Score > maxRiskScore {
+		risk.Score = maxRiskScore
+	}
+	return risk
+}
+
+// averageOrderValue is the mean total of the shop's recent sold orders, if
+// there are enough of them to go by.
+func averageOrderValue(ctx context.Context, shopID primitive.ObjectID) (money.Amount, bool) {
+	filter := bson.M{"shop_id": shopID, "status": bson.M{"$in": soldOrderStatuses}}
+	orders, err := repositories.ListOrdersLimited(ctx, filter, riskBaselineOrders)
+	if err != nil {
+		log.Printf("risk: shop %s: could not load order baseline: %v", shopID.Hex(), err)
+		return 0, false
+	}
+	if len(orders) < riskBaselineMinOrders {
+		return 0, false
+	}
+	var total money.Amount
+	for _, o := range orders {
+		total += o.Total
+	}
+	return total.Part(1, len(orders), money.HalfUp), true
+}
+
+// holdForReview reports whether the shop holds an order with this risk.
+func holdForReview(shop *models.Shop, risk *models.OrderRisk) bool {
+	threshold := RiskReviewThreshold(shop)
+	return threshold > 0 && risk.Score >= threshold
+}
+
+// riskSummary renders a held order's reasons for the timeline and the seller.
+func riskSummary(risk *models.OrderRisk) string {
+	reasons := make([]string, 0, len(risk.Reasons))
+	for _, r := range risk.Reasons {
+		reasons = append(reasons, r.Message)
+	}
+	return fmt.Sprintf("risk score %d: %s", risk.Score, strings.Join(reasons, "; "))
+}
+
+// ApproveOrderReviewService releases an order held for review so the
+// customer can pay for it.
+func ApproveOrderReviewService(order *models.Order, actor models.OrderActor) (*models.Order, error) {
+	if order.Status != models.OrderStatusReview {
+		return nil, fmt.Errorf("%w: order is %s, not held for review", ErrInvalidOrderTransition, order.Status)
+	}
+	return TransitionOrderStatusService(order.ID.Hex(), models.OrderStatusPending, actor)
+}
@@ -3,54 +3,147 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+	"unicode"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// generateOrderNumber creates a unique order number in format: ORD-YYYYMMDD-XXXXX
-// where XXXXX is a sequential number for that day
-func generateOrderNumber() (string, error) {
-	today := time.Now().Format("20060102")
+// orderNumberFormatFor returns the shop's numbering format, falling back to
+// the platform default.
+func orderNumberFormatFor(shop *models.Shop) models.OrderNumberFormat {
+	if shop == nil || shop.OrderNumbering == nil {
+		return models.DefaultOrderNumberFormat
+	}
+	return *shop.OrderNumbering
+}
 
-	// Get count of orders for today to generate sequential number
-	startOfDay := time.Now().Truncate(24 * time.Hour)
-	endOfDay := startOfDay.Add(24 * time.Hour)
+// ValidateOrderNumberFormat checks a seller-supplied numbering format.
+func ValidateOrderNumberFormat(f models.OrderNumberFormat) error {
+	if len(f.Prefix) > 16 {
+		return errors.New("order number prefix must be at most 16 characters")
+	}
+	for _, r := range f.Prefix {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '#') {
+			return errors.New("order number prefix may only contain letters, digits, '-', '_' and '#'")
+		}
+	}
+	if f.Padding < 1 || f.Padding > 10 {
+		return errors.New("order number padding must be between 1 and 10")
+	}
+	switch f.Reset {
+	case models.OrderNumberResetNever, models.OrderNumberResetYearly, models.OrderNumberResetDaily:
+	default:
+		return errors.New("order number reset must be never, yearly or daily")
+	}
+	return nil
+}
 
-	filter := bson.M{
-		"created_at": bson.M{
-			"$gte": startOfDay,
-			"$lt":  endOfDay,
-		},
+// orderNumberPeriod returns the part of the number that identifies the
+// current sequence period; it doubles as the counter key.
+func orderNumberPeriod(reset models.OrderNumberReset, now time.Time) string {
+	switch reset {
+	case models.OrderNumberResetDaily:
+		return now.Format("20060102") + "-"
+	case models.OrderNumberResetYearly:
+		return now.Format("2006") + "-"
 	}
+	return ""
+}
 
-	orders, err := repositories.ListOrders(context.Background(), filter)
+// generateOrderNumber takes the next number from the shop's counter. The
+// counter is incremented outside any checkout transaction, so a failed
+// checkout leaves a gap rather than reusing the number. Counters are moved
+// past numbers issued before they existed once, at startup, by
+// SeedOrderCounters.
+func generateOrderNumber(shopID primitive.ObjectID, format models.OrderNumberFormat) (string, error) {
+	ctx := context.Background()
+	period := orderNumberPeriod(format.Reset, time.Now().UTC())
+	prefix := format.Prefix + period
+
+	seq, err := repositories.NextOrderSequence(ctx, shopID, prefix)
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("%s%0*d", prefix, format.Padding, seq), nil
+}
 
-	// Generate sequential number (5 digits, zero-padded)
-	sequence := len(orders) + 1
-	orderNumber := fmt.Sprintf("ORD-%s-%05d", today, sequence)
-
-	return orderNumber, nil
+// RenumberDuplicateOrders gives each order that shares its number with an
+// older order of the same shop a number of its own: the shared number with
+// "-2", "-3" and so on appended. The oldest order keeps the number, and the
+// change is recorded on each renumbered order's timeline. Numbers must be
+// unique before the index enforcing it can be built. It returns how many
+// orders were renumbered.
+func RenumberDuplicateOrders(ctx context.Context) (int, error) {
+	duplicates, err := repositories.ListDuplicateOrderNumbers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	renumbered := 0
+	for _, dup := range duplicates {
+		suffix := 2
+		for _, id := range dup.OrderIDs[1:] {
+			var number string
+			for {
+				number = fmt.Sprintf("%s-%d", dup.OrderNumber, suffix)
+				suffix++
+				taken, err := repositories.OrderNumberExists(ctx, dup.ShopID, number)
+				if err != nil {
+					return renumbered, err
+				}
+				if !taken {
+					break
+				}
+			}
+			res, err := repositories.RenumberOrder(ctx, id, dup.OrderNumber, number)
+			if err != nil {
+				return renumbered, err
+			}
+			if res.MatchedCount == 0 {
+				continue
+			}
+			renumbered++
+
+			order := &models.Order{ID: id, ShopID: dup.ShopID}
+			changes := map[string]models.OrderFieldChange{"order_number": {Before: dup.OrderNumber, After: number}}
+			event := newOrderEvent(order, models.OrderEventEdited, models.OrderActor{Role: models.OrderActorSystem},
+				"Renumbered: another order had the same number", changes)
+			if _, err := repositories.CreateOrderEvent(ctx, event); err != nil {
+				return renumbered, err
+			}
+		}
+	}
+	return renumbered, nil
 }
 
-func CreateOrderService(o *models.Order) (*models.Order, error) {
+// prepareOrder stamps timestamps and assigns an order number before insert.
+func prepareOrder(o *models.Order, shop *models.Shop) error {
 	now := time.Now()
 	o.CreatedAt = now
 	o.UpdatedAt = now
 
-	// Generate unique order number
-	orderNumber, err := generateOrderNumber()
+	orderNumber, err := generateOrderNumber(o.ShopID, orderNumberFormatFor(shop))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	o.OrderNumber = orderNumber
+	return nil
+}
+
+func CreateOrderService(o *models.Order) (*models.Order, error) {
+	shop, err := repositories.GetShopByID(o.ShopID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareOrder(o, shop); err != nil {
+		return nil, err
+	}
 
 	res, err := repositories.CreateOrder(context.Background(), o)
 	if err != nil {
@@ -64,6 +157,24 @@ func GetOrderByIDService(idHex string) (*models.Order, error) {
 	return repositories.GetOrderByID(context.Background(), idHex)
 }
 
+// GetShopOrdersService loads several of a shop's orders, in the order the IDs
+// are given. Any ID that is not one of the shop's orders fails the whole call
+// with ErrOrderNotFound.
+func GetShopOrdersService(shopID primitive.ObjectID, idHexes []string) ([]*models.Order, error) {
+	orders := make([]*models.Order, 0, len(idHexes))
+	for _, idHex := range idHexes {
+		order, err := repositories.GetOrderByID(context.Background(), idHex)
+		if err != nil {
+			return nil, err
+		}
+		if order == nil || order.ShopID != shopID {
+			return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, idHex)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
 // GetOrderWithCustomerDetails returns order with customer information populated
 func GetOrderWithCustomerDetails(idHex string) (*models.OrderWithCustomer, error) {
 	order, err := repositories.GetOrderByID(context.Background(), idHex)
@@ -111,20 +222,26 @@ func ListOrdersByShopService(shopIDHex string) ([]models.Order, error) {
 	return repositories.ListOrders(context.Background(), bson.M{"shop_id": shopID})
 }
 
-// ListOrdersByShopPaginatedService returns paginated orders with customer information
-func ListOrdersByShopPaginatedService(shopIDHex string, page, limit int, searchQuery string, status string) ([]map[string]interface{}, int64, error) {
-	shopID, err := primitive.ObjectIDFromHex(shopIDHex)
-	if err != nil {
-		return nil, 0, err
-	}
+// OrderFilter selects a shop's orders for the order list, bulk operations
+// and exports.
+type OrderFilter struct {
+	// Search matches the order number, customer ID or an item name
+	Search string
+	// Status is an order status; empty or "all" matches every status
+	Status string
+	// From and To bound the creation time; From is inclusive, To exclusive
+	From *time.Time
+	To   *time.Time
+}
 
-	// Build filter
+// query turns the filter into a query on the shop's orders.
+func (f OrderFilter) query(shopID primitive.ObjectID) bson.M {
 	filter := bson.M{"shop_id": shopID}
 
 	// Add search filter if provided
-	if searchQuery != "" {
+	if f.Search != "" {
 		// Search in order number, customer ID, or product names
-		searchRegex := primitive.Regex{Pattern: searchQuery, Options: "i"}
+		searchRegex := primitive.Regex{Pattern: f.Search, Options: "i"}
 		filter["$or"] = []bson.M{
 			{"order_number": searchRegex},
 			{"customer_id": searchRegex},
@@ -133,9 +250,31 @@ func ListOrdersByShopPaginatedService(shopIDHex string, page, limit int, searchQ
 	}
 
 	// Add status filter if provided
-	if status != "" && status != "all" {
-		filter["status"] = status
+	if f.Status != "" && f.Status != "all" {
+		filter["status"] = f.Status
+	}
+
+	created := bson.M{}
+	if f.From != nil {
+		created["$gte"] = *f.From
+	}
+	if f.To != nil {
+		created["$lt"] = *f.To
 	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	return filter
+}
+
+// ListOrdersByShopPaginatedService returns paginated orders with customer information
+func ListOrdersByShopPaginatedService(shopIDHex string, page, limit int, f OrderFilter) ([]map[string]interface{}, int64, error) {
+	shopID, err := primitive.ObjectIDFromHex(shopIDHex)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := f.query(shopID)
 
 	// Get paginated orders
 	orders, total, err := repositories.ListOrdersPaginated(context.Background(), filter, page, limit)
@@ -199,7 +338,7 @@ func GetOrderStatsByShopService(shopIDHex string) (map[string]interface{}, error
 
 	// Calculate statistics
 	totalOrders := len(orders)
-	totalRevenue := 0.0
+	var grossRevenue, totalRefunds money.Amount
 	pendingOrders := 0
 	deliveredOrders := 0
 	paidOrders := 0
@@ -221,15 +360,18 @@ func GetOrderStatsByShopService(shopIDHex string) (map[string]interface{}, error
 			cancelledOrders++
 		}
 
-		// Calculate revenue for certain statuses (paid, shipped, delivered)
-		if order.Status == "paid" || order.Status == "shipped" || order.Status == "delivered" {
-			totalRevenue += order.Total
+		// Revenue counts sold orders, net of what was refunded on them
+		if IsSoldOrder(&order) {
+			grossRevenue += order.Total
+			totalRefunds += order.RefundedTotal
 		}
 	}
 
 	return map[string]interface{}{
 		"total_orders":     totalOrders,
-		"total_revenue":    totalRevenue,
+		"total_revenue":    grossRevenue - totalRefunds,
+		"gross_revenue":    grossRevenue,
+		"total_refunds":    totalRefunds,
 		"pending_orders":   pendingOrders,
 		"delivered_orders": deliveredOrders,
 		"paid_orders":      paidOrders,
@@ -238,12 +380,21 @@ func GetOrderStatsByShopService(shopIDHex string) (map[string]interface{}, error
 	}, nil
 }
 
-func UpdateOrderService(idHex string, updates bson.M) (*models.Order, error) {
-	updates["updated_at"] = time.Now()
-	if _, err := repositories.UpdateOrder(context.Background(), idHex, updates); err != nil {
-		return nil, err
+// IsSoldOrder reports whether an order counts towards sales and revenue: it
+// was paid for and has not been cancelled or fully refunded.
+func IsSoldOrder(o *models.Order) bool {
+	for _, s := range soldOrderStatuses {
+		if o.Status == s {
+			return true
+		}
 	}
-	return GetOrderByIDService(idHex)
+	return false
+}
+
+// soldOrderStatuses are the statuses IsSoldOrder accepts.
+var soldOrderStatuses = []models.OrderStatus{
+	models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped,
+	models.OrderStatusDelivered, models.OrderStatusPartiallyRefunded,
 }
 
 func DeleteOrderService(idHex string) error {
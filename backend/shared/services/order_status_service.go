@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+var ErrOrderFieldNotEditable = errors.New("order field cannot be edited")
+var ErrOrderStatusDerived = errors.New("status is set by adding shipments or recording refunds")
+
+// orderTransitions is the order state machine: for each status, the statuses
+// it may move to. Statuses without an entry are terminal.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	// Held for review: approving makes the order payable
+	models.OrderStatusReview: {
+		models.OrderStatusPending,
+		models.OrderStatusCancelled,
+	},
+	models.OrderStatusPending: {
+		models.OrderStatusPaid,
+		models.OrderStatusCancelled,
+	},
+	models.OrderStatusPaid: {
+		models.OrderStatusProcessing,
+		models.OrderStatusPartiallyShipped,
+		models.OrderStatusShipped,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+		models.OrderStatusPartiallyRefunded,
+	},
+	models.OrderStatusProcessing: {
+		models.OrderStatusPartiallyShipped,
+		models.OrderStatusShipped,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+		models.OrderStatusPartiallyRefunded,
+	},
+	models.OrderStatusPartiallyShipped: {
+		models.OrderStatusShipped,
+		models.OrderStatusRefunded,
+		models.OrderStatusPartiallyRefunded,
+	},
+	models.OrderStatusShipped: {
+		models.OrderStatusDelivered,
+		models.OrderStatusRefunded,
+		models.OrderStatusPartiallyRefunded,
+	},
+	models.OrderStatusDelivered: {
+		models.OrderStatusRefunded,
+		models.OrderStatusPartiallyRefunded,
+	},
+	models.OrderStatusPartiallyRefunded: {
+		models.OrderStatusPartiallyRefunded,
+		models.OrderStatusRefunded,
+	},
+}
+
+// shipmentDerivedStatuses can only be entered by adding shipments, never set
+// directly.
+var shipmentDerivedStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPartiallyShipped: true,
+	models.OrderStatusShipped:          true,
+}
+
+// refundDerivedStatuses can only be entered by recording refunds, so the
+// order's payment status and refunded total always match its ledger. Partial
+// refunds now show only in the payment status; partially_refunded remains for
+// orders recorded that way before.
+var refundDerivedStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPartiallyRefunded: true,
+	models.OrderStatusRefunded:          true,
+}
+
+// derivedStatusError rejects setting a status directly that only shipments
+// or refunds may set.
+func derivedStatusError(to models.OrderStatus) error {
+	switch {
+	case shipmentDerivedStatuses[to]:
+		return fmt.Errorf("%w: %s is set by adding shipments", ErrOrderStatusDerived, to)
+	case refundDerivedStatuses[to]:
+		return fmt.Errorf("%w: %s is set by recording refunds", ErrOrderStatusDerived, to)
+	}
+	return nil
+}
+
+// editableOrderFields are the fields that may be changed on an order outside
+// the state machine. Pricing, items and status are never raw-editable.
+var editableOrderFields = map[string]bool{
+	"shipping_address": true,
+	"billing_address":  true,
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another.
+func CanTransitionOrder(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedOrderTransitions lists the statuses an order in status from may move to.
+func AllowedOrderTransitions(from models.OrderStatus) []models.OrderStatus {
+	return orderTransitions[from]
+}
+
+// TransitionOrderStatusService validates and applies a status change together
+// with its side-effects (restock on cancel, payment status on paid) and
+// records it on the order timeline as done by actor.
+// Illegal or concurrently-raced transitions return ErrInvalidOrderTransition;
+// statuses set by shipments or refunds return ErrOrderStatusDerived.
+func TransitionOrderStatusService(idHex string, to models.OrderStatus, actor models.OrderActor) (*models.Order, error) {
+	if err := derivedStatusError(to); err != nil {
+		return nil, err
+	}
+	return transitionOrderStatus(idHex, to, actor)
+}
+
+// transitionOrderStatus applies a status change the state machine allows,
+// including those TransitionOrderStatusService refuses to set directly.
+func transitionOrderStatus(idHex string, to models.OrderStatus, actor models.OrderActor) (*models.Order, error) {
+	order, err := repositories.GetOrderByID(context.Background(), idHex)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if !CanTransitionOrder(order.Status, to) {
+		return nil, fmt.Errorf("%w: %s → %s", ErrInvalidOrderTransition, order.Status, to)
+	}
+
+	if err := commitSteps(orderTransitionSteps(order, to, actor)); err != nil {
+		return nil, err
+	}
+	return GetOrderByIDService(idHex)
+}
+
+// orderTransitionSteps builds the writes for a transition: the guarded status
+// update first, then any side-effects of entering the new status, then the
+// timeline event.
+func orderTransitionSteps(order *models.Order, to models.OrderStatus, actor models.OrderActor) []writeStep {
+	from := order.Status
+	set := bson.M{"updated_at": time.Now()}
+	switch to {
+	case models.OrderStatusPaid:
+		set["payment_status"] = models.PaymentStatusPaid
+	case models.OrderStatusCancelled:
+		set["inventory_committed"] = false
+	}
+	if from == models.OrderStatusReview && order.Risk != nil {
+		set["risk.reviewed_by"] = actor
+		set["risk.reviewed_at"] = set["updated_at"]
+	}
+
+	steps := []writeStep{{
+		name: "update order status",
+		apply: func(ctx context.Context) error {
+			res, err := repositories.UpdateOrderStatus(ctx, order.ID, from, to, set)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return fmt.Errorf("%w: order is no longer %s", ErrInvalidOrderTransition, from)
+			}
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			restore := bson.M{
+				"status":              from,
+				"payment_status":      order.PaymentStatus,
+				"inventory_committed": order.InventoryCommitted,
+			}
+			if _, reviewed := set["risk.reviewed_at"]; reviewed {
+				restore["risk.reviewed_by"] = order.Risk.ReviewedBy
+				restore["risk.reviewed_at"] = order.Risk.ReviewedAt
+			}
+			_, err := repositories.SetOrderFields(ctx, order.ID, restore)
+			return err
+		},
+	}}
+
+	if to == models.OrderStatusCancelled {
+		if order.InventoryCommitted {
+			steps = append(steps, restockSteps(order.Items)...)
+		}
+		// Cancelled is terminal, so the uses can only be given back once
+		steps = append(steps, releaseDiscountUsageSteps(order)...)
+	}
+
+	changes := map[string]models.OrderFieldChange{
+		"status": {Before: from, After: to},
+	}
+	if ps, ok := set["payment_status"]; ok && ps != order.PaymentStatus {
+		changes["payment_status"] = models.OrderFieldChange{Before: order.PaymentStatus, After: ps}
+	}
+	steps = append(steps, orderEventStep(newOrderEvent(order, models.OrderEventStatusChanged, actor, "", changes)))
+	return steps
+}
+
+// restockSteps puts every product line of an order back into stock.
+func restockSteps(items []models.OrderItem) []writeStep {
+	var steps []writeStep
+	for _, item := range items {
+		if item.Custom {
+			continue
+		}
+		item := item
+		steps = append(steps, writeStep{
+			name: "restock item",
+			apply: func(ctx context.Context) error {
+				if item.VariantID.IsZero() {
+					return RestoreProductStock(ctx, item.ProductID, item.Quantity)
+				}
+				return RestoreVariantStock(ctx, item.ProductID, item.VariantID, item.Quantity)
+			},
+			undo: func(ctx context.Context) error {
+				if item.VariantID.IsZero() {
+					_, err := repositories.IncrementProductStock(ctx, item.ProductID, -item.Quantity)
+					return err
+				}
+				_, err := repositories.IncrementVariantStock(ctx, item.ProductID, item.VariantID, -item.Quantity)
+				return err
+			},
+		})
+	}
+	return steps
+}
+
+// releaseDiscountUsageSteps gives back every discount use the order recorded,
+// so per-customer and total usage limits are restored.
+func releaseDiscountUsageSteps(order *models.Order) []writeStep {
+	var steps []writeStep
+	for _, usage := range order.DiscountUsages {
+		usage := usage
+		steps = append(steps, writeStep{
+			name: "release discount usage",
+			apply: func(ctx context.Context) error {
+				return ReleaseDiscountUsage(ctx, usage.DiscountID, order.CustomerID, usage.Amount)
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.IncrementDiscountUsage(ctx, usage.DiscountID, order.CustomerID, usage.Amount)
+				return err
+			},
+		})
+	}
+	return steps
+}
+
+// ApplyOrderUpdateService applies a PATCH-style update to an order. A "status"
+// key goes through the state machine; any other key must be an editable field.
+// All keys are validated before anything is written, the edits and the status
+// change are written as one unit, and every change is recorded on the order
+// timeline as done by actor.
+func ApplyOrderUpdateService(idHex string, updates bson.M, actor models.OrderActor) (*models.Order, error) {
+	var target models.OrderStatus
+	details := bson.M{}
+	for k, v := range updates {
+		if k == "status" {
+			s, ok := v.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("%w: status must be a string", ErrOrderFieldNotEditable)
+			}
+			target = models.OrderStatus(s)
+			continue
+		}
+		if !editableOrderFields[k] {
+			return nil, fmt.Errorf("%w: %s", ErrOrderFieldNotEditable, k)
+		}
+		details[k] = v
+	}
+
+	order, err := repositories.GetOrderByID(context.Background(), idHex)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if target != "" && target != order.Status {
+		if err := derivedStatusError(target); err != nil {
+			return nil, err
+		}
+	}
+	if target != "" && target != order.Status && !CanTransitionOrder(order.Status, target) {
+		return nil, fmt.Errorf("%w: %s → %s", ErrInvalidOrderTransition, order.Status, target)
+	}
+
+	// The guarded status change goes first, as the write most likely to fail
+	var steps []writeStep
+	if target != "" && target != order.Status {
+		steps = append(steps, orderTransitionSteps(order, target, actor)...)
+	}
+	if len(details) > 0 {
+		changes := map[string]models.OrderFieldChange{}
+		for k, v := range details {
+			changes[k] = models.OrderFieldChange{Before: orderFieldValue(order, k), After: v}
+		}
+		details["updated_at"] = time.Now()
+		steps = append(steps,
+			writeStep{
+				name: "edit order",
+				apply: func(ctx context.Context) error {
+					_, err := repositories.SetOrderFields(ctx, order.ID, details)
+					return err
+				},
+				undo: func(ctx context.Context) error {
+					before := bson.M{"updated_at": order.UpdatedAt}
+					for k, change := range changes {
+						before[k] = change.Before
+					}
+					_, err := repositories.SetOrderFields(ctx, order.ID, before)
+					return err
+				},
+			},
+			orderEventStep(newOrderEvent(order, models.OrderEventEdited, actor, "", changes)),
+		)
+	}
+	if len(steps) > 0 {
+		if err := commitSteps(steps); err != nil {
+			return nil, err
+		}
+	}
+	return GetOrderByIDService(idHex)
+}
+
+// orderFieldValue returns the current value of an editable order field.
+func orderFieldValue(order *models.Order, field string) interface{} {
+	switch field {
+	case "shipping_address":
+		return order.ShippingAddress
+	case "billing_address":
+		return order.BillingAddress
+	}
+	return nil
+}
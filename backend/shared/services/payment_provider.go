@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment webhook event types providers translate their notifications into.
+const (
+	PaymentEventSucceeded = "payment.succeeded"
+	PaymentEventFailed    = "payment.failed"
+)
+
+// PaymentIntent is what a provider hands back when a payment is started:
+// its reference for the payment and what the customer needs to do next.
+type PaymentIntent struct {
+	Reference    string
+	Instructions string
+	RedirectURL  string
+}
+
+// PaymentWebhookEvent is a verified provider notification about a payment.
+type PaymentWebhookEvent struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// PaymentProvider takes payments for orders. Providers are looked up by Name,
+// which is also what shops list in their payment methods.
+type PaymentProvider interface {
+	Name() string
+	// CreateIntent starts a payment of amount for the order: its total, or
+	// what is still owed on it after an edit.
+	CreateIntent(ctx context.Context, order *models.Order, amount money.Amount) (*PaymentIntent, error)
+	// Capture collects a payment that was authorised or promised.
+	Capture(ctx context.Context, payment *models.Payment) error
+	// Refund pays part or all of a payment back and returns the provider's
+	// reference for the refund.
+	Refund(ctx context.Context, payment *models.Payment, refund *models.Refund) (string, error)
+	// VerifyWebhook checks a notification's signature and decodes it.
+	VerifyWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error)
+}
+
+// ManualPaymentProviderName is the provider every shop can use: cash on
+// delivery or bank transfer, confirmed by the seller.
+const ManualPaymentProviderName = "manual"
+
+var (
+	paymentProvidersMu sync.RWMutex
+	paymentProviders   = map[string]PaymentProvider{
+		ManualPaymentProviderName: manualPaymentProvider{},
+		"mock":                    mockPaymentProvider{},
+	}
+)
+
+// RegisterPaymentProvider adds a provider, replacing any with the same name.
+func RegisterPaymentProvider(p PaymentProvider) {
+	paymentProvidersMu.Lock()
+	defer paymentProvidersMu.Unlock()
+	paymentProviders[strings.ToLower(p.Name())] = p
+}
+
+// PaymentProviderByName returns a registered provider, or nil.
+func PaymentProviderByName(name string) PaymentProvider {
+	paymentProvidersMu.RLock()
+	defer paymentProvidersMu.RUnlock()
+	return paymentProviders[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// manualPaymentProvider records payments made outside the platform. Nothing
+// happens until the seller captures the payment on receiving the money.
+type manualPaymentProvider struct{}
+
+func (manualPaymentProvider) Name() string { return ManualPaymentProviderName }
+
+func (manualPaymentProvider) CreateIntent(ctx context.Context, order *models.Order, amount money.Amount) (*PaymentIntent, error) {
+	return &PaymentIntent{
+		Reference:    "manual_" + primitive.NewObjectID().Hex(),
+		Instructions: "Pay on delivery or by bank transfer quoting order " + order.OrderNumber + ". The shop confirms the payment once it is received.",
+	}, nil
+}
+
+func (manualPaymentProvider) Capture(ctx context.Context, payment *models.Payment) error {
+	return nil
+}
+
+func (manualPaymentProvider) Refund(ctx context.Context, payment *models.Payment, refund *models.Refund) (string, error) {
+	return "", nil
+}
+
+func (manualPaymentProvider) VerifyWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	return nil, errors.New("manual payments have no webhooks")
+}
+
+// mockPaymentProvider is a local stand-in for a card provider, for tests and
+// development. Payments complete when a webhook signed with
+// MOCK_PAYMENT_WEBHOOK_SECRET reports them: the X-Mock-Signature header is
+// the hex HMAC-SHA256 of the body.
+type mockPaymentProvider struct{}
+
+// MockPaymentSignatureHeader carries a mock webhook's signature.
+const MockPaymentSignatureHeader = "X-Mock-Signature"
+
+func (mockPaymentProvider) Name() string { return "mock" }
+
+func (mockPaymentProvider) CreateIntent(ctx context.Context, order *models.Order, amount money.Amount) (*PaymentIntent, error) {
+	return &PaymentIntent{
+		Reference:    "mock_pi_" + primitive.NewObjectID().Hex(),
+		Instructions: "Test payment: send a signed payment.succeeded webhook to complete it.",
+	}, nil
+}
+
+func (mockPaymentProvider) Capture(ctx context.Context, payment *models.Payment) error {
+	return nil
+}
+
+func (mockPaymentProvider) Refund(ctx context.Context, payment *models.Payment, refund *models.Refund) (string, error) {
+	return "mock_re_" + primitive.NewObjectID().Hex(), nil
+}
+
+func (mockPaymentProvider) VerifyWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	secret := os.Getenv("MOCK_PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("MOCK_PAYMENT_WEBHOOK_SECRET is not set")
+	}
+	got, err := hex.DecodeString(header.Get(MockPaymentSignatureHeader))
+	if err != nil || len(got) == 0 {
+		return nil, errors.New("missing or malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, errors.New("signature mismatch")
+	}
+	var event PaymentWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.Reference == "" {
+		return nil, errors.New("event has no payment reference")
+	}
+	return &event, nil
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrPaymentProviderUnknown = errors.New("unknown payment provider")
+var ErrPaymentMethodNotEnabled = errors.New("payment method is not enabled for this shop")
+var ErrOrderNotPayable = errors.New("order cannot be paid")
+var ErrPaymentNotFound = errors.New("payment not found")
+var ErrPaymentWebhookInvalid = errors.New("invalid payment webhook")
+
+// ShopPaymentMethods lists the registered providers a shop accepts. Shops
+// that have not chosen any accept manual payment.
+func ShopPaymentMethods(shop *models.Shop) []string {
+	var methods []string
+	for _, name := range shop.PaymentMethods {
+		if p := PaymentProviderByName(name); p != nil {
+			methods = append(methods, p.Name())
+		}
+	}
+	if len(methods) == 0 {
+		methods = []string{ManualPaymentProviderName}
+	}
+	return methods
+}
+
+// ValidateShopPaymentMethods checks that every name is a registered provider.
+func ValidateShopPaymentMethods(names []string) error {
+	for _, name := range names {
+		if PaymentProviderByName(name) == nil {
+			return fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, name)
+		}
+	}
+	return nil
+}
+
+func shopAcceptsPaymentMethod(shop *models.Shop, provider string) bool {
+	for _, m := range ShopPaymentMethods(shop) {
+		if strings.EqualFold(m, provider) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListOrderPaymentsService returns an order's payment attempts, oldest first.
+func ListOrderPaymentsService(orderID primitive.ObjectID) ([]models.Payment, error) {
+	out, err := repositories.ListPaymentsByOrder(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.Payment{}
+	}
+	return out, nil
+}
+
+// payableAmount is what a payment for the order should collect: the total
+// while it is unpaid, or the amount due after an edit raised a paid order's
+// total. Zero means there is nothing to pay.
+func payableAmount(order *models.Order) money.Amount {
+	if order.Status == models.OrderStatusPending {
+		return order.Total
+	}
+	if order.AmountDue > 0 && editableOrderStatuses[order.Status] {
+		return order.AmountDue
+	}
+	return 0
+}
+
+// StartOrderPaymentService starts paying for a pending order, or for what an
+// edited order still owes, with one of the shop's payment providers and
+// records it as the order's payment method. If a payment with that provider
+// is already under way it is returned instead of starting another.
+func StartOrderPaymentService(shop *models.Shop, order *models.Order, providerName string, actor models.OrderActor) (*models.Payment, error) {
+	ctx := context.Background()
+	amount := payableAmount(order)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotPayable, order.Status)
+	}
+	provider := PaymentProviderByName(providerName)
+	if provider == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, providerName)
+	}
+	if !shopAcceptsPaymentMethod(shop, provider.Name()) {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentMethodNotEnabled, provider.Name())
+	}
+
+	existing, err := repositories.ListPaymentsByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range existing {
+		if existing[i].Provider == provider.Name() && existing[i].Status == models.PaymentAttemptPending {
+			return &existing[i], nil
+		}
+	}
+
+	intent, err := provider.CreateIntent(ctx, order, amount)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	payment := &models.Payment{
+		ID:           primitive.NewObjectID(),
+		ShopID:       order.ShopID,
+		OrderID:      order.ID,
+		Provider:     provider.Name(),
+		Reference:    intent.Reference,
+		Amount:       amount,
+		Currency:     shop.Currency,
+		Status:       models.PaymentAttemptPending,
+		Instructions: intent.Instructions,
+		RedirectURL:  intent.RedirectURL,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	changes := map[string]models.OrderFieldChange{}
+	if order.PaymentMethod != payment.Provider {
+		changes["payment_method"] = models.OrderFieldChange{Before: order.PaymentMethod, After: payment.Provider}
+	}
+	err = commitSteps([]writeStep{
+		{
+			name: "record payment",
+			apply: func(ctx context.Context) error {
+				return repositories.CreatePayment(ctx, payment)
+			},
+			undo: func(ctx context.Context) error {
+				return repositories.DeletePayment(ctx, payment.ID)
+			},
+		},
+		{
+			name: "set payment method",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.SetOrderFields(ctx, order.ID, bson.M{"payment_method": payment.Provider, "updated_at": now})
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.SetOrderFields(ctx, order.ID, bson.M{"payment_method": order.PaymentMethod, "updated_at": order.UpdatedAt})
+				return err
+			},
+		},
+		orderEventStep(newOrderEvent(order, models.OrderEventPayment, actor,
+			"Payment started with "+payment.Provider, changes)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// CapturePaymentService collects the order's pending payment, e.g. a seller
+// confirming cash on delivery, and marks the order paid.
+func CapturePaymentService(order *models.Order, actor models.OrderActor) (*models.Payment, error) {
+	ctx := context.Background()
+	payments, err := repositories.ListPaymentsByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	var payment *models.Payment
+	for i := len(payments) - 1; i >= 0; i-- {
+		if payments[i].Status == models.PaymentAttemptPending {
+			payment = &payments[i]
+			break
+		}
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("%w: order has no pending payment", ErrPaymentNotFound)
+	}
+	provider := PaymentProviderByName(payment.Provider)
+	if provider == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, payment.Provider)
+	}
+	if err := provider.Capture(ctx, payment); err != nil {
+		return nil, err
+	}
+	if err := paymentSucceeded(order, payment, actor); err != nil {
+		return nil, err
+	}
+	payment.Status = models.PaymentAttemptSucceeded
+	return payment, nil
+}
+
+// HandlePaymentWebhookService verifies a provider notification for one of the
+// shop's payments and applies it. Redelivered notifications are harmless.
+func HandlePaymentWebhookService(shop *models.Shop, providerName string, header http.Header, body []byte) error {
+	provider := PaymentProviderByName(providerName)
+	if provider == nil {
+		return fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, providerName)
+	}
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentWebhookInvalid, err)
+	}
+
+	ctx := context.Background()
+	payment, err := repositories.GetPaymentByReference(ctx, provider.Name(), event.Reference)
+	if err != nil {
+		return err
+	}
+	if payment == nil || payment.ShopID != shop.ID {
+		return fmt.Errorf("%w: %s", ErrPaymentNotFound, event.Reference)
+	}
+	order, err := repositories.GetOrderByID(ctx, payment.OrderID.Hex())
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+
+	actor := models.OrderActor{Role: models.OrderActorSystem}
+	switch event.Type {
+	case PaymentEventSucceeded:
+		return paymentSucceeded(order, payment, actor)
+	case PaymentEventFailed:
+		return paymentFailed(order, payment, event.Reason, actor)
+	}
+	// Event types we do not act on are acknowledged so the provider stops
+	// redelivering them
+	return nil
+}
+
+// paymentSucceeded marks a payment succeeded and moves its order to paid, or
+// takes it off the order's amount due if it paid for an edit. If the order
+// was cancelled while the customer paid, the payment is kept and flagged on
+// the timeline for the seller to refund.
+func paymentSucceeded(order *models.Order, payment *models.Payment, actor models.OrderActor) error {
+	ctx := context.Background()
+	res, err := repositories.UpdatePaymentStatus(ctx, payment.ID, models.PaymentAttemptPending, models.PaymentAttemptSucceeded,
+		bson.M{"updated_at": time.Now()})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// Already settled by an earlier delivery of the same event
+		return nil
+	}
+
+	if order.Status == models.OrderStatusPending {
+		_, err := TransitionOrderStatusService(order.ID.Hex(), models.OrderStatusPaid, actor)
+		if err == nil || !errors.Is(err, ErrInvalidOrderTransition) {
+			return err
+		}
+		// The order moved on concurrently; reload to see where it went
+		fresh, err := repositories.GetOrderByID(ctx, order.ID.Hex())
+		if err != nil {
+			return err
+		}
+		if fresh != nil {
+			order = fresh
+		}
+	} else if order.AmountDue > 0 && order.Status != models.OrderStatusCancelled {
+		return settleAmountDue(order, payment, actor)
+	}
+	if order.Status != models.OrderStatusCancelled {
+		return nil
+	}
+
+	message := fmt.Sprintf("Payment %s received through %s after the order was cancelled; refund the customer", payment.Reference, payment.Provider)
+	log.Printf("payments: order %s: %s", order.ID.Hex(), message)
+	// A note, not a payment event, so only the seller sees it
+	return commitSteps([]writeStep{orderEventStep(newOrderEvent(order, models.OrderEventNote, actor, message, nil))})
+}
+
+// settleAmountDue takes a payment off what an edited order still owes.
+func settleAmountDue(order *models.Order, payment *models.Payment, actor models.OrderActor) error {
+	ctx := context.Background()
+	for attempt := 0; attempt < 3; attempt++ {
+		paid := money.Min(payment.Amount, order.AmountDue)
+		res, err := repositories.AdjustOrderAmountDue(ctx, order.ID, order.AmountDue, -paid)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount > 0 {
+			changes := map[string]models.OrderFieldChange{
+				"amount_due": amountChange(order.AmountDue, order.AmountDue-paid),
+			}
+			return commitSteps([]writeStep{orderEventStep(newOrderEvent(order, models.OrderEventPayment, actor,
+				fmt.Sprintf("Received %s owed after the order was edited", paid), changes))})
+		}
+		// The amount due moved concurrently; settle against the new amount
+		fresh, err := repositories.GetOrderByID(ctx, order.ID.Hex())
+		if err != nil {
+			return err
+		}
+		if fresh == nil || fresh.AmountDue <= 0 {
+			return nil
+		}
+		order = fresh
+	}
+	return fmt.Errorf("payments: could not settle amount due on order %s", order.ID.Hex())
+}
+
+// paymentFailed marks a payment failed. The order stays pending so the
+// customer can try again.
+func paymentFailed(order *models.Order, payment *models.Payment, reason string, actor models.OrderActor) error {
+	ctx := context.Background()
+	res, err := repositories.UpdatePaymentStatus(ctx, payment.ID, models.PaymentAttemptPending, models.PaymentAttemptFailed,
+		bson.M{"failure_reason": reason, "updated_at": time.Now()})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return nil
+	}
+	message := "Payment failed"
+	if reason != "" {
+		message += ": " + reason
+	}
+	return commitSteps([]writeStep{orderEventStep(newOrderEvent(order, models.OrderEventPayment, actor, message, nil))})
+}
+
+// paymentRefundProcessor sends refunds back through the provider that took
+// the order's payment. Orders paid outside any provider are refunded manually.
+type paymentRefundProcessor struct{}
+
+func (paymentRefundProcessor) ProcessRefund(order *models.Order, refund *models.Refund) (string, string, error) {
+	ctx := context.Background()
+	payment, provider, err := refundPayment(ctx, order)
+	if err != nil {
+		return "", "", err
+	}
+	if payment == nil {
+		return manualRefundProcessor{}.ProcessRefund(order, refund)
+	}
+	reference, err := provider.Refund(ctx, payment, refund)
+	return provider.Name(), reference, err
+}
+
+// CheckAutomaticRefund returns ErrRefundNotAutomatic unless the order's
+// payment goes back through a provider, without the seller paying it back.
+func (paymentRefundProcessor) CheckAutomaticRefund(order *models.Order) error {
+	payment, provider, err := refundPayment(context.Background(), order)
+	if err != nil {
+		return err
+	}
+	if payment == nil || provider.Name() == ManualPaymentProviderName {
+		return ErrRefundNotAutomatic
+	}
+	return nil
+}
+
+// refundPayment returns the order's latest succeeded payment, which refunds go
+// back through, and its provider. Both are nil if the order was paid outside
+// any provider.
+func refundPayment(ctx context.Context, order *models.Order) (*models.Payment, PaymentProvider, error) {
+	payments, err := repositories.ListPaymentsByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(payments) - 1; i >= 0; i-- {
+		payment := &payments[i]
+		if payment.Status != models.PaymentAttemptSucceeded {
+			continue
+		}
+		provider := PaymentProviderByName(payment.Provider)
+		if provider == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrPaymentProviderUnknown, payment.Provider)
+		}
+		return payment, provider, nil
+	}
+	return nil, nil, nil
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
 
 	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
 	"github.com/Endale2/DRPS/shared/repositories"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,6 +15,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var ErrProductNotFound = errors.New("product not found")
+var ErrVariantNotFound = errors.New("variant not found")
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 // slugify takes a name (e.g. "Catan Base Game") and returns
 // a simple URL‑friendly slug ("catan-base-game").
 func slugify(name string) string {
@@ -130,9 +136,13 @@ func GetAllProductsService() ([]models.Product, error) {
 }
 
 // UpdateProductService updates fields by ID. It also handles recalculating
-// the total stock if the variants are updated.
+// the total stock if the variants are updated. Prices decoded from JSON as
+// numbers are stored as exact amounts.
 func UpdateProductService(id string, updatedData bson.M) (*mongo.UpdateResult, error) {
 	updatedData["updatedAt"] = time.Now()
+	if priceF, ok := updatedData["price"].(float64); ok {
+		updatedData["price"] = money.FromFloat(priceF, money.HalfUp)
+	}
 
 	if newName, ok := updatedData["name"].(string); ok && strings.TrimSpace(newName) != "" {
 		updatedData["slug"] = slugify(newName)
@@ -141,7 +151,7 @@ func UpdateProductService(id string, updatedData bson.M) (*mongo.UpdateResult, e
 	// If variants are updated, we expect each to include an 'options' array
 	if rawVariants, ok := updatedData["variants"].([]interface{}); ok {
 		totalStock := 0
-		minPrice := 0.0
+		var minPrice money.Amount
 		for idx, rv := range rawVariants {
 			if vMap, isMap := rv.(map[string]interface{}); isMap {
 				// Convert the incoming 'options' field to []Option
@@ -157,8 +167,10 @@ func UpdateProductService(id string, updatedData bson.M) (*mongo.UpdateResult, e
 					rawVariants[idx].(map[string]interface{})["options"] = opts
 				}
 				if priceF, hasPrice := vMap["price"].(float64); hasPrice {
-					if idx == 0 || priceF < minPrice {
-						minPrice = priceF
+					price := money.FromFloat(priceF, money.HalfUp)
+					vMap["price"] = price
+					if idx == 0 || price < minPrice {
+						minPrice = price
 					}
 				}
 				if stockF, hasStock := vMap["stock"].(float64); hasStock {
@@ -241,75 +253,58 @@ func GetProductBySlugService(slug string) (*models.Product, error) {
 	return p, nil
 }
 
-// ReduceProductStock reduces stock for a product (no variants)
-func ReduceProductStock(productID primitive.ObjectID, quantity int) error {
-	// Get current product
-	product, err := repositories.GetProductByID(productID.Hex())
+// ReduceProductStock reduces stock for a product (no variants). The decrement is
+// conditional on enough stock being left, so concurrent orders cannot oversell.
+func ReduceProductStock(ctx context.Context, productID primitive.ObjectID, quantity int) error {
+	res, err := repositories.DecrementProductStock(ctx, productID, quantity)
 	if err != nil {
 		return err
 	}
-	if product == nil {
-		return errors.New("product not found")
-	}
-
-	// Check if we have enough stock
-	if product.Stock < quantity {
-		return errors.New("insufficient stock")
+	if res.MatchedCount == 0 {
+		return stockMissError(productID, primitive.NilObjectID)
 	}
-
-	// Update stock
-	newStock := product.Stock - quantity
-	_, err = repositories.UpdateProduct(productID.Hex(), bson.M{
-		"stock":     newStock,
-		"updatedAt": time.Now(),
-	})
-	return err
+	return nil
 }
 
-// ReduceVariantStock reduces stock for a specific variant
-func ReduceVariantStock(productID, variantID primitive.ObjectID, quantity int) error {
-	// Get current product
-	product, err := repositories.GetProductByID(productID.Hex())
+// ReduceVariantStock reduces stock for a specific variant, guarded the same way
+// as ReduceProductStock.
+func ReduceVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	res, err := repositories.DecrementVariantStock(ctx, productID, variantID, quantity)
 	if err != nil {
 		return err
 	}
-	if product == nil {
-		return errors.New("product not found")
+	if res.MatchedCount == 0 {
+		return stockMissError(productID, variantID)
 	}
+	return nil
+}
 
-	// Find the variant
-	var targetVariant *models.Variant
-	for i := range product.Variants {
-		if product.Variants[i].VariantID == variantID {
-			targetVariant = &product.Variants[i]
-			break
-		}
-	}
-	if targetVariant == nil {
-		return errors.New("variant not found")
+// stockMissError explains why a guarded decrement matched nothing.
+func stockMissError(productID, variantID primitive.ObjectID) error {
+	product, err := repositories.GetProductByID(productID.Hex())
+	if err != nil || product == nil {
+		return ErrProductNotFound
 	}
-
-	// Check if we have enough stock
-	if targetVariant.Stock < quantity {
-		return errors.New("insufficient stock for variant")
+	if variantID.IsZero() {
+		return ErrInsufficientStock
 	}
-
-	// Update variant stock
-	targetVariant.Stock -= quantity
-	targetVariant.UpdatedAt = time.Now()
-
-	// Recalculate total stock
-	totalStock := 0
 	for _, v := range product.Variants {
-		totalStock += v.Stock
+		if v.VariantID == variantID {
+			return ErrInsufficientStock
+		}
 	}
+	return ErrVariantNotFound
+}
+
+// RestoreProductStock puts quantity back on a product's stock.
+func RestoreProductStock(ctx context.Context, productID primitive.ObjectID, quantity int) error {
+	_, err := repositories.IncrementProductStock(ctx, productID, quantity)
+	return err
+}
 
-	// Update product with new variant stock and total stock
-	_, err = repositories.UpdateProduct(productID.Hex(), bson.M{
-		"variants":  product.Variants,
-		"stock":     totalStock,
-		"updatedAt": time.Now(),
-	})
+// RestoreVariantStock puts quantity back on a variant's stock.
+func RestoreVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	_, err := repositories.IncrementVariantStock(ctx, productID, variantID, quantity)
 	return err
 }
 
@@ -460,7 +455,44 @@ func GetActiveDiscountsForProductAPI(shopID, productID primitive.ObjectID, varia
 	return apiDiscounts, nil
 }
 
+// ProductToAPIResponse converts a product to API response format, with stock
+// shown as available to sell.
 func ProductToAPIResponse(p *models.Product) map[string]interface{} {
+	held, err := repositories.SumActiveReservationsByVariant(context.Background(), p.ID, primitive.NilObjectID)
+	if err != nil {
+		held = map[primitive.ObjectID]int{}
+	}
+	return productToAPIResponse(p, held)
+}
+
+// ProductsToAPIResponse converts a page of products to API response format,
+// reading the stock held for all of them in one query.
+func ProductsToAPIResponse(products []models.Product) []map[string]interface{} {
+	held := productHolds(products)
+	out := make([]map[string]interface{}, 0, len(products))
+	for i := range products {
+		out = append(out, productToAPIResponse(&products[i], held[products[i].ID]))
+	}
+	return out
+}
+
+// productHolds returns the active holds on products, keyed by product ID and
+// then by variant ID. If they cannot be read, nothing is subtracted.
+func productHolds(products []models.Product) map[primitive.ObjectID]map[primitive.ObjectID]int {
+	ids := make([]primitive.ObjectID, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	held, err := repositories.SumActiveReservationsByProducts(context.Background(), ids)
+	if err != nil {
+		return map[primitive.ObjectID]map[primitive.ObjectID]int{}
+	}
+	return held
+}
+
+// productToAPIResponse builds the response for a product whose holds, keyed
+// by variant ID, have already been read.
+func productToAPIResponse(p *models.Product, held map[primitive.ObjectID]int) map[string]interface{} {
 	// Convert collection IDs to hex strings
 	var collectionIDs []string
 	for _, id := range p.CollectionIDs {
@@ -495,10 +527,12 @@ func ProductToAPIResponse(p *models.Product) map[string]interface{} {
 		}
 	}
 
+	// Stock shown to shoppers is available-to-sell: on hand minus active checkout holds
 	if hasRealVariants {
 		// Product has real variants - include variant information
 		realVariants := []models.Variant{}
 		for _, v := range p.Variants {
+			v.Stock = availableAfterHolds(v.Stock, held[v.VariantID])
 			realVariants = append(realVariants, v)
 		}
 
@@ -519,10 +553,18 @@ func ProductToAPIResponse(p *models.Product) map[string]interface{} {
 
 	// No real variants: treat as simple product (no variants array)
 	resp["price"] = p.Price
-	resp["stock"] = p.Stock
+	resp["stock"] = availableAfterHolds(p.Stock, held[primitive.NilObjectID])
 	return resp
 }
 
+// availableAfterHolds subtracts held units from stock, never going below zero.
+func availableAfterHolds(stock, held int) int {
+	if stock <= held {
+		return 0
+	}
+	return stock - held
+}
+
 // GetCollectionIDsForProduct returns the collection IDs that contain this product
 func GetCollectionIDsForProduct(productID primitive.ObjectID) ([]primitive.ObjectID, error) {
 	// Get the product and return its collection IDs directly
@@ -538,9 +580,22 @@ func GetCollectionIDsForProduct(productID primitive.ObjectID) ([]primitive.Objec
 
 // ProductToAPIResponseWithDiscounts converts a product to API response format and includes active discounts
 func ProductToAPIResponseWithDiscounts(p *models.Product) map[string]interface{} {
-	// Get base product response
-	resp := ProductToAPIResponse(p)
+	return withProductDiscounts(p, ProductToAPIResponse(p))
+}
+
+// ProductsToAPIResponseWithDiscounts converts a page of products to API
+// response format with their active discounts, reading the stock held for all
+// of them in one query.
+func ProductsToAPIResponseWithDiscounts(products []models.Product) []map[string]interface{} {
+	out := ProductsToAPIResponse(products)
+	for i := range products {
+		out[i] = withProductDiscounts(&products[i], out[i])
+	}
+	return out
+}
 
+// withProductDiscounts adds the product's active discounts to its response.
+func withProductDiscounts(p *models.Product, resp map[string]interface{}) map[string]interface{} {
 	// Get collection IDs for this product
 	collectionIDs, err := GetCollectionIDsForProduct(p.ID)
 	if err != nil {
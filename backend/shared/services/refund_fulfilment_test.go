@@ -0,0 +1,83 @@
+//go:build mongo
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A partial refund only changes the payment status: the order can still be
+// shipped and delivered afterwards.
+func TestPartialRefundThenShipAndDeliver(t *testing.T) {
+	requireMongo(t)
+
+	shop := &models.Shop{ID: primitive.NewObjectID(), Name: "Refund test"}
+	productID := primitive.NewObjectID()
+	now := time.Now()
+	order := &models.Order{
+		ID:            primitive.NewObjectID(),
+		ShopID:        shop.ID,
+		CustomerID:    primitive.NewObjectID(),
+		OrderNumber:   "1001",
+		Status:        models.OrderStatusPaid,
+		Items:         []models.OrderItem{{ProductID: productID, Name: "Mug", Quantity: 2, UnitPrice: 1500, TotalPrice: 3000}},
+		Subtotal:      3000,
+		Total:         3000,
+		PaymentMethod: "manual",
+		PaymentStatus: models.PaymentStatusPaid,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := repositories.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_, _ = config.GetCollection("DRPS", "orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+		for _, name := range []string{"order_events", "refunds", "shipments", "notifications"} {
+			_, _ = config.GetCollection("DRPS", name).DeleteMany(ctx, bson.M{"order_id": order.ID})
+		}
+	})
+	seller := models.OrderActor{Role: models.OrderActorSeller}
+
+	if _, err := IssueRefundService(order, RefundRequest{Type: models.RefundTypePartial, Amount: 500}, seller); err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	order = reloadOrder(t, order.ID)
+	if order.Status != models.OrderStatusPaid || order.PaymentStatus != models.PaymentStatusPartiallyRefunded {
+		t.Fatalf("after partial refund: status %s, payment %s; want paid, partially_refunded", order.Status, order.PaymentStatus)
+	}
+
+	shipment := ShipmentRequest{Carrier: "ups", TrackingNumber: "1Z999", Lines: []ShipmentLine{{ProductID: productID, Quantity: 2}}}
+	if _, err := CreateShipmentService(shop, order, shipment, seller); err != nil {
+		t.Fatalf("ship: %v", err)
+	}
+	if order = reloadOrder(t, order.ID); order.Status != models.OrderStatusShipped {
+		t.Fatalf("after shipping: status %s, want shipped", order.Status)
+	}
+
+	if _, err := TransitionOrderStatusService(order.ID.Hex(), models.OrderStatusDelivered, seller); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	order = reloadOrder(t, order.ID)
+	if order.Status != models.OrderStatusDelivered || order.PaymentStatus != models.PaymentStatusPartiallyRefunded {
+		t.Errorf("after delivery: status %s, payment %s; want delivered, partially_refunded", order.Status, order.PaymentStatus)
+	}
+}
+
+func reloadOrder(t *testing.T, id primitive.ObjectID) *models.Order {
+	t.Helper()
+	order, err := repositories.GetOrderByID(context.Background(), id.Hex())
+	if err != nil || order == nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	return order
+}
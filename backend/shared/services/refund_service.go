@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidRefund = errors.New("invalid refund")
+var ErrOrderNotRefundable = errors.New("order cannot be refunded")
+var ErrRefundConflict = errors.New("order was refunded concurrently, please retry")
+var ErrRefundFailed = errors.New("refund was declined by the payment provider")
+var ErrRefundNotAutomatic = errors.New("payment cannot be refunded automatically")
+
+// refundableOrderStatuses are the statuses in which money has been taken.
+var refundableOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPaid:              true,
+	models.OrderStatusProcessing:        true,
+	models.OrderStatusPartiallyShipped:  true,
+	models.OrderStatusShipped:           true,
+	models.OrderStatusDelivered:         true,
+	models.OrderStatusPartiallyRefunded: true,
+	models.OrderStatusCancelled:         true, // paid orders cancelled before shipping
+}
+
+// RefundProcessor sends a refund to whatever took the order's payment and
+// returns the provider's name and reference for it.
+type RefundProcessor interface {
+	ProcessRefund(order *models.Order, refund *models.Refund) (provider, reference string, err error)
+}
+
+// manualRefundProcessor records refunds the seller pays back outside the
+// platform (cash, bank transfer); it always succeeds.
+type manualRefundProcessor struct{}
+
+func (manualRefundProcessor) ProcessRefund(order *models.Order, refund *models.Refund) (string, string, error) {
+	return "manual", "", nil
+}
+
+var refundProcessor RefundProcessor = paymentRefundProcessor{}
+
+// automaticRefundChecker is implemented by refund processors that can tell,
+// before anything changes, whether an order's payment would go back to the
+// customer without the seller paying it back themselves.
+type automaticRefundChecker interface {
+	CheckAutomaticRefund(order *models.Order) error
+}
+
+// checkAutomaticRefund returns ErrRefundNotAutomatic if refunding the order
+// would be left to the seller. Processors that cannot tell are trusted.
+func checkAutomaticRefund(order *models.Order) error {
+	if c, ok := refundProcessor.(automaticRefundChecker); ok {
+		return c.CheckAutomaticRefund(order)
+	}
+	return nil
+}
+
+// SetRefundProcessor replaces how refunds are sent to the payment provider.
+func SetRefundProcessor(p RefundProcessor) {
+	refundProcessor = p
+}
+
+// RefundLineRequest asks to refund a quantity of one order line.
+type RefundLineRequest struct {
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Quantity  int
+}
+
+// RefundRequest describes a refund to issue. Amount is only used for partial
+// refunds and Lines only for line refunds. IncludeShipping adds whatever
+// shipping has not been refunded yet.
+type RefundRequest struct {
+	Type            models.RefundType
+	Amount          money.Amount
+	Lines           []RefundLineRequest
+	IncludeShipping bool
+	Reason          string
+	ReturnID        *primitive.ObjectID
+}
+
+// DerivePaymentStatus returns the payment status implied by how much of an
+// order's total has been refunded.
+func DerivePaymentStatus(total, refunded money.Amount) string {
+	switch {
+	case refunded <= 0:
+		return models.PaymentStatusPaid
+	case refunded >= total:
+		return models.PaymentStatusRefunded
+	default:
+		return models.PaymentStatusPartiallyRefunded
+	}
+}
+
+// ListOrderRefundsService returns an order's refund ledger, oldest first.
+func ListOrderRefundsService(orderID primitive.ObjectID) ([]models.Refund, error) {
+	out, err := repositories.ListRefunds(context.Background(), bson.M{"order_id": orderID})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.Refund{}
+	}
+	return out, nil
+}
+
+// IssueRefundService refunds money on an order. The ledger entry and the
+// order's refunded total are written first, as pending, so concurrent refunds
+// cannot exceed what was paid; then the refund is sent to the payment
+// provider. If the provider declines it, the entry is marked failed and the
+// order's refunded total is restored.
+func IssueRefundService(order *models.Order, req RefundRequest, actor models.OrderActor) (*models.Refund, error) {
+	ctx := context.Background()
+	if !refundableOrderStatuses[order.Status] || order.PaymentStatus == models.PaymentStatusPending || order.PaymentStatus == "" {
+		return nil, fmt.Errorf("%w: order is %s and payment is %q", ErrOrderNotRefundable, order.Status, order.PaymentStatus)
+	}
+
+	ledger, err := repositories.ListRefunds(ctx, bson.M{
+		"order_id": order.ID,
+		"status":   bson.M{"$ne": models.RefundStatusFailed},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refund, err := buildRefund(order, ledger, req)
+	if err != nil {
+		return nil, err
+	}
+	refund.Actor = actor
+
+	if req.ReturnID != nil {
+		ret, err := repositories.GetReturnByID(ctx, *req.ReturnID)
+		if err != nil {
+			return nil, err
+		}
+		if ret == nil || ret.OrderID != order.ID {
+			return nil, fmt.Errorf("%w: return does not belong to this order", ErrInvalidRefund)
+		}
+		if ret.Status != models.ReturnStatusApproved && ret.Status != models.ReturnStatusReceived {
+			return nil, fmt.Errorf("%w: only approved returns can be refunded", ErrInvalidRefund)
+		}
+		if ret.RefundID != nil {
+			return nil, fmt.Errorf("%w: return already has a refund", ErrInvalidRefund)
+		}
+	}
+
+	before := order.RefundedTotal
+	after := before + refund.Amount
+	err = commitSteps([]writeStep{
+		{
+			name: "record refund",
+			apply: func(ctx context.Context) error {
+				return repositories.CreateRefund(ctx, refund)
+			},
+			undo: func(ctx context.Context) error {
+				return repositories.DeleteRefund(ctx, refund.ID)
+			},
+		},
+		{
+			name: "reserve refund on order",
+			apply: func(ctx context.Context) error {
+				res, err := repositories.AdjustOrderRefundedTotal(ctx, order.ID, before, refund.Amount, order.PaymentStatus)
+				if err != nil {
+					return err
+				}
+				if res.MatchedCount == 0 {
+					return ErrRefundConflict
+				}
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.AdjustOrderRefundedTotal(ctx, order.ID, before+refund.Amount, -refund.Amount, order.PaymentStatus)
+				return err
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	provider, reference, procErr := refundProcessor.ProcessRefund(order, refund)
+	if procErr != nil {
+		if _, err := repositories.SetRefundOutcome(ctx, refund.ID, models.RefundStatusFailed, bson.M{"provider": provider, "failure_reason": procErr.Error()}); err != nil {
+			log.Printf("refund %s: could not mark failed: %v", refund.ID.Hex(), err)
+		}
+		if _, err := repositories.AdjustOrderRefundedTotal(ctx, order.ID, before+refund.Amount, -refund.Amount, order.PaymentStatus); err != nil {
+			log.Printf("refund %s: could not release reserved amount on order %s: %v", refund.ID.Hex(), order.ID.Hex(), err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRefundFailed, procErr)
+	}
+
+	refund.Status = models.RefundStatusSucceeded
+	refund.Provider = provider
+	refund.ProviderReference = reference
+	paymentStatus := DerivePaymentStatus(order.Total, after)
+
+	steps := []writeStep{
+		{
+			name: "complete refund",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.SetRefundOutcome(ctx, refund.ID, models.RefundStatusSucceeded, bson.M{"provider": provider, "provider_reference": reference})
+				return err
+			},
+		},
+		{
+			name: "update payment status",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.SetOrderFields(ctx, order.ID, bson.M{"payment_status": paymentStatus, "updated_at": time.Now()})
+				return err
+			},
+		},
+		orderEventStep(newOrderEvent(order, models.OrderEventRefund, actor,
+			fmt.Sprintf("Refunded %s", refund.Amount),
+			map[string]models.OrderFieldChange{
+				"refunded_total": amountChange(before, after),
+				"payment_status": {Before: order.PaymentStatus, After: paymentStatus},
+			})),
+	}
+	if req.ReturnID != nil {
+		returnID := *req.ReturnID
+		steps = append(steps, writeStep{
+			name: "link return",
+			apply: func(ctx context.Context) error {
+				_, err := repositories.SetReturnFields(ctx, returnID, bson.M{"refund_id": refund.ID, "updated_at": time.Now()})
+				return err
+			},
+		})
+	}
+	// The money has moved; these writes bring the records in line and are not
+	// undone if a later one fails.
+	if err := commitSteps(steps); err != nil {
+		log.Printf("refund %s: succeeded at provider but not fully recorded: %v", refund.ID.Hex(), err)
+	}
+
+	// Once nothing is left to refund the order is refunded. A partial refund
+	// shows only in the payment status, so the order keeps its place in
+	// fulfilment and can still be shipped and delivered.
+	if paymentStatus == models.PaymentStatusRefunded && order.Status != models.OrderStatusRefunded && CanTransitionOrder(order.Status, models.OrderStatusRefunded) {
+		if _, err := transitionOrderStatus(order.ID.Hex(), models.OrderStatusRefunded, actor); err != nil {
+			log.Printf("refund %s: could not mark order %s refunded: %v", refund.ID.Hex(), order.ID.Hex(), err)
+		}
+	}
+	return refund, nil
+}
+
+// buildRefund works out the amount and breakdown of a refund from what has
+// already been refunded on the order.
+func buildRefund(order *models.Order, ledger []models.Refund, req RefundRequest) (*models.Refund, error) {
+	var refundedShipping money.Amount
+	refundedQty := map[string]int{}
+	for _, r := range ledger {
+		refundedShipping += r.ShippingAmount
+		for _, line := range r.Lines {
+			refundedQty[orderLineKey(line.ProductID, line.VariantID)] += line.Quantity
+		}
+	}
+	remaining := order.Total - order.RefundedTotal
+	remainingShipping := money.Max(0, order.ShippingCost-refundedShipping)
+	if remaining <= 0 {
+		return nil, fmt.Errorf("%w: order is already fully refunded", ErrOrderNotRefundable)
+	}
+
+	now := time.Now()
+	refund := &models.Refund{
+		ID:        primitive.NewObjectID(),
+		ShopID:    order.ShopID,
+		OrderID:   order.ID,
+		Type:      req.Type,
+		Status:    models.RefundStatusPending,
+		Reason:    strings.TrimSpace(req.Reason),
+		ReturnID:  req.ReturnID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	switch req.Type {
+	case models.RefundTypeFull:
+		refund.Amount = remaining
+		refund.ShippingAmount = remainingShipping
+
+	case models.RefundTypePartial:
+		if req.Amount <= 0 {
+			return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidRefund)
+		}
+		refund.Amount = req.Amount
+		if req.IncludeShipping {
+			refund.ShippingAmount = remainingShipping
+			refund.Amount += remainingShipping
+		}
+
+	case models.RefundTypeLine:
+		if len(req.Lines) == 0 {
+			return nil, fmt.Errorf("%w: no lines to refund", ErrInvalidRefund)
+		}
+		items := map[string]models.OrderItem{}
+		for _, item := range order.Items {
+			items[orderLineKey(item.ProductID, item.VariantID)] = item
+		}
+		for _, line := range req.Lines {
+			key := orderLineKey(line.ProductID, line.VariantID)
+			item, ok := items[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: product %s is not in this order", ErrInvalidRefund, line.ProductID.Hex())
+			}
+			left := item.Quantity - refundedQty[key]
+			if line.Quantity <= 0 || line.Quantity > left {
+				return nil, fmt.Errorf("%w: at most %d of %s can be refunded", ErrInvalidRefund, left, item.Name)
+			}
+			// TotalPrice is after discounts, so refund what was actually paid per
+			// unit, plus its tax when that was charged on top. Each refund takes
+			// the line's share up to its units so far less what came before, so
+			// refunding every unit pays back exactly what the line cost
+			paid := item.TotalPrice
+			if order.Tax != nil && !order.Tax.PricesIncludeTax {
+				paid += item.TaxAmount
+			}
+			prior := refundedQty[key]
+			refundedQty[key] += line.Quantity
+			amount := paid.Part(refundedQty[key], item.Quantity, money.HalfUp) - paid.Part(prior, item.Quantity, money.HalfUp)
+			refund.Lines = append(refund.Lines, models.RefundLine{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Name:      item.Name,
+				Quantity:  line.Quantity,
+				Amount:    amount,
+			})
+			refund.Amount += amount
+		}
+		if req.IncludeShipping {
+			refund.ShippingAmount = remainingShipping
+			refund.Amount += remainingShipping
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: type must be full, partial or line", ErrInvalidRefund)
+	}
+
+	if refund.Amount <= 0 {
+		return nil, fmt.Errorf("%w: nothing to refund", ErrInvalidRefund)
+	}
+	if refund.Amount > remaining {
+		return nil, fmt.Errorf("%w: at most %s can still be refunded", ErrInvalidRefund, remaining)
+	}
+	return refund, nil
+}
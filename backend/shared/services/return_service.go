@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrReturnNotFound = errors.New("return not found")
+var ErrOrderNotReturnable = errors.New("order cannot be returned")
+var ErrInvalidReturnItems = errors.New("invalid return items")
+var ErrInvalidReturnTransition = errors.New("invalid return status transition")
+
+// returnableOrderStatuses are the order statuses in which the customer has
+// received goods that can be sent back.
+var returnableOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPartiallyShipped:  true,
+	models.OrderStatusShipped:           true,
+	models.OrderStatusDelivered:         true,
+	models.OrderStatusPartiallyRefunded: true,
+}
+
+// ReturnLine is a quantity of one order line the customer asks to return.
+type ReturnLine struct {
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Quantity  int
+}
+
+// ReturnMetrics summarises a shop's returns for analytics.
+type ReturnMetrics struct {
+	TotalReturns      int            `json:"total_returns"`
+	OpenReturns       int            `json:"open_returns"`
+	ReturnedUnits     int            `json:"returned_units"`
+	ReturnedValue     money.Amount   `json:"returned_value"`
+	OrdersWithReturns int            `json:"orders_with_returns"`
+	ReturnRate        float64        `json:"return_rate"`      // orders with a return / sold orders
+	UnitReturnRate    float64        `json:"unit_return_rate"` // returned units / sold units
+	Reasons           map[string]int `json:"reasons"`
+}
+
+// orderLineKey identifies an order line by product and variant.
+func orderLineKey(productID, variantID primitive.ObjectID) string {
+	return productID.Hex() + ":" + variantID.Hex()
+}
+
+// RequestReturnService opens a return for some of the customer's order lines.
+// Quantities may not exceed what was ordered minus what is already in other
+// (non-rejected) returns. The seller is notified.
+func RequestReturnService(shop *models.Shop, orderIDHex string, customerID primitive.ObjectID, lines []ReturnLine, reason string) (*models.ReturnRequest, error) {
+	ctx := context.Background()
+	order, err := repositories.GetOrderByID(ctx, orderIDHex)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.ShopID != shop.ID || order.CustomerID != customerID {
+		return nil, ErrOrderNotFound
+	}
+	if !returnableOrderStatuses[order.Status] {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotReturnable, order.Status)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidReturnItems)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrInvalidReturnItems)
+	}
+
+	remaining, err := returnableQuantities(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	ordered := map[string]models.OrderItem{}
+	for _, item := range order.Items {
+		ordered[orderLineKey(item.ProductID, item.VariantID)] = item
+	}
+
+	var items []models.ReturnItem
+	for _, line := range lines {
+		key := orderLineKey(line.ProductID, line.VariantID)
+		item, ok := ordered[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %s is not in this order", ErrInvalidReturnItems, line.ProductID.Hex())
+		}
+		if line.Quantity <= 0 || line.Quantity > remaining[key] {
+			return nil, fmt.Errorf("%w: at most %d of %s can be returned", ErrInvalidReturnItems, remaining[key], item.Name)
+		}
+		remaining[key] -= line.Quantity
+		items = append(items, models.ReturnItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      item.Name,
+			Quantity:  line.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	now := time.Now()
+	ret := &models.ReturnRequest{
+		ID:          primitive.NewObjectID(),
+		ShopID:      shop.ID,
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		CustomerID:  customerID,
+		Items:       items,
+		Reason:      reason,
+		Status:      models.ReturnStatusRequested,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	actor := models.OrderActor{Role: models.OrderActorCustomer, ID: customerID}
+	err = commitSteps([]writeStep{
+		{
+			name: "create return",
+			apply: func(ctx context.Context) error {
+				return repositories.CreateReturn(ctx, ret)
+			},
+			undo: func(ctx context.Context) error {
+				return repositories.DeleteReturn(ctx, ret.ID)
+			},
+		},
+		orderEventStep(returnEvent(order, ret, "", actor, "Return requested")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("A return was requested for order %s. Reason: %s", order.OrderNumber, reason)
+	if err := NotifySellerService(shop, models.NotificationReturnRequested, order.ID, "Return requested", message); err != nil {
+		log.Printf("return %s: could not notify seller: %v", ret.ID.Hex(), err)
+	}
+	return ret, nil
+}
+
+// returnableQuantities returns, per order line, how many units are not yet
+// part of a requested, approved or received return.
+func returnableQuantities(ctx context.Context, order *models.Order) (map[string]int, error) {
+	remaining := map[string]int{}
+	for _, item := range order.Items {
+		remaining[orderLineKey(item.ProductID, item.VariantID)] += item.Quantity
+	}
+	existing, err := repositories.ListReturns(ctx, bson.M{
+		"order_id": order.ID,
+		"status":   bson.M{"$ne": models.ReturnStatusRejected},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range existing {
+		for _, item := range r.Items {
+			remaining[orderLineKey(item.ProductID, item.VariantID)] -= item.Quantity
+		}
+	}
+	return remaining, nil
+}
+
+// returnEvent builds the order timeline entry for a return moving from one
+// status to ret.Status; from is empty when the return was just opened.
+func returnEvent(order *models.Order, ret *models.ReturnRequest, from models.ReturnStatus, actor models.OrderActor, message string) *models.OrderEvent {
+	change := models.OrderFieldChange{After: ret.Status}
+	if from != "" {
+		change.Before = from
+	}
+	return newOrderEvent(order, models.OrderEventReturn, actor, message+" (return "+ret.ID.Hex()+")",
+		map[string]models.OrderFieldChange{"return_status": change})
+}
+
+// ListShopReturnsService lists a shop's returns, optionally only those in one status.
+func ListShopReturnsService(shopID primitive.ObjectID, status string) ([]models.ReturnRequest, error) {
+	filter := bson.M{"shop_id": shopID}
+	if status != "" {
+		filter["status"] = status
+	}
+	out, err := repositories.ListReturns(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.ReturnRequest{}
+	}
+	return out, nil
+}
+
+// ListCustomerOrderReturnsService lists the returns a customer opened for one order.
+func ListCustomerOrderReturnsService(orderID, customerID primitive.ObjectID) ([]models.ReturnRequest, error) {
+	out, err := repositories.ListReturns(context.Background(), bson.M{"order_id": orderID, "customer_id": customerID})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.ReturnRequest{}
+	}
+	return out, nil
+}
+
+// GetShopReturnService loads a return and checks it belongs to the shop.
+func GetShopReturnService(shopID primitive.ObjectID, returnIDHex string) (*models.ReturnRequest, error) {
+	id, err := primitive.ObjectIDFromHex(returnIDHex)
+	if err != nil {
+		return nil, ErrReturnNotFound
+	}
+	ret, err := repositories.GetReturnByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil || ret.ShopID != shopID {
+		return nil, ErrReturnNotFound
+	}
+	return ret, nil
+}
+
+// DecideReturnService approves or rejects a requested return.
+func DecideReturnService(shopID primitive.ObjectID, returnIDHex string, approve bool, note string, actor models.OrderActor) (*models.ReturnRequest, error) {
+	ret, err := GetShopReturnService(shopID, returnIDHex)
+	if err != nil {
+		return nil, err
+	}
+	to, message := models.ReturnStatusRejected, "Return rejected"
+	if approve {
+		to, message = models.ReturnStatusApproved, "Return approved"
+	}
+	now := time.Now()
+	set := bson.M{"updated_at": now, "decided_at": now}
+	if note = strings.TrimSpace(note); note != "" {
+		set["seller_note"] = note
+		message += ": " + note
+	}
+	return transitionReturn(ret, to, set, nil, actor, message)
+}
+
+// ReceiveReturnService marks an approved return's items as received back.
+// dispositions says, per order line key (see ReturnDispositionKey), whether
+// each item is restocked or written off; every item needs one. Restocked items
+// are put back into product and variant stock.
+func ReceiveReturnService(shopID primitive.ObjectID, returnIDHex string, dispositions map[string]models.ReturnDisposition, actor models.OrderActor) (*models.ReturnRequest, error) {
+	ret, err := GetShopReturnService(shopID, returnIDHex)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.ReturnItem, len(ret.Items))
+	var restock []models.OrderItem
+	for i, item := range ret.Items {
+		d := dispositions[ReturnDispositionKey(item.ProductID, item.VariantID)]
+		if d != models.ReturnDispositionRestock && d != models.ReturnDispositionWriteOff {
+			return nil, fmt.Errorf("%w: %s needs a disposition of restock or write_off", ErrInvalidReturnItems, item.Name)
+		}
+		item.Disposition = d
+		items[i] = item
+		if d == models.ReturnDispositionRestock {
+			restock = append(restock, models.OrderItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+		}
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": now, "received_at": now, "items": items}
+	return transitionReturn(ret, models.ReturnStatusReceived, set, restockSteps(restock), actor, "Returned items received")
+}
+
+// ReturnDispositionKey is the key ReceiveReturnService expects for an item.
+func ReturnDispositionKey(productID, variantID primitive.ObjectID) string {
+	return orderLineKey(productID, variantID)
+}
+
+// returnTransitions is the return state machine.
+var returnTransitions = map[models.ReturnStatus][]models.ReturnStatus{
+	models.ReturnStatusRequested: {models.ReturnStatusApproved, models.ReturnStatusRejected},
+	models.ReturnStatusApproved:  {models.ReturnStatusReceived},
+}
+
+// transitionReturn moves a return to a new status, running extra side-effect
+// steps and recording the change on the order timeline as one unit.
+func transitionReturn(ret *models.ReturnRequest, to models.ReturnStatus, set bson.M, extra []writeStep, actor models.OrderActor, message string) (*models.ReturnRequest, error) {
+	allowed := false
+	for _, next := range returnTransitions[ret.Status] {
+		if next == to {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s → %s", ErrInvalidReturnTransition, ret.Status, to)
+	}
+
+	order, err := repositories.GetOrderByID(context.Background(), ret.OrderID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	from := ret.Status
+	steps := []writeStep{{
+		name: "update return status",
+		apply: func(ctx context.Context) error {
+			res, err := repositories.UpdateReturnStatus(ctx, ret.ID, from, to, set)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return fmt.Errorf("%w: return is no longer %s", ErrInvalidReturnTransition, from)
+			}
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			_, err := repositories.SetReturnFields(ctx, ret.ID, bson.M{"status": from, "items": ret.Items, "updated_at": ret.UpdatedAt})
+			return err
+		},
+	}}
+	steps = append(steps, extra...)
+
+	updated := *ret
+	updated.Status = to
+	steps = append(steps, orderEventStep(returnEvent(order, &updated, from, actor, message)))
+
+	if err := commitSteps(steps); err != nil {
+		return nil, err
+	}
+	return repositories.GetReturnByID(context.Background(), ret.ID)
+}
+
+// ReturnMetricsService computes return metrics for a shop against the orders
+// counted as sold.
+func ReturnMetricsService(shopID primitive.ObjectID, soldOrders []models.Order) (*ReturnMetrics, error) {
+	returns, err := repositories.ListReturns(context.Background(), bson.M{
+		"shop_id": shopID,
+		"status":  bson.M{"$ne": models.ReturnStatusRejected},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ReturnMetrics{Reasons: map[string]int{}}
+	ordersWithReturns := map[primitive.ObjectID]bool{}
+	for _, r := range returns {
+		m.TotalReturns++
+		if r.Status == models.ReturnStatusRequested || r.Status == models.ReturnStatusApproved {
+			m.OpenReturns++
+		}
+		ordersWithReturns[r.OrderID] = true
+		m.Reasons[r.Reason]++
+		for _, item := range r.Items {
+			m.ReturnedUnits += item.Quantity
+			m.ReturnedValue += item.UnitPrice.Mul(item.Quantity)
+		}
+	}
+	m.OrdersWithReturns = len(ordersWithReturns)
+
+	soldUnits := 0
+	for _, o := range soldOrders {
+		for _, item := range o.Items {
+			soldUnits += item.Quantity
+		}
+	}
+	if len(soldOrders) > 0 {
+		m.ReturnRate = float64(m.OrdersWithReturns) / float64(len(soldOrders))
+	}
+	if soldUnits > 0 {
+		m.UnitReturnRate = float64(m.ReturnedUnits) / float64(soldUnits)
+	}
+	return m, nil
+}
@@ -1,7 +1,12 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/Endale2/DRPS/config"
+	"github.com/Endale2/DRPS/shared/repositories"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -19,8 +24,59 @@ func NewSeedService() *SeedService {
 
 // CreateIndexes creates necessary database indexes for performance
 // Note: Theme/customization-related indexes removed.
+// A failure does not stop the remaining indexes from being created; every
+// failure is returned, joined.
 func (s *SeedService) CreateIndexes() error {
-	return nil
+	ctx := context.Background()
+	ensure := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		{"reservation", repositories.EnsureReservationIndexes},
+		{"order event", repositories.EnsureOrderEventIndexes},
+		{"idempotency key", repositories.EnsureIdempotencyKeyIndexes},
+		{"notification", repositories.EnsureNotificationIndexes},
+		{"return", repositories.EnsureReturnIndexes},
+		{"refund", repositories.EnsureRefundIndexes},
+		{"shipment", repositories.EnsureShipmentIndexes},
+		{"shipping zone", repositories.EnsureShippingZoneIndexes},
+		{"tax region", repositories.EnsureTaxRegionIndexes},
+		{"payment", repositories.EnsurePaymentIndexes},
+		{"order edit", repositories.EnsureOrderEditIndexes},
+		{"draft order", repositories.EnsureDraftOrderIndexes},
+		{"OTP failure", repositories.EnsureOTPFailureIndexes},
+		{"order counter", repositories.EnsureOrderCounterIndexes},
+		{"order", repositories.EnsureOrderIndexes},
+		{"exchange rate", repositories.EnsureExchangeRateIndexes},
+		{"cart", repositories.EnsureCartIndexes},
+		{"cart recovery", repositories.EnsureCartRecoveryIndexes},
+	}
+	var errs []error
+	for _, e := range ensure {
+		if err := e.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s indexes: %w", e.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateData brings documents written by older versions up to date: amounts
+// stored as floats are rewritten, orders sharing a number are renumbered so
+// order numbers can be indexed as unique, and order counters are moved past
+// the numbers already issued. It returns how many documents it changed.
+func (s *SeedService) MigrateData() (int, error) {
+	ctx := context.Background()
+	changed, err := repositories.MigrateLegacyAmounts(ctx)
+	if err != nil {
+		return changed, err
+	}
+	renumbered, err := RenumberDuplicateOrders(ctx)
+	changed += renumbered
+	if err != nil {
+		return changed, err
+	}
+	seeded, err := repositories.SeedOrderCounters(ctx)
+	return changed + seeded, err
 }
 
 // SeedAll runs all seeding operations
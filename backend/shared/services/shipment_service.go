@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidShipment = errors.New("invalid shipment")
+var ErrOrderNotShippable = errors.New("order cannot be shipped")
+var ErrShipmentConflict = errors.New("another shipment was added to the order at the same time")
+
+// trackingNumberPlaceholder is replaced by the tracking number in templates.
+const trackingNumberPlaceholder = "{tracking_number}"
+
+// carrierTrackingTemplates are used when a shipment names a known carrier but
+// gives no tracking URL template of its own.
+var carrierTrackingTemplates = map[string]string{
+	"ups":   "https://www.ups.com/track?tracknum={tracking_number}",
+	"usps":  "https://tools.usps.com/go/TrackConfirmAction?tLabels={tracking_number}",
+	"fedex": "https://www.fedex.com/fedextrack/?trknbr={tracking_number}",
+	"dhl":   "https://www.dhl.com/en/express/tracking.html?AWB={tracking_number}",
+}
+
+// shippableOrderStatuses are the statuses in which shipments may be added.
+var shippableOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusPaid:             true,
+	models.OrderStatusProcessing:       true,
+	models.OrderStatusPartiallyShipped: true,
+}
+
+// ShipmentLine is a quantity of one order line to put in a shipment.
+type ShipmentLine struct {
+	ProductID primitive.ObjectID
+	VariantID primitive.ObjectID
+	Quantity  int
+}
+
+// ShipmentRequest describes a shipment a seller is sending.
+type ShipmentRequest struct {
+	Lines               []ShipmentLine
+	Carrier             string
+	TrackingNumber      string
+	TrackingURLTemplate string
+}
+
+// CustomerShipment is the customer-facing view of a shipment.
+type CustomerShipment struct {
+	Carrier        string                `json:"carrier"`
+	TrackingNumber string                `json:"tracking_number,omitempty"`
+	TrackingURL    string                `json:"tracking_url,omitempty"`
+	Items          []models.ShipmentItem `json:"items"`
+	ShippedAt      time.Time             `json:"shipped_at"`
+}
+
+// trackingURL fills a tracking URL template in, falling back to the carrier's
+// known template. The number is escaped for the part of the URL it goes in.
+func trackingURL(carrier, template, number string) string {
+	if template == "" {
+		template = carrierTrackingTemplates[strings.ToLower(strings.TrimSpace(carrier))]
+	}
+	if template == "" || number == "" {
+		return ""
+	}
+	escaped := url.PathEscape(number)
+	if q := strings.Index(template, "?"); q >= 0 && q < strings.Index(template, trackingNumberPlaceholder) {
+		escaped = url.QueryEscape(number)
+	}
+	return strings.ReplaceAll(template, trackingNumberPlaceholder, escaped)
+}
+
+// ListOrderShipmentsService returns an order's shipments, oldest first.
+func ListOrderShipmentsService(orderID primitive.ObjectID) ([]models.Shipment, error) {
+	out, err := repositories.ListShipmentsByOrder(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.Shipment{}
+	}
+	return out, nil
+}
+
+// CustomerOrderShipmentsService returns the tracking information a customer
+// may see for an order.
+func CustomerOrderShipmentsService(orderID primitive.ObjectID) ([]CustomerShipment, error) {
+	shipments, err := repositories.ListShipmentsByOrder(context.Background(), orderID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CustomerShipment, 0, len(shipments))
+	for _, s := range shipments {
+		out = append(out, CustomerShipment{
+			Carrier:        s.Carrier,
+			TrackingNumber: s.TrackingNumber,
+			TrackingURL:    s.TrackingURL,
+			Items:          s.Items,
+			ShippedAt:      s.ShippedAt,
+		})
+	}
+	return out, nil
+}
+
+// unshippedLines lists what is still to be sent of each order line.
+func unshippedLines(ctx context.Context, order *models.Order) ([]ShipmentLine, error) {
+	existing, err := repositories.ListShipmentsByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	shipped := map[string]int{}
+	for _, s := range existing {
+		for _, item := range s.Items {
+			shipped[orderLineKey(item.ProductID, item.VariantID)] += item.Quantity
+		}
+	}
+	var out []ShipmentLine
+	for _, item := range order.Items {
+		key := orderLineKey(item.ProductID, item.VariantID)
+		left := item.Quantity - shipped[key]
+		// A product can appear on more than one line; earlier lines use up
+		// what was shipped first
+		shipped[key] -= item.Quantity
+		if shipped[key] < 0 {
+			shipped[key] = 0
+		}
+		if left > 0 {
+			out = append(out, ShipmentLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: left})
+		}
+	}
+	return out, nil
+}
+
+// CreateShipmentService records a shipment for some of an order's items and
+// moves the order to partially_shipped or shipped depending on whether every
+// unit has now been sent. Lines for the same item are added together. If
+// another shipment is added to the order meanwhile, ErrShipmentConflict is
+// returned and nothing is written. The customer is notified.
+func CreateShipmentService(shop *models.Shop, order *models.Order, req ShipmentRequest, actor models.OrderActor) (*models.Shipment, error) {
+	ctx := context.Background()
+	if !shippableOrderStatuses[order.Status] {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotShippable, order.Status)
+	}
+	carrier := strings.TrimSpace(req.Carrier)
+	if carrier == "" {
+		return nil, fmt.Errorf("%w: carrier is required", ErrInvalidShipment)
+	}
+	template := strings.TrimSpace(req.TrackingURLTemplate)
+	if template != "" && !strings.Contains(template, trackingNumberPlaceholder) {
+		return nil, fmt.Errorf("%w: tracking URL template must contain %s", ErrInvalidShipment, trackingNumberPlaceholder)
+	}
+	if len(req.Lines) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrInvalidShipment)
+	}
+
+	existing, err := repositories.ListShipmentsByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	unshipped := map[string]int{}
+	items := map[string]models.OrderItem{}
+	for _, item := range order.Items {
+		key := orderLineKey(item.ProductID, item.VariantID)
+		unshipped[key] += item.Quantity
+		items[key] = item
+	}
+	for _, s := range existing {
+		for _, item := range s.Items {
+			unshipped[orderLineKey(item.ProductID, item.VariantID)] -= item.Quantity
+		}
+	}
+
+	var lines []ShipmentLine
+	lineIndex := map[string]int{}
+	for _, line := range req.Lines {
+		key := orderLineKey(line.ProductID, line.VariantID)
+		if line.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidShipment)
+		}
+		if i, seen := lineIndex[key]; seen {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+		lineIndex[key] = len(lines)
+		lines = append(lines, line)
+	}
+
+	var shipItems []models.ShipmentItem
+	for _, line := range lines {
+		key := orderLineKey(line.ProductID, line.VariantID)
+		item, ok := items[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %s is not in this order", ErrInvalidShipment, line.ProductID.Hex())
+		}
+		if line.Quantity > unshipped[key] {
+			return nil, fmt.Errorf("%w: at most %d of %s are left to ship", ErrInvalidShipment, unshipped[key], item.Name)
+		}
+		unshipped[key] -= line.Quantity
+		shipItems = append(shipItems, models.ShipmentItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      item.Name,
+			Quantity:  line.Quantity,
+		})
+	}
+
+	next := models.OrderStatusShipped
+	for _, left := range unshipped {
+		if left > 0 {
+			next = models.OrderStatusPartiallyShipped
+			break
+		}
+	}
+
+	now := time.Now()
+	number := strings.TrimSpace(req.TrackingNumber)
+	shipment := &models.Shipment{
+		ID:                  primitive.NewObjectID(),
+		ShopID:              order.ShopID,
+		OrderID:             order.ID,
+		Items:               shipItems,
+		Carrier:             carrier,
+		TrackingNumber:      number,
+		TrackingURLTemplate: template,
+		TrackingURL:         trackingURL(carrier, template, number),
+		CreatedBy:           actor,
+		ShippedAt:           now,
+		CreatedAt:           now,
+	}
+
+	message := fmt.Sprintf("Shipped via %s", carrier)
+	if number != "" {
+		message += ", tracking number " + number
+	}
+	steps := []writeStep{
+		{
+			// First, so a shipment added since the order was read stops this one
+			name: "count shipment",
+			apply: func(ctx context.Context) error {
+				res, err := repositories.IncrementOrderShipmentCount(ctx, order.ID, order.ShipmentCount)
+				if err != nil {
+					return err
+				}
+				if res.MatchedCount == 0 {
+					return ErrShipmentConflict
+				}
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				_, err := repositories.DecrementOrderShipmentCount(ctx, order.ID)
+				return err
+			},
+		},
+		{
+			name: "create shipment",
+			apply: func(ctx context.Context) error {
+				return repositories.CreateShipment(ctx, shipment)
+			},
+			undo: func(ctx context.Context) error {
+				return repositories.DeleteShipment(ctx, shipment.ID)
+			},
+		},
+		orderEventStep(newOrderEvent(order, models.OrderEventShipment, actor, message, nil)),
+	}
+	if next != order.Status {
+		steps = append(steps, orderTransitionSteps(order, next, actor)...)
+	}
+	if err := commitSteps(steps); err != nil {
+		return nil, err
+	}
+
+	title := "Your order has shipped"
+	if next == models.OrderStatusPartiallyShipped {
+		title = "Part of your order has shipped"
+	}
+	body := fmt.Sprintf("Order %s: %s.", order.OrderNumber, message)
+	if shipment.TrackingURL != "" {
+		body += " Track it at " + shipment.TrackingURL
+	}
+	if err := NotifyCustomerService(shop, order.CustomerID, models.NotificationOrderShipped, order.ID, title, body); err != nil {
+		log.Printf("shipment %s: could not notify customer: %v", shipment.ID.Hex(), err)
+	}
+	return shipment, nil
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidShippingZone = errors.New("invalid shipping zone")
+var ErrShippingZoneNotFound = errors.New("shipping zone not found")
+
+// ShippingDestination is where a cart or order is being shipped to. Country is
+// an ISO 3166-1 alpha-2 code.
+type ShippingDestination struct {
+	Country    string
+	Region     string
+	PostalCode string
+}
+
+// ShippingDestinationFromAddress reads the destination out of a shipping
+// address as stored on carts and orders. ok is false if it has no country.
+func ShippingDestinationFromAddress(address map[string]interface{}) (dest ShippingDestination, ok bool) {
+	field := func(keys ...string) string {
+		for _, k := range keys {
+			if s, isString := address[k].(string); isString && strings.TrimSpace(s) != "" {
+				return strings.TrimSpace(s)
+			}
+		}
+		return ""
+	}
+	dest.Country = strings.ToUpper(field("country", "country_code"))
+	dest.Region = field("region", "state", "province")
+	dest.PostalCode = field("postal_code", "postalCode", "zip")
+	return dest, dest.Country != ""
+}
+
+// ShippingQuoteRequest is what a rate provider prices: the shop's goods going
+// to Destination. Subtotal is after item discounts; Weight is in kg.
+type ShippingQuoteRequest struct {
+	ShopID      primitive.ObjectID
+	Destination ShippingDestination
+	Subtotal    money.Amount
+	Weight      float64
+	ItemCount   int
+}
+
+// ShippingRateProvider prices shipping options for a request. The built-in
+// provider uses the shop's zones; carrier-rate integrations plug in through
+// RegisterShippingRateProvider. Quote IDs must be unique across providers, so
+// each provider should prefix them with its name.
+type ShippingRateProvider interface {
+	Name() string
+	Quote(ctx context.Context, req ShippingQuoteRequest) ([]models.ShippingQuote, error)
+}
+
+var (
+	shippingProvidersMu sync.RWMutex
+	shippingProviders   = []ShippingRateProvider{zoneRateProvider{}}
+)
+
+// RegisterShippingRateProvider adds a rate provider, replacing any registered
+// provider with the same name.
+func RegisterShippingRateProvider(p ShippingRateProvider) {
+	shippingProvidersMu.Lock()
+	defer shippingProvidersMu.Unlock()
+	for i, existing := range shippingProviders {
+		if existing.Name() == p.Name() {
+			shippingProviders[i] = p
+			return
+		}
+	}
+	shippingProviders = append(shippingProviders, p)
+}
+
+// QuoteShippingService collects the shipping options every provider offers for
+// req, cheapest first. A failing provider is logged and skipped so one carrier
+// outage does not block checkout.
+func QuoteShippingService(req ShippingQuoteRequest) []models.ShippingQuote {
+	shippingProvidersMu.RLock()
+	providers := append([]ShippingRateProvider(nil), shippingProviders...)
+	shippingProvidersMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	quotes := []models.ShippingQuote{}
+	for _, p := range providers {
+		got, err := p.Quote(ctx, req)
+		if err != nil {
+			log.Printf("shipping: provider %s failed to quote shop %s: %v", p.Name(), req.ShopID.Hex(), err)
+			continue
+		}
+		quotes = append(quotes, got...)
+	}
+	sort.SliceStable(quotes, func(i, j int) bool { return quotes[i].Amount < quotes[j].Amount })
+	return quotes
+}
+
+// findShippingQuote returns the quote with the given ID, or nil.
+func findShippingQuote(quotes []models.ShippingQuote, id string) *models.ShippingQuote {
+	for i := range quotes {
+		if quotes[i].ID == id {
+			return &quotes[i]
+		}
+	}
+	return nil
+}
+
+// itemWeight is the shipping weight of one unit of a product or one of its
+// variants; a variant without its own weight uses the product's.
+func itemWeight(product *models.Product, variantID primitive.ObjectID) float64 {
+	if !variantID.IsZero() {
+		for _, v := range product.Variants {
+			if v.VariantID == variantID && v.Weight > 0 {
+				return v.Weight
+			}
+		}
+	}
+	return product.Weight
+}
+
+// zoneRateProvider quotes the methods of the shop zone that best matches the
+// destination: a zone listing the destination's region wins over one that
+// only lists its country.
+type zoneRateProvider struct{}
+
+const zoneRateProviderName = "zones"
+
+func (zoneRateProvider) Name() string { return zoneRateProviderName }
+
+func (zoneRateProvider) Quote(ctx context.Context, req ShippingQuoteRequest) ([]models.ShippingQuote, error) {
+	zones, err := repositories.ListShippingZonesByShop(ctx, req.ShopID)
+	if err != nil {
+		return nil, err
+	}
+	zone := matchShippingZone(zones, req.Destination)
+	if zone == nil {
+		return nil, nil
+	}
+
+	var quotes []models.ShippingQuote
+	for _, m := range zone.Methods {
+		amount, ok := shippingMethodRate(m, req.Subtotal, req.Weight)
+		if !ok {
+			continue
+		}
+		quotes = append(quotes, models.ShippingQuote{
+			ID:            zoneRateProviderName + ":" + m.ID.Hex(),
+			Provider:      zoneRateProviderName,
+			Name:          m.Name,
+			Amount:        amount,
+			EstimatedDays: m.EstimatedDays,
+		})
+	}
+	return quotes, nil
+}
+
+// matchShippingZone picks the most specific zone covering dest, or nil.
+func matchShippingZone(zones []models.ShippingZone, dest ShippingDestination) *models.ShippingZone {
+	var countryMatch *models.ShippingZone
+	for i := range zones {
+		z := &zones[i]
+		if !containsFold(z.Countries, dest.Country) {
+			continue
+		}
+		if len(z.Regions) == 0 {
+			if countryMatch == nil {
+				countryMatch = z
+			}
+			continue
+		}
+		if dest.Region != "" && containsFold(z.Regions, dest.Region) {
+			return z
+		}
+	}
+	return countryMatch
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// shippingMethodRate prices a method for an order of the given subtotal and
+// weight. ok is false if no tier covers the order.
+func shippingMethodRate(m models.ShippingMethod, subtotal money.Amount, weight float64) (amount money.Amount, ok bool) {
+	switch m.Type {
+	case models.ShippingRateFlat:
+		return m.Rate, true
+	case models.ShippingRateFreeOver:
+		if m.FreeOver > 0 && subtotal >= m.FreeOver {
+			return 0, true
+		}
+		return m.Rate, true
+	case models.ShippingRateWeight:
+		return shippingTierRate(m.Tiers, weight)
+	case models.ShippingRatePrice:
+		// Tier bounds are plain numbers, in currency units for price tiers;
+		// a subtotal's float is the same double as its decimal bound
+		return shippingTierRate(m.Tiers, subtotal.Float())
+	}
+	return 0, false
+}
+
+func shippingTierRate(tiers []models.ShippingRateTier, v float64) (money.Amount, bool) {
+	for _, t := range tiers {
+		if v >= t.Min && (t.Max == 0 || v < t.Max) {
+			return t.Rate, true
+		}
+	}
+	return 0, false
+}
+
+// validateShippingZone normalises a zone in place and checks that every
+// method can be priced.
+func validateShippingZone(z *models.ShippingZone) error {
+	z.Name = strings.TrimSpace(z.Name)
+	if z.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidShippingZone)
+	}
+	if len(z.Countries) == 0 {
+		return fmt.Errorf("%w: at least one country is required", ErrInvalidShippingZone)
+	}
+	for i, c := range z.Countries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if len(c) != 2 {
+			return fmt.Errorf("%w: country %q is not a two-letter code", ErrInvalidShippingZone, z.Countries[i])
+		}
+		z.Countries[i] = c
+	}
+	for i := range z.Regions {
+		z.Regions[i] = strings.TrimSpace(z.Regions[i])
+	}
+	if len(z.Methods) == 0 {
+		return fmt.Errorf("%w: at least one method is required", ErrInvalidShippingZone)
+	}
+	for i := range z.Methods {
+		m := &z.Methods[i]
+		m.Name = strings.TrimSpace(m.Name)
+		if m.Name == "" {
+			return fmt.Errorf("%w: method name is required", ErrInvalidShippingZone)
+		}
+		if m.Rate < 0 || m.FreeOver < 0 {
+			return fmt.Errorf("%w: method %q has a negative amount", ErrInvalidShippingZone, m.Name)
+		}
+		switch m.Type {
+		case models.ShippingRateFlat, models.ShippingRateFreeOver:
+		case models.ShippingRateWeight, models.ShippingRatePrice:
+			if len(m.Tiers) == 0 {
+				return fmt.Errorf("%w: method %q needs rate tiers", ErrInvalidShippingZone, m.Name)
+			}
+			for _, t := range m.Tiers {
+				if t.Min < 0 || t.Rate < 0 || (t.Max != 0 && t.Max <= t.Min) {
+					return fmt.Errorf("%w: method %q has an invalid tier", ErrInvalidShippingZone, m.Name)
+				}
+			}
+		default:
+			return fmt.Errorf("%w: method %q has unknown type %q", ErrInvalidShippingZone, m.Name, m.Type)
+		}
+		if m.ID.IsZero() {
+			m.ID = primitive.NewObjectID()
+		}
+	}
+	return nil
+}
+
+// CreateShippingZoneService validates and stores a new zone for a shop.
+func CreateShippingZoneService(shopID primitive.ObjectID, z *models.ShippingZone) (*models.ShippingZone, error) {
+	if err := validateShippingZone(z); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	z.ID = primitive.NewObjectID()
+	z.ShopID = shopID
+	z.CreatedAt = now
+	z.UpdatedAt = now
+	if err := repositories.CreateShippingZone(context.Background(), z); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// ListShippingZonesService returns a shop's zones, oldest first.
+func ListShippingZonesService(shopID primitive.ObjectID) ([]models.ShippingZone, error) {
+	zones, err := repositories.ListShippingZonesByShop(context.Background(), shopID)
+	if err != nil {
+		return nil, err
+	}
+	if zones == nil {
+		zones = []models.ShippingZone{}
+	}
+	return zones, nil
+}
+
+// GetShippingZoneService returns one of a shop's zones.
+func GetShippingZoneService(shopID primitive.ObjectID, idHex string) (*models.ShippingZone, error) {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return nil, ErrShippingZoneNotFound
+	}
+	z, err := repositories.GetShippingZone(context.Background(), shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	if z == nil {
+		return nil, ErrShippingZoneNotFound
+	}
+	return z, nil
+}
+
+// UpdateShippingZoneService replaces a zone's name, destinations and methods.
+// Methods keep their IDs when the client sends them back, so carts that
+// picked a method keep it.
+func UpdateShippingZoneService(shopID primitive.ObjectID, idHex string, z *models.ShippingZone) (*models.ShippingZone, error) {
+	existing, err := GetShippingZoneService(shopID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateShippingZone(z); err != nil {
+		return nil, err
+	}
+	z.ID = existing.ID
+	z.ShopID = shopID
+	z.CreatedAt = existing.CreatedAt
+	z.UpdatedAt = time.Now()
+	if _, err := repositories.ReplaceShippingZone(context.Background(), z); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// DeleteShippingZoneService removes one of a shop's zones.
+func DeleteShippingZoneService(shopID primitive.ObjectID, idHex string) error {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return ErrShippingZoneNotFound
+	}
+	res, err := repositories.DeleteShippingZone(context.Background(), shopID, id)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrShippingZoneNotFound
+	}
+	return nil
+}
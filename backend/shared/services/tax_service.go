@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Endale2/DRPS/shared/models"
+	"github.com/Endale2/DRPS/shared/money"
+	"github.com/Endale2/DRPS/shared/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidTaxRegion = errors.New("invalid tax region")
+var ErrTaxRegionNotFound = errors.New("tax region not found")
+
+// TaxableLine is an amount to tax and the tax class of what it pays for.
+// Amounts are after discounts and, in tax-inclusive shops, contain the tax.
+type TaxableLine struct {
+	Class  string
+	Amount money.Amount
+}
+
+// TaxLineResult is the tax worked out for one TaxableLine.
+type TaxLineResult struct {
+	Rate   float64
+	Amount money.Amount
+}
+
+// TaxResult is the tax on a set of lines and shipping. Region is nil, and
+// every amount zero, when none of the shop's regions covers the destination.
+type TaxResult struct {
+	Region       *models.TaxRegion
+	Inclusive    bool
+	Lines        []TaxLineResult
+	ShippingRate float64
+	ShippingTax  money.Amount
+	Total        money.Amount
+}
+
+// Added is how much the tax adds to the order total: nothing when prices
+// already include it.
+func (r *TaxResult) Added() money.Amount {
+	if r.Inclusive {
+		return 0
+	}
+	return r.Total
+}
+
+// OrderTax is the tax record to store on an order, or nil if untaxed.
+func (r *TaxResult) OrderTax() *models.OrderTax {
+	if r.Region == nil {
+		return nil
+	}
+	return &models.OrderTax{
+		RegionID:         r.Region.ID,
+		RegionName:       r.Region.Name,
+		Country:          r.Region.Country,
+		Region:           r.Region.Region,
+		PricesIncludeTax: r.Inclusive,
+		ShippingRate:     r.ShippingRate,
+		ShippingTax:      r.ShippingTax,
+	}
+}
+
+// CalculateTaxService taxes lines and shipping going to dest under the shop's
+// tax regions and pricing mode. Each line is rounded half up to the cent on
+// its own, so the line amounts always add up to Total.
+func CalculateTaxService(shop *models.Shop, dest ShippingDestination, lines []TaxableLine, shipping money.Amount) (*TaxResult, error) {
+	result := &TaxResult{Inclusive: shop.PricesIncludeTax, Lines: make([]TaxLineResult, len(lines))}
+	regions, err := repositories.ListTaxRegionsByShop(context.Background(), shop.ID)
+	if err != nil {
+		return nil, err
+	}
+	region := matchTaxRegion(regions, dest)
+	if region == nil {
+		return result, nil
+	}
+	result.Region = region
+
+	for i, line := range lines {
+		rate := taxRate(region, line.Class)
+		amount := taxOn(line.Amount, rate, result.Inclusive)
+		result.Lines[i] = TaxLineResult{Rate: rate, Amount: amount}
+		result.Total += amount
+	}
+	if region.TaxShipping && shipping > 0 {
+		result.ShippingRate = region.Rate
+		result.ShippingTax = taxOn(shipping, region.Rate, result.Inclusive)
+		result.Total += result.ShippingTax
+	}
+	return result, nil
+}
+
+// matchTaxRegion picks the most specific region covering dest, or nil.
+func matchTaxRegion(regions []models.TaxRegion, dest ShippingDestination) *models.TaxRegion {
+	var countryMatch *models.TaxRegion
+	for i := range regions {
+		r := &regions[i]
+		if !strings.EqualFold(r.Country, dest.Country) {
+			continue
+		}
+		if r.Region == "" {
+			if countryMatch == nil {
+				countryMatch = r
+			}
+			continue
+		}
+		if dest.Region != "" && strings.EqualFold(r.Region, dest.Region) {
+			return r
+		}
+	}
+	return countryMatch
+}
+
+// taxRate is the region's rate for a tax class.
+func taxRate(region *models.TaxRegion, class string) float64 {
+	switch class {
+	case models.TaxClassExempt:
+		return 0
+	case "", models.TaxClassStandard:
+		return region.Rate
+	}
+	if rate, ok := region.ClassRates[class]; ok {
+		return rate
+	}
+	return region.Rate
+}
+
+// taxOn is the tax in amount at rate: on top of it, or contained in it when
+// prices include tax.
+func taxOn(amount money.Amount, rate float64, inclusive bool) money.Amount {
+	if amount <= 0 || rate <= 0 {
+		return 0
+	}
+	if inclusive {
+		return amount.IncludedRate(rate, money.HalfUp)
+	}
+	return amount.MulRate(rate, money.HalfUp)
+}
+
+// validateTaxRegion normalises a region in place and checks its rates.
+func validateTaxRegion(r *models.TaxRegion) error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	r.Region = strings.TrimSpace(r.Region)
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTaxRegion)
+	}
+	if len(r.Country) != 2 {
+		return fmt.Errorf("%w: country must be a two-letter code", ErrInvalidTaxRegion)
+	}
+	if r.Rate < 0 || r.Rate >= 1 {
+		return fmt.Errorf("%w: rate must be a fraction between 0 and 1", ErrInvalidTaxRegion)
+	}
+	for class, rate := range r.ClassRates {
+		if rate < 0 || rate >= 1 {
+			return fmt.Errorf("%w: rate for class %q must be a fraction between 0 and 1", ErrInvalidTaxRegion, class)
+		}
+	}
+	return nil
+}
+
+// CreateTaxRegionService validates and stores a new tax region for a shop.
+func CreateTaxRegionService(shopID primitive.ObjectID, r *models.TaxRegion) (*models.TaxRegion, error) {
+	if err := validateTaxRegion(r); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r.ID = primitive.NewObjectID()
+	r.ShopID = shopID
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	if err := repositories.CreateTaxRegion(context.Background(), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ListTaxRegionsService returns a shop's tax regions, oldest first.
+func ListTaxRegionsService(shopID primitive.ObjectID) ([]models.TaxRegion, error) {
+	regions, err := repositories.ListTaxRegionsByShop(context.Background(), shopID)
+	if err != nil {
+		return nil, err
+	}
+	if regions == nil {
+		regions = []models.TaxRegion{}
+	}
+	return regions, nil
+}
+
+// GetTaxRegionService returns one of a shop's tax regions.
+func GetTaxRegionService(shopID primitive.ObjectID, idHex string) (*models.TaxRegion, error) {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return nil, ErrTaxRegionNotFound
+	}
+	r, err := repositories.GetTaxRegion(context.Background(), shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, ErrTaxRegionNotFound
+	}
+	return r, nil
+}
+
+// UpdateTaxRegionService replaces a tax region's destination and rates.
+// Orders already placed keep the tax they were charged.
+func UpdateTaxRegionService(shopID primitive.ObjectID, idHex string, r *models.TaxRegion) (*models.TaxRegion, error) {
+	existing, err := GetTaxRegionService(shopID, idHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTaxRegion(r); err != nil {
+		return nil, err
+	}
+	r.ID = existing.ID
+	r.ShopID = shopID
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = time.Now()
+	if _, err := repositories.ReplaceTaxRegion(context.Background(), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DeleteTaxRegionService removes one of a shop's tax regions.
+func DeleteTaxRegionService(shopID primitive.ObjectID, idHex string) error {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return ErrTaxRegionNotFound
+	}
+	res, err := repositories.DeleteTaxRegion(context.Background(), shopID, id)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrTaxRegionNotFound
+	}
+	return nil
+}
+
+// TaxLiabilityRow is the tax a shop owes for one region over a period.
+// Refunded tax is the refunded share of each order's tax.
+type TaxLiabilityRow struct {
+	RegionID     primitive.ObjectID `json:"region_id,omitempty"`
+	RegionName   string             `json:"region_name"`
+	Country      string             `json:"country,omitempty"`
+	Region       string             `json:"region,omitempty"`
+	Orders       int                `json:"orders"`
+	NetSales     money.Amount       `json:"net_sales"`
+	TaxCollected money.Amount       `json:"tax_collected"`
+	TaxRefunded  money.Amount       `json:"tax_refunded"`
+	TaxOwed      money.Amount       `json:"tax_owed"`
+}
+
+// TaxLiabilityReport is the tax a shop collected on orders placed in
+// [From, To), by region.
+type TaxLiabilityReport struct {
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	Regions      []TaxLiabilityRow `json:"regions"`
+	TaxCollected money.Amount      `json:"tax_collected"`
+	TaxRefunded  money.Amount      `json:"tax_refunded"`
+	TaxOwed      money.Amount      `json:"tax_owed"`
+}
+
+// TaxLiabilityReportService totals the tax on a shop's paid orders placed in
+// [from, to). Orders no region covered are reported under "untaxed" so the
+// sales still show up.
+func TaxLiabilityReportService(shopID primitive.ObjectID, from, to time.Time) (*TaxLiabilityReport, error) {
+	orders, err := repositories.ListOrders(context.Background(), bson.M{
+		"shop_id":    shopID,
+		"created_at": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := map[primitive.ObjectID]*TaxLiabilityRow{}
+	for i := range orders {
+		o := &orders[i]
+		if !IsSoldOrder(o) && o.Status != models.OrderStatusRefunded {
+			continue
+		}
+		key := primitive.NilObjectID
+		if o.Tax != nil {
+			key = o.Tax.RegionID
+		}
+		row, ok := rows[key]
+		if !ok {
+			row = &TaxLiabilityRow{RegionName: "untaxed"}
+			if o.Tax != nil {
+				row.RegionID = o.Tax.RegionID
+				row.RegionName = o.Tax.RegionName
+				row.Country = o.Tax.Country
+				row.Region = o.Tax.Region
+			}
+			rows[key] = row
+		}
+
+		refunded := o.TaxAmount.Ratio(o.RefundedTotal, o.Total, money.HalfUp)
+		row.Orders++
+		row.NetSales += o.Total - o.TaxAmount
+		row.TaxCollected += o.TaxAmount
+		row.TaxRefunded += refunded
+	}
+
+	report := &TaxLiabilityReport{From: from, To: to, Regions: []TaxLiabilityRow{}}
+	for _, row := range rows {
+		row.TaxOwed = row.TaxCollected - row.TaxRefunded
+		report.TaxCollected += row.TaxCollected
+		report.TaxRefunded += row.TaxRefunded
+		report.Regions = append(report.Regions, *row)
+	}
+	sort.Slice(report.Regions, func(i, j int) bool {
+		return report.Regions[i].TaxOwed > report.Regions[j].TaxOwed
+	})
+	report.TaxOwed = report.TaxCollected - report.TaxRefunded
+	return report, nil
+}
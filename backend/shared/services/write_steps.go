@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Endale2/DRPS/shared/repositories"
+)
+
+// writeStep is one write of a multi-document change. undo reverses apply and
+// is only used when the deployment cannot run the steps inside a transaction;
+// it may be nil for writes that are not rolled back.
+type writeStep struct {
+	name  string
+	apply func(ctx context.Context) error
+	undo  func(ctx context.Context) error
+}
+
+// commitSteps runs steps in a single transaction. Only when the server reports
+// a standalone deployment, where transactions are unavailable, does it apply
+// them one by one and undo the completed ones in reverse order if a later step
+// fails; any other error, including a failed probe, is returned.
+func commitSteps(steps []writeStep) error {
+	err := repositories.WithTransaction(context.Background(), func(sc context.Context) error {
+		for _, step := range steps {
+			if err := step.apply(sc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, repositories.ErrTransactionsUnsupported) {
+		return err
+	}
+	return applyStepsWithUndo(steps)
+}
+
+// applyStepsWithUndo applies steps one by one outside a transaction and undoes
+// the completed ones in reverse order if a later step fails.
+func applyStepsWithUndo(steps []writeStep) error {
+	ctx := context.Background()
+	for i, step := range steps {
+		if err := step.apply(ctx); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if steps[j].undo == nil {
+					continue
+				}
+				if undoErr := steps[j].undo(ctx); undoErr != nil {
+					log.Printf("failed to undo %q: %v", steps[j].name, undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}